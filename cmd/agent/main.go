@@ -2,14 +2,19 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"flag"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/ChronoCoders/sentra/internal/agent"
 	"github.com/ChronoCoders/sentra/internal/config"
+	"github.com/ChronoCoders/sentra/internal/signing"
 	"github.com/ChronoCoders/sentra/internal/wireguard"
+	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -19,7 +24,15 @@ func main() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
 
-	cfg := config.Load()
+	configFile := flag.String("config", os.Getenv("SENTRA_CONFIG"), "path to the YAML configuration file")
+	flag.Parse()
+
+	cfg, err := config.LoadFile(*configFile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load config")
+	}
+	level, _ := cfg.Level()
+	zerolog.SetGlobalLevel(level)
 	log.Info().Bool("insecure", cfg.Insecure).Str("control_url", cfg.ControlURL).Msg("loaded config")
 
 	// Init WG Manager
@@ -34,22 +47,247 @@ func main() {
 		log.Fatal().Err(err).Msg("failed to get status from wireguard interface. ensure interface is up")
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Load or create the agent identity holding the report signing key
+	identity, err := agent.LoadOrCreateIdentity(cfg.IdentityFile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load agent identity")
+	}
+
+	// Load or obtain agent credentials
+	creds, err := agent.LoadCredentials(cfg.CredentialsFile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load agent credentials")
+	}
+	if creds == nil && cfg.JoinToken != "" {
+		bootstrapTLS, err := agent.BootstrapTLSConfig(cfg.CACert, cfg.Insecure)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load control plane CA certificate")
+		}
+		hostname, _ := os.Hostname()
+		creds, err = agent.Enroll(ctx, cfg.ControlURL, cfg.JoinToken, hostname, identity.PublicKey(), bootstrapTLS)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to enroll agent")
+		}
+		if err := agent.SaveCredentials(cfg.CredentialsFile, creds); err != nil {
+			log.Fatal().Err(err).Msg("failed to save agent credentials")
+		}
+		log.Info().Str("agent_id", creds.AgentID).Str("server_id", creds.ServerID).Msg("agent enrolled")
+	}
+
+	// Select credentials for the control plane
+	var tlsConfig *tls.Config
+	var certs *agent.CertManager
+	token, serverID := cfg.AuthToken, cfg.ServerID
+	switch {
+	case creds != nil && creds.Certificate != "" && strings.HasPrefix(cfg.ControlURL, "https://"):
+		certs, err = agent.NewCertManager(cfg.ControlURL, cfg.CredentialsFile, creds)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load client certificate")
+		}
+		go certs.Run(ctx)
+		tlsConfig = certs.TLSConfig()
+		token, serverID = "", creds.ServerID
+		log.Info().Str("agent_id", creds.AgentID).Msg("using client certificate for control plane")
+	case creds != nil:
+		token, serverID = creds.Credential, creds.ServerID
+	default:
+		log.Warn().Msg("agent is not enrolled, falling back to shared SENTRA_AUTH_TOKEN")
+	}
+	if tlsConfig == nil && cfg.Insecure {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+		log.Info().Msg("insecure mode enabled: skipping TLS verification")
+	}
+
+	// Without enrollment or an explicit ID, the server is identified by the agent identity
+	if serverID == "" {
+		serverID = identity.ID
+	}
+	log.Info().Str("agent_id", identity.ID).Str("server_id", serverID).Msg("agent identity loaded")
+
+	// Agents enrolled before report signing register their key once
+	if creds != nil {
+		if err := agent.RegisterSigningKey(ctx, cfg.ControlURL, token, identity.PublicKey(), tlsConfig); err != nil {
+			log.Warn().Err(err).Msg("failed to register signing key, reports may be rejected")
+		}
+	}
+
 	// Init Reporter
-	reporter := agent.NewHTTPReporter(cfg.ControlURL, cfg.AuthToken, cfg.Insecure)
+	var reporter agent.Reporter
+	var channel *agent.ChannelReporter
+	var grpcReporter *agent.GRPCReporter
+	var natsReporter *agent.NATSReporter
+	// The gRPC and NATS transports use TLS whenever the control plane does.
+	streamTLS := tlsConfig
+	if streamTLS == nil && strings.HasPrefix(cfg.ControlURL, "https://") {
+		streamTLS = &tls.Config{}
+	}
+	switch cfg.Transport {
+	case "channel":
+		channel = agent.NewChannelReporter(cfg.ControlURL, token, tlsConfig)
+		channel.SetSigner(identity.SigningKey)
+		reporter = channel
+	case "grpc":
+		grpcReporter, err = agent.NewGRPCReporter(cfg.GRPCAddr, token, streamTLS)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to init gRPC reporter")
+		}
+		defer grpcReporter.Close()
+		grpcReporter.SetSigner(identity.SigningKey)
+		reporter = grpcReporter
+	case "nats":
+		if creds == nil || creds.OrgID == "" {
+			log.Fatal().Msg("the nats transport requires an agent enrolled with a join token, re-enroll agents enrolled by earlier versions")
+		}
+		var opts []nats.Option
+		if cfg.NATSCreds != "" {
+			opts = append(opts, nats.UserCredentials(cfg.NATSCreds))
+		}
+		natsReporter, err = agent.NewNATSReporter(cfg.NATSURL, creds, token, streamTLS, opts...)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to init NATS reporter")
+		}
+		defer natsReporter.Close()
+		natsReporter.SetSigner(identity.SigningKey)
+		reporter = natsReporter
+	case "http":
+		httpReporter := agent.NewHTTPReporterWithTLS(cfg.ControlURL, token, tlsConfig)
+		httpReporter.SetSigner(identity.SigningKey)
+		reporter = httpReporter
+	default:
+		log.Fatal().Str("transport", cfg.Transport).Msg("unknown transport")
+	}
+
+	// Deliver reports to the configured sinks, the control plane first
+	if len(cfg.ReportSinks) != 1 || cfg.ReportSinks[0] != "control" {
+		var primary agent.Sink
+		var others []agent.Sink
+		for _, name := range cfg.ReportSinks {
+			switch name {
+			case "control":
+				primary = agent.Sink{Name: name, Reporter: reporter}
+			case "file":
+				file, err := agent.NewFileReporter(cfg.ReportFile, int64(cfg.ReportFileMaxMB)<<20, cfg.ReportFileBackups)
+				if err != nil {
+					log.Fatal().Err(err).Msg("failed to open report file")
+				}
+				defer file.Close()
+				others = append(others, agent.Sink{Name: name, Reporter: file})
+			case "stdout":
+				others = append(others, agent.Sink{Name: name, Reporter: agent.NewWriterReporter(os.Stdout)})
+			case "syslog":
+				sl, err := agent.NewSyslogReporter("sentra-agent")
+				if err != nil {
+					log.Fatal().Err(err).Msg("failed to connect to syslog")
+				}
+				others = append(others, agent.Sink{Name: name, Reporter: sl})
+			}
+		}
+		reporter = agent.NewMultiReporter(ctx, primary, others...)
+		log.Info().Strs("sinks", cfg.ReportSinks).Msg("reporting to multiple sinks")
+	}
+
+	opts := []agent.Option{
+		agent.WithFullSnapshotEvery(cfg.FullSnapshotEvery),
+		agent.WithIdentity(identity),
+		agent.WithPollInterval(cfg.PollInterval),
+		agent.WithEndpointPolicy(cfg.EndpointPolicy),
+	}
+
+	// Peer endpoints can be reduced to their country without leaving the machine
+	if cfg.GeoIPDB != "" {
+		geo, err := agent.OpenGeoIP(cfg.GeoIPDB)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to open GeoIP database")
+		}
+		defer geo.Close()
+		opts = append(opts, agent.WithGeoIP(geo))
+	}
+
+	// Self-update requires the key releases are signed with
+	if cfg.ReleasePublicKey != "" {
+		releaseKey, err := signing.DecodePublicKey(cfg.ReleasePublicKey)
+		if err != nil {
+			log.Fatal().Err(err).Msg("invalid SENTRA_RELEASE_PUBLIC_KEY")
+		}
+		updater, err := agent.NewUpdater(cfg.ControlURL, token, tlsConfig, releaseKey, cfg.UpdateStateFile, cfg.UpdateDeadline)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to init updater")
+		}
+		if err := updater.Start(); err != nil {
+			log.Fatal().Err(err).Msg("failed to resume agent update")
+		}
+		opts = append(opts, agent.WithUpdater(updater))
+	}
 
 	// Init Agent
-	agt := agent.New(wg, reporter, cfg.ServerID)
+	agt := agent.New(wg, reporter, serverID, opts...)
+	if channel != nil {
+		channel.OnCommand(agt.HandleCommand)
+		go channel.Run(ctx)
+	}
+	if grpcReporter != nil {
+		grpcReporter.OnCommand(agt.HandleCommand)
+		go grpcReporter.Run(ctx)
+	}
+	if natsReporter != nil {
+		natsReporter.OnCommand(agt.HandleCommand)
+		go natsReporter.Run(ctx)
+	}
 
 	// Run Agent
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
 	go func() {
 		if err := agt.Run(ctx); err != nil {
 			log.Error().Err(err).Msg("agent error")
 		}
 	}()
 
+	// Serve the local status and metrics API
+	if cfg.LocalAPI != "" {
+		go func() {
+			if err := agent.ServeLocalAPI(ctx, cfg.LocalAPI, agt); err != nil {
+				log.Error().Err(err).Msg("local agent API error")
+			}
+		}()
+	}
+
+	// Reload the configuration file on SIGHUP. Settings that cannot change at
+	// runtime are reported and keep their current value.
+	reload := func() error {
+		next, err := config.LoadFile(*configFile)
+		if err != nil {
+			return err
+		}
+		if certs != nil {
+			if err := certs.Reload(); err != nil {
+				return err
+			}
+		}
+		if changed := cfg.RestartRequired(next); len(changed) > 0 {
+			log.Warn().Strs("settings", changed).Msg("changed settings take effect after a restart")
+		}
+		level, _ := next.Level()
+		if err := agt.SetLocalDefaults(next.PollInterval, level); err != nil {
+			return err
+		}
+		cfg.LogLevel, cfg.PollInterval = next.LogLevel, next.PollInterval
+		return nil
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := reload(); err != nil {
+				log.Error().Err(err).Msg("config reload rejected, keeping running config")
+				continue
+			}
+			log.Info().Str("log_level", cfg.LogLevel).Dur("poll_interval", cfg.PollInterval).Msg("config reloaded")
+		}
+	}()
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
@@ -2,10 +2,14 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"flag"
 	stdlog "log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -14,12 +18,15 @@ import (
 	"github.com/ChronoCoders/sentra/internal/api"
 	"github.com/ChronoCoders/sentra/internal/config"
 	"github.com/ChronoCoders/sentra/internal/control"
+	"github.com/ChronoCoders/sentra/internal/natsbus"
 	"github.com/ChronoCoders/sentra/internal/store"
 	sentratls "github.com/ChronoCoders/sentra/internal/tls"
 	"github.com/ChronoCoders/sentra/internal/wireguard"
 	"github.com/ChronoCoders/sentra/internal/ws"
+	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
 )
 
 func main() {
@@ -27,7 +34,15 @@ func main() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
 
-	cfg := config.Load()
+	configFile := flag.String("config", os.Getenv("SENTRA_CONFIG"), "path to the YAML configuration file")
+	flag.Parse()
+
+	cfg, err := config.LoadFile(*configFile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load config")
+	}
+	level, _ := cfg.Level()
+	zerolog.SetGlobalLevel(level)
 
 	// Init DB
 	db, err := store.New(cfg.DBPath)
@@ -59,17 +74,111 @@ func main() {
 	go hub.Run()
 
 	// Init StatusCache (Client)
-	client := control.NewStatusCache(bus, hub)
+	client := control.NewStatusCache(bus, hub, db)
+	client.SetThresholds(cfg.StaleAfter, cfg.OfflineAfter)
+	go client.Watch(context.Background(), db)
+
+	// Init fleet inventory and agent command channels
+	inventory, err := control.NewInventory(context.Background(), bus, db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load agent inventory")
+	}
+	// Register reporting servers and keep their last-seen time
+	control.NewRegistry(bus, db)
+
+	// Record the metric history of reporting servers, written in batches
+	history := control.NewHistory(bus, db, control.HistoryRetention{
+		Raw:    cfg.HistoryRawRetention,
+		Minute: cfg.HistoryMinuteRetention,
+		Hour:   cfg.HistoryHourRetention,
+	})
+	flushCtx, stopFlushing := context.WithCancel(context.Background())
+	historyDone := make(chan struct{})
+	go func() {
+		history.Run(flushCtx)
+		close(historyDone)
+	}()
+
+	// Account the data usage of peers, written in batches
+	usage, err := control.NewUsage(context.Background(), bus, db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load peer usage")
+	}
+	usageDone := make(chan struct{})
+	go func() {
+		usage.Run(flushCtx)
+		close(usageDone)
+	}()
+
+	channels := control.NewChannelHub(inventory)
+	rollouts := control.NewRollouts(context.Background(), bus, db, channels, inventory)
+	configs := control.NewConfigs(bus, db, channels, inventory)
+
+	// Notify dashboards, and hold peers to their data quotas
+	notifications := control.NewNotifications()
+	notifications.Register("websocket", hub)
+	quotas := control.NewQuotas(db, client, channels, notifications)
+	quotas.SetBillingDay(cfg.BillingDay)
+	go quotas.Run(context.Background())
+
+	// Alert on rules evaluated against the status of every server
+	alerts, err := control.NewAlerts(context.Background(), bus, db, client, notifications)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load active alerts")
+	}
+	alerts.SetRules(cfg.AlertRules)
+	alerts.SetOfflineAfter(cfg.OfflineAfter)
+	go alerts.Run(context.Background())
+
+	// Deliver events to the webhooks of organizations
+	webhooks := control.NewWebhooks(bus, db, client)
+	notifications.Register("webhooks", webhooks)
+	go webhooks.Run(context.Background())
+
+	// Post to the chat channels of organizations
+	chat := control.NewChat(db)
+	chat.SetDashboardURL(cfg.Dashboard())
+	notifications.Register("chat", chat)
+	webhooks.Observe(chat)
+	go chat.Run(context.Background())
+
+	// Email users, and warn of peers about to expire
+	email := control.NewEmail(db)
+	email.Configure(smtpConfig(cfg), cfg.EmailDigestWindow, cfg.Dashboard())
+	notifications.Register("email", email)
+	go email.Run(context.Background())
+	expiries := control.NewPeerExpiries(db, notifications)
+	expiries.SetWarnWithin(cfg.PeerExpiryWarning)
+	go expiries.Run(context.Background())
 
 	// Init Agent
+	var ag *agent.Agent
 	if !cfg.DisableAgent {
-		reporter := agent.NewEventBusReporter(bus)
-		var ag *agent.Agent
+		identity, err := agent.LoadOrCreateIdentity(cfg.IdentityFile)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load agent identity")
+		}
+		reporter := agent.NewCacheReporter(client)
+		opts := []agent.Option{
+			agent.WithFullSnapshotEvery(cfg.FullSnapshotEvery),
+			agent.WithIdentity(identity),
+			agent.WithPollInterval(cfg.PollInterval),
+			agent.WithEndpointPolicy(cfg.EndpointPolicy),
+		}
+		if cfg.GeoIPDB != "" {
+			geo, err := agent.OpenGeoIP(cfg.GeoIPDB)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to open GeoIP database")
+			}
+			defer geo.Close()
+			opts = append(opts, agent.WithGeoIP(geo))
+		}
 		if wg != nil {
-			ag = agent.New(wg, reporter, "local")
+			ag = agent.New(wg, reporter, "local", opts...)
 		} else {
-			ag = agent.New(nil, reporter, "local")
+			ag = agent.New(nil, reporter, "local", opts...)
 		}
+		channels.Register("local", control.LocalTarget(ag.HandleCommand))
 		go func() {
 			if err := ag.Run(context.Background()); err != nil {
 				log.Error().Err(err).Msg("agent run error")
@@ -79,37 +188,129 @@ func main() {
 		log.Info().Msg("internal agent disabled by configuration")
 	}
 
+	// Init internal CA for agent client certificates, which are only used
+	// when the control plane serves TLS
+	var ca *sentratls.CA
+	if cfg.TLSAuto || cfg.TLSCert != "" {
+		ca, err = sentratls.LoadOrCreateCA(cfg.CACert, cfg.CAKey)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to init certificate authority")
+		}
+	}
+
+	if cfg.TLSAuto {
+		if cfg.TLSCert == "" {
+			cfg.TLSCert = "cert.pem"
+		}
+		if cfg.TLSKey == "" {
+			cfg.TLSKey = "key.pem"
+		}
+
+		if _, err := os.Stat(cfg.TLSCert); os.IsNotExist(err) {
+			log.Info().Msg("issuing server certificate from internal CA")
+			if err := ca.IssueServerCert(cfg.TLSCert, cfg.TLSKey, cfg.TLSSANs); err != nil {
+				log.Fatal().Err(err).Msg("failed to generate certificates")
+			}
+		}
+	}
+
+	// The server certificate is reloaded on SIGHUP
+	var certs *sentratls.CertReloader
+	if cfg.TLSCert != "" && cfg.TLSKey != "" {
+		certs, err = sentratls.NewCertReloader(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load server certificate")
+		}
+	}
+
 	// Init API Server
-	srv := api.NewServer(cfg, db, client, hub, bus)
+	srv := api.NewServer(cfg, db, client, hub, ca, certs, channels, inventory, rollouts, configs, quotas, alerts, webhooks, email, expiries, chat)
 
 	// Filter out noisy TLS handshake errors for internal agent reporting
 	httpServer := &http.Server{
-		Addr:     ":" + cfg.Port,
-		Handler:  srv,
-		ErrorLog: stdlog.New(&tlsErrorFilter{}, "", 0),
+		Addr:      ":" + cfg.Port,
+		Handler:   srv,
+		ErrorLog:  stdlog.New(&tlsErrorFilter{}, "", 0),
+		TLSConfig: &tls.Config{},
 	}
 
-	// Graceful shutdown
-	go func() {
-		if cfg.TLSAuto {
-			if cfg.TLSCert == "" {
-				cfg.TLSCert = "cert.pem"
-			}
-			if cfg.TLSKey == "" {
-				cfg.TLSKey = "key.pem"
-			}
+	if certs != nil {
+		httpServer.TLSConfig.GetCertificate = certs.GetCertificate
+	}
+	// Client certificates are optional at the TLS layer so that browsers can
+	// still reach the dashboard. Agent endpoints check them per request.
+	if ca != nil {
+		httpServer.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		httpServer.TLSConfig.ClientCAs = ca.Pool()
+	}
 
-			if _, err := os.Stat(cfg.TLSCert); os.IsNotExist(err) {
-				log.Info().Msg("generating self-signed certificates")
-				if err := sentratls.GenerateSelfSignedCert(cfg.TLSCert, cfg.TLSKey, cfg.TLSSANs); err != nil {
-					log.Fatal().Err(err).Msg("failed to generate certificates")
-				}
+	// Serve the gRPC agent service on its own port, with the same TLS setup
+	var grpcServer *grpc.Server
+	if cfg.GRPCPort != "" {
+		var grpcTLS *tls.Config
+		if certs != nil {
+			grpcTLS = httpServer.TLSConfig.Clone()
+		}
+		grpcServer = srv.NewGRPCServer(grpcTLS)
+		lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to listen for gRPC")
+		}
+		go func() {
+			log.Info().Str("port", cfg.GRPCPort).Bool("tls", grpcTLS != nil).Msg("starting gRPC agent service")
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Fatal().Err(err).Msg("gRPC server error")
 			}
+		}()
+	}
+
+	// Carry agent reports and commands over NATS, on an embedded server or an
+	// external one
+	natsCtx, stopNATS := context.WithCancel(context.Background())
+	defer stopNATS()
+	var natsServer *natsbus.Server
+	var natsConn *nats.Conn
+	switch {
+	case cfg.NATSPort != "":
+		var natsTLS *tls.Config
+		if certs != nil {
+			natsTLS = httpServer.TLSConfig.Clone()
+		}
+		port, _ := strconv.Atoi(cfg.NATSPort)
+		natsServer, err = natsbus.StartServer(natsbus.ServerConfig{
+			Port:      port,
+			StoreDir:  cfg.NATSDir,
+			TLSConfig: natsTLS,
+			Auth:      srv.NATSAuth,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to start NATS server")
+		}
+		log.Info().Str("port", cfg.NATSPort).Bool("tls", natsTLS != nil).Msg("started embedded NATS server")
+		natsConn, err = natsServer.Connect()
+	case cfg.NATSURL != "":
+		var opts []nats.Option
+		if cfg.NATSCreds != "" {
+			opts = append(opts, nats.UserCredentials(cfg.NATSCreds))
 		}
+		natsConn, err = nats.Connect(cfg.NATSURL, append(opts, nats.Name("sentra-control"), nats.MaxReconnects(-1))...)
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to connect to NATS")
+	}
+	if natsConn != nil {
+		go func() {
+			if err := srv.ServeNATS(natsCtx, natsConn, natsServer == nil); err != nil {
+				log.Fatal().Err(err).Msg("NATS agent transport error")
+			}
+		}()
+	}
 
-		if cfg.TLSCert != "" && cfg.TLSKey != "" {
+	// Graceful shutdown
+	go func() {
+		if certs != nil {
 			log.Info().Str("port", cfg.Port).Str("cert", cfg.TLSCert).Msg("starting control server (HTTPS)")
-			if err := httpServer.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey); err != nil && err != http.ErrServerClosed {
+			if err := httpServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
 				log.Fatal().Err(err).Msg("server error")
 			}
 		} else {
@@ -120,6 +321,58 @@ func main() {
 		}
 	}()
 
+	// Reload the configuration file on SIGHUP. Settings that cannot change at
+	// runtime are reported and keep their current value. cfg is shared with
+	// the request handlers and is never modified; reloaded settings only go
+	// to the components that use them.
+	reload := func() (*config.Config, error) {
+		next, err := config.LoadFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		if certs != nil {
+			certPath, keyPath := next.TLSCert, next.TLSKey
+			if certPath == "" && next.TLSAuto {
+				certPath, keyPath = certs.Paths()
+			}
+			if err := certs.Reload(certPath, keyPath); err != nil {
+				return nil, err
+			}
+		}
+		if changed := cfg.RestartRequired(next); len(changed) > 0 {
+			log.Warn().Strs("settings", changed).Msg("changed settings take effect after a restart")
+		}
+		level, _ := next.Level()
+		if ag != nil {
+			if err := ag.SetLocalDefaults(next.PollInterval, level); err != nil {
+				return nil, err
+			}
+		} else {
+			zerolog.SetGlobalLevel(level)
+		}
+		client.SetThresholds(next.StaleAfter, next.OfflineAfter)
+		quotas.SetBillingDay(next.BillingDay)
+		alerts.SetRules(next.AlertRules)
+		alerts.SetOfflineAfter(next.OfflineAfter)
+		email.Configure(smtpConfig(next), next.EmailDigestWindow, next.Dashboard())
+		expiries.SetWarnWithin(next.PeerExpiryWarning)
+		chat.SetDashboardURL(next.Dashboard())
+		return next, nil
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			next, err := reload()
+			if err != nil {
+				log.Error().Err(err).Msg("config reload rejected, keeping running config")
+				continue
+			}
+			log.Info().Str("log_level", next.LogLevel).Dur("poll_interval", next.PollInterval).Msg("config reloaded")
+		}
+	}()
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
@@ -127,9 +380,24 @@ func main() {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	if grpcServer != nil {
+		// Agent streams never end on their own, so don't wait for them.
+		grpcServer.Stop()
+	}
+	if natsConn != nil {
+		stopNATS()
+		natsConn.Drain()
+	}
+	if natsServer != nil {
+		natsServer.Shutdown()
+	}
 	if err := httpServer.Shutdown(ctx); err != nil {
 		log.Fatal().Err(err).Msg("server forced to shutdown")
 	}
+	// Write the metric samples and usage still buffered
+	stopFlushing()
+	<-historyDone
+	<-usageDone
 
 	log.Info().Msg("server exited")
 }
@@ -147,3 +415,14 @@ func (f *tlsErrorFilter) Write(p []byte) (n int, err error) {
 	// Forward other errors to stderr
 	return os.Stderr.Write(p)
 }
+
+// smtpConfig returns how emails are sent with cfg.
+func smtpConfig(cfg *config.Config) control.SMTPConfig {
+	return control.SMTPConfig{
+		Addr:     cfg.SMTPAddr,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.SMTPFrom,
+		TLS:      cfg.SMTPTLS,
+	}
+}
@@ -0,0 +1,106 @@
+// Command sentra-release manages the offline key that signs agent releases.
+//
+//	sentra-release keygen <key-file>
+//	sentra-release sign <key-file> <binary> <version> <os> <arch>
+//
+// The public key printed by keygen is configured on the control plane and on
+// agents as SENTRA_RELEASE_PUBLIC_KEY.
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ChronoCoders/sentra/internal/signing"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "keygen":
+		if len(os.Args) != 3 {
+			usage()
+		}
+		err = keygen(os.Args[2])
+	case "sign":
+		if len(os.Args) != 7 {
+			usage()
+		}
+		err = sign(os.Args[2], os.Args[3], os.Args[4], os.Args[5], os.Args[6])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: sentra-release keygen <key-file>")
+	fmt.Fprintln(os.Stderr, "       sentra-release sign <key-file> <binary> <version> <os> <arch>")
+	os.Exit(2)
+}
+
+func keygen(path string) error {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(base64.StdEncoding.EncodeToString(priv) + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Println(signing.EncodePublicKey(pub))
+	return nil
+}
+
+func sign(keyPath, binary, version, goos, goarch string) error {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return err
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(raw) != ed25519.PrivateKeySize {
+		return fmt.Errorf("invalid release key in %s", keyPath)
+	}
+
+	f, err := os.Open(binary)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]string{
+		"version":   version,
+		"os":        goos,
+		"arch":      goarch,
+		"sha256":    sum,
+		"signature": signing.SignRelease(ed25519.PrivateKey(raw), version, goos, goarch, sum),
+	})
+}
@@ -2,10 +2,13 @@ package agent
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/ChronoCoders/sentra/internal/models"
 	"github.com/ChronoCoders/sentra/internal/wireguard"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/shirou/gopsutil/v4/cpu"
 	"github.com/shirou/gopsutil/v4/disk"
@@ -15,28 +18,136 @@ import (
 	"github.com/shirou/gopsutil/v4/net"
 )
 
+// DefaultFullSnapshotEvery is the number of report intervals between two full snapshots.
+const DefaultFullSnapshotEvery = 30
+
+// DefaultPollInterval is the report interval unless configured remotely.
+const DefaultPollInterval = 10 * time.Second
+
 type Agent struct {
 	wg       wireguard.Manager
 	reporter Reporter
 	serverID string
+	identity *Identity
+	delta    *deltaTracker
+	updater  *Updater
+	geo      *GeoIP
+
+	commandsMu sync.RWMutex
+	commands   map[string]CommandHandler
+
+	// Local settings restored when a remote config leaves them unset.
+	defaults localDefaults
+
+	configMu      sync.RWMutex
+	pollInterval  time.Duration
+	collectors    map[string]bool
+	configVersion string
+	redactor      endpointRedactor
+	remote        *models.ConfigUpdate
+	reconfigured  chan struct{}
+
+	// Outcome of the last report, served by the local API.
+	healthMu   sync.RWMutex
+	health     ReportHealth
+	lastEvent  *models.StatusEvent
+	lastStatus *models.Status
+}
+
+// Option configures optional Agent behaviour.
+type Option func(*Agent)
+
+// WithFullSnapshotEvery sets how many report intervals pass between two full
+// snapshots. Reports in between only carry changed peers.
+func WithFullSnapshotEvery(n int) Option {
+	return func(a *Agent) {
+		a.delta = newDeltaTracker(n)
+	}
+}
+
+// WithIdentity stamps every report with the agent's stable identity and the
+// attributes of the machine it runs on.
+func WithIdentity(id *Identity) Option {
+	return func(a *Agent) {
+		a.identity = id
+	}
+}
+
+// WithPollInterval sets the report interval used unless configured remotely.
+func WithPollInterval(d time.Duration) Option {
+	return func(a *Agent) {
+		a.defaults.pollInterval = d
+	}
+}
+
+// WithEndpointPolicy sets how peer endpoints are redacted unless configured
+// remotely, one of models.EndpointPolicies.
+func WithEndpointPolicy(policy string) Option {
+	return func(a *Agent) {
+		a.defaults.endpointPolicy = policy
+	}
+}
+
+// WithGeoIP provides the database for the country endpoint policy.
+func WithGeoIP(geo *GeoIP) Option {
+	return func(a *Agent) {
+		a.geo = geo
+	}
 }
 
-func New(wg wireguard.Manager, reporter Reporter, serverID string) *Agent {
-	return &Agent{wg: wg, reporter: reporter, serverID: serverID}
+// WithUpdater lets the control plane update the agent binary.
+func WithUpdater(u *Updater) Option {
+	return func(a *Agent) {
+		a.updater = u
+	}
+}
+
+func New(wg wireguard.Manager, reporter Reporter, serverID string, opts ...Option) *Agent {
+	a := &Agent{
+		wg:       wg,
+		reporter: reporter,
+		serverID: serverID,
+		delta:    newDeltaTracker(DefaultFullSnapshotEvery),
+		commands: make(map[string]CommandHandler),
+		defaults: localDefaults{
+			pollInterval: DefaultPollInterval,
+			logLevel:     zerolog.GlobalLevel(),
+		},
+		reconfigured: make(chan struct{}, 1),
+	}
+	if wg != nil {
+		a.defaults.interfaces = wg.Interfaces()
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	a.pollInterval = a.defaults.pollInterval
+	redactor, err := a.newRedactor(a.defaults.endpointPolicy, "")
+	if err != nil {
+		log.Error().Err(err).Msg("dropping peer endpoints")
+		redactor = endpointRedactor{policy: models.EndpointDrop}
+	}
+	a.redactor = redactor
+	a.collectors = enabledCollectors(nil)
+	a.registerBuiltinCommands()
+	return a
 }
 
 func (a *Agent) Run(ctx context.Context) error {
-	ticker := time.NewTicker(10 * time.Second)
+	ticker := time.NewTicker(a.interval())
 	defer ticker.Stop()
+	var lastPolicy string
 
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
+		case <-a.reconfigured:
+			ticker.Reset(a.interval())
 		case <-ticker.C:
 			var status *models.Status
 
-			if a.wg != nil {
+			if a.wg != nil && a.collectorEnabled(models.CollectorWireGuard) {
 				s, err := a.wg.GetStatus(ctx)
 				if err != nil {
 					// Only log warning if it's NOT the "file does not exist" error which is expected in containers without WG
@@ -56,16 +167,44 @@ func (a *Agent) Run(ctx context.Context) error {
 			sysInfo := a.collectSystemInfo()
 			status.System = sysInfo
 
-			event := models.StatusEvent{
-				ServerID: a.serverID,
-				Status:   status,
-				Time:     time.Now(),
+			// A new endpoint policy applies to all peers at once.
+			redactor := a.endpointRedactor()
+			if redactor.policy != lastPolicy {
+				a.delta.resync()
+				lastPolicy = redactor.policy
+			}
+			event := a.delta.next(a.serverID, redactor.redactStatus(status))
+			event.Time = time.Now()
+			if a.identity != nil {
+				event.AgentID = a.identity.ID
+				event.Attributes = a.identity.Attributes()
+			}
+			if !event.Delta {
+				event.Agent = a.info()
 			}
 
-			if err := a.reporter.Report(ctx, event); err != nil {
-				log.Error().Err(err).Msg("failed to report status")
+			err := a.reporter.Report(ctx, event)
+			a.recordReport(event, status, err)
+			if err != nil {
+				// The control plane may have missed this report, so the next
+				// one has to be a full snapshot to be applicable.
+				a.delta.resync()
+				if errors.Is(err, ErrResyncRequired) {
+					log.Warn().Uint64("seq", event.Seq).Msg("control plane requested full status resync")
+				} else {
+					log.Error().Err(err).Msg("failed to report status")
+				}
 			} else {
-				log.Info().Int("peer_count", len(status.Peers)).Msg("agent status reported")
+				if a.updater != nil {
+					a.updater.Confirm()
+				}
+				log.Info().
+					Int("peer_count", len(status.Peers)).
+					Int("changed_peers", len(event.Status.Peers)).
+					Int("removed_peers", len(event.RemovedPeers)).
+					Bool("delta", event.Delta).
+					Uint64("seq", event.Seq).
+					Msg("agent status reported")
 			}
 		}
 	}
@@ -74,41 +213,53 @@ func (a *Agent) Run(ctx context.Context) error {
 func (a *Agent) collectSystemInfo() models.SystemInfo {
 	var info models.SystemInfo
 
-	if h, err := host.Info(); err == nil {
-		info.Hostname = h.Hostname
-		info.OS = h.OS
-		info.KernelVersion = h.KernelVersion
-		info.Platform = h.Platform
-		info.Uptime = h.Uptime
+	if a.collectorEnabled(models.CollectorHost) {
+		if h, err := host.Info(); err == nil {
+			info.Hostname = h.Hostname
+			info.OS = h.OS
+			info.KernelVersion = h.KernelVersion
+			info.Platform = h.Platform
+			info.Uptime = h.Uptime
+		}
 	}
 
-	if c, err := cpu.Counts(true); err == nil {
-		info.CPUCount = c
-	}
+	if a.collectorEnabled(models.CollectorCPU) {
+		if c, err := cpu.Counts(true); err == nil {
+			info.CPUCount = c
+		}
 
-	if p, err := cpu.Percent(0, false); err == nil && len(p) > 0 {
-		info.CPUPercent = p[0]
+		if p, err := cpu.Percent(0, false); err == nil && len(p) > 0 {
+			info.CPUPercent = p[0]
+		}
 	}
 
-	if v, err := mem.VirtualMemory(); err == nil {
-		info.MemoryTotal = v.Total
-		info.MemoryUsed = v.Used
-		info.MemoryPercent = v.UsedPercent
+	if a.collectorEnabled(models.CollectorMemory) {
+		if v, err := mem.VirtualMemory(); err == nil {
+			info.MemoryTotal = v.Total
+			info.MemoryUsed = v.Used
+			info.MemoryPercent = v.UsedPercent
+		}
 	}
 
-	if d, err := disk.Usage("/"); err == nil {
-		info.DiskTotal = d.Total
-		info.DiskUsed = d.Used
-		info.DiskPercent = d.UsedPercent
+	if a.collectorEnabled(models.CollectorDisk) {
+		if d, err := disk.Usage("/"); err == nil {
+			info.DiskTotal = d.Total
+			info.DiskUsed = d.Used
+			info.DiskPercent = d.UsedPercent
+		}
 	}
 
-	if l, err := load.Avg(); err == nil {
-		info.LoadAverage = l.Load1
+	if a.collectorEnabled(models.CollectorLoad) {
+		if l, err := load.Avg(); err == nil {
+			info.LoadAverage = l.Load1
+		}
 	}
 
-	if n, err := net.IOCounters(false); err == nil && len(n) > 0 {
-		info.NetBytesSent = n[0].BytesSent
-		info.NetBytesRecv = n[0].BytesRecv
+	if a.collectorEnabled(models.CollectorNetwork) {
+		if n, err := net.IOCounters(false); err == nil && len(n) > 0 {
+			info.NetBytesSent = n[0].BytesSent
+			info.NetBytesRecv = n[0].BytesRecv
+		}
 	}
 
 	return info
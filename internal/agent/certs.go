@@ -0,0 +1,202 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	sentratls "github.com/ChronoCoders/sentra/internal/tls"
+	"github.com/rs/zerolog/log"
+)
+
+// certExpiryMargin is how long before it expires the client certificate is
+// no longer presented, so that it cannot expire during a handshake.
+const certExpiryMargin = 30 * time.Second
+
+// CertManager holds the agent's client certificate issued by the control
+// plane CA and renews it before it expires.
+type CertManager struct {
+	serverURL string
+	path      string
+
+	mu    sync.RWMutex
+	creds *Credentials
+	cert  *tls.Certificate
+	roots *x509.CertPool
+}
+
+// NewCertManager loads the certificate from enrolled credentials. The
+// credentials are saved to path again whenever the certificate is renewed.
+func NewCertManager(serverURL, path string, creds *Credentials) (*CertManager, error) {
+	m := &CertManager{serverURL: serverURL, path: path}
+	if err := m.load(creds); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *CertManager) load(creds *Credentials) error {
+	cert, err := tls.X509KeyPair([]byte(creds.Certificate), []byte(creds.PrivateKey))
+	if err != nil {
+		return fmt.Errorf("failed to load client certificate: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM([]byte(creds.CACertificate)) {
+		return errors.New("failed to load control plane CA certificate")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.creds = creds
+	m.cert = &cert
+	m.roots = roots
+	return nil
+}
+
+// Reload reads the credentials file again, e.g. after the certificate was
+// replaced on disk. The current certificate is kept if it cannot be loaded.
+func (m *CertManager) Reload() error {
+	creds, err := LoadCredentials(m.path)
+	if err != nil {
+		return err
+	}
+	if creds == nil || creds.Certificate == "" {
+		return fmt.Errorf("no client certificate in %s", m.path)
+	}
+	return m.load(creds)
+}
+
+// TLSConfig returns a client configuration that verifies the control plane
+// against the internal CA and presents the current certificate. A
+// certificate that expired, or is about to, is not presented: the control
+// plane would fail the handshake, while without a certificate the agent can
+// still renew it with its credential.
+func (m *CertManager) TLSConfig() *tls.Config {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return &tls.Config{
+		RootCAs: m.roots,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			m.mu.RLock()
+			defer m.mu.RUnlock()
+			if time.Now().Add(certExpiryMargin).After(m.cert.Leaf.NotAfter) {
+				return &tls.Certificate{}, nil
+			}
+			return m.cert, nil
+		},
+	}
+}
+
+// Run renews the certificate once less than a third of its lifetime is left.
+func (m *CertManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		if m.renewDue(time.Now()) {
+			if err := m.renew(ctx); err != nil {
+				log.Error().Err(err).Msg("failed to renew client certificate")
+			} else {
+				log.Info().Time("expires", m.leaf().NotAfter).Msg("client certificate renewed")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *CertManager) leaf() *x509.Certificate {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cert.Leaf
+}
+
+func (m *CertManager) renewDue(now time.Time) bool {
+	leaf := m.leaf()
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	return now.After(leaf.NotAfter.Add(-lifetime / 3))
+}
+
+func (m *CertManager) renew(ctx context.Context) error {
+	m.mu.RLock()
+	creds := *m.creds
+	m.mu.RUnlock()
+
+	keyPEM, csrPEM, err := sentratls.GenerateCSR(creds.AgentID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(map[string]string{"csr": string(csrPEM)})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/api/agents/renew", m.serverURL)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// An expired certificate is not presented, so the credential is what
+	// authenticates the agent then.
+	req.Header.Set("Authorization", "Bearer "+creds.Credential)
+
+	resp, err := newHTTPClient(m.TLSConfig()).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned status: %d", resp.StatusCode)
+	}
+
+	var issued struct {
+		Certificate   string `json:"certificate"`
+		CACertificate string `json:"ca_certificate"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&issued); err != nil {
+		return err
+	}
+
+	creds.PrivateKey = string(keyPEM)
+	creds.Certificate = issued.Certificate
+	creds.CACertificate = issued.CACertificate
+	if err := m.load(&creds); err != nil {
+		return err
+	}
+	return SaveCredentials(m.path, &creds)
+}
+
+// BootstrapTLSConfig returns the TLS configuration used before the agent has
+// enrolled. The control plane is verified against caFile if it exists, or not
+// at all in insecure mode.
+func BootstrapTLSConfig(caFile string, insecure bool) (*tls.Config, error) {
+	if insecure {
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	}
+	data, err := os.ReadFile(caFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return &tls.Config{RootCAs: roots}, nil
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sentratls "github.com/ChronoCoders/sentra/internal/tls"
+)
+
+func TestCertManagerRenewsExpiredCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := sentratls.LoadOrCreateCA(filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert, serverKey := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem")
+	if err := ca.IssueServerCert(serverCert, serverKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.LoadX509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The control plane verifies client certificates if given, like the real
+	// one, so presenting the expired certificate fails the handshake.
+	var presented bool
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/agents/renew" || r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		presented = len(r.TLS.PeerCertificates) > 0
+		var req struct {
+			CSR string `json:"csr"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		_, certPEM, err := ca.SignClientCSR([]byte(req.CSR), "agent-1", time.Hour)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"certificate":    string(certPEM),
+			"ca_certificate": string(ca.CertPEM()),
+		})
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    ca.Pool(),
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	keyPEM, csrPEM, err := sentratls.GenerateCSR("agent-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, expiredPEM, err := ca.SignClientCSR(csrPEM, "agent-1", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "credentials.json")
+	m, err := NewCertManager(srv.URL, path, &Credentials{
+		AgentID:       "agent-1",
+		ServerID:      "server-1",
+		Credential:    "secret",
+		PrivateKey:    string(keyPEM),
+		Certificate:   string(expiredPEM),
+		CACertificate: string(ca.CertPEM()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.renewDue(time.Now()) {
+		t.Fatal("renewal of expired certificate not due")
+	}
+
+	if err := m.renew(context.Background()); err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	if presented {
+		t.Error("expired certificate was presented")
+	}
+	if leaf := m.leaf(); !leaf.NotAfter.After(time.Now()) {
+		t.Errorf("renewed certificate expires at %s", leaf.NotAfter)
+	}
+	creds, err := LoadCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds == nil || creds.Certificate == string(expiredPEM) {
+		t.Error("renewed certificate was not saved")
+	}
+
+	// The renewed certificate is presented again.
+	if err := m.renew(context.Background()); err != nil {
+		t.Fatalf("renew with valid certificate: %v", err)
+	}
+	if !presented {
+		t.Error("valid certificate was not presented")
+	}
+}
@@ -0,0 +1,280 @@
+package agent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/ChronoCoders/sentra/internal/signing"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	channelWriteWait  = 10 * time.Second
+	channelPongWait   = 60 * time.Second
+	channelPingPeriod = (channelPongWait * 9) / 10
+	channelAckTimeout = 10 * time.Second
+	channelMaxBackoff = 30 * time.Second
+)
+
+// ErrNotConnected is returned when a report is made while the channel is down.
+var ErrNotConnected = errors.New("agent channel not connected")
+
+// ChannelReporter keeps a long-lived WebSocket connection to the control
+// plane. Reports flow up and are acknowledged, commands flow down and are
+// answered with their result. The connection is re-established automatically.
+type ChannelReporter struct {
+	url       string
+	token     string
+	dialer    *websocket.Dialer
+	signer    ed25519.PrivateKey
+	onCommand func(ctx context.Context, cmd models.Command) models.CommandResult
+
+	nextID atomic.Uint64
+
+	mu      sync.Mutex
+	conn    *channelConn
+	pending map[string]chan models.ChannelMessage
+}
+
+type channelConn struct {
+	ws   *websocket.Conn
+	send chan models.ChannelMessage
+	done chan struct{}
+}
+
+// NewChannelReporter creates a reporter for the agent channel of serverURL.
+// token may be empty when tlsConfig presents a client certificate.
+func NewChannelReporter(serverURL, token string, tlsConfig *tls.Config) *ChannelReporter {
+	url := strings.Replace(serverURL, "http", "ws", 1) + "/api/agent/channel"
+	return &ChannelReporter{
+		url:   url,
+		token: token,
+		dialer: &websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: 10 * time.Second,
+			TLSClientConfig:  tlsConfig,
+		},
+		pending: make(map[string]chan models.ChannelMessage),
+	}
+}
+
+// SetSigner makes the reporter sign every report with key.
+func (r *ChannelReporter) SetSigner(key ed25519.PrivateKey) {
+	r.signer = key
+}
+
+// OnCommand sets the function that executes commands sent by the control plane.
+func (r *ChannelReporter) OnCommand(fn func(ctx context.Context, cmd models.Command) models.CommandResult) {
+	r.onCommand = fn
+}
+
+// Run connects to the control plane and reconnects with exponential backoff
+// until ctx is cancelled.
+func (r *ChannelReporter) Run(ctx context.Context) {
+	backoff := time.Second
+	for {
+		err := r.connect(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Warn().Err(err).Dur("retry_in", backoff).Msg("agent channel disconnected")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if err != nil {
+			backoff = min(backoff*2, channelMaxBackoff)
+		} else {
+			backoff = time.Second
+		}
+	}
+}
+
+func (r *ChannelReporter) connect(ctx context.Context) error {
+	header := http.Header{}
+	if r.token != "" {
+		header.Set("Authorization", "Bearer "+r.token)
+	}
+
+	ws, resp, err := r.dialer.DialContext(ctx, r.url, header)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("%w (status %d)", err, resp.StatusCode)
+		}
+		return err
+	}
+	log.Info().Str("url", r.url).Msg("agent channel connected")
+
+	conn := &channelConn{
+		ws:   ws,
+		send: make(chan models.ChannelMessage, 16),
+		done: make(chan struct{}),
+	}
+	r.mu.Lock()
+	r.conn = conn
+	r.mu.Unlock()
+
+	go r.writePump(conn)
+	err = r.readPump(ctx, conn)
+
+	r.mu.Lock()
+	r.conn = nil
+	r.mu.Unlock()
+	close(conn.done)
+	ws.Close()
+	return err
+}
+
+func (r *ChannelReporter) readPump(ctx context.Context, conn *channelConn) error {
+	conn.ws.SetReadDeadline(time.Now().Add(channelPongWait))
+	conn.ws.SetPongHandler(func(string) error {
+		conn.ws.SetReadDeadline(time.Now().Add(channelPongWait))
+		return nil
+	})
+
+	// Closing the connection unblocks ReadJSON on shutdown.
+	stop := context.AfterFunc(ctx, func() { conn.ws.Close() })
+	defer stop()
+
+	for {
+		var msg models.ChannelMessage
+		if err := conn.ws.ReadJSON(&msg); err != nil {
+			return err
+		}
+
+		switch msg.Type {
+		case models.ChannelReportAck:
+			r.mu.Lock()
+			ch, ok := r.pending[msg.ID]
+			delete(r.pending, msg.ID)
+			r.mu.Unlock()
+			if ok {
+				ch <- msg
+			}
+		case models.ChannelCommand:
+			go r.execute(ctx, conn, msg)
+		default:
+			log.Warn().Str("type", msg.Type).Msg("unexpected message on agent channel")
+		}
+	}
+}
+
+func (r *ChannelReporter) execute(ctx context.Context, conn *channelConn, msg models.ChannelMessage) {
+	result := models.CommandResult{Error: "agent does not accept commands"}
+	if r.onCommand != nil && msg.Command != nil {
+		result = r.onCommand(ctx, *msg.Command)
+	}
+	reply := models.ChannelMessage{Type: models.ChannelCommandResult, ID: msg.ID, Result: &result}
+	select {
+	case conn.send <- reply:
+	case <-conn.done:
+	}
+}
+
+func (r *ChannelReporter) writePump(conn *channelConn) {
+	ticker := time.NewTicker(channelPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-conn.done:
+			return
+		case msg := <-conn.send:
+			conn.ws.SetWriteDeadline(time.Now().Add(channelWriteWait))
+			if err := conn.ws.WriteJSON(msg); err != nil {
+				conn.ws.Close()
+				return
+			}
+		case <-ticker.C:
+			conn.ws.SetWriteDeadline(time.Now().Add(channelWriteWait))
+			if err := conn.ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				conn.ws.Close()
+				return
+			}
+		}
+	}
+}
+
+// QueueDepth returns the number of reports waiting for an acknowledgement.
+func (r *ChannelReporter) QueueDepth() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.pending)
+}
+
+// Report sends a status event and waits for the control plane to acknowledge it.
+func (r *ChannelReporter) Report(ctx context.Context, event models.StatusEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	msg := models.ChannelMessage{Type: models.ChannelReport, Report: data}
+	if r.signer != nil {
+		sig, err := signing.Sign(r.signer, data)
+		if err != nil {
+			return err
+		}
+		msg.Signature = sig
+	}
+
+	r.mu.Lock()
+	conn := r.conn
+	if conn == nil {
+		r.mu.Unlock()
+		return ErrNotConnected
+	}
+	msg.ID = strconv.FormatUint(r.nextID.Add(1), 10)
+	id := msg.ID
+	ack := make(chan models.ChannelMessage, 1)
+	r.pending[id] = ack
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, id)
+		r.mu.Unlock()
+	}()
+
+	select {
+	case conn.send <- msg:
+	case <-conn.done:
+		return ErrNotConnected
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	timeout := time.NewTimer(channelAckTimeout)
+	defer timeout.Stop()
+	select {
+	case reply := <-ack:
+		if reply.Resync {
+			return ErrResyncRequired
+		}
+		if reply.Error != "" {
+			return errors.New(reply.Error)
+		}
+		return nil
+	case <-conn.done:
+		return ErrNotConnected
+	case <-timeout.C:
+		return errors.New("timed out waiting for report acknowledgement")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
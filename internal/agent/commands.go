@@ -0,0 +1,82 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// CommandHandler executes a command payload and returns a result that is
+// encoded as JSON, or nil.
+type CommandHandler func(ctx context.Context, payload json.RawMessage) (any, error)
+
+// RegisterCommand adds or replaces the handler for a command name.
+func (a *Agent) RegisterCommand(name string, handler CommandHandler) {
+	a.commandsMu.Lock()
+	defer a.commandsMu.Unlock()
+	a.commands[name] = handler
+}
+
+// HandleCommand runs a command received from the control plane.
+func (a *Agent) HandleCommand(ctx context.Context, cmd models.Command) models.CommandResult {
+	a.commandsMu.RLock()
+	handler, ok := a.commands[cmd.Name]
+	a.commandsMu.RUnlock()
+	if !ok {
+		return models.CommandResult{Error: fmt.Sprintf("unknown command %q", cmd.Name)}
+	}
+
+	out, err := handler(ctx, cmd.Payload)
+	if err != nil {
+		log.Warn().Err(err).Str("command", cmd.Name).Msg("command failed")
+		return models.CommandResult{Error: err.Error()}
+	}
+	log.Info().Str("command", cmd.Name).Msg("command executed")
+
+	if out == nil {
+		return models.CommandResult{}
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		return models.CommandResult{Error: err.Error()}
+	}
+	return models.CommandResult{Payload: data}
+}
+
+func (a *Agent) registerBuiltinCommands() {
+	a.RegisterCommand(models.CommandAddPeer, a.addPeer)
+	a.RegisterCommand(models.CommandRemovePeer, a.removePeer)
+	a.RegisterCommand(models.CommandConfig, a.applyConfig)
+	if a.updater != nil {
+		a.RegisterCommand(models.CommandUpdate, a.updater.handleUpdate)
+	}
+}
+
+func (a *Agent) addPeer(ctx context.Context, payload json.RawMessage) (any, error) {
+	if a.wg == nil {
+		return nil, errors.New("wireguard is not available on this agent")
+	}
+	var peer models.PeerConfig
+	if err := json.Unmarshal(payload, &peer); err != nil {
+		return nil, fmt.Errorf("invalid peer: %w", err)
+	}
+	return nil, a.wg.AddPeer(ctx, peer)
+}
+
+func (a *Agent) removePeer(ctx context.Context, payload json.RawMessage) (any, error) {
+	if a.wg == nil {
+		return nil, errors.New("wireguard is not available on this agent")
+	}
+	var req struct {
+		Interface string `json:"interface"`
+		PublicKey string `json:"public_key"`
+	}
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	return nil, a.wg.RemovePeer(ctx, req.Interface, req.PublicKey)
+}
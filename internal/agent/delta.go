@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"slices"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+// deltaTracker remembers the peers of the previous report so that only
+// changes have to be sent, and decides when a full snapshot is due.
+type deltaTracker struct {
+	fullEvery int
+	sinceFull int
+	seq       uint64
+	forceFull bool
+	lastPeers map[string]models.Peer
+}
+
+func newDeltaTracker(fullEvery int) *deltaTracker {
+	if fullEvery < 1 {
+		fullEvery = 1
+	}
+	return &deltaTracker{fullEvery: fullEvery}
+}
+
+// next turns the collected status into the event to report, either a full
+// snapshot or a delta against the previously reported peers.
+func (t *deltaTracker) next(serverID string, status *models.Status) models.StatusEvent {
+	t.seq++
+	event := models.StatusEvent{
+		ServerID: serverID,
+		Status:   status,
+		Seq:      t.seq,
+	}
+
+	current := make(map[string]models.Peer, len(status.Peers))
+	for _, p := range status.Peers {
+		current[p.Key()] = p
+	}
+
+	if t.lastPeers == nil || t.forceFull || t.sinceFull >= t.fullEvery {
+		t.forceFull = false
+		t.sinceFull = 1
+		t.lastPeers = current
+		return event
+	}
+
+	var changed []models.Peer
+	for _, p := range status.Peers {
+		if prev, ok := t.lastPeers[p.Key()]; !ok || peerChanged(prev, p) {
+			changed = append(changed, p)
+		}
+	}
+	var removed []string
+	for key := range t.lastPeers {
+		if _, ok := current[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	slices.Sort(removed)
+
+	delta := *status
+	delta.Peers = changed
+	event.Status = &delta
+	event.Delta = true
+	event.RemovedPeers = removed
+
+	t.sinceFull++
+	t.lastPeers = current
+	return event
+}
+
+// resync forces the next report to be a full snapshot. It is used after a
+// failed report or when the control plane asks for one.
+func (t *deltaTracker) resync() {
+	t.forceFull = true
+}
+
+func peerChanged(a, b models.Peer) bool {
+	return !a.LatestHandshake.Equal(b.LatestHandshake) ||
+		a.ReceiveBytes != b.ReceiveBytes ||
+		a.TransmitBytes != b.TransmitBytes ||
+		a.Endpoint != b.Endpoint ||
+		a.KeepAlive != b.KeepAlive ||
+		!slices.Equal(a.AllowedIPs, b.AllowedIPs)
+}
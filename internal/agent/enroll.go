@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	sentratls "github.com/ChronoCoders/sentra/internal/tls"
+)
+
+// Credentials are issued by the control plane when an agent enrolls with a
+// join token. They are persisted so the agent only enrolls once.
+type Credentials struct {
+	AgentID    string `json:"agent_id"`
+	OrgID      string `json:"org_id,omitempty"`
+	ServerID   string `json:"server_id"`
+	Credential string `json:"credential"`
+
+	// Client certificate issued by the control plane CA, with its key and the
+	// CA certificate used to verify the control plane.
+	PrivateKey    string `json:"private_key,omitempty"`
+	Certificate   string `json:"certificate,omitempty"`
+	CACertificate string `json:"ca_certificate,omitempty"`
+}
+
+// LoadCredentials reads previously saved credentials. It returns nil without
+// error if the file does not exist.
+func LoadCredentials(path string) (*Credentials, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var creds Credentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials %s: %w", path, err)
+	}
+	return &creds, nil
+}
+
+// SaveCredentials writes credentials readable by the owner only.
+func SaveCredentials(path string, creds *Credentials) error {
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// Enroll exchanges a one-time join token for agent credentials and a client
+// certificate, registering the agent's public signing key. tlsConfig is used
+// to reach the control plane during enrollment.
+func Enroll(ctx context.Context, serverURL, joinToken, hostname, signingKey string, tlsConfig *tls.Config) (*Credentials, error) {
+	keyPEM, csrPEM, err := sentratls.GenerateCSR(hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(map[string]string{
+		"token":       joinToken,
+		"hostname":    hostname,
+		"csr":         string(csrPEM),
+		"signing_key": signingKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/api/agents/enroll", serverURL)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := newHTTPClient(tlsConfig).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("enrollment failed: server returned status: %d", resp.StatusCode)
+	}
+
+	var creds Credentials
+	if err := json.NewDecoder(resp.Body).Decode(&creds); err != nil {
+		return nil, fmt.Errorf("failed to decode enrollment response: %w", err)
+	}
+	if creds.Certificate != "" {
+		creds.PrivateKey = string(keyPEM)
+	}
+	return &creds, nil
+}
+
+// RegisterSigningKey registers the signing key of an agent that enrolled
+// before it had one. It succeeds if the same key is already registered.
+func RegisterSigningKey(ctx context.Context, serverURL, token, signingKey string, tlsConfig *tls.Config) error {
+	data, err := json.Marshal(map[string]string{"signing_key": signingKey})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/api/agents/signing-key", serverURL)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := newHTTPClient(tlsConfig).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("server returned status: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package agent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/agentpb"
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/ChronoCoders/sentra/internal/signing"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCReporter reports to the control plane's gRPC agent service. Reports
+// share one client stream; the control plane ends it when it rejects a report
+// or needs a full snapshot, which surfaces on the next report.
+type GRPCReporter struct {
+	conn      *grpc.ClientConn
+	client    agentpb.AgentServiceClient
+	token     string
+	signer    ed25519.PrivateKey
+	onCommand func(ctx context.Context, cmd models.Command) models.CommandResult
+
+	mu     sync.Mutex
+	stream agentpb.AgentService_StreamReportsClient
+	cancel context.CancelFunc
+}
+
+// NewGRPCReporter creates a reporter for the gRPC service at addr (host:port).
+// A nil tlsConfig connects without TLS. token may be empty when tlsConfig
+// presents a client certificate.
+func NewGRPCReporter(addr, token string, tlsConfig *tls.Config) (*GRPCReporter, error) {
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCReporter{conn: conn, client: agentpb.NewAgentServiceClient(conn), token: token}, nil
+}
+
+// SetSigner makes the reporter sign every report with key.
+func (r *GRPCReporter) SetSigner(key ed25519.PrivateKey) {
+	r.signer = key
+}
+
+// OnCommand sets the function that executes commands sent by the control plane.
+func (r *GRPCReporter) OnCommand(fn func(ctx context.Context, cmd models.Command) models.CommandResult) {
+	r.onCommand = fn
+}
+
+func (r *GRPCReporter) withToken(ctx context.Context) context.Context {
+	if r.token == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+r.token)
+}
+
+func (r *GRPCReporter) Report(ctx context.Context, event models.StatusEvent) error {
+	req := &agentpb.ReportRequest{Event: agentpb.EventToProto(event)}
+	if r.signer != nil {
+		payload, err := agentpb.EventPayload(req.Event)
+		if err != nil {
+			return err
+		}
+		sig, err := signing.Sign(r.signer, payload)
+		if err != nil {
+			return err
+		}
+		req.Signature = agentpb.SignatureToProto(sig)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stream == nil {
+		// The stream outlives a single report, so it does not use ctx.
+		streamCtx, cancel := context.WithCancel(r.withToken(context.Background()))
+		stream, err := r.client.StreamReports(streamCtx)
+		if err != nil {
+			cancel()
+			return err
+		}
+		r.stream, r.cancel = stream, cancel
+	}
+
+	if err := r.stream.Send(req); err != nil {
+		// The control plane ended the stream, its status tells why.
+		_, err = r.stream.CloseAndRecv()
+		r.closeStreamLocked()
+		if status.Code(err) == codes.FailedPrecondition {
+			return ErrResyncRequired
+		}
+		if err == nil || err == io.EOF {
+			err = errors.New("report stream closed")
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *GRPCReporter) closeStreamLocked() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.stream, r.cancel = nil, nil
+}
+
+// Run keeps the command stream open and reconnects with exponential backoff
+// until ctx is cancelled.
+func (r *GRPCReporter) Run(ctx context.Context) {
+	backoff := time.Second
+	for {
+		err := r.serveCommands(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Warn().Err(err).Dur("retry_in", backoff).Msg("agent gRPC command stream disconnected")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if err != nil {
+			backoff = min(backoff*2, channelMaxBackoff)
+		} else {
+			backoff = time.Second
+		}
+	}
+}
+
+func (r *GRPCReporter) serveCommands(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := r.client.Commands(r.withToken(ctx))
+	if err != nil {
+		return err
+	}
+	// Announce the stream so the control plane registers the agent.
+	if err := stream.Send(&agentpb.CommandResult{}); err != nil {
+		return err
+	}
+	log.Info().Msg("agent gRPC command stream connected")
+
+	var sendMu sync.Mutex
+	for {
+		cmd, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		go func() {
+			result := models.CommandResult{Error: "agent does not accept commands"}
+			if r.onCommand != nil {
+				result = r.onCommand(ctx, agentpb.CommandFromProto(cmd))
+			}
+			sendMu.Lock()
+			defer sendMu.Unlock()
+			if err := stream.Send(agentpb.ResultToProto(cmd.GetId(), result)); err != nil {
+				log.Warn().Err(err).Str("command", cmd.GetName()).Msg("failed to send command result")
+			}
+		}()
+	}
+}
+
+// Close ends the report stream and the connection.
+func (r *GRPCReporter) Close() error {
+	r.mu.Lock()
+	if r.stream != nil {
+		r.stream.CloseAndRecv()
+	}
+	r.closeStreamLocked()
+	r.mu.Unlock()
+	return r.conn.Close()
+}
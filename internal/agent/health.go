@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+// Reporter health states.
+const (
+	HealthStarting = "starting"
+	HealthOK       = "ok"
+	HealthFailing  = "failing"
+)
+
+// failingAfter is the number of consecutive failed reports after which
+// reporting is considered failing.
+const failingAfter = 3
+
+// QueueReporter is implemented by reporters that hold reports not yet
+// acknowledged by the control plane.
+type QueueReporter interface {
+	QueueDepth() int
+}
+
+// ReportHealth describes how reporting to the control plane is going.
+type ReportHealth struct {
+	Status              string      `json:"status"`
+	Succeeded           uint64      `json:"reports_succeeded"`
+	Failed              uint64      `json:"reports_failed"`
+	ConsecutiveFailures int         `json:"consecutive_failures"`
+	LastReport          time.Time   `json:"last_report,omitzero"`
+	LastSuccess         time.Time   `json:"last_success,omitzero"`
+	LastError           string      `json:"last_error,omitempty"`
+	LastErrorAt         time.Time   `json:"last_error_at,omitzero"`
+	QueueDepth          int         `json:"queue_depth"`
+	Sinks               []SinkStats `json:"sinks,omitempty"`
+}
+
+// recordReport keeps the outcome of a report for the local API.
+func (a *Agent) recordReport(event models.StatusEvent, status *models.Status, err error) {
+	a.healthMu.Lock()
+	defer a.healthMu.Unlock()
+
+	a.lastEvent = &event
+	a.lastStatus = status
+	a.health.LastReport = event.Time
+	// A resync request is part of the protocol, not a reporting failure.
+	if err == nil || errors.Is(err, ErrResyncRequired) {
+		a.health.Succeeded++
+		a.health.ConsecutiveFailures = 0
+		a.health.LastSuccess = event.Time
+		return
+	}
+	a.health.Failed++
+	a.health.ConsecutiveFailures++
+	a.health.LastError = err.Error()
+	a.health.LastErrorAt = event.Time
+}
+
+// Health returns the current reporting health.
+func (a *Agent) Health() ReportHealth {
+	a.healthMu.RLock()
+	h := a.health
+	a.healthMu.RUnlock()
+
+	switch {
+	case h.LastReport.IsZero():
+		h.Status = HealthStarting
+	case h.ConsecutiveFailures >= failingAfter:
+		h.Status = HealthFailing
+	default:
+		h.Status = HealthOK
+	}
+	if q, ok := a.reporter.(QueueReporter); ok {
+		h.QueueDepth = q.QueueDepth()
+	}
+	if m, ok := a.reporter.(SinkReporter); ok {
+		h.Sinks = m.SinkStats()
+	}
+	return h
+}
+
+// LastReport returns the last status event sent to the control plane and the
+// complete status it was built from. Both are nil before the first report.
+func (a *Agent) LastReport() (*models.StatusEvent, *models.Status) {
+	a.healthMu.RLock()
+	defer a.healthMu.RUnlock()
+	return a.lastEvent, a.lastStatus
+}
@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/ChronoCoders/sentra/internal/signing"
+	"github.com/google/uuid"
+	"github.com/shirou/gopsutil/v4/host"
+)
+
+// Identity is the agent's stable local identity. It is created on first start
+// and never leaves the machine, except for the ID and the public key.
+type Identity struct {
+	ID         string             `json:"id"`
+	SigningKey ed25519.PrivateKey `json:"signing_key"`
+}
+
+// LoadOrCreateIdentity reads the identity at path, generating and saving a new
+// one if it does not exist yet. Identities written before IDs existed get one.
+func LoadOrCreateIdentity(path string) (*Identity, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		var id Identity
+		if err := json.Unmarshal(data, &id); err != nil {
+			return nil, fmt.Errorf("failed to parse identity %s: %w", path, err)
+		}
+		if len(id.SigningKey) != ed25519.PrivateKeySize {
+			return nil, fmt.Errorf("invalid signing key in %s", path)
+		}
+		if id.ID == "" {
+			id.ID = uuid.NewString()
+			if err := saveIdentity(path, &id); err != nil {
+				return nil, err
+			}
+		}
+		return &id, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := &Identity{ID: uuid.NewString(), SigningKey: key}
+	if err := saveIdentity(path, id); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+func saveIdentity(path string, id *Identity) error {
+	data, err := json.MarshalIndent(id, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// PublicKey returns the base64 encoded public signing key.
+func (id *Identity) PublicKey() string {
+	return signing.EncodePublicKey(id.SigningKey.Public().(ed25519.PublicKey))
+}
+
+// Attributes describes the machine the agent runs on. The control plane uses
+// them to tell apart agents that claim the same identity.
+func (id *Identity) Attributes() map[string]string {
+	attrs := make(map[string]string)
+	if hostname, err := os.Hostname(); err == nil {
+		attrs[models.AttributeHostname] = hostname
+	}
+	if machineID, err := host.HostID(); err == nil && machineID != "" {
+		attrs[models.AttributeMachineID] = machineID
+	}
+	return attrs
+}
@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"runtime"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/ChronoCoders/sentra/internal/version"
+)
+
+// capabilities returns the features this agent supports in its current setup.
+func (a *Agent) capabilities() []string {
+	caps := []string{models.CapabilitySystemMetrics, models.CapabilityRemoteConfig}
+	if a.wg != nil {
+		caps = append(caps, models.CapabilityPeerManagement, models.CapabilityMultiInterface)
+	}
+	if a.updater != nil {
+		caps = append(caps, models.CapabilitySelfUpdate)
+	}
+	return caps
+}
+
+// info describes the agent software for the control plane's fleet inventory.
+func (a *Agent) info() *models.AgentInfo {
+	info := &models.AgentInfo{
+		Version:         version.Version,
+		ProtocolVersion: version.ProtocolVersion,
+		Capabilities:    a.capabilities(),
+		GoVersion:       runtime.Version(),
+		OS:              runtime.GOOS,
+		Arch:            runtime.GOARCH,
+	}
+	cfg, configVersion := a.effectiveConfig()
+	info.Config, info.ConfigVersion = &cfg, configVersion
+	if a.updater != nil {
+		info.RolledBackFrom = a.updater.RolledBackFrom()
+	}
+	return info
+}
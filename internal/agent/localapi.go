@@ -0,0 +1,119 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ListenLocal opens the listener of the local API. addr is a loopback
+// host:port or "unix:" followed by a socket path.
+func ListenLocal(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		// Remove a socket left behind by a previous run.
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(path, 0600); err != nil {
+			l.Close()
+			return nil, err
+		}
+		return l, nil
+	}
+	if err := checkLocalAddr(addr); err != nil {
+		return nil, err
+	}
+	return net.Listen("tcp", addr)
+}
+
+// checkLocalAddr returns an error unless addr is a Unix socket or a loopback
+// host:port, so the local API is never exposed to the network.
+func checkLocalAddr(addr string) error {
+	if strings.HasPrefix(addr, "unix:") {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%q is not a loopback address", addr)
+	}
+	return nil
+}
+
+// ServeLocalAPI serves the agent's local API on addr until ctx is cancelled:
+//
+//	GET /status   last status event and the complete status it was built from
+//	GET /health   reporting health, 503 while reporting is failing
+//	GET /metrics  Prometheus metrics
+func ServeLocalAPI(ctx context.Context, addr string, a *Agent) error {
+	l, err := ListenLocal(addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: a.LocalHandler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Info().Str("addr", addr).Msg("local agent API listening")
+	if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// LocalHandler returns the handler of the local API.
+func (a *Agent) LocalHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", a.handleLocalStatus)
+	mux.HandleFunc("GET /health", a.handleLocalHealth)
+	mux.HandleFunc("GET /metrics", a.handleLocalMetrics)
+	return mux
+}
+
+func (a *Agent) handleLocalStatus(w http.ResponseWriter, r *http.Request) {
+	event, status := a.LastReport()
+	if event == nil {
+		http.Error(w, "no status collected yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"event":  event,
+		"status": status,
+	})
+}
+
+func (a *Agent) handleLocalHealth(w http.ResponseWriter, r *http.Request) {
+	health := a.Health()
+	w.Header().Set("Content-Type", "application/json")
+	if health.Status == HealthFailing {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(health)
+}
+
+func (a *Agent) handleLocalMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	a.writeMetrics(w)
+}
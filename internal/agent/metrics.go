@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/version"
+)
+
+// promWriter writes metrics in the Prometheus text exposition format.
+type promWriter struct {
+	w io.Writer
+}
+
+// family starts a metric family.
+func (p promWriter) family(name, typ, help string) {
+	fmt.Fprintf(p.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes one sample. labels are name/value pairs.
+func (p promWriter) sample(name string, value float64, labels ...string) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(labels[i])
+			b.WriteString(`="`)
+			b.WriteString(labelEscaper.Replace(labels[i+1]))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	b.WriteByte('\n')
+	io.WriteString(p.w, b.String())
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func unixSeconds(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixNano()) / 1e9
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// writeMetrics writes the agent's reporting and WireGuard metrics.
+func (a *Agent) writeMetrics(w io.Writer) {
+	p := promWriter{w: w}
+	health := a.Health()
+
+	p.family("sentra_agent_info", "gauge", "Agent version.")
+	p.sample("sentra_agent_info", 1, "version", version.Version, "server_id", a.serverID)
+
+	p.family("sentra_agent_reports_total", "counter", "Status reports sent to the control plane.")
+	p.sample("sentra_agent_reports_total", float64(health.Succeeded), "result", "success")
+	p.sample("sentra_agent_reports_total", float64(health.Failed), "result", "failure")
+
+	p.family("sentra_agent_report_consecutive_failures", "gauge", "Status reports that failed since the last success.")
+	p.sample("sentra_agent_report_consecutive_failures", float64(health.ConsecutiveFailures))
+
+	p.family("sentra_agent_reporting_healthy", "gauge", "Whether reporting to the control plane works.")
+	p.sample("sentra_agent_reporting_healthy", boolValue(health.Status != HealthFailing))
+
+	p.family("sentra_agent_last_report_success_timestamp_seconds", "gauge", "Time of the last successful status report.")
+	p.sample("sentra_agent_last_report_success_timestamp_seconds", unixSeconds(health.LastSuccess))
+
+	p.family("sentra_agent_report_queue_depth", "gauge", "Status reports waiting for an acknowledgement.")
+	p.sample("sentra_agent_report_queue_depth", float64(health.QueueDepth))
+
+	if len(health.Sinks) > 0 {
+		p.family("sentra_agent_sink_reports_total", "counter", "Status reports delivered to a report sink.")
+		for _, sink := range health.Sinks {
+			p.sample("sentra_agent_sink_reports_total", float64(sink.Succeeded), "sink", sink.Name, "result", "success")
+			p.sample("sentra_agent_sink_reports_total", float64(sink.Resynced), "sink", sink.Name, "result", "resync")
+			p.sample("sentra_agent_sink_reports_total", float64(sink.Failed), "sink", sink.Name, "result", "failure")
+		}
+		p.family("sentra_agent_sink_dropped_total", "counter", "Status reports dropped because a sink's queue was full.")
+		for _, sink := range health.Sinks {
+			p.sample("sentra_agent_sink_dropped_total", float64(sink.Dropped), "sink", sink.Name)
+		}
+		p.family("sentra_agent_sink_queue_depth", "gauge", "Status reports waiting for delivery to a sink.")
+		for _, sink := range health.Sinks {
+			p.sample("sentra_agent_sink_queue_depth", float64(sink.QueueDepth), "sink", sink.Name)
+		}
+	}
+
+	_, status := a.LastReport()
+	if status == nil {
+		return
+	}
+
+	p.family("sentra_wireguard_interface_up", "gauge", "Whether the WireGuard interface could be read.")
+	for _, iface := range status.Interfaces {
+		p.sample("sentra_wireguard_interface_up", boolValue(iface.Error == ""), "interface", iface.Name)
+	}
+	p.family("sentra_wireguard_peers", "gauge", "Configured WireGuard peers.")
+	for _, iface := range status.Interfaces {
+		p.sample("sentra_wireguard_peers", float64(iface.PeerCount), "interface", iface.Name)
+	}
+
+	p.family("sentra_wireguard_peer_receive_bytes_total", "counter", "Bytes received from the peer.")
+	for _, peer := range status.Peers {
+		p.sample("sentra_wireguard_peer_receive_bytes_total", float64(peer.ReceiveBytes), "interface", peer.Interface, "public_key", peer.PublicKey)
+	}
+	p.family("sentra_wireguard_peer_transmit_bytes_total", "counter", "Bytes sent to the peer.")
+	for _, peer := range status.Peers {
+		p.sample("sentra_wireguard_peer_transmit_bytes_total", float64(peer.TransmitBytes), "interface", peer.Interface, "public_key", peer.PublicKey)
+	}
+	p.family("sentra_wireguard_peer_last_handshake_timestamp_seconds", "gauge", "Time of the latest handshake with the peer, 0 if none.")
+	for _, peer := range status.Peers {
+		p.sample("sentra_wireguard_peer_last_handshake_timestamp_seconds", unixSeconds(peer.LatestHandshake), "interface", peer.Interface, "public_key", peer.PublicKey)
+	}
+
+	sys := status.System
+	p.family("sentra_host_cpu_percent", "gauge", "CPU utilisation.")
+	p.sample("sentra_host_cpu_percent", sys.CPUPercent)
+	p.family("sentra_host_memory_used_bytes", "gauge", "Memory in use.")
+	p.sample("sentra_host_memory_used_bytes", float64(sys.MemoryUsed))
+	p.family("sentra_host_memory_total_bytes", "gauge", "Total memory.")
+	p.sample("sentra_host_memory_total_bytes", float64(sys.MemoryTotal))
+	p.family("sentra_host_disk_used_bytes", "gauge", "Disk space in use.")
+	p.sample("sentra_host_disk_used_bytes", float64(sys.DiskUsed))
+	p.family("sentra_host_load1", "gauge", "One minute load average.")
+	p.sample("sentra_host_load1", sys.LoadAverage)
+}
@@ -0,0 +1,185 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// sinkQueueSize is the number of reports buffered for a secondary sink. When
+// it is full the oldest report is dropped.
+const sinkQueueSize = 32
+
+// sinkTimeout bounds a single delivery to a secondary sink.
+const sinkTimeout = 30 * time.Second
+
+// Sink is a named destination for status reports.
+type Sink struct {
+	Name     string
+	Reporter Reporter
+}
+
+// SinkStats describes deliveries to one sink. Resynced counts reports that
+// arrived but were refused until a full snapshot, which counts as succeeded
+// once it is delivered.
+type SinkStats struct {
+	Name        string    `json:"name"`
+	Primary     bool      `json:"primary"`
+	Succeeded   uint64    `json:"succeeded"`
+	Resynced    uint64    `json:"resync_requested"`
+	Failed      uint64    `json:"failed"`
+	Dropped     uint64    `json:"dropped"`
+	QueueDepth  int       `json:"queue_depth"`
+	LastSuccess time.Time `json:"last_success,omitzero"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at,omitzero"`
+}
+
+// SinkReporter is implemented by reporters that deliver to several sinks.
+type SinkReporter interface {
+	SinkStats() []SinkStats
+}
+
+// MultiReporter delivers every report to several sinks independently. The
+// primary sink, usually the control plane, is reported to synchronously and
+// its result is returned so the agent can resync. Secondary sinks each have
+// their own queue and goroutine, so a slow or failing sink never blocks the
+// others.
+type MultiReporter struct {
+	primary *sinkState
+	others  []*sinkState
+}
+
+type sinkState struct {
+	sink  Sink
+	queue chan models.StatusEvent
+
+	mu    sync.Mutex
+	stats SinkStats
+}
+
+// NewMultiReporter creates a reporter for primary and others. primary may
+// have a nil Reporter, in which case all sinks are secondary. The secondary
+// sinks are served until ctx is cancelled.
+func NewMultiReporter(ctx context.Context, primary Sink, others ...Sink) *MultiReporter {
+	m := &MultiReporter{}
+	if primary.Reporter != nil {
+		m.primary = &sinkState{sink: primary, stats: SinkStats{Name: primary.Name, Primary: true}}
+	}
+	for _, sink := range others {
+		s := &sinkState{
+			sink:  sink,
+			queue: make(chan models.StatusEvent, sinkQueueSize),
+			stats: SinkStats{Name: sink.Name},
+		}
+		m.others = append(m.others, s)
+		go s.run(ctx)
+	}
+	return m
+}
+
+// Report queues event for the secondary sinks and reports it to the primary.
+func (m *MultiReporter) Report(ctx context.Context, event models.StatusEvent) error {
+	for _, s := range m.others {
+		s.enqueue(event)
+	}
+	if m.primary == nil {
+		return nil
+	}
+	err := m.primary.sink.Reporter.Report(ctx, event)
+	m.primary.record(err)
+	return err
+}
+
+// QueueDepth returns the queue depth of the primary sink.
+func (m *MultiReporter) QueueDepth() int {
+	if m.primary == nil {
+		return 0
+	}
+	if q, ok := m.primary.sink.Reporter.(QueueReporter); ok {
+		return q.QueueDepth()
+	}
+	return 0
+}
+
+// SinkStats returns delivery statistics of all sinks, primary first.
+func (m *MultiReporter) SinkStats() []SinkStats {
+	var stats []SinkStats
+	if m.primary != nil {
+		st := m.primary.snapshot()
+		st.QueueDepth = m.QueueDepth()
+		stats = append(stats, st)
+	}
+	for _, s := range m.others {
+		stats = append(stats, s.snapshot())
+	}
+	return stats
+}
+
+func (s *sinkState) enqueue(event models.StatusEvent) {
+	for {
+		select {
+		case s.queue <- event:
+			return
+		default:
+		}
+		// Drop the oldest report to make room.
+		select {
+		case <-s.queue:
+			s.mu.Lock()
+			s.stats.Dropped++
+			s.mu.Unlock()
+		default:
+		}
+	}
+}
+
+func (s *sinkState) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-s.queue:
+			reportCtx, cancel := context.WithTimeout(ctx, sinkTimeout)
+			err := s.sink.Reporter.Report(reportCtx, event)
+			cancel()
+			if err != nil && !errors.Is(err, ErrResyncRequired) {
+				log.Warn().Err(err).Str("sink", s.sink.Name).Msg("failed to deliver report to sink")
+			}
+			s.record(err)
+		}
+	}
+}
+
+func (s *sinkState) record(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	switch {
+	case err == nil:
+		s.stats.Succeeded++
+		s.stats.LastSuccess = now
+	case errors.Is(err, ErrResyncRequired):
+		// The report arrived but was not applied, so it is not a failure
+		// but not a delivery either.
+		s.stats.Resynced++
+	default:
+		s.stats.Failed++
+		s.stats.LastError = err.Error()
+		s.stats.LastErrorAt = now
+	}
+}
+
+func (s *sinkState) snapshot() SinkStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stats
+	if s.queue != nil {
+		st.QueueDepth = len(s.queue)
+	}
+	return st
+}
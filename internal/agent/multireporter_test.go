@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+// scriptedReporter answers consecutive reports with its results.
+type scriptedReporter struct {
+	results []error
+}
+
+func (r *scriptedReporter) Report(ctx context.Context, event models.StatusEvent) error {
+	err := r.results[0]
+	r.results = r.results[1:]
+	return err
+}
+
+func TestMultiReporterStats(t *testing.T) {
+	errDown := errors.New("connection refused")
+	tests := []struct {
+		name string
+		// results are what the sink answers to consecutive reports.
+		results []error
+		want    SinkStats
+	}{
+		{
+			name:    "delivered",
+			results: []error{nil, nil},
+			want:    SinkStats{Succeeded: 2},
+		},
+		{
+			name:    "failed",
+			results: []error{errDown},
+			want:    SinkStats{Failed: 1, LastError: errDown.Error()},
+		},
+		{
+			name:    "resync is not a delivery",
+			results: []error{ErrResyncRequired},
+			want:    SinkStats{Resynced: 1},
+		},
+		{
+			name:    "snapshot after a resync is a delivery",
+			results: []error{nil, ErrResyncRequired, nil},
+			want:    SinkStats{Succeeded: 2, Resynced: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			m := NewMultiReporter(ctx,
+				Sink{Name: "control", Reporter: &scriptedReporter{results: tt.results}},
+				Sink{Name: "file", Reporter: &scriptedReporter{results: tt.results}})
+
+			for range tt.results {
+				m.Report(ctx, models.StatusEvent{Time: time.Now()})
+			}
+			var stats []SinkStats
+			for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+				stats = m.SinkStats()
+				secondary := stats[1]
+				if secondary.Succeeded+secondary.Failed+secondary.Resynced == uint64(len(tt.results)) {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("secondary sink delivered %+v of %d reports", secondary, len(tt.results))
+				}
+			}
+
+			for _, st := range stats {
+				if st.Succeeded != tt.want.Succeeded || st.Resynced != tt.want.Resynced || st.Failed != tt.want.Failed || st.LastError != tt.want.LastError {
+					t.Errorf("%s stats = %+v, want %+v", st.Name, st, tt.want)
+				}
+				if got := !st.LastSuccess.IsZero(); got != (tt.want.Succeeded > 0) {
+					t.Errorf("%s last success set = %v", st.Name, got)
+				}
+			}
+		})
+	}
+}
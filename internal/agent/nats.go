@@ -0,0 +1,187 @@
+package agent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"sync/atomic"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/agentpb"
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/ChronoCoders/sentra/internal/natsbus"
+	"github.com/ChronoCoders/sentra/internal/signing"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// NATSReporter publishes reports to the control plane's JetStream report
+// stream and answers commands sent to the agent's command subject. The
+// control plane asks for a full snapshot asynchronously; the request
+// surfaces on the next report.
+type NATSReporter struct {
+	nc        *nats.Conn
+	js        jetstream.JetStream
+	agentID   string
+	orgID     string
+	serverID  string
+	signer    ed25519.PrivateKey
+	onCommand func(ctx context.Context, cmd models.Command) models.CommandResult
+	resync    atomic.Bool
+	// serving is set once Run subscribed to commands.
+	serving atomic.Bool
+}
+
+// NewNATSReporter connects to the NATS server at url as the enrolled agent
+// creds. It authenticates with token, or with the client certificate of
+// tlsConfig if token is empty. opts are applied last, e.g. to pass a
+// credentials file for an external server. The connection is retried in the
+// background if the server is unreachable.
+func NewNATSReporter(url string, creds *Credentials, token string, tlsConfig *tls.Config, opts ...nats.Option) (*NATSReporter, error) {
+	r := &NATSReporter{agentID: creds.AgentID, orgID: creds.OrgID, serverID: creds.ServerID}
+
+	options := []nats.Option{
+		nats.Name("sentra-agent " + creds.AgentID),
+		nats.CustomInboxPrefix(natsbus.InboxPrefix(creds.AgentID)),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(2 * time.Second),
+		nats.ConnectHandler(func(*nats.Conn) { r.hello() }),
+		nats.ReconnectHandler(func(*nats.Conn) { r.hello() }),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Warn().Err(err).Msg("agent NATS connection lost")
+			}
+		}),
+	}
+	if token != "" {
+		options = append(options, nats.Token(token))
+	}
+	if tlsConfig != nil {
+		options = append(options, nats.Secure(tlsConfig))
+	}
+	nc, err := nats.Connect(url, append(options, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	r.nc, r.js = nc, js
+	return r, nil
+}
+
+// SetSigner makes the reporter sign every report with key.
+func (r *NATSReporter) SetSigner(key ed25519.PrivateKey) {
+	r.signer = key
+}
+
+// OnCommand sets the function that executes commands sent by the control plane.
+func (r *NATSReporter) OnCommand(fn func(ctx context.Context, cmd models.Command) models.CommandResult) {
+	r.onCommand = fn
+}
+
+func (r *NATSReporter) subject(kind string) string {
+	return natsbus.Subject(r.orgID, r.serverID, kind)
+}
+
+// hello announces the agent so the control plane can send it commands.
+func (r *NATSReporter) hello() {
+	if !r.serving.Load() {
+		return
+	}
+	msg := nats.NewMsg(r.subject(natsbus.KindHello))
+	msg.Header.Set(natsbus.AgentHeader, r.agentID)
+	if err := r.nc.PublishMsg(msg); err != nil {
+		log.Warn().Err(err).Msg("failed to announce agent over NATS")
+		return
+	}
+	log.Info().Msg("agent NATS connection established")
+}
+
+func (r *NATSReporter) Report(ctx context.Context, event models.StatusEvent) error {
+	if r.resync.Swap(false) {
+		return ErrResyncRequired
+	}
+
+	req := &agentpb.ReportRequest{Event: agentpb.EventToProto(event)}
+	if r.signer != nil {
+		payload, err := agentpb.EventPayload(req.Event)
+		if err != nil {
+			return err
+		}
+		sig, err := signing.Sign(r.signer, payload)
+		if err != nil {
+			return err
+		}
+		req.Signature = agentpb.SignatureToProto(sig)
+	}
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(r.subject(natsbus.KindStatus))
+	msg.Header.Set(natsbus.AgentHeader, r.agentID)
+	msg.Data = data
+	// The report is stored once acknowledged by JetStream, even if the
+	// control plane is down.
+	_, err = r.js.PublishMsg(ctx, msg)
+	return err
+}
+
+// Run answers commands and resync requests until ctx is cancelled.
+func (r *NATSReporter) Run(ctx context.Context) {
+	resync, err := r.nc.Subscribe(r.subject(natsbus.KindResync), func(*nats.Msg) {
+		r.resync.Store(true)
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to subscribe to NATS resync requests")
+		return
+	}
+	defer resync.Unsubscribe()
+
+	commands, err := r.nc.Subscribe(r.subject(natsbus.KindCommands), func(msg *nats.Msg) {
+		go r.handleCommand(ctx, msg)
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to subscribe to NATS commands")
+		return
+	}
+	defer commands.Unsubscribe()
+
+	// Connections established from now on are announced by the handlers.
+	r.serving.Store(true)
+	if r.nc.IsConnected() {
+		r.hello()
+	}
+	<-ctx.Done()
+	r.serving.Store(false)
+}
+
+func (r *NATSReporter) handleCommand(ctx context.Context, msg *nats.Msg) {
+	var cmd agentpb.Command
+	result := models.CommandResult{Error: "agent does not accept commands"}
+	if err := proto.Unmarshal(msg.Data, &cmd); err != nil {
+		result = models.CommandResult{Error: "invalid command"}
+	} else if r.onCommand != nil {
+		result = r.onCommand(ctx, agentpb.CommandFromProto(&cmd))
+	}
+
+	data, err := proto.Marshal(agentpb.ResultToProto(cmd.GetId(), result))
+	if err == nil {
+		err = msg.Respond(data)
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("command", cmd.GetName()).Msg("failed to send command result")
+	}
+}
+
+// Close drains the connection.
+func (r *NATSReporter) Close() error {
+	return r.nc.Drain()
+}
@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/netip"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoIP looks up countries in a local MaxMind (GeoLite2 or GeoIP2) country
+// or city database. Addresses never leave the machine.
+type GeoIP struct {
+	db *maxminddb.Reader
+}
+
+// OpenGeoIP opens the database at path.
+func OpenGeoIP(path string) (*GeoIP, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &GeoIP{db: db}, nil
+}
+
+// Country returns the ISO 3166-1 country code of addr, or "" if unknown.
+func (g *GeoIP) Country(addr netip.Addr) string {
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+	if err := g.db.Lookup(net.IP(addr.AsSlice()), &record); err != nil {
+		return ""
+	}
+	return record.Country.ISOCode
+}
+
+func (g *GeoIP) Close() error {
+	return g.db.Close()
+}
+
+// endpointRedactor rewrites peer endpoints according to an endpoint policy
+// before they are reported.
+type endpointRedactor struct {
+	policy string
+	salt   []byte
+	geo    *GeoIP
+}
+
+// newRedactor returns the redactor for policy. Endpoints are dropped under the
+// hash policy until the control plane sent the organization's salt.
+func (a *Agent) newRedactor(policy, salt string) (endpointRedactor, error) {
+	switch policy {
+	case "":
+		policy = models.EndpointKeep
+	case models.EndpointHash:
+		if salt == "" {
+			policy = models.EndpointDrop
+		}
+	case models.EndpointCountry:
+		if a.geo == nil {
+			return endpointRedactor{}, errors.New("the country endpoint policy requires a GeoIP database on the agent")
+		}
+	}
+	return endpointRedactor{policy: policy, salt: []byte(salt), geo: a.geo}, nil
+}
+
+// redact returns the reportable form of a peer endpoint. Endpoints that
+// cannot be parsed are dropped.
+func (r endpointRedactor) redact(endpoint string) string {
+	if r.policy == models.EndpointKeep || endpoint == "" {
+		return endpoint
+	}
+	ap, err := netip.ParseAddrPort(endpoint)
+	if err != nil {
+		return ""
+	}
+	addr := ap.Addr().Unmap()
+
+	switch r.policy {
+	case models.EndpointTruncate:
+		bits := 24
+		if addr.Is6() {
+			bits = 48
+		}
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			return ""
+		}
+		return prefix.String()
+	case models.EndpointHash:
+		mac := hmac.New(sha256.New, r.salt)
+		mac.Write(addr.AsSlice())
+		return hex.EncodeToString(mac.Sum(nil)[:16])
+	case models.EndpointCountry:
+		return r.geo.Country(addr)
+	default:
+		return ""
+	}
+}
+
+// redactStatus returns a copy of status with redacted peer endpoints and the
+// policy recorded.
+func (r endpointRedactor) redactStatus(status *models.Status) *models.Status {
+	out := *status
+	out.EndpointPolicy = r.policy
+	if r.policy == models.EndpointKeep {
+		return &out
+	}
+	out.Peers = make([]models.Peer, len(status.Peers))
+	for i, p := range status.Peers {
+		p.Endpoint = r.redact(p.Endpoint)
+		out.Peers[i] = p
+	}
+	return &out
+}
@@ -0,0 +1,189 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// localDefaults are the settings the agent was started with.
+type localDefaults struct {
+	pollInterval   time.Duration
+	logLevel       zerolog.Level
+	interfaces     []string
+	endpointPolicy string
+}
+
+// enabledCollectors returns the set of collectors to run. All are enabled if
+// names is empty.
+func enabledCollectors(names []string) map[string]bool {
+	if len(names) == 0 {
+		names = models.Collectors
+	}
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+func (a *Agent) interval() time.Duration {
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+	return a.pollInterval
+}
+
+func (a *Agent) endpointRedactor() endpointRedactor {
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+	return a.redactor
+}
+
+func (a *Agent) collectorEnabled(name string) bool {
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+	return a.collectors[name]
+}
+
+// ApplyConfig applies a remote configuration without restarting. Unset fields
+// fall back to the local defaults. An invalid configuration is rejected as a
+// whole and the running configuration stays in place.
+func (a *Agent) ApplyConfig(update models.ConfigUpdate) error {
+	cfg := update.Config
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	a.configMu.RLock()
+	defaults := a.defaults
+	a.configMu.RUnlock()
+
+	level := defaults.logLevel
+	if cfg.LogLevel != "" {
+		l, err := zerolog.ParseLevel(cfg.LogLevel)
+		if err != nil {
+			return err
+		}
+		level = l
+	}
+	policy := defaults.endpointPolicy
+	if cfg.EndpointPolicy != "" {
+		policy = cfg.EndpointPolicy
+	}
+	redactor, err := a.newRedactor(policy, update.EndpointSalt)
+	if err != nil {
+		return err
+	}
+
+	// Interfaces are applied first since they may fail.
+	if a.wg == nil {
+		if len(cfg.Interfaces) > 0 {
+			return errors.New("wireguard is not available on this agent")
+		}
+	} else {
+		ifaces := cfg.Interfaces
+		if len(ifaces) == 0 {
+			ifaces = defaults.interfaces
+		}
+		if !slices.Equal(ifaces, a.wg.Interfaces()) {
+			if err := a.wg.SetInterfaces(ifaces); err != nil {
+				return err
+			}
+		}
+	}
+
+	interval := defaults.pollInterval
+	if cfg.PollInterval > 0 {
+		interval = time.Duration(cfg.PollInterval) * time.Second
+	}
+
+	a.configMu.Lock()
+	a.pollInterval = interval
+	a.collectors = enabledCollectors(cfg.Collectors)
+	a.redactor = redactor
+	a.configVersion = update.Version
+	a.remote = &update
+	a.configMu.Unlock()
+	zerolog.SetGlobalLevel(level)
+
+	a.notifyReconfigured()
+	log.Info().Str("version", update.Version).Dur("poll_interval", interval).Str("endpoint_policy", redactor.policy).Msg("remote config applied")
+	return nil
+}
+
+// SetLocalDefaults replaces the settings the agent was started with, as on a
+// configuration file reload. Values set by the remote configuration keep
+// precedence.
+func (a *Agent) SetLocalDefaults(pollInterval time.Duration, level zerolog.Level) error {
+	a.configMu.Lock()
+	previous := a.defaults
+	a.defaults.pollInterval = pollInterval
+	a.defaults.logLevel = level
+	remote := a.remote
+	if remote == nil {
+		a.pollInterval = pollInterval
+	}
+	a.configMu.Unlock()
+
+	if remote != nil {
+		if err := a.ApplyConfig(*remote); err != nil {
+			a.configMu.Lock()
+			a.defaults = previous
+			a.configMu.Unlock()
+			return err
+		}
+		return nil
+	}
+	zerolog.SetGlobalLevel(level)
+	a.notifyReconfigured()
+	return nil
+}
+
+// notifyReconfigured wakes Run to pick up a new poll interval.
+func (a *Agent) notifyReconfigured() {
+	select {
+	case a.reconfigured <- struct{}{}:
+	default:
+	}
+}
+
+// effectiveConfig returns the configuration the agent currently runs with.
+func (a *Agent) effectiveConfig() (models.AgentConfig, string) {
+	a.configMu.RLock()
+	cfg := models.AgentConfig{
+		PollInterval:   int(a.pollInterval / time.Second),
+		LogLevel:       zerolog.GlobalLevel().String(),
+		EndpointPolicy: a.redactor.policy,
+	}
+	for _, name := range models.Collectors {
+		if a.collectors[name] {
+			cfg.Collectors = append(cfg.Collectors, name)
+		}
+	}
+	version := a.configVersion
+	a.configMu.RUnlock()
+
+	if a.wg != nil {
+		cfg.Interfaces = a.wg.Interfaces()
+	}
+	return cfg, version
+}
+
+// applyConfig is the config.apply command. It answers with the effective config.
+func (a *Agent) applyConfig(ctx context.Context, payload json.RawMessage) (any, error) {
+	var update models.ConfigUpdate
+	if err := json.Unmarshal(payload, &update); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if err := a.ApplyConfig(update); err != nil {
+		return nil, err
+	}
+	cfg, version := a.effectiveConfig()
+	return models.ConfigUpdate{Version: version, Config: cfg}, nil
+}
@@ -3,34 +3,46 @@ package agent
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/ChronoCoders/sentra/internal/control"
 	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/ChronoCoders/sentra/internal/signing"
 	"github.com/rs/zerolog/log"
 )
 
+// ErrResyncRequired is returned by a Reporter when the control plane could not
+// apply a delta report and needs a full snapshot.
+var ErrResyncRequired = errors.New("control plane requested full resync")
+
 // Reporter defines how the agent reports status to the control plane.
 type Reporter interface {
 	Report(ctx context.Context, event models.StatusEvent) error
 }
 
-// EventBusReporter reports status to a local EventBus (for single-server mode).
-type EventBusReporter struct {
-	bus *control.EventBus
+// CacheReporter reports status to the local status cache (for single-server
+// mode).
+type CacheReporter struct {
+	cache *control.StatusCache
 }
 
-func NewEventBusReporter(bus *control.EventBus) *EventBusReporter {
-	return &EventBusReporter{bus: bus}
+func NewCacheReporter(cache *control.StatusCache) *CacheReporter {
+	return &CacheReporter{cache: cache}
 }
 
-func (r *EventBusReporter) Report(ctx context.Context, event models.StatusEvent) error {
-	r.bus.Publish(event)
-	return nil
+func (r *CacheReporter) Report(ctx context.Context, event models.StatusEvent) error {
+	err := r.cache.Ingest(event)
+	if errors.Is(err, control.ErrResyncRequired) {
+		return ErrResyncRequired
+	}
+	return err
 }
 
 // HTTPReporter reports status to a remote Control Plane via HTTP.
@@ -38,22 +50,42 @@ type HTTPReporter struct {
 	serverURL string
 	token     string
 	client    *http.Client
+	signer    ed25519.PrivateKey
 }
 
 func NewHTTPReporter(serverURL, token string, insecure bool) *HTTPReporter {
-	tr := http.DefaultTransport.(*http.Transport).Clone()
+	var tlsConfig *tls.Config
 	if insecure {
-		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
 		log.Info().Msg("insecure mode enabled: skipping TLS verification")
 	}
+	return NewHTTPReporterWithTLS(serverURL, token, tlsConfig)
+}
 
+// NewHTTPReporterWithTLS creates a reporter with a custom TLS configuration,
+// e.g. one presenting a client certificate. token may be empty.
+func NewHTTPReporterWithTLS(serverURL, token string, tlsConfig *tls.Config) *HTTPReporter {
 	return &HTTPReporter{
 		serverURL: serverURL,
 		token:     token,
-		client: &http.Client{
-			Timeout:   5 * time.Second,
-			Transport: tr,
-		},
+		client:    newHTTPClient(tlsConfig),
+	}
+}
+
+// SetSigner makes the reporter sign every report with key.
+func (r *HTTPReporter) SetSigner(key ed25519.PrivateKey) {
+	r.signer = key
+}
+
+func newHTTPClient(tlsConfig *tls.Config) *http.Client {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		tr.TLSClientConfig = tlsConfig
+	}
+
+	return &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: tr,
 	}
 }
 
@@ -73,6 +105,15 @@ func (r *HTTPReporter) Report(ctx context.Context, event models.StatusEvent) err
 	if r.token != "" {
 		req.Header.Set("Authorization", "Bearer "+r.token)
 	}
+	if r.signer != nil {
+		sig, err := signing.Sign(r.signer, data)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("X-Sentra-Timestamp", strconv.FormatInt(sig.Timestamp, 10))
+		req.Header.Set("X-Sentra-Nonce", sig.Nonce)
+		req.Header.Set("X-Sentra-Signature", sig.Signature)
+	}
 
 	resp, err := r.client.Do(req)
 	if err != nil {
@@ -80,6 +121,10 @@ func (r *HTTPReporter) Report(ctx context.Context, event models.StatusEvent) err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusConflict {
+		return ErrResyncRequired
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("server returned status: %d", resp.StatusCode)
 	}
@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+// WriterReporter writes every report as a JSON line to w, e.g. os.Stdout.
+type WriterReporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterReporter(w io.Writer) *WriterReporter {
+	return &WriterReporter{w: w}
+}
+
+func (r *WriterReporter) Report(ctx context.Context, event models.StatusEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err = r.w.Write(append(line, '\n'))
+	return err
+}
+
+// FileReporter appends every report as a JSON line to a file. Once the file
+// exceeds maxSize bytes it is rotated to path.1, path.1 to path.2 and so on,
+// keeping at most backups old files.
+type FileReporter struct {
+	path    string
+	maxSize int64
+	backups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewFileReporter opens path for appending.
+func NewFileReporter(path string, maxSize int64, backups int) (*FileReporter, error) {
+	r := &FileReporter{path: path, maxSize: maxSize, backups: backups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *FileReporter) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, info.Size()
+	return nil
+}
+
+func (r *FileReporter) Report(ctx context.Context, event models.StatusEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		// A previous rotation failed to reopen the file.
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(line)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return fmt.Errorf("failed to rotate %s: %w", r.path, err)
+		}
+	}
+	n, err := r.file.Write(line)
+	r.size += int64(n)
+	return err
+}
+
+// rotate shifts the backups by one and starts a new file.
+func (r *FileReporter) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	r.file = nil
+
+	if r.backups <= 0 {
+		if err := os.Remove(r.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return r.open()
+	}
+	for i := r.backups - 1; i >= 1; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+// Close closes the file.
+func (r *FileReporter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
@@ -0,0 +1,33 @@
+//go:build !windows && !plan9
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"log/syslog"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+// SyslogReporter sends every report as a JSON message to the local syslog daemon.
+type SyslogReporter struct {
+	w *syslog.Writer
+}
+
+// NewSyslogReporter connects to the local syslog daemon with tag.
+func NewSyslogReporter(tag string) (*SyslogReporter, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogReporter{w: w}, nil
+}
+
+func (r *SyslogReporter) Report(ctx context.Context, event models.StatusEvent) error {
+	msg, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return r.w.Info(string(msg))
+}
@@ -0,0 +1,21 @@
+//go:build windows || plan9
+
+package agent
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+// SyslogReporter is not available on this platform.
+type SyslogReporter struct{}
+
+func NewSyslogReporter(tag string) (*SyslogReporter, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
+
+func (r *SyslogReporter) Report(ctx context.Context, event models.StatusEvent) error {
+	return errors.New("syslog is not supported on this platform")
+}
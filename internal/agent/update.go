@@ -0,0 +1,291 @@
+package agent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/ChronoCoders/sentra/internal/signing"
+	"github.com/ChronoCoders/sentra/internal/version"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// maxUpdateAttempts is how often a new version may start without
+	// confirming before it is rolled back.
+	maxUpdateAttempts = 3
+	// restartDelay leaves time to send the command result before re-exec.
+	restartDelay = 2 * time.Second
+)
+
+// updateState is persisted while an update is being tried and after a rollback.
+type updateState struct {
+	// Version is the version being tried, empty once confirmed or rolled back.
+	Version   string    `json:"version,omitempty"`
+	Previous  string    `json:"previous,omitempty"`
+	RolloutID string    `json:"rollout_id,omitempty"`
+	Deadline  time.Time `json:"deadline"`
+	Attempts  int       `json:"attempts,omitempty"`
+	// RolledBackFrom is the version that failed and was rolled back.
+	RolledBackFrom string `json:"rolled_back_from,omitempty"`
+}
+
+// Updater replaces the agent binary with a release from the control plane.
+// Releases must be signed with the release key. A new version has to report
+// successfully before its deadline, otherwise the previous binary is restored.
+type Updater struct {
+	serverURL string
+	token     string
+	client    *http.Client
+	publicKey ed25519.PublicKey
+	binary    string
+	stateFile string
+	deadline  time.Duration
+
+	mu         sync.Mutex
+	state      updateState
+	timer      *time.Timer
+	installing bool
+}
+
+func NewUpdater(serverURL, token string, tlsConfig *tls.Config, publicKey ed25519.PublicKey, stateFile string, deadline time.Duration) (*Updater, error) {
+	binary, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	if binary, err = filepath.EvalSymlinks(binary); err != nil {
+		return nil, err
+	}
+
+	client := newHTTPClient(tlsConfig)
+	client.Timeout = 0 // Downloads are bounded by the command context
+
+	return &Updater{
+		serverURL: strings.TrimRight(serverURL, "/"),
+		token:     token,
+		client:    client,
+		publicKey: publicKey,
+		binary:    binary,
+		stateFile: stateFile,
+		deadline:  deadline,
+	}, nil
+}
+
+// Start resumes an update in progress. If this is a new version on trial it
+// is rolled back when it does not confirm in time or keeps restarting.
+func (u *Updater) Start() error {
+	data, err := os.ReadFile(u.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := json.Unmarshal(data, &u.state); err != nil {
+		return fmt.Errorf("invalid update state %s: %w", u.stateFile, err)
+	}
+	if u.state.Version == "" {
+		return nil
+	}
+	if u.state.Version != version.Version {
+		log.Warn().Str("expected", u.state.Version).Str("running", version.Version).Msg("update did not start the new version")
+		u.state = updateState{RolledBackFrom: u.state.Version}
+		return u.saveLocked()
+	}
+
+	u.state.Attempts++
+	if u.state.Attempts > maxUpdateAttempts || time.Now().After(u.state.Deadline) {
+		u.rollbackLocked("new version did not confirm in time")
+		return nil
+	}
+	if err := u.saveLocked(); err != nil {
+		return err
+	}
+
+	log.Info().Str("version", u.state.Version).Time("deadline", u.state.Deadline).Msg("trying new agent version")
+	u.timer = time.AfterFunc(time.Until(u.state.Deadline), func() {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		if u.state.Version != "" {
+			u.rollbackLocked("new version did not report before the deadline")
+		}
+	})
+	return nil
+}
+
+// Confirm marks a version on trial as good. It is called after every
+// successful report.
+func (u *Updater) Confirm() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.state.Version == "" {
+		return
+	}
+	if u.timer != nil {
+		u.timer.Stop()
+	}
+	log.Info().Str("version", u.state.Version).Str("previous", u.state.Previous).Msg("agent update confirmed")
+	u.state = updateState{}
+	if err := u.saveLocked(); err != nil {
+		log.Error().Err(err).Msg("failed to save update state")
+	}
+	os.Remove(u.binary + ".bak")
+}
+
+// RolledBackFrom returns the version of the last failed update, if any.
+func (u *Updater) RolledBackFrom() string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.state.RolledBackFrom
+}
+
+// handleUpdate is the agent.update command.
+func (u *Updater) handleUpdate(ctx context.Context, payload json.RawMessage) (any, error) {
+	var req models.UpdateRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, fmt.Errorf("invalid update request: %w", err)
+	}
+	if req.Version == version.Version {
+		return nil, fmt.Errorf("agent already runs version %s", req.Version)
+	}
+	// Refuse before downloading anything not signed with the release key.
+	if err := signing.VerifyRelease(u.publicKey, req.Version, runtime.GOOS, runtime.GOARCH, req.SHA256, req.Signature); err != nil {
+		return nil, err
+	}
+
+	u.mu.Lock()
+	if u.state.Version != "" || u.installing {
+		u.mu.Unlock()
+		return nil, errors.New("another update is in progress")
+	}
+	u.installing = true
+	u.mu.Unlock()
+
+	staged := u.binary + ".new"
+	err := u.download(ctx, req.URL, staged, req.SHA256)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.installing = false
+	if err != nil {
+		os.Remove(staged)
+		return nil, err
+	}
+
+	backup := u.binary + ".bak"
+	if err := os.Rename(u.binary, backup); err != nil {
+		os.Remove(staged)
+		return nil, fmt.Errorf("failed to back up current binary: %w", err)
+	}
+	if err := os.Rename(staged, u.binary); err != nil {
+		os.Rename(backup, u.binary)
+		os.Remove(staged)
+		return nil, fmt.Errorf("failed to install new binary: %w", err)
+	}
+
+	u.state = updateState{
+		Version:   req.Version,
+		Previous:  version.Version,
+		RolloutID: req.RolloutID,
+		Deadline:  time.Now().Add(u.deadline),
+	}
+	if err := u.saveLocked(); err != nil {
+		os.Rename(backup, u.binary)
+		u.state = updateState{}
+		return nil, fmt.Errorf("failed to save update state: %w", err)
+	}
+
+	log.Info().Str("version", req.Version).Str("previous", version.Version).Msg("agent binary replaced, restarting")
+	time.AfterFunc(restartDelay, u.restart)
+	return map[string]string{"version": req.Version, "status": "restarting"}, nil
+}
+
+// download fetches the release at path into dest and checks its checksum.
+func (u *Updater) download(ctx context.Context, path, dest, sha256Hex string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u.serverURL+path, nil)
+	if err != nil {
+		return err
+	}
+	if u.token != "" {
+		req.Header.Set("Authorization", "Bearer "+u.token)
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("release download failed: %s", resp.Status)
+	}
+
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), resp.Body); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, sha256Hex) {
+		return fmt.Errorf("release checksum mismatch: got %s", sum)
+	}
+	return nil
+}
+
+// rollbackLocked restores the previous binary and restarts into it.
+func (u *Updater) rollbackLocked(reason string) {
+	failed := u.state.Version
+	log.Error().Str("version", failed).Str("previous", u.state.Previous).Str("reason", reason).Msg("rolling back agent update")
+
+	if err := os.Rename(u.binary+".bak", u.binary); err != nil {
+		log.Error().Err(err).Msg("failed to restore previous agent binary")
+		return
+	}
+	u.state = updateState{RolledBackFrom: failed}
+	if err := u.saveLocked(); err != nil {
+		log.Error().Err(err).Msg("failed to save update state")
+	}
+	u.restart()
+}
+
+// restart replaces the running process with the installed binary.
+func (u *Updater) restart() {
+	if err := syscall.Exec(u.binary, os.Args, os.Environ()); err != nil {
+		log.Error().Err(err).Msg("failed to restart agent")
+	}
+}
+
+func (u *Updater) saveLocked() error {
+	data, err := json.MarshalIndent(u.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := u.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, u.stateFile)
+}
@@ -0,0 +1,1237 @@
+// Agent protocol of the Sentra control plane.
+//
+// Agents authenticate with their enrollment credential in the "authorization"
+// metadata ("Bearer <credential>") or with a client certificate issued by the
+// control plane CA.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: sentra/agent/v1/agent.proto
+
+package agentpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ReportRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Event         *StatusEvent           `protobuf:"bytes,1,opt,name=event,proto3" json:"event,omitempty"`
+	Signature     *ReportSignature       `protobuf:"bytes,2,opt,name=signature,proto3" json:"signature,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReportRequest) Reset() {
+	*x = ReportRequest{}
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReportRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReportRequest) ProtoMessage() {}
+
+func (x *ReportRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReportRequest.ProtoReflect.Descriptor instead.
+func (*ReportRequest) Descriptor() ([]byte, []int) {
+	return file_sentra_agent_v1_agent_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ReportRequest) GetEvent() *StatusEvent {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *ReportRequest) GetSignature() *ReportSignature {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+type ReportSummary struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Accepted      uint64                 `protobuf:"varint,1,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReportSummary) Reset() {
+	*x = ReportSummary{}
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReportSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReportSummary) ProtoMessage() {}
+
+func (x *ReportSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReportSummary.ProtoReflect.Descriptor instead.
+func (*ReportSummary) Descriptor() ([]byte, []int) {
+	return file_sentra_agent_v1_agent_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ReportSummary) GetAccepted() uint64 {
+	if x != nil {
+		return x.Accepted
+	}
+	return 0
+}
+
+type ReportSignature struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Unix seconds.
+	Timestamp int64  `protobuf:"varint,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Nonce     string `protobuf:"bytes,2,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	// Base64 Ed25519 signature over the deterministic encoding of the event.
+	Signature     string `protobuf:"bytes,3,opt,name=signature,proto3" json:"signature,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReportSignature) Reset() {
+	*x = ReportSignature{}
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReportSignature) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReportSignature) ProtoMessage() {}
+
+func (x *ReportSignature) ProtoReflect() protoreflect.Message {
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReportSignature.ProtoReflect.Descriptor instead.
+func (*ReportSignature) Descriptor() ([]byte, []int) {
+	return file_sentra_agent_v1_agent_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ReportSignature) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *ReportSignature) GetNonce() string {
+	if x != nil {
+		return x.Nonce
+	}
+	return ""
+}
+
+func (x *ReportSignature) GetSignature() string {
+	if x != nil {
+		return x.Signature
+	}
+	return ""
+}
+
+type StatusEvent struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	ServerId   string                 `protobuf:"bytes,1,opt,name=server_id,json=serverId,proto3" json:"server_id,omitempty"`
+	Status     *Status                `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	Time       *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=time,proto3" json:"time,omitempty"`
+	AgentId    string                 `protobuf:"bytes,4,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	Attributes map[string]string      `protobuf:"bytes,5,rep,name=attributes,proto3" json:"attributes,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Only sent with full snapshots.
+	Agent *AgentInfo `protobuf:"bytes,6,opt,name=agent,proto3" json:"agent,omitempty"`
+	Seq   uint64     `protobuf:"varint,7,opt,name=seq,proto3" json:"seq,omitempty"`
+	// A delta only carries added or changed peers and the keys of removed ones.
+	Delta         bool     `protobuf:"varint,8,opt,name=delta,proto3" json:"delta,omitempty"`
+	RemovedPeers  []string `protobuf:"bytes,9,rep,name=removed_peers,json=removedPeers,proto3" json:"removed_peers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatusEvent) Reset() {
+	*x = StatusEvent{}
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatusEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatusEvent) ProtoMessage() {}
+
+func (x *StatusEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatusEvent.ProtoReflect.Descriptor instead.
+func (*StatusEvent) Descriptor() ([]byte, []int) {
+	return file_sentra_agent_v1_agent_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *StatusEvent) GetServerId() string {
+	if x != nil {
+		return x.ServerId
+	}
+	return ""
+}
+
+func (x *StatusEvent) GetStatus() *Status {
+	if x != nil {
+		return x.Status
+	}
+	return nil
+}
+
+func (x *StatusEvent) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *StatusEvent) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *StatusEvent) GetAttributes() map[string]string {
+	if x != nil {
+		return x.Attributes
+	}
+	return nil
+}
+
+func (x *StatusEvent) GetAgent() *AgentInfo {
+	if x != nil {
+		return x.Agent
+	}
+	return nil
+}
+
+func (x *StatusEvent) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *StatusEvent) GetDelta() bool {
+	if x != nil {
+		return x.Delta
+	}
+	return false
+}
+
+func (x *StatusEvent) GetRemovedPeers() []string {
+	if x != nil {
+		return x.RemovedPeers
+	}
+	return nil
+}
+
+type Status struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Interface  string                 `protobuf:"bytes,1,opt,name=interface,proto3" json:"interface,omitempty"`
+	PublicKey  string                 `protobuf:"bytes,2,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"`
+	ListenPort int32                  `protobuf:"varint,3,opt,name=listen_port,json=listenPort,proto3" json:"listen_port,omitempty"`
+	Interfaces []*InterfaceStatus     `protobuf:"bytes,4,rep,name=interfaces,proto3" json:"interfaces,omitempty"`
+	Peers      []*Peer                `protobuf:"bytes,5,rep,name=peers,proto3" json:"peers,omitempty"`
+	System     *SystemInfo            `protobuf:"bytes,6,opt,name=system,proto3" json:"system,omitempty"`
+	// How peer endpoints were redacted, empty if they were not.
+	EndpointPolicy string `protobuf:"bytes,7,opt,name=endpoint_policy,json=endpointPolicy,proto3" json:"endpoint_policy,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Status) Reset() {
+	*x = Status{}
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Status) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Status) ProtoMessage() {}
+
+func (x *Status) ProtoReflect() protoreflect.Message {
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Status.ProtoReflect.Descriptor instead.
+func (*Status) Descriptor() ([]byte, []int) {
+	return file_sentra_agent_v1_agent_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Status) GetInterface() string {
+	if x != nil {
+		return x.Interface
+	}
+	return ""
+}
+
+func (x *Status) GetPublicKey() string {
+	if x != nil {
+		return x.PublicKey
+	}
+	return ""
+}
+
+func (x *Status) GetListenPort() int32 {
+	if x != nil {
+		return x.ListenPort
+	}
+	return 0
+}
+
+func (x *Status) GetInterfaces() []*InterfaceStatus {
+	if x != nil {
+		return x.Interfaces
+	}
+	return nil
+}
+
+func (x *Status) GetPeers() []*Peer {
+	if x != nil {
+		return x.Peers
+	}
+	return nil
+}
+
+func (x *Status) GetSystem() *SystemInfo {
+	if x != nil {
+		return x.System
+	}
+	return nil
+}
+
+func (x *Status) GetEndpointPolicy() string {
+	if x != nil {
+		return x.EndpointPolicy
+	}
+	return ""
+}
+
+type InterfaceStatus struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	PublicKey     string                 `protobuf:"bytes,2,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"`
+	ListenPort    int32                  `protobuf:"varint,3,opt,name=listen_port,json=listenPort,proto3" json:"listen_port,omitempty"`
+	PeerCount     int32                  `protobuf:"varint,4,opt,name=peer_count,json=peerCount,proto3" json:"peer_count,omitempty"`
+	Error         string                 `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InterfaceStatus) Reset() {
+	*x = InterfaceStatus{}
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InterfaceStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InterfaceStatus) ProtoMessage() {}
+
+func (x *InterfaceStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InterfaceStatus.ProtoReflect.Descriptor instead.
+func (*InterfaceStatus) Descriptor() ([]byte, []int) {
+	return file_sentra_agent_v1_agent_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *InterfaceStatus) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *InterfaceStatus) GetPublicKey() string {
+	if x != nil {
+		return x.PublicKey
+	}
+	return ""
+}
+
+func (x *InterfaceStatus) GetListenPort() int32 {
+	if x != nil {
+		return x.ListenPort
+	}
+	return 0
+}
+
+func (x *InterfaceStatus) GetPeerCount() int32 {
+	if x != nil {
+		return x.PeerCount
+	}
+	return 0
+}
+
+func (x *InterfaceStatus) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type Peer struct {
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	Interface           string                 `protobuf:"bytes,1,opt,name=interface,proto3" json:"interface,omitempty"`
+	PublicKey           string                 `protobuf:"bytes,2,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"`
+	Endpoint            string                 `protobuf:"bytes,3,opt,name=endpoint,proto3" json:"endpoint,omitempty"`
+	AllowedIps          []string               `protobuf:"bytes,4,rep,name=allowed_ips,json=allowedIps,proto3" json:"allowed_ips,omitempty"`
+	LatestHandshake     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=latest_handshake,json=latestHandshake,proto3" json:"latest_handshake,omitempty"`
+	ReceiveBytes        int64                  `protobuf:"varint,6,opt,name=receive_bytes,json=receiveBytes,proto3" json:"receive_bytes,omitempty"`
+	TransmitBytes       int64                  `protobuf:"varint,7,opt,name=transmit_bytes,json=transmitBytes,proto3" json:"transmit_bytes,omitempty"`
+	PersistentKeepalive int32                  `protobuf:"varint,8,opt,name=persistent_keepalive,json=persistentKeepalive,proto3" json:"persistent_keepalive,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *Peer) Reset() {
+	*x = Peer{}
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Peer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Peer) ProtoMessage() {}
+
+func (x *Peer) ProtoReflect() protoreflect.Message {
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Peer.ProtoReflect.Descriptor instead.
+func (*Peer) Descriptor() ([]byte, []int) {
+	return file_sentra_agent_v1_agent_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Peer) GetInterface() string {
+	if x != nil {
+		return x.Interface
+	}
+	return ""
+}
+
+func (x *Peer) GetPublicKey() string {
+	if x != nil {
+		return x.PublicKey
+	}
+	return ""
+}
+
+func (x *Peer) GetEndpoint() string {
+	if x != nil {
+		return x.Endpoint
+	}
+	return ""
+}
+
+func (x *Peer) GetAllowedIps() []string {
+	if x != nil {
+		return x.AllowedIps
+	}
+	return nil
+}
+
+func (x *Peer) GetLatestHandshake() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LatestHandshake
+	}
+	return nil
+}
+
+func (x *Peer) GetReceiveBytes() int64 {
+	if x != nil {
+		return x.ReceiveBytes
+	}
+	return 0
+}
+
+func (x *Peer) GetTransmitBytes() int64 {
+	if x != nil {
+		return x.TransmitBytes
+	}
+	return 0
+}
+
+func (x *Peer) GetPersistentKeepalive() int32 {
+	if x != nil {
+		return x.PersistentKeepalive
+	}
+	return 0
+}
+
+type SystemInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Hostname      string                 `protobuf:"bytes,1,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	Os            string                 `protobuf:"bytes,2,opt,name=os,proto3" json:"os,omitempty"`
+	Arch          string                 `protobuf:"bytes,3,opt,name=arch,proto3" json:"arch,omitempty"`
+	KernelVersion string                 `protobuf:"bytes,4,opt,name=kernel_version,json=kernelVersion,proto3" json:"kernel_version,omitempty"`
+	Platform      string                 `protobuf:"bytes,5,opt,name=platform,proto3" json:"platform,omitempty"`
+	CpuCount      int32                  `protobuf:"varint,6,opt,name=cpu_count,json=cpuCount,proto3" json:"cpu_count,omitempty"`
+	CpuPercent    float64                `protobuf:"fixed64,7,opt,name=cpu_percent,json=cpuPercent,proto3" json:"cpu_percent,omitempty"`
+	MemoryTotal   uint64                 `protobuf:"varint,8,opt,name=memory_total,json=memoryTotal,proto3" json:"memory_total,omitempty"`
+	MemoryUsed    uint64                 `protobuf:"varint,9,opt,name=memory_used,json=memoryUsed,proto3" json:"memory_used,omitempty"`
+	MemoryPercent float64                `protobuf:"fixed64,10,opt,name=memory_percent,json=memoryPercent,proto3" json:"memory_percent,omitempty"`
+	DiskTotal     uint64                 `protobuf:"varint,11,opt,name=disk_total,json=diskTotal,proto3" json:"disk_total,omitempty"`
+	DiskUsed      uint64                 `protobuf:"varint,12,opt,name=disk_used,json=diskUsed,proto3" json:"disk_used,omitempty"`
+	DiskPercent   float64                `protobuf:"fixed64,13,opt,name=disk_percent,json=diskPercent,proto3" json:"disk_percent,omitempty"`
+	LoadAverage   float64                `protobuf:"fixed64,14,opt,name=load_average,json=loadAverage,proto3" json:"load_average,omitempty"`
+	Uptime        uint64                 `protobuf:"varint,15,opt,name=uptime,proto3" json:"uptime,omitempty"`
+	NetBytesSent  uint64                 `protobuf:"varint,16,opt,name=net_bytes_sent,json=netBytesSent,proto3" json:"net_bytes_sent,omitempty"`
+	NetBytesRecv  uint64                 `protobuf:"varint,17,opt,name=net_bytes_recv,json=netBytesRecv,proto3" json:"net_bytes_recv,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SystemInfo) Reset() {
+	*x = SystemInfo{}
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SystemInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SystemInfo) ProtoMessage() {}
+
+func (x *SystemInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SystemInfo.ProtoReflect.Descriptor instead.
+func (*SystemInfo) Descriptor() ([]byte, []int) {
+	return file_sentra_agent_v1_agent_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SystemInfo) GetHostname() string {
+	if x != nil {
+		return x.Hostname
+	}
+	return ""
+}
+
+func (x *SystemInfo) GetOs() string {
+	if x != nil {
+		return x.Os
+	}
+	return ""
+}
+
+func (x *SystemInfo) GetArch() string {
+	if x != nil {
+		return x.Arch
+	}
+	return ""
+}
+
+func (x *SystemInfo) GetKernelVersion() string {
+	if x != nil {
+		return x.KernelVersion
+	}
+	return ""
+}
+
+func (x *SystemInfo) GetPlatform() string {
+	if x != nil {
+		return x.Platform
+	}
+	return ""
+}
+
+func (x *SystemInfo) GetCpuCount() int32 {
+	if x != nil {
+		return x.CpuCount
+	}
+	return 0
+}
+
+func (x *SystemInfo) GetCpuPercent() float64 {
+	if x != nil {
+		return x.CpuPercent
+	}
+	return 0
+}
+
+func (x *SystemInfo) GetMemoryTotal() uint64 {
+	if x != nil {
+		return x.MemoryTotal
+	}
+	return 0
+}
+
+func (x *SystemInfo) GetMemoryUsed() uint64 {
+	if x != nil {
+		return x.MemoryUsed
+	}
+	return 0
+}
+
+func (x *SystemInfo) GetMemoryPercent() float64 {
+	if x != nil {
+		return x.MemoryPercent
+	}
+	return 0
+}
+
+func (x *SystemInfo) GetDiskTotal() uint64 {
+	if x != nil {
+		return x.DiskTotal
+	}
+	return 0
+}
+
+func (x *SystemInfo) GetDiskUsed() uint64 {
+	if x != nil {
+		return x.DiskUsed
+	}
+	return 0
+}
+
+func (x *SystemInfo) GetDiskPercent() float64 {
+	if x != nil {
+		return x.DiskPercent
+	}
+	return 0
+}
+
+func (x *SystemInfo) GetLoadAverage() float64 {
+	if x != nil {
+		return x.LoadAverage
+	}
+	return 0
+}
+
+func (x *SystemInfo) GetUptime() uint64 {
+	if x != nil {
+		return x.Uptime
+	}
+	return 0
+}
+
+func (x *SystemInfo) GetNetBytesSent() uint64 {
+	if x != nil {
+		return x.NetBytesSent
+	}
+	return 0
+}
+
+func (x *SystemInfo) GetNetBytesRecv() uint64 {
+	if x != nil {
+		return x.NetBytesRecv
+	}
+	return 0
+}
+
+type AgentInfo struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Version         string                 `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	ProtocolVersion int32                  `protobuf:"varint,2,opt,name=protocol_version,json=protocolVersion,proto3" json:"protocol_version,omitempty"`
+	Capabilities    []string               `protobuf:"bytes,3,rep,name=capabilities,proto3" json:"capabilities,omitempty"`
+	GoVersion       string                 `protobuf:"bytes,4,opt,name=go_version,json=goVersion,proto3" json:"go_version,omitempty"`
+	Os              string                 `protobuf:"bytes,5,opt,name=os,proto3" json:"os,omitempty"`
+	Arch            string                 `protobuf:"bytes,6,opt,name=arch,proto3" json:"arch,omitempty"`
+	ConfigVersion   string                 `protobuf:"bytes,7,opt,name=config_version,json=configVersion,proto3" json:"config_version,omitempty"`
+	Config          *AgentConfig           `protobuf:"bytes,8,opt,name=config,proto3" json:"config,omitempty"`
+	RolledBackFrom  string                 `protobuf:"bytes,9,opt,name=rolled_back_from,json=rolledBackFrom,proto3" json:"rolled_back_from,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *AgentInfo) Reset() {
+	*x = AgentInfo{}
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AgentInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentInfo) ProtoMessage() {}
+
+func (x *AgentInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentInfo.ProtoReflect.Descriptor instead.
+func (*AgentInfo) Descriptor() ([]byte, []int) {
+	return file_sentra_agent_v1_agent_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *AgentInfo) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *AgentInfo) GetProtocolVersion() int32 {
+	if x != nil {
+		return x.ProtocolVersion
+	}
+	return 0
+}
+
+func (x *AgentInfo) GetCapabilities() []string {
+	if x != nil {
+		return x.Capabilities
+	}
+	return nil
+}
+
+func (x *AgentInfo) GetGoVersion() string {
+	if x != nil {
+		return x.GoVersion
+	}
+	return ""
+}
+
+func (x *AgentInfo) GetOs() string {
+	if x != nil {
+		return x.Os
+	}
+	return ""
+}
+
+func (x *AgentInfo) GetArch() string {
+	if x != nil {
+		return x.Arch
+	}
+	return ""
+}
+
+func (x *AgentInfo) GetConfigVersion() string {
+	if x != nil {
+		return x.ConfigVersion
+	}
+	return ""
+}
+
+func (x *AgentInfo) GetConfig() *AgentConfig {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+func (x *AgentInfo) GetRolledBackFrom() string {
+	if x != nil {
+		return x.RolledBackFrom
+	}
+	return ""
+}
+
+type AgentConfig struct {
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	PollIntervalSeconds int32                  `protobuf:"varint,1,opt,name=poll_interval_seconds,json=pollIntervalSeconds,proto3" json:"poll_interval_seconds,omitempty"`
+	Collectors          []string               `protobuf:"bytes,2,rep,name=collectors,proto3" json:"collectors,omitempty"`
+	LogLevel            string                 `protobuf:"bytes,3,opt,name=log_level,json=logLevel,proto3" json:"log_level,omitempty"`
+	Interfaces          []string               `protobuf:"bytes,4,rep,name=interfaces,proto3" json:"interfaces,omitempty"`
+	EndpointPolicy      string                 `protobuf:"bytes,5,opt,name=endpoint_policy,json=endpointPolicy,proto3" json:"endpoint_policy,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *AgentConfig) Reset() {
+	*x = AgentConfig{}
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AgentConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentConfig) ProtoMessage() {}
+
+func (x *AgentConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentConfig.ProtoReflect.Descriptor instead.
+func (*AgentConfig) Descriptor() ([]byte, []int) {
+	return file_sentra_agent_v1_agent_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *AgentConfig) GetPollIntervalSeconds() int32 {
+	if x != nil {
+		return x.PollIntervalSeconds
+	}
+	return 0
+}
+
+func (x *AgentConfig) GetCollectors() []string {
+	if x != nil {
+		return x.Collectors
+	}
+	return nil
+}
+
+func (x *AgentConfig) GetLogLevel() string {
+	if x != nil {
+		return x.LogLevel
+	}
+	return ""
+}
+
+func (x *AgentConfig) GetInterfaces() []string {
+	if x != nil {
+		return x.Interfaces
+	}
+	return nil
+}
+
+func (x *AgentConfig) GetEndpointPolicy() string {
+	if x != nil {
+		return x.EndpointPolicy
+	}
+	return ""
+}
+
+type Command struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name  string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	// JSON payload, see the HTTP API for the format of each command.
+	Payload       []byte `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Command) Reset() {
+	*x = Command{}
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Command) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Command) ProtoMessage() {}
+
+func (x *Command) ProtoReflect() protoreflect.Message {
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Command.ProtoReflect.Descriptor instead.
+func (*Command) Descriptor() ([]byte, []int) {
+	return file_sentra_agent_v1_agent_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Command) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Command) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Command) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+type CommandResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Error string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	// JSON payload.
+	Payload       []byte `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommandResult) Reset() {
+	*x = CommandResult{}
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandResult) ProtoMessage() {}
+
+func (x *CommandResult) ProtoReflect() protoreflect.Message {
+	mi := &file_sentra_agent_v1_agent_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandResult.ProtoReflect.Descriptor instead.
+func (*CommandResult) Descriptor() ([]byte, []int) {
+	return file_sentra_agent_v1_agent_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *CommandResult) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *CommandResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *CommandResult) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+var File_sentra_agent_v1_agent_proto protoreflect.FileDescriptor
+
+const file_sentra_agent_v1_agent_proto_rawDesc = "" +
+	"\n" +
+	"\x1bsentra/agent/v1/agent.proto\x12\x0fsentra.agent.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x83\x01\n" +
+	"\rReportRequest\x122\n" +
+	"\x05event\x18\x01 \x01(\v2\x1c.sentra.agent.v1.StatusEventR\x05event\x12>\n" +
+	"\tsignature\x18\x02 \x01(\v2 .sentra.agent.v1.ReportSignatureR\tsignature\"+\n" +
+	"\rReportSummary\x12\x1a\n" +
+	"\baccepted\x18\x01 \x01(\x04R\baccepted\"c\n" +
+	"\x0fReportSignature\x12\x1c\n" +
+	"\ttimestamp\x18\x01 \x01(\x03R\ttimestamp\x12\x14\n" +
+	"\x05nonce\x18\x02 \x01(\tR\x05nonce\x12\x1c\n" +
+	"\tsignature\x18\x03 \x01(\tR\tsignature\"\xb2\x03\n" +
+	"\vStatusEvent\x12\x1b\n" +
+	"\tserver_id\x18\x01 \x01(\tR\bserverId\x12/\n" +
+	"\x06status\x18\x02 \x01(\v2\x17.sentra.agent.v1.StatusR\x06status\x12.\n" +
+	"\x04time\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x19\n" +
+	"\bagent_id\x18\x04 \x01(\tR\aagentId\x12L\n" +
+	"\n" +
+	"attributes\x18\x05 \x03(\v2,.sentra.agent.v1.StatusEvent.AttributesEntryR\n" +
+	"attributes\x120\n" +
+	"\x05agent\x18\x06 \x01(\v2\x1a.sentra.agent.v1.AgentInfoR\x05agent\x12\x10\n" +
+	"\x03seq\x18\a \x01(\x04R\x03seq\x12\x14\n" +
+	"\x05delta\x18\b \x01(\bR\x05delta\x12#\n" +
+	"\rremoved_peers\x18\t \x03(\tR\fremovedPeers\x1a=\n" +
+	"\x0fAttributesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xb3\x02\n" +
+	"\x06Status\x12\x1c\n" +
+	"\tinterface\x18\x01 \x01(\tR\tinterface\x12\x1d\n" +
+	"\n" +
+	"public_key\x18\x02 \x01(\tR\tpublicKey\x12\x1f\n" +
+	"\vlisten_port\x18\x03 \x01(\x05R\n" +
+	"listenPort\x12@\n" +
+	"\n" +
+	"interfaces\x18\x04 \x03(\v2 .sentra.agent.v1.InterfaceStatusR\n" +
+	"interfaces\x12+\n" +
+	"\x05peers\x18\x05 \x03(\v2\x15.sentra.agent.v1.PeerR\x05peers\x123\n" +
+	"\x06system\x18\x06 \x01(\v2\x1b.sentra.agent.v1.SystemInfoR\x06system\x12'\n" +
+	"\x0fendpoint_policy\x18\a \x01(\tR\x0eendpointPolicy\"\x9a\x01\n" +
+	"\x0fInterfaceStatus\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1d\n" +
+	"\n" +
+	"public_key\x18\x02 \x01(\tR\tpublicKey\x12\x1f\n" +
+	"\vlisten_port\x18\x03 \x01(\x05R\n" +
+	"listenPort\x12\x1d\n" +
+	"\n" +
+	"peer_count\x18\x04 \x01(\x05R\tpeerCount\x12\x14\n" +
+	"\x05error\x18\x05 \x01(\tR\x05error\"\xc6\x02\n" +
+	"\x04Peer\x12\x1c\n" +
+	"\tinterface\x18\x01 \x01(\tR\tinterface\x12\x1d\n" +
+	"\n" +
+	"public_key\x18\x02 \x01(\tR\tpublicKey\x12\x1a\n" +
+	"\bendpoint\x18\x03 \x01(\tR\bendpoint\x12\x1f\n" +
+	"\vallowed_ips\x18\x04 \x03(\tR\n" +
+	"allowedIps\x12E\n" +
+	"\x10latest_handshake\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x0flatestHandshake\x12#\n" +
+	"\rreceive_bytes\x18\x06 \x01(\x03R\freceiveBytes\x12%\n" +
+	"\x0etransmit_bytes\x18\a \x01(\x03R\rtransmitBytes\x121\n" +
+	"\x14persistent_keepalive\x18\b \x01(\x05R\x13persistentKeepalive\"\x9e\x04\n" +
+	"\n" +
+	"SystemInfo\x12\x1a\n" +
+	"\bhostname\x18\x01 \x01(\tR\bhostname\x12\x0e\n" +
+	"\x02os\x18\x02 \x01(\tR\x02os\x12\x12\n" +
+	"\x04arch\x18\x03 \x01(\tR\x04arch\x12%\n" +
+	"\x0ekernel_version\x18\x04 \x01(\tR\rkernelVersion\x12\x1a\n" +
+	"\bplatform\x18\x05 \x01(\tR\bplatform\x12\x1b\n" +
+	"\tcpu_count\x18\x06 \x01(\x05R\bcpuCount\x12\x1f\n" +
+	"\vcpu_percent\x18\a \x01(\x01R\n" +
+	"cpuPercent\x12!\n" +
+	"\fmemory_total\x18\b \x01(\x04R\vmemoryTotal\x12\x1f\n" +
+	"\vmemory_used\x18\t \x01(\x04R\n" +
+	"memoryUsed\x12%\n" +
+	"\x0ememory_percent\x18\n" +
+	" \x01(\x01R\rmemoryPercent\x12\x1d\n" +
+	"\n" +
+	"disk_total\x18\v \x01(\x04R\tdiskTotal\x12\x1b\n" +
+	"\tdisk_used\x18\f \x01(\x04R\bdiskUsed\x12!\n" +
+	"\fdisk_percent\x18\r \x01(\x01R\vdiskPercent\x12!\n" +
+	"\fload_average\x18\x0e \x01(\x01R\vloadAverage\x12\x16\n" +
+	"\x06uptime\x18\x0f \x01(\x04R\x06uptime\x12$\n" +
+	"\x0enet_bytes_sent\x18\x10 \x01(\x04R\fnetBytesSent\x12$\n" +
+	"\x0enet_bytes_recv\x18\x11 \x01(\x04R\fnetBytesRecv\"\xbe\x02\n" +
+	"\tAgentInfo\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\tR\aversion\x12)\n" +
+	"\x10protocol_version\x18\x02 \x01(\x05R\x0fprotocolVersion\x12\"\n" +
+	"\fcapabilities\x18\x03 \x03(\tR\fcapabilities\x12\x1d\n" +
+	"\n" +
+	"go_version\x18\x04 \x01(\tR\tgoVersion\x12\x0e\n" +
+	"\x02os\x18\x05 \x01(\tR\x02os\x12\x12\n" +
+	"\x04arch\x18\x06 \x01(\tR\x04arch\x12%\n" +
+	"\x0econfig_version\x18\a \x01(\tR\rconfigVersion\x124\n" +
+	"\x06config\x18\b \x01(\v2\x1c.sentra.agent.v1.AgentConfigR\x06config\x12(\n" +
+	"\x10rolled_back_from\x18\t \x01(\tR\x0erolledBackFrom\"\xc7\x01\n" +
+	"\vAgentConfig\x122\n" +
+	"\x15poll_interval_seconds\x18\x01 \x01(\x05R\x13pollIntervalSeconds\x12\x1e\n" +
+	"\n" +
+	"collectors\x18\x02 \x03(\tR\n" +
+	"collectors\x12\x1b\n" +
+	"\tlog_level\x18\x03 \x01(\tR\blogLevel\x12\x1e\n" +
+	"\n" +
+	"interfaces\x18\x04 \x03(\tR\n" +
+	"interfaces\x12'\n" +
+	"\x0fendpoint_policy\x18\x05 \x01(\tR\x0eendpointPolicy\"G\n" +
+	"\aCommand\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x18\n" +
+	"\apayload\x18\x03 \x01(\fR\apayload\"O\n" +
+	"\rCommandResult\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\x12\x18\n" +
+	"\apayload\x18\x03 \x01(\fR\apayload2\xab\x01\n" +
+	"\fAgentService\x12Q\n" +
+	"\rStreamReports\x12\x1e.sentra.agent.v1.ReportRequest\x1a\x1e.sentra.agent.v1.ReportSummary(\x01\x12H\n" +
+	"\bCommands\x12\x1e.sentra.agent.v1.CommandResult\x1a\x18.sentra.agent.v1.Command(\x010\x01B1Z/github.com/ChronoCoders/sentra/internal/agentpbb\x06proto3"
+
+var (
+	file_sentra_agent_v1_agent_proto_rawDescOnce sync.Once
+	file_sentra_agent_v1_agent_proto_rawDescData []byte
+)
+
+func file_sentra_agent_v1_agent_proto_rawDescGZIP() []byte {
+	file_sentra_agent_v1_agent_proto_rawDescOnce.Do(func() {
+		file_sentra_agent_v1_agent_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_sentra_agent_v1_agent_proto_rawDesc), len(file_sentra_agent_v1_agent_proto_rawDesc)))
+	})
+	return file_sentra_agent_v1_agent_proto_rawDescData
+}
+
+var file_sentra_agent_v1_agent_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
+var file_sentra_agent_v1_agent_proto_goTypes = []any{
+	(*ReportRequest)(nil),         // 0: sentra.agent.v1.ReportRequest
+	(*ReportSummary)(nil),         // 1: sentra.agent.v1.ReportSummary
+	(*ReportSignature)(nil),       // 2: sentra.agent.v1.ReportSignature
+	(*StatusEvent)(nil),           // 3: sentra.agent.v1.StatusEvent
+	(*Status)(nil),                // 4: sentra.agent.v1.Status
+	(*InterfaceStatus)(nil),       // 5: sentra.agent.v1.InterfaceStatus
+	(*Peer)(nil),                  // 6: sentra.agent.v1.Peer
+	(*SystemInfo)(nil),            // 7: sentra.agent.v1.SystemInfo
+	(*AgentInfo)(nil),             // 8: sentra.agent.v1.AgentInfo
+	(*AgentConfig)(nil),           // 9: sentra.agent.v1.AgentConfig
+	(*Command)(nil),               // 10: sentra.agent.v1.Command
+	(*CommandResult)(nil),         // 11: sentra.agent.v1.CommandResult
+	nil,                           // 12: sentra.agent.v1.StatusEvent.AttributesEntry
+	(*timestamppb.Timestamp)(nil), // 13: google.protobuf.Timestamp
+}
+var file_sentra_agent_v1_agent_proto_depIdxs = []int32{
+	3,  // 0: sentra.agent.v1.ReportRequest.event:type_name -> sentra.agent.v1.StatusEvent
+	2,  // 1: sentra.agent.v1.ReportRequest.signature:type_name -> sentra.agent.v1.ReportSignature
+	4,  // 2: sentra.agent.v1.StatusEvent.status:type_name -> sentra.agent.v1.Status
+	13, // 3: sentra.agent.v1.StatusEvent.time:type_name -> google.protobuf.Timestamp
+	12, // 4: sentra.agent.v1.StatusEvent.attributes:type_name -> sentra.agent.v1.StatusEvent.AttributesEntry
+	8,  // 5: sentra.agent.v1.StatusEvent.agent:type_name -> sentra.agent.v1.AgentInfo
+	5,  // 6: sentra.agent.v1.Status.interfaces:type_name -> sentra.agent.v1.InterfaceStatus
+	6,  // 7: sentra.agent.v1.Status.peers:type_name -> sentra.agent.v1.Peer
+	7,  // 8: sentra.agent.v1.Status.system:type_name -> sentra.agent.v1.SystemInfo
+	13, // 9: sentra.agent.v1.Peer.latest_handshake:type_name -> google.protobuf.Timestamp
+	9,  // 10: sentra.agent.v1.AgentInfo.config:type_name -> sentra.agent.v1.AgentConfig
+	0,  // 11: sentra.agent.v1.AgentService.StreamReports:input_type -> sentra.agent.v1.ReportRequest
+	11, // 12: sentra.agent.v1.AgentService.Commands:input_type -> sentra.agent.v1.CommandResult
+	1,  // 13: sentra.agent.v1.AgentService.StreamReports:output_type -> sentra.agent.v1.ReportSummary
+	10, // 14: sentra.agent.v1.AgentService.Commands:output_type -> sentra.agent.v1.Command
+	13, // [13:15] is the sub-list for method output_type
+	11, // [11:13] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
+}
+
+func init() { file_sentra_agent_v1_agent_proto_init() }
+func file_sentra_agent_v1_agent_proto_init() {
+	if File_sentra_agent_v1_agent_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_sentra_agent_v1_agent_proto_rawDesc), len(file_sentra_agent_v1_agent_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   13,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_sentra_agent_v1_agent_proto_goTypes,
+		DependencyIndexes: file_sentra_agent_v1_agent_proto_depIdxs,
+		MessageInfos:      file_sentra_agent_v1_agent_proto_msgTypes,
+	}.Build()
+	File_sentra_agent_v1_agent_proto = out.File
+	file_sentra_agent_v1_agent_proto_goTypes = nil
+	file_sentra_agent_v1_agent_proto_depIdxs = nil
+}
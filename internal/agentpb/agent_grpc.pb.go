@@ -0,0 +1,164 @@
+// Agent protocol of the Sentra control plane.
+//
+// Agents authenticate with their enrollment credential in the "authorization"
+// metadata ("Bearer <credential>") or with a client certificate issued by the
+// control plane CA.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: sentra/agent/v1/agent.proto
+
+package agentpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	AgentService_StreamReports_FullMethodName = "/sentra.agent.v1.AgentService/StreamReports"
+	AgentService_Commands_FullMethodName      = "/sentra.agent.v1.AgentService/Commands"
+)
+
+// AgentServiceClient is the client API for AgentService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AgentServiceClient interface {
+	// StreamReports carries an agent's status reports. The control plane ends
+	// the stream with FAILED_PRECONDITION when it needs a full snapshot, and
+	// with PERMISSION_DENIED or INVALID_ARGUMENT when it rejects a report.
+	StreamReports(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ReportRequest, ReportSummary], error)
+	// Commands delivers commands to an enrolled agent. The agent opens the
+	// stream with an empty CommandResult and answers every Command with a
+	// CommandResult carrying the same id.
+	Commands(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[CommandResult, Command], error)
+}
+
+type agentServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAgentServiceClient(cc grpc.ClientConnInterface) AgentServiceClient {
+	return &agentServiceClient{cc}
+}
+
+func (c *agentServiceClient) StreamReports(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ReportRequest, ReportSummary], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AgentService_ServiceDesc.Streams[0], AgentService_StreamReports_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ReportRequest, ReportSummary]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AgentService_StreamReportsClient = grpc.ClientStreamingClient[ReportRequest, ReportSummary]
+
+func (c *agentServiceClient) Commands(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[CommandResult, Command], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AgentService_ServiceDesc.Streams[1], AgentService_Commands_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[CommandResult, Command]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AgentService_CommandsClient = grpc.BidiStreamingClient[CommandResult, Command]
+
+// AgentServiceServer is the server API for AgentService service.
+// All implementations must embed UnimplementedAgentServiceServer
+// for forward compatibility.
+type AgentServiceServer interface {
+	// StreamReports carries an agent's status reports. The control plane ends
+	// the stream with FAILED_PRECONDITION when it needs a full snapshot, and
+	// with PERMISSION_DENIED or INVALID_ARGUMENT when it rejects a report.
+	StreamReports(grpc.ClientStreamingServer[ReportRequest, ReportSummary]) error
+	// Commands delivers commands to an enrolled agent. The agent opens the
+	// stream with an empty CommandResult and answers every Command with a
+	// CommandResult carrying the same id.
+	Commands(grpc.BidiStreamingServer[CommandResult, Command]) error
+	mustEmbedUnimplementedAgentServiceServer()
+}
+
+// UnimplementedAgentServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAgentServiceServer struct{}
+
+func (UnimplementedAgentServiceServer) StreamReports(grpc.ClientStreamingServer[ReportRequest, ReportSummary]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamReports not implemented")
+}
+func (UnimplementedAgentServiceServer) Commands(grpc.BidiStreamingServer[CommandResult, Command]) error {
+	return status.Errorf(codes.Unimplemented, "method Commands not implemented")
+}
+func (UnimplementedAgentServiceServer) mustEmbedUnimplementedAgentServiceServer() {}
+func (UnimplementedAgentServiceServer) testEmbeddedByValue()                      {}
+
+// UnsafeAgentServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AgentServiceServer will
+// result in compilation errors.
+type UnsafeAgentServiceServer interface {
+	mustEmbedUnimplementedAgentServiceServer()
+}
+
+func RegisterAgentServiceServer(s grpc.ServiceRegistrar, srv AgentServiceServer) {
+	// If the following call pancis, it indicates UnimplementedAgentServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&AgentService_ServiceDesc, srv)
+}
+
+func _AgentService_StreamReports_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AgentServiceServer).StreamReports(&grpc.GenericServerStream[ReportRequest, ReportSummary]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AgentService_StreamReportsServer = grpc.ClientStreamingServer[ReportRequest, ReportSummary]
+
+func _AgentService_Commands_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AgentServiceServer).Commands(&grpc.GenericServerStream[CommandResult, Command]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AgentService_CommandsServer = grpc.BidiStreamingServer[CommandResult, Command]
+
+// AgentService_ServiceDesc is the grpc.ServiceDesc for AgentService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AgentService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sentra.agent.v1.AgentService",
+	HandlerType: (*AgentServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamReports",
+			Handler:       _AgentService_StreamReports_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Commands",
+			Handler:       _AgentService_Commands_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "sentra/agent/v1/agent.proto",
+}
@@ -0,0 +1,261 @@
+// Package agentpb holds the protobuf agent protocol generated from
+// proto/sentra/agent/v1/agent.proto and its conversion to the models package.
+package agentpb
+
+//go:generate protoc -I ../../proto --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative sentra/agent/v1/agent.proto
+
+import (
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// EventToProto converts a status event to its protobuf form.
+func EventToProto(e models.StatusEvent) *StatusEvent {
+	return &StatusEvent{
+		ServerId:     e.ServerID,
+		Status:       statusToProto(e.Status),
+		Time:         timeToProto(e.Time),
+		AgentId:      e.AgentID,
+		Attributes:   e.Attributes,
+		Agent:        agentInfoToProto(e.Agent),
+		Seq:          e.Seq,
+		Delta:        e.Delta,
+		RemovedPeers: e.RemovedPeers,
+	}
+}
+
+// EventFromProto converts a protobuf status event.
+func EventFromProto(e *StatusEvent) models.StatusEvent {
+	return models.StatusEvent{
+		ServerID:     e.GetServerId(),
+		Status:       statusFromProto(e.GetStatus()),
+		Time:         timeFromProto(e.GetTime()),
+		AgentID:      e.GetAgentId(),
+		Attributes:   e.GetAttributes(),
+		Agent:        agentInfoFromProto(e.GetAgent()),
+		Seq:          e.GetSeq(),
+		Delta:        e.GetDelta(),
+		RemovedPeers: e.GetRemovedPeers(),
+	}
+}
+
+// EventPayload returns the bytes of e that reports are signed over: its
+// deterministic wire encoding. The control plane keeps the fields it does not
+// know when decoding e, so it encodes the same bytes again whatever version
+// the agent runs.
+func EventPayload(e *StatusEvent) ([]byte, error) {
+	return proto.MarshalOptions{Deterministic: true}.Marshal(e)
+}
+
+func SignatureToProto(s *models.ReportSignature) *ReportSignature {
+	if s == nil {
+		return nil
+	}
+	return &ReportSignature{Timestamp: s.Timestamp, Nonce: s.Nonce, Signature: s.Signature}
+}
+
+func SignatureFromProto(s *ReportSignature) *models.ReportSignature {
+	if s == nil {
+		return nil
+	}
+	return &models.ReportSignature{Timestamp: s.GetTimestamp(), Nonce: s.GetNonce(), Signature: s.GetSignature()}
+}
+
+func CommandToProto(id string, c models.Command) *Command {
+	return &Command{Id: id, Name: c.Name, Payload: c.Payload}
+}
+
+func CommandFromProto(c *Command) models.Command {
+	return models.Command{Name: c.GetName(), Payload: c.GetPayload()}
+}
+
+func ResultToProto(id string, r models.CommandResult) *CommandResult {
+	return &CommandResult{Id: id, Error: r.Error, Payload: r.Payload}
+}
+
+func ResultFromProto(r *CommandResult) models.CommandResult {
+	return models.CommandResult{Error: r.GetError(), Payload: r.GetPayload()}
+}
+
+func timeToProto(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func timeFromProto(t *timestamppb.Timestamp) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return t.AsTime()
+}
+
+func statusToProto(s *models.Status) *Status {
+	if s == nil {
+		return nil
+	}
+	out := &Status{
+		Interface:      s.Interface,
+		PublicKey:      s.PublicKey,
+		ListenPort:     int32(s.ListenPort),
+		System:         systemToProto(s.System),
+		EndpointPolicy: s.EndpointPolicy,
+	}
+	for _, iface := range s.Interfaces {
+		out.Interfaces = append(out.Interfaces, &InterfaceStatus{
+			Name:       iface.Name,
+			PublicKey:  iface.PublicKey,
+			ListenPort: int32(iface.ListenPort),
+			PeerCount:  int32(iface.PeerCount),
+			Error:      iface.Error,
+		})
+	}
+	for _, p := range s.Peers {
+		out.Peers = append(out.Peers, &Peer{
+			Interface:           p.Interface,
+			PublicKey:           p.PublicKey,
+			Endpoint:            p.Endpoint,
+			AllowedIps:          p.AllowedIPs,
+			LatestHandshake:     timeToProto(p.LatestHandshake),
+			ReceiveBytes:        p.ReceiveBytes,
+			TransmitBytes:       p.TransmitBytes,
+			PersistentKeepalive: int32(p.KeepAlive),
+		})
+	}
+	return out
+}
+
+func statusFromProto(s *Status) *models.Status {
+	if s == nil {
+		return nil
+	}
+	out := &models.Status{
+		Interface:      s.GetInterface(),
+		PublicKey:      s.GetPublicKey(),
+		ListenPort:     int(s.GetListenPort()),
+		System:         systemFromProto(s.GetSystem()),
+		EndpointPolicy: s.GetEndpointPolicy(),
+	}
+	for _, iface := range s.GetInterfaces() {
+		out.Interfaces = append(out.Interfaces, models.InterfaceStatus{
+			Name:       iface.GetName(),
+			PublicKey:  iface.GetPublicKey(),
+			ListenPort: int(iface.GetListenPort()),
+			PeerCount:  int(iface.GetPeerCount()),
+			Error:      iface.GetError(),
+		})
+	}
+	for _, p := range s.GetPeers() {
+		out.Peers = append(out.Peers, models.Peer{
+			Interface:       p.GetInterface(),
+			PublicKey:       p.GetPublicKey(),
+			Endpoint:        p.GetEndpoint(),
+			AllowedIPs:      p.GetAllowedIps(),
+			LatestHandshake: timeFromProto(p.GetLatestHandshake()),
+			ReceiveBytes:    p.GetReceiveBytes(),
+			TransmitBytes:   p.GetTransmitBytes(),
+			KeepAlive:       int(p.GetPersistentKeepalive()),
+		})
+	}
+	return out
+}
+
+func systemToProto(s models.SystemInfo) *SystemInfo {
+	return &SystemInfo{
+		Hostname:      s.Hostname,
+		Os:            s.OS,
+		Arch:          s.Arch,
+		KernelVersion: s.KernelVersion,
+		Platform:      s.Platform,
+		CpuCount:      int32(s.CPUCount),
+		CpuPercent:    s.CPUPercent,
+		MemoryTotal:   s.MemoryTotal,
+		MemoryUsed:    s.MemoryUsed,
+		MemoryPercent: s.MemoryPercent,
+		DiskTotal:     s.DiskTotal,
+		DiskUsed:      s.DiskUsed,
+		DiskPercent:   s.DiskPercent,
+		LoadAverage:   s.LoadAverage,
+		Uptime:        s.Uptime,
+		NetBytesSent:  s.NetBytesSent,
+		NetBytesRecv:  s.NetBytesRecv,
+	}
+}
+
+func systemFromProto(s *SystemInfo) models.SystemInfo {
+	return models.SystemInfo{
+		Hostname:      s.GetHostname(),
+		OS:            s.GetOs(),
+		Arch:          s.GetArch(),
+		KernelVersion: s.GetKernelVersion(),
+		Platform:      s.GetPlatform(),
+		CPUCount:      int(s.GetCpuCount()),
+		CPUPercent:    s.GetCpuPercent(),
+		MemoryTotal:   s.GetMemoryTotal(),
+		MemoryUsed:    s.GetMemoryUsed(),
+		MemoryPercent: s.GetMemoryPercent(),
+		DiskTotal:     s.GetDiskTotal(),
+		DiskUsed:      s.GetDiskUsed(),
+		DiskPercent:   s.GetDiskPercent(),
+		LoadAverage:   s.GetLoadAverage(),
+		Uptime:        s.GetUptime(),
+		NetBytesSent:  s.GetNetBytesSent(),
+		NetBytesRecv:  s.GetNetBytesRecv(),
+	}
+}
+
+func agentInfoToProto(a *models.AgentInfo) *AgentInfo {
+	if a == nil {
+		return nil
+	}
+	out := &AgentInfo{
+		Version:         a.Version,
+		ProtocolVersion: int32(a.ProtocolVersion),
+		Capabilities:    a.Capabilities,
+		GoVersion:       a.GoVersion,
+		Os:              a.OS,
+		Arch:            a.Arch,
+		ConfigVersion:   a.ConfigVersion,
+		RolledBackFrom:  a.RolledBackFrom,
+	}
+	if a.Config != nil {
+		out.Config = &AgentConfig{
+			PollIntervalSeconds: int32(a.Config.PollInterval),
+			Collectors:          a.Config.Collectors,
+			LogLevel:            a.Config.LogLevel,
+			Interfaces:          a.Config.Interfaces,
+			EndpointPolicy:      a.Config.EndpointPolicy,
+		}
+	}
+	return out
+}
+
+func agentInfoFromProto(a *AgentInfo) *models.AgentInfo {
+	if a == nil {
+		return nil
+	}
+	out := &models.AgentInfo{
+		Version:         a.GetVersion(),
+		ProtocolVersion: int(a.GetProtocolVersion()),
+		Capabilities:    a.GetCapabilities(),
+		GoVersion:       a.GetGoVersion(),
+		OS:              a.GetOs(),
+		Arch:            a.GetArch(),
+		ConfigVersion:   a.GetConfigVersion(),
+		RolledBackFrom:  a.GetRolledBackFrom(),
+	}
+	if c := a.GetConfig(); c != nil {
+		out.Config = &models.AgentConfig{
+			PollInterval:   int(c.GetPollIntervalSeconds()),
+			Collectors:     c.GetCollectors(),
+			LogLevel:       c.GetLogLevel(),
+			Interfaces:     c.GetInterfaces(),
+			EndpointPolicy: c.GetEndpointPolicy(),
+		}
+	}
+	return out
+}
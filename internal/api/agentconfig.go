@@ -0,0 +1,250 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+var configGroupName = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// serverConfigStatus shows the configuration a server should run next to the
+// one its agent reported.
+type serverConfigStatus struct {
+	ServerID       string               `json:"server_id"`
+	Group          string               `json:"group,omitempty"`
+	Config         models.AgentConfig   `json:"config"`
+	Desired        *models.ConfigUpdate `json:"desired"`
+	AppliedVersion string               `json:"applied_version"`
+	Effective      *models.AgentConfig  `json:"effective,omitempty"`
+	InSync         bool                 `json:"in_sync"`
+}
+
+func (s *Server) serverConfigStatus(ctx context.Context, serverID string) (*serverConfigStatus, error) {
+	st := &serverConfigStatus{ServerID: serverID}
+	sc, err := s.store.GetServerConfig(ctx, serverID)
+	if err != nil {
+		return nil, err
+	}
+	if sc != nil {
+		st.Group, st.Config = sc.Group, sc.Config
+	}
+	if st.Desired, err = s.configs.Desired(ctx, serverID); err != nil {
+		return nil, err
+	}
+	if inv, ok := s.inventory.Get(serverID); ok {
+		st.AppliedVersion, st.Effective = inv.ConfigVersion, inv.Config
+	}
+	st.InSync = st.Desired == nil || st.Desired.Version == st.AppliedVersion
+	return st, nil
+}
+
+func (s *Server) handleListConfigGroups(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	groups, err := s.store.ListConfigGroups(r.Context(), user.OrgID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list config groups")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(groups)
+}
+
+// handlePutConfigGroup creates or replaces a group's configuration and pushes
+// it to the group's connected agents.
+func (s *Server) handlePutConfigGroup(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if !configGroupName.MatchString(name) {
+		http.Error(w, "invalid group name", http.StatusBadRequest)
+		return
+	}
+	var cfg models.AgentConfig
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	group := &models.ConfigGroup{OrgID: user.OrgID, Name: name, Config: cfg, UpdatedAt: time.Now().UTC()}
+	if err := s.store.UpsertConfigGroup(r.Context(), group); err != nil {
+		log.Error().Err(err).Msg("failed to store config group")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	s.configs.PushGroup(r.Context(), user.OrgID, name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(group)
+}
+
+func (s *Server) handleDeleteConfigGroup(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	name := chi.URLParam(r, "name")
+	members, err := s.store.ListServerConfigsInGroup(r.Context(), user.OrgID, name)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list config group members")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if len(members) > 0 {
+		http.Error(w, "group has assigned servers", http.StatusConflict)
+		return
+	}
+	ok, err := s.store.DeleteConfigGroup(r.Context(), user.OrgID, name)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete config group")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "group not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleGetServerConfig(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id := chi.URLParam(r, "id")
+	sc, err := s.store.GetServerConfig(r.Context(), id)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get server config")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if sc != nil && sc.OrgID != user.OrgID {
+		http.Error(w, "server not found", http.StatusNotFound)
+		return
+	}
+
+	st, err := s.serverConfigStatus(r.Context(), id)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get server config")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+// handlePutServerConfig sets a server's group and own configuration and
+// pushes the result to its agent.
+func (s *Server) handlePutServerConfig(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Group  string             `json:"group"`
+		Config models.AgentConfig `json:"config"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := req.Config.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	existing, err := s.store.GetServerConfig(r.Context(), id)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get server config")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if existing != nil && existing.OrgID != user.OrgID {
+		http.Error(w, "server not found", http.StatusNotFound)
+		return
+	}
+	req.Group = strings.TrimSpace(req.Group)
+	if req.Group != "" {
+		g, err := s.store.GetConfigGroup(r.Context(), user.OrgID, req.Group)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to get config group")
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if g == nil {
+			http.Error(w, "unknown group", http.StatusBadRequest)
+			return
+		}
+	}
+
+	sc := &models.ServerConfig{ServerID: id, OrgID: user.OrgID, Group: req.Group, Config: req.Config, UpdatedAt: time.Now().UTC()}
+	if err := s.store.UpsertServerConfig(r.Context(), sc); err != nil {
+		log.Error().Err(err).Msg("failed to store server config")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	go s.configs.Push(context.Background(), id)
+
+	st, err := s.serverConfigStatus(r.Context(), id)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get server config")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+// handleConfigDrift lists servers whose agent does not run the desired configuration.
+func (s *Server) handleConfigDrift(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	configs, err := s.store.ListServerConfigs(r.Context(), user.OrgID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list server configs")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	drift := []serverConfigStatus{}
+	for _, sc := range configs {
+		st, err := s.serverConfigStatus(r.Context(), sc.ServerID)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to get server config")
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if !st.InSync {
+			drift = append(drift, *st)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(drift)
+}
@@ -0,0 +1,393 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/auth"
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/ChronoCoders/sentra/internal/signing"
+	"github.com/ChronoCoders/sentra/internal/store"
+	sentratls "github.com/ChronoCoders/sentra/internal/tls"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const defaultJoinTokenTTL = 24 * time.Hour
+
+// currentUser loads the user behind the request's JWT.
+func (s *Server) currentUser(r *http.Request) (*models.User, error) {
+	claims, ok := r.Context().Value(userContextKey).(*auth.UserClaims)
+	if !ok {
+		return nil, errors.New("missing user claims")
+	}
+	user, err := s.store.GetUserByID(r.Context(), claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+	return user, nil
+}
+
+func (s *Server) handleCreateJoinToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ServerID   string `json:"server_id"`
+		TTLSeconds int    `json:"ttl_seconds"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	user, err := s.currentUser(r)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load current user")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ttl := defaultJoinTokenTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if req.ServerID == "" {
+		req.ServerID = uuid.NewString()
+	} else {
+		// A token may only enroll servers of the user's organization.
+		orgID, err := s.store.ServerOrgID(r.Context(), req.ServerID)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to look up server")
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if orgID != "" && orgID != user.OrgID {
+			http.Error(w, "server_id is already in use", http.StatusConflict)
+			return
+		}
+	}
+
+	secret, err := auth.GenerateSecret()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to generate join token")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	token := &models.JoinToken{
+		ID:        uuid.NewString(),
+		OrgID:     user.OrgID,
+		ServerID:  req.ServerID,
+		CreatedBy: user.ID,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if err := s.store.CreateJoinToken(r.Context(), token, auth.HashSecret(secret)); err != nil {
+		log.Error().Err(err).Msg("failed to store join token")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		*models.JoinToken
+		Token string `json:"token"`
+	}{token, secret})
+}
+
+func (s *Server) handleListJoinTokens(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	tokens, err := s.store.ListJoinTokens(r.Context(), user.OrgID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list join tokens")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func (s *Server) handleDeleteJoinToken(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok, err := s.store.DeleteJoinToken(r.Context(), user.OrgID, chi.URLParam(r, "id"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete join token")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "join token not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleEnroll exchanges a one-time join token for a per-agent credential.
+func (s *Server) handleEnroll(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token      string `json:"token"`
+		Hostname   string `json:"hostname"`
+		CSR        string `json:"csr"`
+		SigningKey string `json:"signing_key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.SigningKey != "" {
+		if _, err := signing.DecodePublicKey(req.SigningKey); err != nil {
+			http.Error(w, "invalid signing key", http.StatusBadRequest)
+			return
+		}
+	}
+
+	credential, err := auth.GenerateSecret()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to generate agent credential")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	agent := &models.Agent{
+		ID:         uuid.NewString(),
+		Hostname:   req.Hostname,
+		SigningKey: req.SigningKey,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := s.store.EnrollAgent(r.Context(), auth.HashSecret(req.Token), agent, auth.HashSecret(credential)); err != nil {
+		if errors.Is(err, store.ErrInvalidJoinToken) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, store.ErrForeignServer) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Error().Err(err).Msg("failed to enroll agent")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Info().Str("agent_id", agent.ID).Str("server_id", agent.ServerID).Str("hostname", agent.Hostname).Msg("agent enrolled")
+
+	resp := map[string]string{
+		"agent_id":   agent.ID,
+		"org_id":     agent.OrgID,
+		"server_id":  agent.ServerID,
+		"credential": credential,
+	}
+	if req.CSR != "" && s.ca != nil {
+		certPEM, err := s.issueAgentCertificate(r.Context(), agent.ID, []byte(req.CSR))
+		if err != nil {
+			// The agent is enrolled and can still use its credential and retry through renewal.
+			log.Error().Err(err).Str("agent_id", agent.ID).Msg("failed to issue agent certificate")
+		} else {
+			resp["certificate"] = string(certPEM)
+			resp["ca_certificate"] = string(s.ca.CertPEM())
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// issueAgentCertificate signs an agent's CSR with the internal CA and records
+// the certificate so that it can be revoked.
+func (s *Server) issueAgentCertificate(ctx context.Context, agentID string, csrPEM []byte) ([]byte, error) {
+	cert, certPEM, err := s.ca.SignClientCSR(csrPEM, agentID, s.cfg.ClientCertTTL)
+	if err != nil {
+		return nil, err
+	}
+	record := &models.AgentCertificate{
+		Serial:    sentratls.SerialString(cert.SerialNumber),
+		AgentID:   agentID,
+		ExpiresAt: cert.NotAfter.UTC(),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.store.AddAgentCertificate(ctx, record); err != nil {
+		return nil, err
+	}
+	return certPEM, nil
+}
+
+// handleRenewCertificate issues a fresh client certificate to an enrolled
+// agent and revokes its previous certificates.
+func (s *Server) handleRenewCertificate(w http.ResponseWriter, r *http.Request) {
+	agent := agentFromContext(r.Context())
+	if agent == nil || s.ca == nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		CSR string `json:"csr"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CSR == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	certPEM, err := s.issueAgentCertificate(r.Context(), agent.ID, []byte(req.CSR))
+	if err != nil {
+		log.Error().Err(err).Str("agent_id", agent.ID).Msg("failed to renew agent certificate")
+		http.Error(w, "invalid certificate request", http.StatusBadRequest)
+		return
+	}
+	cert, err := sentratls.ParseCertificatePEM(certPEM)
+	if err == nil {
+		err = s.store.RevokeAgentCertificates(r.Context(), agent.ID, sentratls.SerialString(cert.SerialNumber), time.Now().UTC())
+	}
+	if err != nil {
+		log.Error().Err(err).Str("agent_id", agent.ID).Msg("failed to revoke previous agent certificates")
+	}
+
+	log.Info().Str("agent_id", agent.ID).Msg("agent certificate renewed")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"certificate":    string(certPEM),
+		"ca_certificate": string(s.ca.CertPEM()),
+	})
+}
+
+// handleCRL serves the list of revoked, not yet expired agent certificates.
+func (s *Server) handleCRL(w http.ResponseWriter, r *http.Request) {
+	if s.ca == nil {
+		http.Error(w, "CA not configured", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now().UTC()
+	revoked, err := s.store.ListRevokedCertificates(r.Context(), now)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list revoked certificates")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	entries := make([]x509.RevocationListEntry, 0, len(revoked))
+	for _, c := range revoked {
+		serial, ok := new(big.Int).SetString(c.Serial, 16)
+		if !ok {
+			continue
+		}
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   serial,
+			RevocationTime: *c.RevokedAt,
+		})
+	}
+
+	crl, err := s.ca.CreateCRL(entries, now.Unix())
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create CRL")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pkix-crl")
+	w.Write(crl)
+}
+
+func (s *Server) handleListAgents(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	agents, err := s.store.ListAgents(r.Context(), user.OrgID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list agents")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(agents)
+}
+
+func (s *Server) handleRevokeAgent(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id := chi.URLParam(r, "id")
+	ok, err := s.store.RevokeAgent(r.Context(), user.OrgID, id, time.Now().UTC())
+	if err != nil {
+		log.Error().Err(err).Msg("failed to revoke agent")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "agent not found", http.StatusNotFound)
+		return
+	}
+	// Open channels and streams authenticated the agent when they connected.
+	s.agentConns.closeAll(id)
+	log.Info().Str("agent_id", id).Str("revoked_by", user.ID).Msg("agent revoked")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// agentConnections holds how to close the open channels and streams of every
+// agent, so that revoking an agent disconnects it right away.
+type agentConnections struct {
+	mu     sync.Mutex
+	nextID uint64
+	conns  map[string]map[uint64]func()
+}
+
+// add registers closeConn for a connection of an agent. The returned function
+// removes it once the connection ended.
+func (c *agentConnections) add(agentID string, closeConn func()) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conns == nil {
+		c.conns = make(map[string]map[uint64]func())
+	}
+	if c.conns[agentID] == nil {
+		c.conns[agentID] = make(map[uint64]func())
+	}
+	c.nextID++
+	id := c.nextID
+	c.conns[agentID][id] = closeConn
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.conns[agentID], id)
+		if len(c.conns[agentID]) == 0 {
+			delete(c.conns, agentID)
+		}
+	}
+}
+
+// closeAll closes every open connection of an agent.
+func (c *agentConnections) closeAll(agentID string) {
+	c.mu.Lock()
+	closers := make([]func(), 0, len(c.conns[agentID]))
+	for _, closeConn := range c.conns[agentID] {
+		closers = append(closers, closeConn)
+	}
+	c.mu.Unlock()
+	for _, closeConn := range closers {
+		closeConn()
+	}
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/config"
+	"github.com/ChronoCoders/sentra/internal/control"
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/ChronoCoders/sentra/internal/signing"
+)
+
+func TestRevokedAgentReports(t *testing.T) {
+	db := newTestStore(t)
+	key := enrollTestAgent(t, db, "agent-1", "srv-1", "credential")
+	s := &Server{
+		cfg:    &config.Config{},
+		store:  db,
+		client: control.NewStatusCache(control.NewEventBus(), nil, db),
+		replay: control.NewReplayGuard(db, reportSignatureWindow),
+	}
+	agent, err := db.GetAgent(context.Background(), "agent-1")
+	if err != nil || agent == nil {
+		t.Fatalf("get agent: %v", err)
+	}
+	// Like a channel or stream, the context keeps the agent it connected as.
+	ctx := context.WithValue(context.Background(), agentContextKey, agent)
+	report := func() error {
+		payload := []byte(`{"server_id":"srv-1"}`)
+		sig, err := signing.Sign(key, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		event := models.StatusEvent{ServerID: "srv-1", Status: &models.Status{}, Time: time.Now()}
+		return s.ingestReport(ctx, &event, payload, sig, "test")
+	}
+
+	if err := report(); err != nil {
+		t.Fatalf("report before revocation: %v", err)
+	}
+	closed := 0
+	remove := s.agentConns.add("agent-1", func() { closed++ })
+	s.agentConns.add("agent-1", func() { closed++ })
+	s.agentConns.add("agent-2", func() { t.Error("connection of another agent closed") })
+	remove()
+
+	if _, err := db.RevokeAgent(context.Background(), models.DefaultOrgID, "agent-1", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	s.agentConns.closeAll("agent-1")
+	if closed != 1 {
+		t.Errorf("closed %d connections, want 1", closed)
+	}
+	if err := report(); !errors.Is(err, errAgentRevoked) {
+		t.Errorf("report after revocation = %v, want %v", err, errAgentRevoked)
+	}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultAlertLimit = 100
+	maxAlertLimit     = 1000
+)
+
+// alertRuleResponse is an alert rule with its durations as strings.
+type alertRuleResponse struct {
+	Name      string   `json:"name"`
+	Kind      string   `json:"kind"`
+	Severity  string   `json:"severity"`
+	Threshold float64  `json:"threshold,omitempty"`
+	Window    string   `json:"window,omitempty"`
+	For       string   `json:"for,omitempty"`
+	Repeat    string   `json:"repeat,omitempty"`
+	Servers   []string `json:"servers,omitempty"`
+}
+
+// handleListAlerts returns the alert history of the user's organization, the
+// most recently fired first, optionally filtered by state, server_id,
+// severity and a from/to range (RFC 3339 or Unix seconds) on when the alerts
+// fired.
+func (s *Server) handleListAlerts(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	params := r.URL.Query()
+	filter := models.AlertFilter{
+		State:    params.Get("state"),
+		ServerID: params.Get("server_id"),
+		Severity: params.Get("severity"),
+		Limit:    defaultAlertLimit,
+	}
+	if filter.State != "" && filter.State != models.AlertFiring && filter.State != models.AlertResolved {
+		http.Error(w, fmt.Sprintf("unknown state %q, must be firing or resolved", filter.State), http.StatusBadRequest)
+		return
+	}
+	if filter.Severity != "" && !slices.Contains(models.Severities, filter.Severity) {
+		http.Error(w, fmt.Sprintf("unknown severity %q, must be one of %s", filter.Severity, strings.Join(models.Severities, ", ")), http.StatusBadRequest)
+		return
+	}
+	if v := params.Get("from"); v != "" {
+		if filter.From, err = parseQueryTime(v); err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := params.Get("to"); v != "" {
+		if filter.To, err = parseQueryTime(v); err != nil {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxAlertLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxAlertLimit), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	alerts, err := s.store.ListAlerts(r.Context(), user.OrgID, filter)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list alerts")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alerts)
+}
+
+func (s *Server) handleGetAlert(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	alert, err := s.store.GetAlert(r.Context(), user.OrgID, chi.URLParam(r, "id"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get alert")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if alert == nil {
+		http.Error(w, "alert not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alert)
+}
+
+// handleAcknowledgeAlert records that the user took note of an alert, which
+// stops its repeated notifications.
+func (s *Server) handleAcknowledgeAlert(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	alert, err := s.alerts.Acknowledge(r.Context(), user.OrgID, chi.URLParam(r, "id"), user.Email)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to acknowledge alert")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if alert == nil {
+		http.Error(w, "alert not found", http.StatusNotFound)
+		return
+	}
+	log.Info().Str("user", user.Email).Str("alert_id", alert.ID).Msg("alert acknowledged")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alert)
+}
+
+// handleListAlertRules returns the rules alerts are evaluated on.
+func (s *Server) handleListAlertRules(w http.ResponseWriter, r *http.Request) {
+	rules := []alertRuleResponse{}
+	for _, rule := range s.alerts.Rules() {
+		res := alertRuleResponse{
+			Name:      rule.Name,
+			Kind:      rule.Kind,
+			Severity:  rule.Severity,
+			Threshold: rule.Threshold,
+			Servers:   rule.Servers,
+		}
+		if rule.Window > 0 {
+			res.Window = rule.Window.String()
+		}
+		if rule.For > 0 {
+			res.For = rule.For.String()
+		}
+		if rule.Repeat > 0 {
+			res.Repeat = rule.Repeat.String()
+		}
+		rules = append(rules, res)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
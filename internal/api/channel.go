@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/ChronoCoders/sentra/internal/control"
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+)
+
+var agentUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// handleAgentChannel upgrades an authenticated agent to a persistent channel
+// carrying reports up and commands down.
+func (s *Server) handleAgentChannel(w http.ResponseWriter, r *http.Request) {
+	agent := agentFromContext(r.Context())
+	if agent == nil {
+		http.Error(w, "agent channel requires an enrolled agent", http.StatusForbidden)
+		return
+	}
+
+	conn, err := agentUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to upgrade agent channel")
+		return
+	}
+
+	// The request context ends with the handler; keep the agent for report checks.
+	ctx := context.WithValue(context.Background(), agentContextKey, agent)
+	remoteAddr := r.RemoteAddr
+	session := control.NewAgentSession(conn, agent.ServerID, func(ctx context.Context, msg models.ChannelMessage) models.ChannelMessage {
+		return s.channelReport(ctx, msg, remoteAddr)
+	})
+	s.channels.Register(agent.ServerID, session)
+	remove := s.agentConns.add(agent.ID, session.Close)
+	log.Info().Str("agent_id", agent.ID).Str("server_id", agent.ServerID).Msg("agent channel connected")
+	go s.configs.Push(ctx, agent.ServerID)
+
+	session.Run(ctx)
+
+	remove()
+	s.channels.Unregister(agent.ServerID, session)
+	log.Info().Str("agent_id", agent.ID).Str("server_id", agent.ServerID).Msg("agent channel disconnected")
+}
+
+func (s *Server) channelReport(ctx context.Context, msg models.ChannelMessage, remoteAddr string) models.ChannelMessage {
+	var event models.StatusEvent
+	if err := json.Unmarshal(msg.Report, &event); err != nil {
+		return models.ChannelMessage{Error: "invalid report"}
+	}
+	err := s.ingestReport(ctx, &event, msg.Report, msg.Signature, remoteAddr)
+	switch {
+	case err == nil:
+		return models.ChannelMessage{}
+	case errors.Is(err, control.ErrResyncRequired):
+		return models.ChannelMessage{Resync: true}
+	default:
+		return models.ChannelMessage{Error: err.Error()}
+	}
+}
+
+// sendCommand executes a command on a server's agent and writes the outcome.
+// It reports whether the command succeeded.
+func (s *Server) sendCommand(w http.ResponseWriter, r *http.Request, serverID string, cmd models.Command) bool {
+	result, err := s.channels.SendCommand(r.Context(), serverID, cmd)
+	if err != nil {
+		if errors.Is(err, control.ErrAgentNotConnected) {
+			http.Error(w, "agent not connected", http.StatusServiceUnavailable)
+			return false
+		}
+		if errors.Is(err, control.ErrCapabilityMissing) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return false
+		}
+		log.Error().Err(err).Str("server_id", serverID).Str("command", cmd.Name).Msg("failed to send command")
+		http.Error(w, "agent did not respond", http.StatusGatewayTimeout)
+		return false
+	}
+	if result.Error != "" {
+		http.Error(w, result.Error, http.StatusUnprocessableEntity)
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(result.Payload) == 0 {
+		w.Write([]byte("{}"))
+		return true
+	}
+	w.Write(result.Payload)
+	return true
+}
+
+func (s *Server) handleAddPeer(w http.ResponseWriter, r *http.Request) {
+	var peer models.PeerConfig
+	if err := json.NewDecoder(r.Body).Decode(&peer); err != nil || peer.PublicKey == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	serverID := chi.URLParam(r, "id")
+	if !s.checkServer(w, r, serverID) {
+		return
+	}
+	payload, _ := json.Marshal(peer)
+	if s.sendCommand(w, r, serverID, models.Command{Name: models.CommandAddPeer, Payload: payload}) {
+		s.publishPeerEvent(r, models.EventPeerCreated, serverID, peer.Interface, peer.PublicKey)
+	}
+}
+
+func (s *Server) handleRemovePeer(w http.ResponseWriter, r *http.Request) {
+	publicKey, err := peerKeyParam(r)
+	if err != nil {
+		http.Error(w, "invalid public key", http.StatusBadRequest)
+		return
+	}
+	serverID := chi.URLParam(r, "id")
+	if !s.checkServer(w, r, serverID) {
+		return
+	}
+	iface := r.URL.Query().Get("interface")
+	payload, _ := json.Marshal(map[string]string{
+		"interface":  iface,
+		"public_key": publicKey,
+	})
+	if s.sendCommand(w, r, serverID, models.Command{Name: models.CommandRemovePeer, Payload: payload}) {
+		s.publishPeerEvent(r, models.EventPeerRemoved, serverID, iface, publicKey)
+	}
+}
+
+// publishPeerEvent tells the webhooks of the user's organization that a peer
+// was created or removed through the API.
+func (s *Server) publishPeerEvent(r *http.Request, eventType, serverID, iface, publicKey string) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		return
+	}
+	s.webhooks.Publish(r.Context(), user.OrgID, eventType, map[string]any{
+		"server_id":  serverID,
+		"interface":  iface,
+		"public_key": publicKey,
+		"by":         user.Email,
+	})
+}
+
+// peerKeyParam returns the peer public key from the URL. Keys are base64 and
+// may contain '/', so clients send them path-escaped.
+func peerKeyParam(r *http.Request) (string, error) {
+	return url.PathUnescape(chi.URLParam(r, "publicKey"))
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/control"
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// chatChannelRequest is the editable part of a chat channel.
+type chatChannelRequest struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	URL         string   `json:"url"`
+	Enabled     bool     `json:"enabled"`
+	MinSeverity string   `json:"min_severity"`
+	Kinds       []string `json:"kinds"`
+	Servers     []string `json:"servers"`
+}
+
+// apply checks a request and applies it to c. An empty URL keeps the current
+// one.
+func (req chatChannelRequest) apply(c *models.ChatChannel) error {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return errors.New("name must not be empty")
+	}
+	if !slices.Contains(models.ChatTypes, req.Type) {
+		return fmt.Errorf("type must be one of %s", strings.Join(models.ChatTypes, ", "))
+	}
+	if req.URL == "" && c.URL == "" {
+		return errors.New("url must not be empty")
+	}
+	if req.URL != "" {
+		u, err := url.Parse(strings.TrimSpace(req.URL))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("url must be an http:// or https:// URL")
+		}
+		c.URL = u.String()
+	}
+	if !slices.Contains(models.Severities, req.MinSeverity) {
+		return fmt.Errorf("min_severity must be one of %s", strings.Join(models.Severities, ", "))
+	}
+	kinds := []string{}
+	for _, kind := range req.Kinds {
+		if !slices.Contains(models.ChatKinds, kind) {
+			return fmt.Errorf("unknown kind %q, must be one of %s", kind, strings.Join(models.ChatKinds, ", "))
+		}
+		if !slices.Contains(kinds, kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+	servers := []string{}
+	for _, server := range req.Servers {
+		server = strings.TrimSpace(server)
+		if server == "" || strings.Contains(server, ",") {
+			return fmt.Errorf("invalid server %q", server)
+		}
+		if !slices.Contains(servers, server) {
+			servers = append(servers, server)
+		}
+	}
+	c.Name, c.Type, c.Enabled, c.MinSeverity, c.Kinds, c.Servers = name, req.Type, req.Enabled, req.MinSeverity, kinds, servers
+	return nil
+}
+
+func (s *Server) handleListChatChannels(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	channels, err := s.store.ListChatChannels(r.Context(), user.OrgID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list chat channels")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	for i := range channels {
+		channels[i].URL = ""
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(channels)
+}
+
+// handleCreateChatChannel adds a chat channel to the user's organization.
+// Its URL is only returned here.
+func (s *Server) handleCreateChatChannel(w http.ResponseWriter, r *http.Request) {
+	req := chatChannelRequest{Enabled: true, MinSeverity: models.SeverityInfo}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	var c models.ChatChannel
+	if err := req.apply(&c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	c.ID = uuid.NewString()
+	c.OrgID = user.OrgID
+	c.CreatedAt = time.Now().UTC()
+	if err := s.store.CreateChatChannel(r.Context(), &c); err != nil {
+		log.Error().Err(err).Msg("failed to create chat channel")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	log.Info().Str("user", user.Email).Str("channel_id", c.ID).Str("name", c.Name).Str("type", c.Type).Msg("chat channel created")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(c)
+}
+
+// chatChannel returns the chat channel of the URL if it belongs to the
+// user's organization, or writes an error and returns nil.
+func (s *Server) chatChannel(w http.ResponseWriter, r *http.Request) *models.ChatChannel {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil
+	}
+	c, err := s.store.GetChatChannel(r.Context(), user.OrgID, chi.URLParam(r, "id"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get chat channel")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return nil
+	}
+	if c == nil {
+		http.Error(w, "chat channel not found", http.StatusNotFound)
+	}
+	return c
+}
+
+func (s *Server) handleGetChatChannel(w http.ResponseWriter, r *http.Request) {
+	c := s.chatChannel(w, r)
+	if c == nil {
+		return
+	}
+	c.URL = ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+// handleUpdateChatChannel changes a chat channel. Fields left out keep their
+// value.
+func (s *Server) handleUpdateChatChannel(w http.ResponseWriter, r *http.Request) {
+	c := s.chatChannel(w, r)
+	if c == nil {
+		return
+	}
+	req := chatChannelRequest{
+		Name:        c.Name,
+		Type:        c.Type,
+		Enabled:     c.Enabled,
+		MinSeverity: c.MinSeverity,
+		Kinds:       c.Kinds,
+		Servers:     c.Servers,
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := req.apply(c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := s.store.UpdateChatChannel(r.Context(), c); err != nil {
+		log.Error().Err(err).Msg("failed to update chat channel")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if req.URL == "" {
+		c.URL = ""
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+func (s *Server) handleDeleteChatChannel(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok, err := s.store.DeleteChatChannel(r.Context(), user.OrgID, chi.URLParam(r, "id"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete chat channel")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "chat channel not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTestChatChannel posts a sample notification to a chat channel right
+// away, even if it is disabled, and reports why it failed.
+func (s *Server) handleTestChatChannel(w http.ResponseWriter, r *http.Request) {
+	c := s.chatChannel(w, r)
+	if c == nil {
+		return
+	}
+	if err := s.chat.Send(r.Context(), *c, control.SampleNotification(c.OrgID, time.Now())); err != nil {
+		log.Warn().Err(err).Str("channel_id", c.ID).Msg("failed to post test chat message")
+		http.Error(w, "failed to post message: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,490 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/auth"
+	"github.com/ChronoCoders/sentra/internal/control"
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/ChronoCoders/sentra/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	invitationTTL     = 7 * 24 * time.Hour
+	minPasswordLength = 8
+)
+
+// userRoles are the roles users can be invited with.
+var userRoles = []string{"admin", "viewer"}
+
+// sampleEmailData is what templates are checked with before they are saved.
+func sampleEmailData(orgID, dashboardURL string) control.EmailData {
+	now := time.Now().UTC()
+	n := control.SampleNotification(orgID, now)
+	return control.EmailData{
+		OrgID:         orgID,
+		To:            "user@example.com",
+		Name:          "Example User",
+		DashboardURL:  dashboardURL,
+		Notification:  n,
+		Notifications: []models.Notification{n, n},
+		More:          1,
+		Invitation: models.Invitation{
+			OrgID:     orgID,
+			Email:     "user@example.com",
+			Role:      "viewer",
+			InvitedBy: "admin@example.com",
+			ExpiresAt: now.Add(invitationTTL),
+			CreatedAt: now,
+		},
+		AcceptURL: dashboardURL + "/invite.html?token=example",
+	}
+}
+
+// handleListEmailTemplates returns every template of the user's
+// organization, built-in ones marked as default.
+func (s *Server) handleListEmailTemplates(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	replaced, err := s.store.ListEmailTemplates(r.Context(), user.OrgID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list email templates")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	templates := make([]models.EmailTemplate, 0, len(models.EmailTemplateNames))
+	for _, name := range models.EmailTemplateNames {
+		t := control.DefaultEmailTemplate(name)
+		t.OrgID = user.OrgID
+		if i := slices.IndexFunc(replaced, func(t models.EmailTemplate) bool { return t.Name == name }); i >= 0 {
+			t = replaced[i]
+		}
+		templates = append(templates, t)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(templates)
+}
+
+// handlePutEmailTemplate replaces a template for the user's organization. It
+// is rendered with sample data first, so a broken template is rejected
+// instead of failing when it is needed.
+func (s *Server) handlePutEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if !slices.Contains(models.EmailTemplateNames, name) {
+		http.Error(w, "template not found", http.StatusNotFound)
+		return
+	}
+	var req struct {
+		Subject string `json:"subject"`
+		Text    string `json:"text"`
+		HTML    string `json:"html"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Subject) == "" || strings.TrimSpace(req.Text) == "" {
+		http.Error(w, "subject and text must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	t := models.EmailTemplate{
+		OrgID:     user.OrgID,
+		Name:      name,
+		Subject:   req.Subject,
+		Text:      req.Text,
+		HTML:      req.HTML,
+		UpdatedAt: time.Now().UTC(),
+	}
+	if _, _, _, err := control.RenderEmail(t, sampleEmailData(user.OrgID, s.email.DashboardURL())); err != nil {
+		http.Error(w, "invalid template: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.store.SetEmailTemplate(r.Context(), &t); err != nil {
+		log.Error().Err(err).Msg("failed to set email template")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// handleDeleteEmailTemplate goes back to the built-in template.
+func (s *Server) handleDeleteEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok, err := s.store.DeleteEmailTemplate(r.Context(), user.OrgID, chi.URLParam(r, "name"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete email template")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "template not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTestEmail emails a sample notification to the user right away,
+// reporting why it could not be sent.
+func (s *Server) handleTestEmail(w http.ResponseWriter, r *http.Request) {
+	if !s.email.Enabled() {
+		http.Error(w, "email is not configured", http.StatusServiceUnavailable)
+		return
+	}
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := s.email.SendTest(r.Context(), *user); err != nil {
+		log.Warn().Err(err).Str("to", user.Email).Msg("failed to send test email")
+		http.Error(w, "failed to send email: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetNotificationPreference returns how the user is notified.
+func (s *Server) handleGetNotificationPreference(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	pref, err := s.store.GetNotificationPreference(r.Context(), user.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get notification preference")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if pref == nil {
+		def := models.DefaultNotificationPreference(*user)
+		pref = &def
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pref)
+}
+
+// handlePutNotificationPreference sets how the user is notified.
+func (s *Server) handlePutNotificationPreference(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email       bool     `json:"email"`
+		MinSeverity string   `json:"min_severity"`
+		Kinds       []string `json:"kinds"`
+	}
+	req.MinSeverity = models.SeverityWarning
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(models.Severities, req.MinSeverity) {
+		http.Error(w, fmt.Sprintf("min_severity must be one of %s", strings.Join(models.Severities, ", ")), http.StatusBadRequest)
+		return
+	}
+	kinds := []string{}
+	for _, kind := range req.Kinds {
+		if !slices.Contains(models.NotifyKinds, kind) {
+			http.Error(w, fmt.Sprintf("unknown kind %q, must be one of %s", kind, strings.Join(models.NotifyKinds, ", ")), http.StatusBadRequest)
+			return
+		}
+		if !slices.Contains(kinds, kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	pref := models.NotificationPreference{
+		UserID:      user.ID,
+		OrgID:       user.OrgID,
+		Email:       req.Email,
+		MinSeverity: req.MinSeverity,
+		Kinds:       kinds,
+	}
+	if err := s.store.SetNotificationPreference(r.Context(), &pref); err != nil {
+		log.Error().Err(err).Msg("failed to set notification preference")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pref)
+}
+
+func (s *Server) handleListInvitations(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	invitations, err := s.store.ListInvitations(r.Context(), user.OrgID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list invitations")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invitations)
+}
+
+// handleCreateInvitation invites someone to the user's organization. The
+// invitation is emailed if email is configured; otherwise, or if sending
+// failed, the accept URL is returned to be passed on some other way.
+func (s *Server) handleCreateInvitation(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+		Name  string `json:"name"`
+		Role  string `json:"role"`
+	}
+	req.Role = "viewer"
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	addr, err := mail.ParseAddress(req.Email)
+	if err != nil {
+		http.Error(w, "email must be an email address", http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(userRoles, req.Role) {
+		http.Error(w, fmt.Sprintf("role must be one of %s", strings.Join(userRoles, ", ")), http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	existing, err := s.store.GetUserByEmail(r.Context(), addr.Address)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get user")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		http.Error(w, "a user with this email already exists", http.StatusConflict)
+		return
+	}
+
+	token, err := auth.GenerateSecret()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to generate invitation token")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now().UTC()
+	inv := &models.Invitation{
+		ID:        uuid.NewString(),
+		OrgID:     user.OrgID,
+		Email:     addr.Address,
+		Name:      strings.TrimSpace(req.Name),
+		Role:      req.Role,
+		InvitedBy: user.Email,
+		ExpiresAt: now.Add(invitationTTL),
+		CreatedAt: now,
+	}
+	if err := s.store.CreateInvitation(r.Context(), inv, auth.HashSecret(token)); err != nil {
+		log.Error().Err(err).Msg("failed to create invitation")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	log.Info().Str("user", user.Email).Str("email", inv.Email).Str("role", inv.Role).Msg("invitation created")
+
+	resp := struct {
+		*models.Invitation
+		Emailed   bool   `json:"emailed"`
+		AcceptURL string `json:"accept_url,omitempty"`
+	}{Invitation: inv}
+	acceptURL := s.email.DashboardURL() + "/invite.html?token=" + url.QueryEscape(token)
+	if s.email.Enabled() {
+		if err := s.email.SendInvitation(r.Context(), *inv, acceptURL); err != nil {
+			log.Warn().Err(err).Str("email", inv.Email).Msg("failed to email invitation")
+		} else {
+			resp.Emailed = true
+		}
+	}
+	if !resp.Emailed {
+		resp.AcceptURL = acceptURL
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) handleDeleteInvitation(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok, err := s.store.DeleteInvitation(r.Context(), user.OrgID, chi.URLParam(r, "id"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete invitation")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "invitation not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAcceptInvitation creates the invited user with the password they
+// chose and logs them in.
+func (s *Server) handleAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		http.Error(w, fmt.Sprintf("password must be at least %d characters", minPasswordLength), http.StatusBadRequest)
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		// Passwords longer than bcrypt accepts.
+		http.Error(w, "invalid password", http.StatusBadRequest)
+		return
+	}
+
+	user := &models.User{
+		ID:        uuid.NewString(),
+		Name:      strings.TrimSpace(req.Name),
+		Password:  string(hash),
+		CreatedAt: time.Now().UTC(),
+	}
+	switch err := s.store.AcceptInvitation(r.Context(), auth.HashSecret(req.Token), user); {
+	case errors.Is(err, store.ErrInvalidInvitation):
+		http.Error(w, "invalid or expired invitation", http.StatusUnauthorized)
+		return
+	case errors.Is(err, store.ErrUserExists):
+		http.Error(w, "a user with this email already exists", http.StatusConflict)
+		return
+	case err != nil:
+		log.Error().Err(err).Msg("failed to accept invitation")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	log.Info().Str("user", user.Email).Str("role", user.Role).Msg("invitation accepted")
+
+	token, err := s.auth.GenerateAccessToken(user.ID, user.Role)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to generate token")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"token": token, "email": user.Email})
+}
+
+func (s *Server) handleListPeerExpiries(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	expiries, err := s.store.ListPeerExpiries(r.Context(), user.OrgID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list peer expiries")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(expiries)
+}
+
+// handleSetPeerExpiry sets when a peer expires. Its organization is warned
+// peer_expiry_warning ahead and told once it expired.
+func (s *Server) handleSetPeerExpiry(w http.ResponseWriter, r *http.Request) {
+	publicKey, err := peerKeyParam(r)
+	if err != nil || publicKey == "" {
+		http.Error(w, "invalid public key", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		ExpiresAt string `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	expiresAt, err := parseQueryTime(req.ExpiresAt)
+	if err != nil {
+		http.Error(w, "expires_at must be an RFC 3339 time or Unix seconds", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	e := &models.PeerExpiry{OrgID: user.OrgID, PublicKey: publicKey, ExpiresAt: expiresAt.UTC()}
+	if err := s.store.SetPeerExpiry(r.Context(), e); err != nil {
+		log.Error().Err(err).Msg("failed to set peer expiry")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	s.expiries.Check()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(e)
+}
+
+func (s *Server) handleDeletePeerExpiry(w http.ResponseWriter, r *http.Request) {
+	publicKey, err := peerKeyParam(r)
+	if err != nil {
+		http.Error(w, "invalid public key", http.StatusBadRequest)
+		return
+	}
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok, err := s.store.DeletePeerExpiry(r.Context(), user.OrgID, publicKey)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete peer expiry")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "peer expiry not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
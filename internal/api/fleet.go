@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+// handleFleetAgents lists the agent inventory, optionally filtered by version
+// or capability.
+func (s *Server) handleFleetAgents(w http.ResponseWriter, r *http.Request) {
+	version := r.URL.Query().Get("version")
+	capability := r.URL.Query().Get("capability")
+
+	agents := []models.AgentInventory{}
+	for _, a := range s.inventory.List() {
+		if version != "" && a.Version != version {
+			continue
+		}
+		if capability != "" && !a.HasCapability(capability) {
+			continue
+		}
+		agents = append(agents, a)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(agents)
+}
+
+type fleetVersion struct {
+	Version         string   `json:"version"`
+	ProtocolVersion int      `json:"protocol_version"`
+	Count           int      `json:"count"`
+	Servers         []string `json:"servers"`
+}
+
+// handleFleetVersions groups servers by agent version for upgrade planning.
+func (s *Server) handleFleetVersions(w http.ResponseWriter, r *http.Request) {
+	byVersion := make(map[string]*fleetVersion)
+	for _, a := range s.inventory.List() {
+		v, ok := byVersion[a.Version]
+		if !ok {
+			v = &fleetVersion{Version: a.Version, ProtocolVersion: a.ProtocolVersion}
+			byVersion[a.Version] = v
+		}
+		v.Count++
+		v.Servers = append(v.Servers, a.ServerID)
+	}
+
+	versions := make([]*fleetVersion, 0, len(byVersion))
+	for _, v := range byVersion {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
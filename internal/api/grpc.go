@@ -0,0 +1,274 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ChronoCoders/sentra/internal/agentpb"
+	"github.com/ChronoCoders/sentra/internal/control"
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// NewGRPCServer returns a gRPC server for the agent protocol. tlsConfig may be
+// nil to serve without TLS.
+func (s *Server) NewGRPCServer(tlsConfig *tls.Config) *grpc.Server {
+	opts := []grpc.ServerOption{grpc.StreamInterceptor(s.grpcAgentAuth)}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	srv := grpc.NewServer(opts...)
+	agentpb.RegisterAgentServiceServer(srv, &grpcAgentService{s: s})
+	return srv
+}
+
+// grpcAgentAuth authenticates agents like agentMiddleware does for HTTP.
+func (s *Server) grpcAgentAuth(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx := ss.Context()
+	var state *tls.ConnectionState
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			state = &tlsInfo.State
+		}
+	}
+	var authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			authorization = values[0]
+		}
+	}
+
+	agent, err := s.authenticateAgent(ctx, state, authorization, !s.cfg.RequireClientCert)
+	switch {
+	case errors.As(err, new(agentAuthError)):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case err != nil:
+		log.Error().Err(err).Msg("failed to authenticate agent")
+		return status.Error(codes.Internal, "internal error")
+	}
+	if agent != nil {
+		ss = &agentServerStream{ServerStream: ss, ctx: context.WithValue(ctx, agentContextKey, agent)}
+	}
+	return handler(srv, ss)
+}
+
+type agentServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *agentServerStream) Context() context.Context {
+	return s.ctx
+}
+
+type grpcAgentService struct {
+	agentpb.UnimplementedAgentServiceServer
+	s *Server
+}
+
+// StreamReports ingests reports until the agent closes the stream, a report
+// is rejected or the agent is revoked.
+func (g *grpcAgentService) StreamReports(stream agentpb.AgentService_StreamReportsServer) error {
+	ctx := stream.Context()
+	var remoteAddr string
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+
+	revoked := make(chan struct{})
+	if agent := agentFromContext(ctx); agent != nil {
+		var once sync.Once
+		remove := g.s.agentConns.add(agent.ID, func() { once.Do(func() { close(revoked) }) })
+		defer remove()
+	}
+
+	reqs := make(chan *agentpb.ReportRequest)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case reqs <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var accepted uint64
+	for {
+		var req *agentpb.ReportRequest
+		select {
+		case req = <-reqs:
+		case err := <-errc:
+			if err == io.EOF {
+				return stream.SendAndClose(&agentpb.ReportSummary{Accepted: accepted})
+			}
+			return err
+		case <-revoked:
+			return status.Error(codes.Unauthenticated, errAgentRevoked.Error())
+		}
+		if req.GetEvent() == nil {
+			return status.Error(codes.InvalidArgument, "missing event")
+		}
+
+		payload, err := agentpb.EventPayload(req.GetEvent())
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		event := agentpb.EventFromProto(req.GetEvent())
+		err = g.s.ingestReport(ctx, &event, payload, agentpb.SignatureFromProto(req.GetSignature()), remoteAddr)
+		switch {
+		case err == nil:
+			accepted++
+		case errors.Is(err, control.ErrResyncRequired):
+			return status.Error(codes.FailedPrecondition, err.Error())
+		case errors.Is(err, errForeignServer), errors.Is(err, control.ErrIdentityConflict):
+			return status.Error(codes.PermissionDenied, err.Error())
+		case errors.Is(err, errInvalidSignature), errors.Is(err, errAgentRevoked):
+			return status.Error(codes.Unauthenticated, err.Error())
+		default:
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+}
+
+// Commands makes an enrolled agent reachable for commands while the stream is open.
+func (g *grpcAgentService) Commands(stream agentpb.AgentService_CommandsServer) error {
+	agent := agentFromContext(stream.Context())
+	if agent == nil {
+		return status.Error(codes.PermissionDenied, "commands require an enrolled agent")
+	}
+
+	session := newGRPCSession(stream)
+	g.s.channels.Register(agent.ServerID, session)
+	remove := g.s.agentConns.add(agent.ID, session.revoke)
+	log.Info().Str("agent_id", agent.ID).Str("server_id", agent.ServerID).Msg("agent gRPC command stream connected")
+	go g.s.configs.Push(context.Background(), agent.ServerID)
+
+	err := session.run()
+
+	remove()
+	g.s.channels.Unregister(agent.ServerID, session)
+	log.Info().Str("agent_id", agent.ID).Str("server_id", agent.ServerID).Msg("agent gRPC command stream disconnected")
+	return err
+}
+
+// grpcSession is the control plane end of an agent's gRPC command stream.
+type grpcSession struct {
+	stream agentpb.AgentService_CommandsServer
+	nextID atomic.Uint64
+	done   chan struct{}
+	once   sync.Once
+	// revoked is set if the session was closed because the agent was revoked.
+	revoked atomic.Bool
+
+	sendMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]chan models.CommandResult
+}
+
+func newGRPCSession(stream agentpb.AgentService_CommandsServer) *grpcSession {
+	return &grpcSession{
+		stream:  stream,
+		done:    make(chan struct{}),
+		pending: make(map[string]chan models.CommandResult),
+	}
+}
+
+// run delivers command results until the stream ends or the session is closed.
+func (g *grpcSession) run() error {
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			res, err := g.stream.Recv()
+			if err != nil {
+				errc <- err
+				return
+			}
+			// The agent opens the stream with an empty result.
+			if res.GetId() == "" {
+				continue
+			}
+			g.mu.Lock()
+			ch, ok := g.pending[res.GetId()]
+			delete(g.pending, res.GetId())
+			g.mu.Unlock()
+			if ok {
+				ch <- agentpb.ResultFromProto(res)
+			}
+		}
+	}()
+
+	select {
+	case err := <-errc:
+		g.Close()
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	case <-g.done:
+		if g.revoked.Load() {
+			return status.Error(codes.Unauthenticated, errAgentRevoked.Error())
+		}
+		return status.Error(codes.Aborted, "replaced by a newer connection")
+	}
+}
+
+// revoke closes the session of a revoked agent.
+func (g *grpcSession) revoke() {
+	g.revoked.Store(true)
+	g.Close()
+}
+
+// Close ends the session. Pending commands fail with control.ErrSessionClosed.
+func (g *grpcSession) Close() {
+	g.once.Do(func() { close(g.done) })
+}
+
+// Execute sends a command to the agent and waits for its result.
+func (g *grpcSession) Execute(ctx context.Context, cmd models.Command) (models.CommandResult, error) {
+	id := strconv.FormatUint(g.nextID.Add(1), 10)
+	ch := make(chan models.CommandResult, 1)
+	g.mu.Lock()
+	g.pending[id] = ch
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.pending, id)
+		g.mu.Unlock()
+	}()
+
+	g.sendMu.Lock()
+	err := g.stream.Send(agentpb.CommandToProto(id, cmd))
+	g.sendMu.Unlock()
+	if err != nil {
+		return models.CommandResult{}, control.ErrSessionClosed
+	}
+
+	select {
+	case result := <-ch:
+		return result, nil
+	case <-g.done:
+		return models.CommandResult{}, control.ErrSessionClosed
+	case <-ctx.Done():
+		return models.CommandResult{}, ctx.Err()
+	}
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/agentpb"
+	"github.com/ChronoCoders/sentra/internal/config"
+	"github.com/ChronoCoders/sentra/internal/control"
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/ChronoCoders/sentra/internal/signing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCStreamsClosedOnRevoke(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db := newTestStore(t)
+	key := enrollTestAgent(t, db, "agent-1", "srv-1", "credential")
+	bus := control.NewEventBus()
+	client := control.NewStatusCache(bus, nil, db)
+	inventory, err := control.NewInventory(ctx, bus, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	channels := control.NewChannelHub(inventory)
+	cfg := &config.Config{JWTSecret: "secret"}
+	srv := NewServer(cfg, db, client, nil, nil, nil, channels, inventory, nil, control.NewConfigs(bus, db, channels, inventory), nil, nil, nil, nil, nil, nil)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := srv.NewGRPCServer(nil)
+	go gs.Serve(ln)
+	defer gs.Stop()
+	conn, err := grpc.NewClient(ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	agentClient := agentpb.NewAgentServiceClient(conn)
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer credential")
+
+	commands, err := agentClient.Commands(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := commands.Send(&agentpb.CommandResult{}); err != nil {
+		t.Fatal(err)
+	}
+	reports, err := agentClient.StreamReports(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &agentpb.ReportRequest{Event: agentpb.EventToProto(models.StatusEvent{ServerID: "srv-1", Status: &models.Status{}, Time: time.Now()})}
+	payload, err := agentpb.EventPayload(req.Event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := signing.Sign(key, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Signature = agentpb.SignatureToProto(sig)
+	if err := reports.Send(req); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait until both streams are served.
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		cached, _ := client.GetStatus(ctx, "srv-1")
+		if cached != nil && channels.Connected("srv-1") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("streams were not served")
+		}
+	}
+
+	if _, err := db.RevokeAgent(ctx, models.DefaultOrgID, "agent-1", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	srv.agentConns.closeAll("agent-1")
+
+	if _, err := reports.CloseAndRecv(); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("report stream ended with %v, want %v", err, codes.Unauthenticated)
+	}
+	for {
+		_, err := commands.Recv()
+		if err == nil {
+			continue
+		}
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("command stream ended with %v, want %v", err, codes.Unauthenticated)
+		}
+		break
+	}
+	for deadline := time.Now().Add(5 * time.Second); channels.Connected("srv-1"); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("revoked agent is still reachable for commands")
+		}
+	}
+}
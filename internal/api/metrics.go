@@ -0,0 +1,246 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// defaultMetricBuckets is how many buckets a query returns without a step.
+	defaultMetricBuckets = 300
+	// maxMetricBuckets bounds the buckets of a single query.
+	maxMetricBuckets = 10000
+)
+
+// metricsQuery is a parsed history query.
+type metricsQuery struct {
+	from, to   time.Time
+	step       int // seconds
+	resolution int
+	metrics    []string
+}
+
+// handleServerMetrics returns the metric history of a server.
+func (s *Server) handleServerMetrics(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	if !s.checkServer(w, r, serverID) {
+		return
+	}
+	q, err := s.parseMetricsQuery(r, models.ServerMetrics)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	points, err := s.store.QueryServerMetrics(r.Context(), serverID, q.resolution, q.from, q.to, q.step, q.metrics)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to query server metrics")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	writeMetrics(w, r, alignMetrics(models.MetricsResult{ServerID: serverID}, q, points))
+}
+
+// handlePeerMetrics returns the history of a peer's counters and handshakes.
+func (s *Server) handlePeerMetrics(w http.ResponseWriter, r *http.Request) {
+	serverID := chi.URLParam(r, "id")
+	publicKey, err := peerKeyParam(r)
+	if err != nil {
+		http.Error(w, "invalid public key", http.StatusBadRequest)
+		return
+	}
+	if !s.checkServer(w, r, serverID) {
+		return
+	}
+	q, err := s.parseMetricsQuery(r, models.PeerMetrics)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	iface := r.URL.Query().Get("interface")
+	points, err := s.store.QueryPeerMetrics(r.Context(), serverID, iface, publicKey, q.resolution, q.from, q.to, q.step, q.metrics)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to query peer metrics")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	peer := models.Peer{Interface: iface, PublicKey: publicKey}.Key()
+	writeMetrics(w, r, alignMetrics(models.MetricsResult{ServerID: serverID, Peer: peer}, q, points))
+}
+
+// checkServer writes an error and returns false unless serverID is a
+// registered server of the user's organization.
+func (s *Server) checkServer(w http.ResponseWriter, r *http.Request, serverID string) bool {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	server, err := s.store.GetServer(r.Context(), user.OrgID, serverID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get server")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return false
+	}
+	if server == nil {
+		http.Error(w, "server not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// parseMetricsQuery reads from and to (RFC 3339 or Unix seconds, default the
+// last hour), step (a duration or seconds) and metrics (comma-separated,
+// default all of known). The coarsest tier that is fine enough for the step
+// is chosen, or a coarser one if it no longer holds samples from the start of
+// the range. The step is rounded up to whole samples of that tier.
+func (s *Server) parseMetricsQuery(r *http.Request, known []string) (metricsQuery, error) {
+	params := r.URL.Query()
+	now := time.Now()
+	q := metricsQuery{to: now, metrics: known}
+
+	var err error
+	if v := params.Get("to"); v != "" {
+		if q.to, err = parseQueryTime(v); err != nil {
+			return q, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	q.from = q.to.Add(-time.Hour)
+	if v := params.Get("from"); v != "" {
+		if q.from, err = parseQueryTime(v); err != nil {
+			return q, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if !q.to.After(q.from) {
+		return q, errors.New("from must be before to")
+	}
+
+	span := q.to.Sub(q.from)
+	step := (span + defaultMetricBuckets - 1) / defaultMetricBuckets
+	if v := params.Get("step"); v != "" {
+		if step, err = parseQueryStep(v); err != nil {
+			return q, fmt.Errorf("invalid step: %w", err)
+		}
+	}
+
+	switch {
+	case step < time.Minute && q.from.After(now.Add(-s.cfg.HistoryRawRetention)):
+		q.resolution = models.ResolutionRaw
+	case step < time.Hour && q.from.After(now.Add(-s.cfg.HistoryMinuteRetention)):
+		q.resolution = models.ResolutionMinute
+	default:
+		q.resolution = models.ResolutionHour
+	}
+	unit := max(time.Duration(q.resolution)*time.Second, time.Second)
+	step = (step + unit - 1) / unit * unit
+	q.step = int(step / time.Second)
+	if span/step > maxMetricBuckets {
+		return q, fmt.Errorf("step %s yields more than %d buckets", step, maxMetricBuckets)
+	}
+
+	if v := params.Get("metrics"); v != "" {
+		q.metrics = nil
+		for _, metric := range strings.Split(v, ",") {
+			metric = strings.TrimSpace(metric)
+			if !slices.Contains(known, metric) {
+				return q, fmt.Errorf("unknown metric %q, must be one of %s", metric, strings.Join(known, ", "))
+			}
+			if !slices.Contains(q.metrics, metric) {
+				q.metrics = append(q.metrics, metric)
+			}
+		}
+	}
+	return q, nil
+}
+
+func parseQueryTime(v string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func parseQueryStep(v string) (time.Duration, error) {
+	if _, err := strconv.Atoi(v); err == nil {
+		v += "s"
+	}
+	step, err := time.ParseDuration(v)
+	if err == nil && step < time.Second {
+		err = errors.New("must be at least 1s")
+	}
+	return step, err
+}
+
+// alignMetrics lays the points out on the buckets of q, with a series per
+// metric.
+func alignMetrics(res models.MetricsResult, q metricsQuery, points []models.MetricPoint) models.MetricsResult {
+	res.From, res.To, res.Step, res.Resolution = q.from.UTC(), q.to.UTC(), q.step, q.resolution
+
+	step := int64(q.step)
+	first := q.from.Unix() / step * step
+	index := make(map[int64]int)
+	res.Timestamps = []time.Time{}
+	for ts := first; ts < q.to.Unix(); ts += step {
+		index[ts] = len(res.Timestamps)
+		res.Timestamps = append(res.Timestamps, time.Unix(ts, 0).UTC())
+	}
+
+	series := make(map[string]*models.MetricSeries, len(q.metrics))
+	res.Series = make([]models.MetricSeries, len(q.metrics))
+	for i, metric := range q.metrics {
+		n := len(res.Timestamps)
+		res.Series[i] = models.MetricSeries{Metric: metric, Min: make([]*float64, n), Avg: make([]*float64, n), Max: make([]*float64, n)}
+		series[metric] = &res.Series[i]
+	}
+	for _, p := range points {
+		i, ok := index[p.Time.Unix()]
+		if !ok {
+			continue
+		}
+		ms := series[p.Metric]
+		ms.Min[i], ms.Avg[i], ms.Max[i] = &p.Min, &p.Avg, &p.Max
+	}
+	return res
+}
+
+// writeMetrics writes res as JSON, or as CSV with a row per bucket if the
+// client asked for it with format=csv or an Accept header.
+func writeMetrics(w http.ResponseWriter, r *http.Request, res models.MetricsResult) {
+	if r.URL.Query().Get("format") != "csv" && !strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	cw := csv.NewWriter(w)
+	header := []string{"time"}
+	for _, ms := range res.Series {
+		header = append(header, ms.Metric+"_min", ms.Metric+"_avg", ms.Metric+"_max")
+	}
+	cw.Write(header)
+	format := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	}
+	for i, ts := range res.Timestamps {
+		row := []string{ts.Format(time.RFC3339)}
+		for _, ms := range res.Series {
+			row = append(row, format(ms.Min[i]), format(ms.Avg[i]), format(ms.Max[i]))
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+}
@@ -2,16 +2,24 @@ package api
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/ChronoCoders/sentra/internal/auth"
+	"github.com/ChronoCoders/sentra/internal/models"
+	sentratls "github.com/ChronoCoders/sentra/internal/tls"
+	"github.com/rs/zerolog/log"
 )
 
 type contextKey string
 
 const (
-	userContextKey = contextKey("user")
+	userContextKey  = contextKey("user")
+	agentContextKey = contextKey("agent")
 )
 
 func (s *Server) jwtMiddleware(next http.Handler) http.Handler {
@@ -70,3 +78,105 @@ func (s *Server) RequireRole(requiredRole string) func(http.Handler) http.Handle
 		})
 	}
 }
+
+// agentMiddleware authenticates agent requests. Agents are identified by a
+// client certificate issued by the internal CA or, unless client certificates
+// are required, by their enrollment credential. The shared SENTRA_AUTH_TOKEN is
+// still accepted for agents that have not enrolled yet; such requests carry no
+// agent in the context.
+func (s *Server) agentMiddleware(next http.Handler) http.Handler {
+	return s.agentAuth(next, !s.cfg.RequireClientCert)
+}
+
+// agentRenewMiddleware always accepts the enrollment credential so that an
+// agent whose certificate expired can still obtain a new one.
+func (s *Server) agentRenewMiddleware(next http.Handler) http.Handler {
+	return s.agentAuth(next, true)
+}
+
+func (s *Server) agentAuth(next http.Handler, allowBearer bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agent, err := s.authenticateAgent(r.Context(), r.TLS, r.Header.Get("Authorization"), allowBearer)
+		switch {
+		case errors.As(err, new(agentAuthError)):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		case err != nil:
+			log.Error().Err(err).Msg("failed to authenticate agent")
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if agent != nil {
+			r = r.WithContext(context.WithValue(r.Context(), agentContextKey, agent))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// agentAuthError is the reason an agent is turned away.
+type agentAuthError string
+
+func (e agentAuthError) Error() string { return string(e) }
+
+// authenticateAgent identifies an agent by its verified client certificate or,
+// if allowBearer is set, by the credential in authorization. It returns nil
+// without error for the legacy shared token.
+func (s *Server) authenticateAgent(ctx context.Context, state *tls.ConnectionState, authorization string, allowBearer bool) (*models.Agent, error) {
+	if state != nil && len(state.VerifiedChains) > 0 {
+		agent, err := s.agentFromCertificate(ctx, state.VerifiedChains[0][0])
+		if err != nil {
+			return nil, err
+		}
+		if agent == nil {
+			return nil, agentAuthError("certificate revoked")
+		}
+		return agent, nil
+	}
+
+	if !allowBearer {
+		return nil, agentAuthError("client certificate required")
+	}
+
+	credential, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || credential == "" {
+		return nil, agentAuthError("missing authorization")
+	}
+
+	if s.cfg.AuthToken != "" && credential == s.cfg.AuthToken {
+		return nil, nil
+	}
+
+	agent, err := s.store.GetAgentByCredential(ctx, auth.HashSecret(credential))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up agent credential: %w", err)
+	}
+	if agent == nil || agent.RevokedAt != nil {
+		return nil, agentAuthError("unauthorized")
+	}
+	return agent, nil
+}
+
+// agentFromCertificate maps a verified client certificate to its agent. It
+// returns nil if the certificate is unknown or revoked, or the agent is revoked.
+func (s *Server) agentFromCertificate(ctx context.Context, leaf *x509.Certificate) (*models.Agent, error) {
+	cert, err := s.store.GetAgentCertificate(ctx, sentratls.SerialString(leaf.SerialNumber))
+	if err != nil || cert == nil || cert.RevokedAt != nil {
+		return nil, err
+	}
+	if cert.AgentID != leaf.Subject.CommonName {
+		return nil, nil
+	}
+
+	agent, err := s.store.GetAgent(ctx, cert.AgentID)
+	if err != nil || agent == nil || agent.RevokedAt != nil {
+		return nil, err
+	}
+	return agent, nil
+}
+
+// agentFromContext returns the enrolled agent of the request, or nil for
+// requests authenticated with the legacy shared token.
+func agentFromContext(ctx context.Context) *models.Agent {
+	agent, _ := ctx.Value(agentContextKey).(*models.Agent)
+	return agent
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ChronoCoders/sentra/internal/agentpb"
+	"github.com/ChronoCoders/sentra/internal/control"
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/ChronoCoders/sentra/internal/natsbus"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// NATSAuth authenticates agents connecting to the embedded NATS server like
+// agentMiddleware does for HTTP. Only enrolled agents are accepted.
+func (s *Server) NATSAuth(state *tls.ConnectionState, credential string) (*models.Agent, error) {
+	var authorization string
+	if credential != "" {
+		authorization = "Bearer " + credential
+	}
+	agent, err := s.authenticateAgent(context.Background(), state, authorization, !s.cfg.RequireClientCert)
+	if errors.As(err, new(agentAuthError)) {
+		return nil, nil
+	}
+	return agent, err
+}
+
+// ServeNATS ingests agent reports from the report stream and makes agents
+// reachable for commands over nc until ctx is cancelled. external is set if
+// nc is connected to a NATS server the control plane does not embed, which
+// cannot tell agents apart, so that only signed reports are accepted.
+func (s *Server) ServeNATS(ctx context.Context, nc *nats.Conn, external bool) error {
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return err
+	}
+	stream, err := natsbus.EnsureStream(ctx, js, reportSignatureWindow)
+	if err != nil {
+		return fmt.Errorf("failed to create report stream: %w", err)
+	}
+	consumer, err := stream.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+		Durable:   natsbus.ConsumerName,
+		AckPolicy: jetstream.AckExplicitPolicy,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create report consumer: %w", err)
+	}
+
+	b := &natsBridge{s: s, nc: nc, external: external, targets: make(map[string]*natsTarget)}
+	hello, err := nc.Subscribe(natsbus.AllServers(natsbus.KindHello), func(msg *nats.Msg) {
+		b.hello(ctx, msg)
+	})
+	if err != nil {
+		return err
+	}
+	defer hello.Unsubscribe()
+
+	reports, err := consumer.Consume(func(msg jetstream.Msg) {
+		b.report(ctx, msg)
+	})
+	if err != nil {
+		return err
+	}
+	defer reports.Stop()
+
+	log.Info().Msg("serving agents over NATS")
+	<-ctx.Done()
+	return nil
+}
+
+// natsBridge connects agents on NATS to the control plane.
+type natsBridge struct {
+	s        *Server
+	nc       *nats.Conn
+	external bool
+
+	mu      sync.Mutex
+	targets map[string]*natsTarget
+}
+
+// agent returns the enrolled agent that published on subject. On an embedded
+// server agents can only publish on their own subjects; on an external one
+// the subject is all there is, so report only accepts signed reports there.
+func (b *natsBridge) agent(ctx context.Context, subject, agentID string) (*models.Agent, error) {
+	orgID, serverID, _, ok := natsbus.ParseSubject(subject)
+	if !ok {
+		return nil, fmt.Errorf("invalid subject %q", subject)
+	}
+	agent, err := b.s.store.GetAgent(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+	if agent == nil || agent.RevokedAt != nil || agent.OrgID != orgID || agent.ServerID != serverID {
+		return nil, fmt.Errorf("agent %q is not enrolled for %s", agentID, subject)
+	}
+	return agent, nil
+}
+
+// register makes the agent's server reachable for commands through NATS.
+func (b *natsBridge) register(agent *models.Agent) {
+	b.mu.Lock()
+	target, ok := b.targets[agent.ServerID]
+	if !ok {
+		target = &natsTarget{
+			bridge:   b,
+			serverID: agent.ServerID,
+			subject:  natsbus.Subject(agent.OrgID, agent.ServerID, natsbus.KindCommands),
+		}
+		b.targets[agent.ServerID] = target
+	}
+	b.mu.Unlock()
+	b.s.channels.Register(agent.ServerID, target)
+}
+
+func (b *natsBridge) unregister(target *natsTarget) {
+	b.mu.Lock()
+	if b.targets[target.serverID] == target {
+		delete(b.targets, target.serverID)
+	}
+	b.mu.Unlock()
+	b.s.channels.Unregister(target.serverID, target)
+}
+
+func (b *natsBridge) hello(ctx context.Context, msg *nats.Msg) {
+	agent, err := b.agent(ctx, msg.Subject, msg.Header.Get(natsbus.AgentHeader))
+	if err != nil {
+		log.Warn().Err(err).Msg("ignoring NATS agent announcement")
+		return
+	}
+	b.register(agent)
+	log.Info().Str("agent_id", agent.ID).Str("server_id", agent.ServerID).Msg("agent NATS connection announced")
+	go b.s.configs.Push(ctx, agent.ServerID)
+}
+
+func (b *natsBridge) report(ctx context.Context, msg jetstream.Msg) {
+	agent, err := b.agent(ctx, msg.Subject(), msg.Headers().Get(natsbus.AgentHeader))
+	if err != nil {
+		log.Warn().Err(err).Msg("rejected NATS report")
+		msg.Term()
+		return
+	}
+	var req agentpb.ReportRequest
+	if err := proto.Unmarshal(msg.Data(), &req); err != nil || req.GetEvent() == nil {
+		log.Warn().Err(err).Str("agent_id", agent.ID).Msg("rejected malformed NATS report")
+		msg.Term()
+		return
+	}
+	if b.external && req.GetSignature() == nil {
+		b.s.recordSecurityEvent(ctx, agent, agent.ServerID, models.SecurityMissingSignature, "report over an external NATS server is not signed", "nats")
+		msg.Ack()
+		return
+	}
+	// Agents that only report are still reachable for commands, e.g. after
+	// the control plane restarted.
+	b.register(agent)
+
+	payload, err := agentpb.EventPayload(req.GetEvent())
+	if err != nil {
+		log.Warn().Err(err).Str("agent_id", agent.ID).Msg("rejected malformed NATS report")
+		msg.Term()
+		return
+	}
+	event := agentpb.EventFromProto(req.GetEvent())
+	err = b.s.ingestReport(context.WithValue(ctx, agentContextKey, agent), &event, payload, agentpb.SignatureFromProto(req.GetSignature()), "nats")
+	switch {
+	case err == nil:
+	case errors.Is(err, control.ErrResyncRequired):
+		if err := b.nc.Publish(natsbus.Subject(agent.OrgID, agent.ServerID, natsbus.KindResync), nil); err != nil {
+			log.Error().Err(err).Str("server_id", agent.ServerID).Msg("failed to request resync")
+		}
+	default:
+		log.Warn().Err(err).Str("agent_id", agent.ID).Str("server_id", event.ServerID).Msg("rejected NATS report")
+	}
+	// Rejected reports are not redelivered either.
+	msg.Ack()
+}
+
+// natsTarget executes commands on an agent through NATS requests.
+type natsTarget struct {
+	bridge   *natsBridge
+	serverID string
+	subject  string
+}
+
+func (t *natsTarget) Execute(ctx context.Context, cmd models.Command) (models.CommandResult, error) {
+	data, err := proto.Marshal(agentpb.CommandToProto(uuid.NewString(), cmd))
+	if err != nil {
+		return models.CommandResult{}, err
+	}
+	reply, err := t.bridge.nc.RequestWithContext(ctx, t.subject, data)
+	if errors.Is(err, nats.ErrNoResponders) {
+		t.bridge.unregister(t)
+		return models.CommandResult{}, control.ErrAgentNotConnected
+	}
+	if err != nil {
+		return models.CommandResult{}, err
+	}
+
+	var res agentpb.CommandResult
+	if err := proto.Unmarshal(reply.Data, &res); err != nil {
+		return models.CommandResult{}, fmt.Errorf("invalid command result: %w", err)
+	}
+	return agentpb.ResultFromProto(&res), nil
+}
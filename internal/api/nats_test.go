@@ -0,0 +1,379 @@
+package api
+
+import (
+	"context"
+	"crypto/ed25519"
+	"net"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/agent"
+	"github.com/ChronoCoders/sentra/internal/agentpb"
+	"github.com/ChronoCoders/sentra/internal/config"
+	"github.com/ChronoCoders/sentra/internal/control"
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/ChronoCoders/sentra/internal/natsbus"
+	"github.com/ChronoCoders/sentra/internal/signing"
+	"github.com/ChronoCoders/sentra/internal/store"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	natsTestAgentID  = "agent-1"
+	natsTestServerID = "srv-1"
+)
+
+// natsTest is a control plane serving agents over an embedded NATS server,
+// and an enrolled agent connected to it.
+type natsTest struct {
+	db       *store.Store
+	client   *control.StatusCache
+	consumer jetstream.Consumer
+	stream   jetstream.Stream
+	resync   *nats.Subscription
+
+	key      ed25519.PrivateKey
+	reporter *agent.NATSReporter
+	agentJS  jetstream.JetStream
+	// published is how many reports the agent published.
+	published uint64
+}
+
+// natsTestOptions select how the control plane and the agent are set up.
+type natsTestOptions struct {
+	// external serves NATS as if the server was not embedded.
+	external bool
+	// keyless enrolls the agent without a signing key, and does not
+	// require signed reports.
+	keyless bool
+}
+
+func newNATSTest(t *testing.T, opts natsTestOptions) *natsTest {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	dir := t.TempDir()
+
+	db := newTestStore(t)
+	bus := control.NewEventBus()
+	client := control.NewStatusCache(bus, nil, db)
+	inventory, err := control.NewInventory(ctx, bus, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{JWTSecret: "secret", RequireSignedReports: !opts.keyless}
+	srv := NewServer(cfg, db, client, nil, nil, nil, control.NewChannelHub(inventory), inventory, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	credential := "agent-credential"
+	var key ed25519.PrivateKey
+	if opts.keyless {
+		enrollAgent(t, db, natsTestAgentID, natsTestServerID, credential, nil)
+	} else {
+		key = enrollTestAgent(t, db, natsTestAgentID, natsTestServerID, credential)
+	}
+
+	// Agents connect over the network, so the server needs a port.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	ns, err := natsbus.StartServer(natsbus.ServerConfig{
+		Host:     "127.0.0.1",
+		Port:     port,
+		StoreDir: filepath.Join(dir, "nats"),
+		Auth:     srv.NATSAuth,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ns.Shutdown)
+	nc, err := ns.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	served := make(chan error, 1)
+	go func() { served <- srv.ServeNATS(ctx, nc, opts.external) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Errorf("ServeNATS: %v", err)
+		}
+	})
+
+	resync, err := nc.SubscribeSync(natsbus.Subject(models.DefaultOrgID, natsTestServerID, natsbus.KindResync))
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ServeNATS creates the stream and consumer.
+	var consumer jetstream.Consumer
+	for deadline := time.Now().Add(5 * time.Second); consumer == nil; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("report consumer was not created")
+		}
+		consumer, _ = js.Consumer(ctx, natsbus.StreamName, natsbus.ConsumerName)
+	}
+	stream, err := js.Stream(ctx, natsbus.StreamName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := "nats://127.0.0.1:" + strconv.Itoa(port)
+	creds := &agent.Credentials{AgentID: natsTestAgentID, OrgID: models.DefaultOrgID, ServerID: natsTestServerID, Credential: credential}
+	reporter, err := agent.NewNATSReporter(url, creds, credential, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { reporter.Close() })
+	if key != nil {
+		reporter.SetSigner(key)
+	}
+	agentConn, err := nats.Connect(url, nats.Token(credential), nats.CustomInboxPrefix(natsbus.InboxPrefix(natsTestAgentID)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(agentConn.Close)
+	agentJS, err := jetstream.New(agentConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &natsTest{
+		db:       db,
+		client:   client,
+		consumer: consumer,
+		stream:   stream,
+		resync:   resync,
+		key:      key,
+		reporter: reporter,
+		agentJS:  agentJS,
+	}
+}
+
+// report publishes event through the agent's reporter.
+func (n *natsTest) report(t *testing.T, event models.StatusEvent) {
+	t.Helper()
+	if err := n.reporter.Report(context.Background(), event); err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	n.published++
+}
+
+// publish publishes data on the agent's status subject as agentID.
+func (n *natsTest) publish(t *testing.T, agentID string, data []byte) {
+	t.Helper()
+	msg := nats.NewMsg(natsbus.Subject(models.DefaultOrgID, natsTestServerID, natsbus.KindStatus))
+	msg.Header.Set(natsbus.AgentHeader, agentID)
+	msg.Data = data
+	if _, err := n.agentJS.PublishMsg(context.Background(), msg); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	n.published++
+}
+
+// signedReport encodes a report request for event signed by the agent.
+func (n *natsTest) signedReport(t *testing.T, event models.StatusEvent) *agentpb.ReportRequest {
+	t.Helper()
+	req := &agentpb.ReportRequest{Event: agentpb.EventToProto(event)}
+	payload, err := agentpb.EventPayload(req.Event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := signing.Sign(n.key, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Signature = agentpb.SignatureToProto(sig)
+	return req
+}
+
+func marshal(t *testing.T, m proto.Message) []byte {
+	t.Helper()
+	data, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// wait waits until the control plane acknowledged or terminated every report
+// that was published.
+func (n *natsTest) wait(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		info, err := n.consumer.Info(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Delivered.Consumer >= n.published && info.NumAckPending == 0 && info.NumPending == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("reports not acknowledged: %d of %d delivered, %d pending ack", info.Delivered.Consumer, n.published, info.NumAckPending)
+		}
+	}
+}
+
+func natsTestEvent(seq uint64, delta bool, publicKey string) models.StatusEvent {
+	return models.StatusEvent{
+		ServerID: natsTestServerID,
+		Seq:      seq,
+		Delta:    delta,
+		Status:   &models.Status{PublicKey: publicKey},
+		Time:     time.Now(),
+	}
+}
+
+func TestNATSReports(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    natsTestOptions
+		publish func(t *testing.T, n *natsTest)
+		// wantKey is the public key of the cached status, if any.
+		wantKey      string
+		wantSecurity []string
+		wantResync   bool
+	}{
+		{
+			name: "signed report is ingested",
+			publish: func(t *testing.T, n *natsTest) {
+				n.report(t, natsTestEvent(1, false, "pk-1"))
+			},
+			wantKey: "pk-1",
+		},
+		{
+			name: "deltas in sequence are applied",
+			publish: func(t *testing.T, n *natsTest) {
+				n.report(t, natsTestEvent(1, false, "pk-1"))
+				n.report(t, natsTestEvent(2, true, "pk-2"))
+			},
+			wantKey: "pk-2",
+		},
+		{
+			name: "delta out of sequence requests resync",
+			publish: func(t *testing.T, n *natsTest) {
+				n.report(t, natsTestEvent(1, false, "pk-1"))
+				n.report(t, natsTestEvent(3, true, "pk-3"))
+			},
+			wantKey:    "pk-1",
+			wantResync: true,
+		},
+		{
+			name: "unsigned report is rejected",
+			publish: func(t *testing.T, n *natsTest) {
+				req := &agentpb.ReportRequest{Event: agentpb.EventToProto(natsTestEvent(1, false, "pk-1"))}
+				n.publish(t, natsTestAgentID, marshal(t, req))
+			},
+			wantSecurity: []string{models.SecurityMissingSignature},
+		},
+		{
+			name: "unsigned report of an agent without a key is ingested",
+			opts: natsTestOptions{keyless: true},
+			publish: func(t *testing.T, n *natsTest) {
+				n.report(t, natsTestEvent(1, false, "pk-1"))
+			},
+			wantKey: "pk-1",
+		},
+		{
+			name: "unsigned report over an external server is rejected",
+			opts: natsTestOptions{external: true, keyless: true},
+			publish: func(t *testing.T, n *natsTest) {
+				n.report(t, natsTestEvent(1, false, "pk-1"))
+			},
+			wantSecurity: []string{models.SecurityMissingSignature},
+		},
+		{
+			name: "signed report over an external server is ingested",
+			opts: natsTestOptions{external: true},
+			publish: func(t *testing.T, n *natsTest) {
+				n.report(t, natsTestEvent(1, false, "pk-1"))
+			},
+			wantKey: "pk-1",
+		},
+		{
+			name: "tampered report is rejected",
+			publish: func(t *testing.T, n *natsTest) {
+				req := n.signedReport(t, natsTestEvent(1, false, "pk-1"))
+				req.Event.Status.PublicKey = "pk-forged"
+				n.publish(t, natsTestAgentID, marshal(t, req))
+			},
+			wantSecurity: []string{models.SecurityInvalidSignature},
+		},
+		{
+			name: "replayed report is rejected",
+			publish: func(t *testing.T, n *natsTest) {
+				data := marshal(t, n.signedReport(t, natsTestEvent(1, false, "pk-1")))
+				n.publish(t, natsTestAgentID, data)
+				n.publish(t, natsTestAgentID, data)
+			},
+			wantKey:      "pk-1",
+			wantSecurity: []string{models.SecurityReplayedReport},
+		},
+		{
+			name: "report of an unknown agent is terminated",
+			publish: func(t *testing.T, n *natsTest) {
+				n.publish(t, "agent-2", marshal(t, n.signedReport(t, natsTestEvent(1, false, "pk-1"))))
+			},
+		},
+		{
+			name: "malformed report is terminated",
+			publish: func(t *testing.T, n *natsTest) {
+				n.publish(t, natsTestAgentID, []byte("not a report"))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newNATSTest(t, tt.opts)
+			tt.publish(t, n)
+			n.wait(t)
+
+			ctx := context.Background()
+			info, err := n.stream.Info(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.State.Msgs != 0 {
+				t.Errorf("%d reports left in the stream", info.State.Msgs)
+			}
+
+			status, err := n.client.GetStatus(ctx, natsTestServerID)
+			var key string
+			if err == nil && status != nil {
+				key = status.PublicKey
+			}
+			if key != tt.wantKey {
+				t.Errorf("cached public key = %q, want %q", key, tt.wantKey)
+			}
+
+			events, err := n.db.ListSecurityEvents(ctx, models.DefaultOrgID, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var kinds []string
+			for _, e := range events {
+				kinds = append(kinds, e.Kind)
+			}
+			if !slices.Equal(kinds, tt.wantSecurity) {
+				t.Errorf("security events = %v, want %v", kinds, tt.wantSecurity)
+			}
+
+			_, err = n.resync.NextMsg(100 * time.Millisecond)
+			if got := err == nil; got != tt.wantResync {
+				t.Errorf("resync requested = %v, want %v", got, tt.wantResync)
+			}
+		})
+	}
+}
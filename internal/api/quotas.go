@@ -0,0 +1,301 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/control"
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// quotaRequest is the editable part of a quota.
+type quotaRequest struct {
+	Scope        string `json:"scope"`
+	Target       string `json:"target"`
+	LimitBytes   int64  `json:"limit_bytes"`
+	WarnPercents []int  `json:"warn_percents"`
+	Action       string `json:"action"`
+}
+
+// quota checks a request and fills in defaults: the default warning
+// thresholds and flagging only.
+func (req quotaRequest) quota() (models.Quota, error) {
+	q := models.Quota{
+		Scope:        req.Scope,
+		Target:       strings.TrimSpace(req.Target),
+		LimitBytes:   req.LimitBytes,
+		WarnPercents: req.WarnPercents,
+		Action:       req.Action,
+	}
+	if !slices.Contains(models.QuotaScopes, q.Scope) {
+		return q, fmt.Errorf("scope must be one of %s", strings.Join(models.QuotaScopes, ", "))
+	}
+	if q.Target == "" {
+		return q, errors.New("target must not be empty")
+	}
+	if q.LimitBytes <= 0 {
+		return q, errors.New("limit_bytes must be positive")
+	}
+	if q.Action == "" {
+		q.Action = models.QuotaActionFlag
+	}
+	if q.Action != models.QuotaActionSuspend && q.Action != models.QuotaActionFlag {
+		return q, errors.New("action must be suspend or flag")
+	}
+	if q.WarnPercents == nil {
+		q.WarnPercents = models.DefaultQuotaWarnPercents
+	}
+	q.WarnPercents = slices.Compact(slices.Sorted(slices.Values(q.WarnPercents)))
+	for _, p := range q.WarnPercents {
+		if p < 1 || p > 99 {
+			return q, errors.New("warn_percents must be between 1 and 99")
+		}
+	}
+	return q, nil
+}
+
+func (s *Server) handleListQuotas(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	quotas, err := s.store.ListQuotas(r.Context(), user.OrgID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list quotas")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quotas)
+}
+
+func (s *Server) handleCreateQuota(w http.ResponseWriter, r *http.Request) {
+	var req quotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	quota, err := req.quota()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	existing, err := s.store.GetQuotaFor(r.Context(), user.OrgID, quota.Scope, quota.Target)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to look up quota")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		http.Error(w, "quota already exists", http.StatusConflict)
+		return
+	}
+
+	quota.ID = uuid.NewString()
+	quota.OrgID = user.OrgID
+	quota.CreatedAt = time.Now()
+	if err := s.store.CreateQuota(r.Context(), &quota); err != nil {
+		log.Error().Err(err).Msg("failed to create quota")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	s.quotas.Check()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(quota)
+}
+
+// handleUpdateQuota changes the limit, warnings and action of a quota. Its
+// scope and target stay.
+func (s *Server) handleUpdateQuota(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	existing, err := s.store.GetQuota(r.Context(), user.OrgID, chi.URLParam(r, "id"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get quota")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if existing == nil {
+		http.Error(w, "quota not found", http.StatusNotFound)
+		return
+	}
+
+	req := quotaRequest{LimitBytes: existing.LimitBytes, WarnPercents: existing.WarnPercents, Action: existing.Action}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	req.Scope, req.Target = existing.Scope, existing.Target
+	quota, err := req.quota()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	quota.ID, quota.OrgID, quota.CreatedAt = existing.ID, existing.OrgID, existing.CreatedAt
+	if _, err := s.store.UpdateQuota(r.Context(), &quota); err != nil {
+		log.Error().Err(err).Msg("failed to update quota")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	s.quotas.Check()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quota)
+}
+
+func (s *Server) handleDeleteQuota(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok, err := s.store.DeleteQuota(r.Context(), user.OrgID, chi.URLParam(r, "id"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete quota")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "quota not found", http.StatusNotFound)
+		return
+	}
+	// Peers it suspended are resumed.
+	s.quotas.Check()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleQuotaStatus returns where every peer held to a quota stands in the
+// current billing period.
+func (s *Server) handleQuotaStatus(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	status, err := s.quotas.Status(r.Context(), user.OrgID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to evaluate quotas")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+func (s *Server) handleListQuotaOverrides(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	overrides, err := s.store.ListQuotaOverrides(r.Context(), user.OrgID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list quota overrides")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(overrides)
+}
+
+// handleSetQuotaOverride replaces the quota of a peer with limit_bytes, or
+// lifts it without one, until expires_at (default the end of the current
+// billing period).
+func (s *Server) handleSetQuotaOverride(w http.ResponseWriter, r *http.Request) {
+	publicKey, err := peerKeyParam(r)
+	if err != nil || publicKey == "" {
+		http.Error(w, "invalid public key", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		LimitBytes *int64     `json:"limit_bytes"`
+		ExpiresAt  *time.Time `json:"expires_at"`
+		Reason     string     `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.LimitBytes != nil && *req.LimitBytes < 0 {
+		http.Error(w, "limit_bytes must not be negative", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	_, expiresAt := control.BillingPeriod(now, s.quotas.BillingDay())
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+	if !expiresAt.After(now) {
+		http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	override := models.QuotaOverride{
+		OrgID:      user.OrgID,
+		PublicKey:  publicKey,
+		LimitBytes: req.LimitBytes,
+		ExpiresAt:  expiresAt.UTC(),
+		Reason:     strings.TrimSpace(req.Reason),
+		CreatedAt:  now.UTC(),
+	}
+	if err := s.store.SetQuotaOverride(r.Context(), &override); err != nil {
+		log.Error().Err(err).Msg("failed to set quota override")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	log.Info().Str("user", user.Email).Str("public_key", publicKey).Msg("quota override set")
+	s.quotas.Check()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(override)
+}
+
+func (s *Server) handleDeleteQuotaOverride(w http.ResponseWriter, r *http.Request) {
+	publicKey, err := peerKeyParam(r)
+	if err != nil {
+		http.Error(w, "invalid public key", http.StatusBadRequest)
+		return
+	}
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok, err := s.store.DeleteQuotaOverride(r.Context(), user.OrgID, publicKey)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete quota override")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "override not found", http.StatusNotFound)
+		return
+	}
+	s.quotas.Check()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,295 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/control"
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/ChronoCoders/sentra/internal/signing"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const maxReleaseSize = 256 << 20
+
+// releaseField restricts version and platform names of uploaded releases.
+var releaseField = regexp.MustCompile(`^[A-Za-z0-9._+-]{1,64}$`)
+
+// handleUploadRelease stores an agent binary uploaded as multipart form with
+// the fields version, os, arch, signature and file.
+func (s *Server) handleUploadRelease(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxReleaseSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	rel := &models.Release{
+		ID:        uuid.NewString(),
+		Version:   r.FormValue("version"),
+		OS:        r.FormValue("os"),
+		Arch:      r.FormValue("arch"),
+		Signature: r.FormValue("signature"),
+		CreatedBy: user.ID,
+		CreatedAt: time.Now().UTC(),
+	}
+	for _, v := range []string{rel.Version, rel.OS, rel.Arch} {
+		if !releaseField.MatchString(v) {
+			http.Error(w, "invalid version, os or arch", http.StatusBadRequest)
+			return
+		}
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "missing file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	existing, err := s.store.GetReleaseFor(r.Context(), rel.Version, rel.OS, rel.Arch)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to look up release")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		http.Error(w, "release already exists", http.StatusConflict)
+		return
+	}
+
+	if err := os.MkdirAll(s.cfg.ReleaseDir, 0755); err != nil {
+		log.Error().Err(err).Msg("failed to create release directory")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	tmp, err := os.CreateTemp(s.cfg.ReleaseDir, ".upload-*")
+	if err != nil {
+		log.Error().Err(err).Msg("failed to store release")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	rel.Size, err = io.Copy(io.MultiWriter(tmp, h), file)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("failed to store release")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	rel.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+	// Agents verify the signature as well; checking it here catches mistakes early.
+	if s.cfg.ReleasePublicKey != "" {
+		pub, err := signing.DecodePublicKey(s.cfg.ReleasePublicKey)
+		if err != nil {
+			log.Error().Err(err).Msg("invalid release public key")
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if err := signing.VerifyRelease(pub, rel.Version, rel.OS, rel.Arch, rel.SHA256, rel.Signature); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(s.cfg.ReleaseDir, rel.ID)); err != nil {
+		log.Error().Err(err).Msg("failed to store release")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.store.CreateRelease(r.Context(), rel); err != nil {
+		log.Error().Err(err).Msg("failed to store release")
+		os.Remove(filepath.Join(s.cfg.ReleaseDir, rel.ID))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	log.Info().Str("version", rel.Version).Str("os", rel.OS).Str("arch", rel.Arch).Msg("agent release uploaded")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rel)
+}
+
+func (s *Server) handleListReleases(w http.ResponseWriter, r *http.Request) {
+	releases, err := s.store.ListReleases(r.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list releases")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(releases)
+}
+
+// handleDownloadRelease serves a release binary to an agent.
+func (s *Server) handleDownloadRelease(w http.ResponseWriter, r *http.Request) {
+	rel, err := s.store.GetRelease(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get release")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if rel == nil {
+		http.Error(w, "release not found", http.StatusNotFound)
+		return
+	}
+	f, err := os.Open(filepath.Join(s.cfg.ReleaseDir, rel.ID))
+	if err != nil {
+		log.Error().Err(err).Str("release_id", rel.ID).Msg("release file missing")
+		http.Error(w, "release not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "sentra-agent", rel.CreatedAt, f)
+}
+
+func (s *Server) handleCreateRollout(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Version     string   `json:"version"`
+		Canary      []string `json:"canary"`
+		CanaryCount int      `json:"canary_count"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Version == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rollout, err := s.rollouts.Plan(r.Context(), user.OrgID, req.Version, req.Canary, req.CanaryCount)
+	if err != nil {
+		if errors.Is(err, control.ErrNoRolloutTargets) || errors.Is(err, control.ErrUnknownCanaryHost) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		log.Error().Err(err).Msg("failed to plan rollout")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	rollout.ID = uuid.NewString()
+	rollout.CreatedBy = user.ID
+	for i := range rollout.Targets {
+		rollout.Targets[i].RolloutID = rollout.ID
+	}
+	if err := s.store.CreateRollout(r.Context(), rollout); err != nil {
+		log.Error().Err(err).Msg("failed to store rollout")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	log.Info().Str("rollout_id", rollout.ID).Str("version", rollout.Version).Msg("rollout started")
+	s.rollouts.Dispatch(rollout, models.StageCanary)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rollout)
+}
+
+func (s *Server) handleListRollouts(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	rollouts, err := s.store.ListRollouts(r.Context(), user.OrgID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list rollouts")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rollouts)
+}
+
+// rolloutFromRequest loads the rollout named in the URL if it belongs to the
+// user's organization. It writes the error response and returns nil otherwise.
+func (s *Server) rolloutFromRequest(w http.ResponseWriter, r *http.Request) *models.Rollout {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil
+	}
+	rollout, err := s.store.GetRollout(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get rollout")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return nil
+	}
+	if rollout == nil || rollout.OrgID != user.OrgID {
+		http.Error(w, "rollout not found", http.StatusNotFound)
+		return nil
+	}
+	return rollout
+}
+
+func (s *Server) handleGetRollout(w http.ResponseWriter, r *http.Request) {
+	rollout := s.rolloutFromRequest(w, r)
+	if rollout == nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rollout)
+}
+
+func (s *Server) handlePromoteRollout(w http.ResponseWriter, r *http.Request) {
+	rollout := s.rolloutFromRequest(w, r)
+	if rollout == nil {
+		return
+	}
+	s.changeRollout(w, r, rollout, s.rollouts.Promote)
+}
+
+func (s *Server) handleCancelRollout(w http.ResponseWriter, r *http.Request) {
+	rollout := s.rolloutFromRequest(w, r)
+	if rollout == nil {
+		return
+	}
+	s.changeRollout(w, r, rollout, s.rollouts.Cancel)
+}
+
+func (s *Server) changeRollout(w http.ResponseWriter, r *http.Request, rollout *models.Rollout, change func(ctx context.Context, rollout *models.Rollout) error) {
+	if err := change(r.Context(), rollout); err != nil {
+		if errors.Is(err, control.ErrRolloutState) || errors.Is(err, control.ErrCanaryIncomplete) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Error().Err(err).Str("rollout_id", rollout.ID).Msg("failed to change rollout")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	rollout, err := s.store.GetRollout(r.Context(), rollout.ID)
+	if err != nil || rollout == nil {
+		log.Error().Err(err).Msg("failed to get rollout")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rollout)
+}
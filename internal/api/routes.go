@@ -1,7 +1,10 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -13,6 +16,7 @@ import (
 	"github.com/ChronoCoders/sentra/internal/control"
 	"github.com/ChronoCoders/sentra/internal/models"
 	"github.com/ChronoCoders/sentra/internal/store"
+	sentratls "github.com/ChronoCoders/sentra/internal/tls"
 	"github.com/ChronoCoders/sentra/internal/ws"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -21,27 +25,53 @@ import (
 )
 
 type Server struct {
-	cfg    *config.Config
-	store  *store.Store
-	client control.AgentClient
-	hub    *ws.Hub
-	bus    *control.EventBus
-	auth   *auth.JWTManager
-	router *chi.Mux
+	cfg       *config.Config
+	store     *store.Store
+	client    control.AgentClient
+	hub       *ws.Hub
+	auth      *auth.JWTManager
+	ca        *sentratls.CA
+	certs     *sentratls.CertReloader
+	channels  *control.ChannelHub
+	inventory *control.Inventory
+	rollouts  *control.Rollouts
+	configs   *control.Configs
+	quotas    *control.Quotas
+	alerts    *control.Alerts
+	webhooks  *control.Webhooks
+	email     *control.Email
+	expiries  *control.PeerExpiries
+	chat      *control.Chat
+	replay    *control.ReplayGuard
+	router    *chi.Mux
+
+	agentConns agentConnections
 }
 
-func NewServer(cfg *config.Config, store *store.Store, client control.AgentClient, hub *ws.Hub, bus *control.EventBus) *Server {
+func NewServer(cfg *config.Config, store *store.Store, client control.AgentClient, hub *ws.Hub, ca *sentratls.CA, certs *sentratls.CertReloader, channels *control.ChannelHub, inventory *control.Inventory, rollouts *control.Rollouts, configs *control.Configs, quotas *control.Quotas, alerts *control.Alerts, webhooks *control.Webhooks, email *control.Email, expiries *control.PeerExpiries, chat *control.Chat) *Server {
 	// Initialize router
 	r := chi.NewRouter()
 
 	s := &Server{
-		cfg:    cfg,
-		store:  store,
-		client: client,
-		hub:    hub,
-		bus:    bus,
-		auth:   auth.NewJWTManager(cfg.JWTSecret),
-		router: r,
+		cfg:       cfg,
+		store:     store,
+		client:    client,
+		hub:       hub,
+		auth:      auth.NewJWTManager(cfg.JWTSecret),
+		ca:        ca,
+		certs:     certs,
+		channels:  channels,
+		inventory: inventory,
+		rollouts:  rollouts,
+		configs:   configs,
+		quotas:    quotas,
+		alerts:    alerts,
+		webhooks:  webhooks,
+		email:     email,
+		expiries:  expiries,
+		chat:      chat,
+		replay:    control.NewReplayGuard(store, reportSignatureWindow),
+		router:    r,
 	}
 	s.setupRoutes()
 	return s
@@ -53,8 +83,21 @@ func (s *Server) setupRoutes() {
 
 	// Public routes
 	s.router.Post("/api/login", s.handleLogin)
-	s.router.Post("/api/report", s.handleReport)    // Agent reporting
-	s.router.Get("/api/cert", s.handleCertDownload) // Download CA cert
+	s.router.Post("/api/agents/enroll", s.handleEnroll) // Exchange join token for agent credential
+	s.router.Get("/api/cert", s.handleCertDownload)     // Download CA cert
+	s.router.Get("/api/ca/crl", s.handleCRL)            // Revoked agent certificates
+	s.router.Post("/api/invitations/accept", s.handleAcceptInvitation)
+
+	// Agent routes
+	s.router.Group(func(r chi.Router) {
+		r.Use(s.agentMiddleware)
+
+		r.Post("/api/report", s.handleReport)             // Agent reporting
+		r.Get("/api/agent/channel", s.handleAgentChannel) // Persistent agent connection
+		r.Post("/api/agents/signing-key", s.handleRegisterSigningKey)
+		r.Get("/api/agent/releases/{id}/download", s.handleDownloadRelease)
+	})
+	s.router.With(s.agentRenewMiddleware).Post("/api/agents/renew", s.handleRenewCertificate)
 
 	// Authenticated routes
 	s.router.Group(func(r chi.Router) {
@@ -67,8 +110,96 @@ func (s *Server) setupRoutes() {
 
 			r.Get("/api/health", s.handleHealth)
 			r.Get("/api/status", s.handleStatus)
+			r.Get("/api/servers", s.handleListServers)
+			r.Get("/api/servers/{id}", s.handleGetServer)
+			r.Get("/api/servers/{id}/metrics", s.handleServerMetrics)
+			r.Get("/api/servers/{id}/peers/{publicKey}/metrics", s.handlePeerMetrics)
+			r.Get("/api/fleet/agents", s.handleFleetAgents)
+			r.Get("/api/fleet/versions", s.handleFleetVersions)
+			r.Get("/api/alerts", s.handleListAlerts)
+			r.Get("/api/alerts/rules", s.handleListAlertRules)
+			r.Get("/api/alerts/{id}", s.handleGetAlert)
+			r.Get("/api/me/notifications", s.handleGetNotificationPreference)
+			r.Put("/api/me/notifications", s.handlePutNotificationPreference)
 			r.Get("/ws", s.handleWs)
 		})
+
+		// Admin access
+		r.Group(func(r chi.Router) {
+			r.Use(s.RequireRole("admin"))
+
+			r.Patch("/api/servers/{id}", s.handleUpdateServer)
+			r.Get("/api/identity/conflicts", s.handleIdentityConflicts)
+			r.Post("/api/servers/{id}/peers", s.handleAddPeer)
+			r.Delete("/api/servers/{id}/peers/{publicKey}", s.handleRemovePeer)
+
+			r.Get("/api/security/events", s.handleListSecurityEvents)
+
+			r.Get("/api/agents", s.handleListAgents)
+			r.Post("/api/agents/{id}/revoke", s.handleRevokeAgent)
+			r.Get("/api/agents/tokens", s.handleListJoinTokens)
+			r.Post("/api/agents/tokens", s.handleCreateJoinToken)
+			r.Delete("/api/agents/tokens/{id}", s.handleDeleteJoinToken)
+
+			r.Get("/api/releases", s.handleListReleases)
+			r.Post("/api/releases", s.handleUploadRelease)
+			r.Get("/api/rollouts", s.handleListRollouts)
+			r.Post("/api/rollouts", s.handleCreateRollout)
+			r.Get("/api/rollouts/{id}", s.handleGetRollout)
+			r.Post("/api/rollouts/{id}/promote", s.handlePromoteRollout)
+			r.Post("/api/rollouts/{id}/cancel", s.handleCancelRollout)
+
+			r.Get("/api/config/groups", s.handleListConfigGroups)
+			r.Put("/api/config/groups/{name}", s.handlePutConfigGroup)
+			r.Delete("/api/config/groups/{name}", s.handleDeleteConfigGroup)
+			r.Get("/api/config/drift", s.handleConfigDrift)
+			r.Get("/api/servers/{id}/config", s.handleGetServerConfig)
+			r.Put("/api/servers/{id}/config", s.handlePutServerConfig)
+
+			r.Get("/api/usage", s.handleUsage)
+			r.Get("/api/usage/owners", s.handleListPeerOwners)
+			r.Put("/api/usage/owners/{publicKey}", s.handleSetPeerOwner)
+
+			r.Get("/api/quotas", s.handleListQuotas)
+			r.Post("/api/quotas", s.handleCreateQuota)
+			r.Get("/api/quotas/status", s.handleQuotaStatus)
+			r.Put("/api/quotas/{id}", s.handleUpdateQuota)
+			r.Delete("/api/quotas/{id}", s.handleDeleteQuota)
+			r.Get("/api/quotas/overrides", s.handleListQuotaOverrides)
+			r.Put("/api/quotas/overrides/{publicKey}", s.handleSetQuotaOverride)
+			r.Delete("/api/quotas/overrides/{publicKey}", s.handleDeleteQuotaOverride)
+
+			r.Post("/api/alerts/{id}/ack", s.handleAcknowledgeAlert)
+
+			r.Get("/api/webhooks", s.handleListWebhooks)
+			r.Post("/api/webhooks", s.handleCreateWebhook)
+			r.Get("/api/webhooks/{id}", s.handleGetWebhook)
+			r.Put("/api/webhooks/{id}", s.handleUpdateWebhook)
+			r.Delete("/api/webhooks/{id}", s.handleDeleteWebhook)
+			r.Get("/api/webhooks/{id}/deliveries", s.handleListWebhookDeliveries)
+			r.Get("/api/webhooks/{id}/deliveries/{deliveryID}", s.handleGetWebhookDelivery)
+			r.Post("/api/webhooks/{id}/deliveries/{deliveryID}/redeliver", s.handleRedeliverWebhook)
+
+			r.Get("/api/email/templates", s.handleListEmailTemplates)
+			r.Put("/api/email/templates/{name}", s.handlePutEmailTemplate)
+			r.Delete("/api/email/templates/{name}", s.handleDeleteEmailTemplate)
+			r.Post("/api/email/test", s.handleTestEmail)
+
+			r.Get("/api/invitations", s.handleListInvitations)
+			r.Post("/api/invitations", s.handleCreateInvitation)
+			r.Delete("/api/invitations/{id}", s.handleDeleteInvitation)
+
+			r.Get("/api/peers/expiries", s.handleListPeerExpiries)
+			r.Put("/api/peers/expiries/{publicKey}", s.handleSetPeerExpiry)
+			r.Delete("/api/peers/expiries/{publicKey}", s.handleDeletePeerExpiry)
+
+			r.Get("/api/chat/channels", s.handleListChatChannels)
+			r.Post("/api/chat/channels", s.handleCreateChatChannel)
+			r.Get("/api/chat/channels/{id}", s.handleGetChatChannel)
+			r.Put("/api/chat/channels/{id}", s.handleUpdateChatChannel)
+			r.Delete("/api/chat/channels/{id}", s.handleDeleteChatChannel)
+			r.Post("/api/chat/channels/{id}/test", s.handleTestChatChannel)
+		})
 	})
 
 	// Static Files
@@ -77,20 +208,28 @@ func (s *Server) setupRoutes() {
 	FileServer(s.router, "/", filesDir)
 }
 
+// handleCertDownload serves the server certificate currently in use, or the
+// internal CA certificate when there is none.
 func (s *Server) handleCertDownload(w http.ResponseWriter, r *http.Request) {
-	certPath := s.cfg.TLSCert
-	if certPath == "" {
-		certPath = "cert.pem"
+	if s.certs != nil {
+		certPath, _ := s.certs.Paths()
+		if _, err := os.Stat(certPath); os.IsNotExist(err) {
+			http.Error(w, "Certificate not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+		w.Header().Set("Content-Disposition", "attachment; filename=sentra-ca.crt")
+		http.ServeFile(w, r, certPath)
+		return
 	}
-
-	if _, err := os.Stat(certPath); os.IsNotExist(err) {
+	if s.ca == nil {
 		http.Error(w, "Certificate not found", http.StatusNotFound)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/x-x509-ca-cert")
 	w.Header().Set("Content-Disposition", "attachment; filename=sentra-ca.crt")
-	http.ServeFile(w, r, certPath)
+	w.Write(s.ca.CertPEM())
 }
 
 func FileServer(r chi.Router, path string, root http.FileSystem) {
@@ -121,23 +260,63 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
 
+// statusResponse is a server's status with the time of its last report and
+// its liveness state.
+type statusResponse struct {
+	*models.Status
+	State      string     `json:"state"`
+	ReportedAt *time.Time `json:"reported_at,omitempty"`
+}
+
 func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	serverID := r.URL.Query().Get("server_id")
 	if serverID == "" {
 		http.Error(w, "missing server_id", http.StatusBadRequest)
 		return
 	}
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	server, err := s.store.GetServer(r.Context(), user.OrgID, serverID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get server")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if server == nil {
+		http.Error(w, "server not found", http.StatusNotFound)
+		return
+	}
+
 	status, err := s.client.GetStatus(r.Context(), serverID)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to get status")
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
-	if status == nil {
-		http.Error(w, "server not found", http.StatusNotFound)
+	if status != nil {
+		resp := statusResponse{Status: status, State: models.StateOffline}
+		if l, ok := s.client.Liveness(serverID); ok {
+			resp.State, resp.ReportedAt = l.State, &l.ReportedAt
+		}
+		json.NewEncoder(w).Encode(resp)
 		return
 	}
-	json.NewEncoder(w).Encode(status)
+
+	// A registered server that has not reported since the control plane
+	// started is known by its last recorded identity only.
+	json.NewEncoder(w).Encode(statusResponse{
+		Status: &models.Status{
+			PublicKey:  server.PublicKey,
+			ListenPort: server.ListenPort,
+			Peers:      []models.Peer{},
+			System:     models.SystemInfo{Hostname: server.Hostname},
+		},
+		State:      models.StateOffline,
+		ReportedAt: server.LastSeen,
+	})
 }
 
 func (s *Server) handleWs(w http.ResponseWriter, r *http.Request) {
@@ -191,23 +370,101 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleReport(w http.ResponseWriter, r *http.Request) {
-	// Simple token check
-	if s.cfg.AuthToken != "" {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader != "Bearer "+s.cfg.AuthToken {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
+	// Authentication handled by agentMiddleware
+	// The signature covers the body as it was sent.
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxReportSize))
+	if err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
 	}
-
 	var event models.StatusEvent
-	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+	if err := json.Unmarshal(body, &event); err != nil {
 		http.Error(w, "invalid request", http.StatusBadRequest)
 		return
 	}
 
-	event.Time = time.Now()
-	s.bus.Publish(event)
+	err = s.ingestReport(r.Context(), &event, body, signatureFromHeaders(r), r.RemoteAddr)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+	case errors.Is(err, errForeignServer):
+		http.Error(w, "forbidden", http.StatusForbidden)
+	case errors.Is(err, errAgentRevoked):
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	case errors.Is(err, control.ErrIdentityConflict):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, errInvalidSignature):
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+	case errors.Is(err, control.ErrResyncRequired):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]bool{"resync": true})
+	default:
+		http.Error(w, "invalid request", http.StatusBadRequest)
+	}
+}
+
+var (
+	errForeignServer = errors.New("agent reported for foreign server")
+	errAgentRevoked  = errors.New("agent revoked")
+)
 
-	w.WriteHeader(http.StatusOK)
+// ingestReport checks a report received from an agent, over HTTP or the agent
+// channel, and hands it to the status cache. payload is the encoded report
+// its signature covers.
+func (s *Server) ingestReport(ctx context.Context, event *models.StatusEvent, payload []byte, sig *models.ReportSignature, remoteAddr string) error {
+	agent := agentFromContext(ctx)
+	if agent != nil {
+		// Channels and streams authenticate the agent once, when they
+		// connect; it may have been revoked since.
+		current, err := s.store.GetAgent(ctx, agent.ID)
+		if err != nil {
+			return err
+		}
+		if current == nil || current.RevokedAt != nil {
+			log.Warn().Str("agent_id", agent.ID).Msg("revoked agent reported")
+			return errAgentRevoked
+		}
+	}
+	if err := s.verifyReport(ctx, agent, event.ServerID, payload, sig, remoteAddr); err != nil {
+		return err
+	}
+
+	// Enrolled agents may only report for the server they were enrolled for.
+	// Agents using the shared token belong to the default organization,
+	// whatever their report claims, and may only report for its servers that
+	// no agent is enrolled for; verifyReport refused the latter.
+	if agent != nil {
+		if event.ServerID != agent.ServerID {
+			log.Warn().Str("agent_id", agent.ID).Str("server_id", event.ServerID).Msg("agent reported for foreign server")
+			return errForeignServer
+		}
+		event.OrgID = agent.OrgID
+	} else {
+		orgID, err := s.store.ServerOrgID(ctx, event.ServerID)
+		if err != nil {
+			return err
+		}
+		if orgID != "" && orgID != models.DefaultOrgID {
+			log.Warn().Str("server_id", event.ServerID).Str("org_id", orgID).Msg("shared token reported for server of another organization")
+			return errForeignServer
+		}
+		event.OrgID = models.DefaultOrgID
+	}
+
+	// The agent's time says when the counters were read, which matters for
+	// reports that were queued while the control plane was unreachable.
+	now := time.Now()
+	event.ObservedAt = event.Time
+	if event.ObservedAt.IsZero() || event.ObservedAt.After(now) {
+		event.ObservedAt = now
+	}
+	event.Time = now
+	event.RemoteAddr = remoteAddr
+	// Liveness is the control plane's to decide.
+	event.State, event.StateChange = "", nil
+	// The cache checks the sequence of deltas under its lock, so an out of
+	// sequence delta is refused to the request that carried it with
+	// control.ErrResyncRequired.
+	return s.client.Ingest(*event)
 }
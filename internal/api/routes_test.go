@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/auth"
+	"github.com/ChronoCoders/sentra/internal/control"
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestStatusOfAnotherOrganization(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+	for _, u := range []models.User{
+		{ID: "u1", OrgID: models.DefaultOrgID, Email: "a@example.com", Role: "user", CreatedAt: time.Now()},
+		{ID: "u2", OrgID: "org-2", Email: "b@example.com", Role: "user", CreatedAt: time.Now()},
+	} {
+		if err := db.CreateUser(ctx, &u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := &models.Server{ID: "srv-1", OrgID: models.DefaultOrgID, PublicKey: "pk-1"}
+	if err := db.RecordServerReport(ctx, srv, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	client := control.NewStatusCache(control.NewEventBus(), nil, db)
+	event := models.StatusEvent{OrgID: models.DefaultOrgID, ServerID: "srv-1", Status: &models.Status{PublicKey: "pk-1"}}
+	if err := client.Ingest(event); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{store: db, client: client}
+
+	tests := []struct {
+		name     string
+		userID   string
+		serverID string
+		wantCode int
+	}{
+		{name: "server of the organization", userID: "u1", serverID: "srv-1", wantCode: http.StatusOK},
+		{name: "server of another organization", userID: "u2", serverID: "srv-1", wantCode: http.StatusNotFound},
+		{name: "unknown server", userID: "u1", serverID: "srv-2", wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/status?server_id="+tt.serverID, nil)
+			claims := &auth.UserClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: tt.userID}}
+			r = r.WithContext(context.WithValue(r.Context(), userContextKey, claims))
+			w := httptest.NewRecorder()
+			s.handleStatus(w, r)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status code = %d, want %d", w.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var resp statusResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status.PublicKey != "pk-1" {
+				t.Errorf("public key = %q, want %q", resp.Status.PublicKey, "pk-1")
+			}
+		})
+	}
+}
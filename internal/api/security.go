@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/control"
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/ChronoCoders/sentra/internal/signing"
+	"github.com/rs/zerolog/log"
+)
+
+// Headers carrying the report signature on POST /api/report.
+const (
+	headerSignatureTimestamp = "X-Sentra-Timestamp"
+	headerSignatureNonce     = "X-Sentra-Nonce"
+	headerSignature          = "X-Sentra-Signature"
+)
+
+const reportSignatureWindow = 5 * time.Minute
+
+// maxReportSize bounds the body of an HTTP report.
+const maxReportSize = 8 << 20
+
+var errInvalidSignature = errors.New("report signature rejected")
+
+// signatureFromHeaders reads a report signature from request headers, or nil.
+func signatureFromHeaders(r *http.Request) *models.ReportSignature {
+	value := r.Header.Get(headerSignature)
+	if value == "" {
+		return nil
+	}
+	ts, _ := strconv.ParseInt(r.Header.Get(headerSignatureTimestamp), 10, 64)
+	return &models.ReportSignature{
+		Timestamp: ts,
+		Nonce:     r.Header.Get(headerSignatureNonce),
+		Signature: value,
+	}
+}
+
+// verifyReport checks the signature of a report payload from serverID against
+// the agent's enrolled key and rejects replays. Agents with an enrolled key
+// must sign, and the shared token is refused for servers with an enrolled
+// agent. Failures are recorded as security events.
+func (s *Server) verifyReport(ctx context.Context, agent *models.Agent, serverID string, payload []byte, sig *models.ReportSignature, remoteAddr string) error {
+	if agent == nil {
+		if s.cfg.RequireSignedReports {
+			s.recordSecurityEvent(ctx, agent, serverID, models.SecurityMissingSignature, "shared token reports are not signed", remoteAddr)
+			return errInvalidSignature
+		}
+		// The shared token cannot stand in for an enrolled agent, whose
+		// reports would otherwise be forged without its key.
+		enrolled, err := s.store.ServerHasAgent(ctx, serverID)
+		if err != nil {
+			log.Error().Err(err).Str("server_id", serverID).Msg("failed to look up enrolled agents")
+			return err
+		}
+		if enrolled {
+			s.recordSecurityEvent(ctx, agent, serverID, models.SecurityMissingSignature, "shared token report for a server with an enrolled agent", remoteAddr)
+			return errInvalidSignature
+		}
+		return nil
+	}
+
+	if agent.SigningKey == "" {
+		if !s.cfg.RequireSignedReports {
+			return nil
+		}
+		s.recordSecurityEvent(ctx, agent, serverID, models.SecurityMissingSignature, "agent has no enrolled signing key", remoteAddr)
+		return errInvalidSignature
+	}
+
+	// An agent with an enrolled key always signs, so an unsigned report did
+	// not come from it.
+	if sig == nil {
+		s.recordSecurityEvent(ctx, agent, serverID, models.SecurityMissingSignature, "report is not signed", remoteAddr)
+		return errInvalidSignature
+	}
+
+	pub, err := signing.DecodePublicKey(agent.SigningKey)
+	if err != nil {
+		log.Error().Err(err).Str("agent_id", agent.ID).Msg("invalid enrolled signing key")
+		return errInvalidSignature
+	}
+	if err := signing.Verify(pub, payload, sig); err != nil {
+		s.recordSecurityEvent(ctx, agent, serverID, models.SecurityInvalidSignature, err.Error(), remoteAddr)
+		return errInvalidSignature
+	}
+
+	switch err := s.replay.Check(ctx, agent.ID, sig.Nonce, time.Unix(sig.Timestamp, 0), time.Now()); {
+	case errors.Is(err, control.ErrStaleReport):
+		s.recordSecurityEvent(ctx, agent, serverID, models.SecurityStaleReport, err.Error(), remoteAddr)
+		return errInvalidSignature
+	case errors.Is(err, control.ErrReplayedReport):
+		s.recordSecurityEvent(ctx, agent, serverID, models.SecurityReplayedReport, err.Error(), remoteAddr)
+		return errInvalidSignature
+	case err != nil:
+		log.Error().Err(err).Str("agent_id", agent.ID).Msg("failed to check report nonce")
+		return err
+	}
+	return nil
+}
+
+func (s *Server) recordSecurityEvent(ctx context.Context, agent *models.Agent, serverID, kind, detail, remoteAddr string) {
+	e := &models.SecurityEvent{
+		ServerID:   serverID,
+		Kind:       kind,
+		Detail:     detail,
+		RemoteAddr: remoteAddr,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if agent != nil {
+		e.OrgID = agent.OrgID
+		e.AgentID = agent.ID
+	} else {
+		// Reports with the shared token belong to the default organization,
+		// unless they claim a server of another one.
+		e.OrgID = models.DefaultOrgID
+		if orgID, err := s.store.ServerOrgID(ctx, serverID); err == nil && orgID != "" {
+			e.OrgID = orgID
+		}
+	}
+
+	log.Warn().
+		Str("kind", kind).
+		Str("agent_id", e.AgentID).
+		Str("server_id", serverID).
+		Str("remote_addr", remoteAddr).
+		Str("detail", detail).
+		Msg("security event")
+
+	if err := s.store.AddSecurityEvent(ctx, e); err != nil {
+		log.Error().Err(err).Msg("failed to store security event")
+	}
+}
+
+func (s *Server) handleListSecurityEvents(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit := 100
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 1000 {
+		limit = v
+	}
+
+	events, err := s.store.ListSecurityEvents(r.Context(), user.OrgID, limit)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list security events")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// handleRegisterSigningKey lets an agent that enrolled before report signing
+// existed register its key once.
+func (s *Server) handleRegisterSigningKey(w http.ResponseWriter, r *http.Request) {
+	agent := agentFromContext(r.Context())
+	if agent == nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		SigningKey string `json:"signing_key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if _, err := signing.DecodePublicKey(req.SigningKey); err != nil {
+		http.Error(w, "invalid signing key", http.StatusBadRequest)
+		return
+	}
+
+	ok, err := s.store.SetAgentSigningKey(r.Context(), agent.ID, req.SigningKey)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to register signing key")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !ok && agent.SigningKey != req.SigningKey {
+		http.Error(w, "signing key already registered", http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
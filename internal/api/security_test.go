@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"crypto/ed25519"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/auth"
+	"github.com/ChronoCoders/sentra/internal/config"
+	"github.com/ChronoCoders/sentra/internal/control"
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/ChronoCoders/sentra/internal/signing"
+	"github.com/ChronoCoders/sentra/internal/store"
+)
+
+func newTestStore(t *testing.T) *store.Store {
+	t.Helper()
+	db, err := store.New(filepath.Join(t.TempDir(), "sentra.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// enrollTestAgent enrolls an agent of the default organization for serverID
+// with credential, and returns its signing key.
+func enrollTestAgent(t *testing.T, db *store.Store, agentID, serverID, credential string) ed25519.PrivateKey {
+	t.Helper()
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enrollAgent(t, db, agentID, serverID, credential, pub)
+	return key
+}
+
+// enrollAgent enrolls an agent with the signing key pub, or without one if
+// pub is nil.
+func enrollAgent(t *testing.T, db *store.Store, agentID, serverID, credential string, pub ed25519.PublicKey) {
+	t.Helper()
+	var signingKey string
+	if pub != nil {
+		signingKey = signing.EncodePublicKey(pub)
+	}
+	ctx := context.Background()
+	now := time.Now()
+	token := "join-" + agentID
+	if err := db.CreateJoinToken(ctx, &models.JoinToken{
+		ID:        token,
+		OrgID:     models.DefaultOrgID,
+		ServerID:  serverID,
+		ExpiresAt: now.Add(time.Hour),
+		CreatedAt: now,
+	}, auth.HashSecret(token)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.EnrollAgent(ctx, auth.HashSecret(token), &models.Agent{
+		ID:         agentID,
+		SigningKey: signingKey,
+		CreatedAt:  now,
+	}, auth.HashSecret(credential)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyReport(t *testing.T) {
+	db := newTestStore(t)
+	key := enrollTestAgent(t, db, "agent-1", "srv-1", "credential")
+	ctx := context.Background()
+	agent, err := db.GetAgent(ctx, "agent-1")
+	if err != nil || agent == nil {
+		t.Fatalf("get agent: %v", err)
+	}
+	keyless := &models.Agent{ID: "agent-2", OrgID: models.DefaultOrgID, ServerID: "srv-2"}
+	payload := []byte(`{"server_id":"srv-1"}`)
+
+	tests := []struct {
+		name     string
+		require  bool
+		agent    *models.Agent
+		serverID string
+		sign     bool
+		wantErr  bool
+		// wantEvent is the kind of security event recorded, if any.
+		wantEvent string
+	}{
+		{name: "signed report", agent: agent, serverID: "srv-1", sign: true},
+		{name: "unsigned report of an agent with a key", agent: agent, serverID: "srv-1", wantErr: true, wantEvent: models.SecurityMissingSignature},
+		{name: "unsigned report of an agent without a key", agent: keyless, serverID: "srv-2"},
+		{name: "unsigned report of an agent without a key when required", require: true, agent: keyless, serverID: "srv-2", wantErr: true, wantEvent: models.SecurityMissingSignature},
+		{name: "shared token for a server without agents", serverID: "legacy"},
+		{name: "shared token when signatures are required", require: true, serverID: "legacy", wantErr: true, wantEvent: models.SecurityMissingSignature},
+		{name: "shared token for a server with an enrolled agent", serverID: "srv-1", wantErr: true, wantEvent: models.SecurityMissingSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{
+				cfg:    &config.Config{RequireSignedReports: tt.require},
+				store:  db,
+				replay: control.NewReplayGuard(db, reportSignatureWindow),
+			}
+			var sig *models.ReportSignature
+			if tt.sign {
+				if sig, err = signing.Sign(key, payload); err != nil {
+					t.Fatal(err)
+				}
+			}
+			before, err := db.ListSecurityEvents(ctx, models.DefaultOrgID, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = s.verifyReport(ctx, tt.agent, tt.serverID, payload, sig, "test")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyReport = %v, want error %v", err, tt.wantErr)
+			}
+
+			after, err := db.ListSecurityEvents(ctx, models.DefaultOrgID, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var kind string
+			if len(after) > len(before) {
+				kind = after[0].Kind
+			}
+			if kind != tt.wantEvent {
+				t.Errorf("security event = %q, want %q", kind, tt.wantEvent)
+			}
+		})
+	}
+}
+
+func TestIngestSharedTokenReport(t *testing.T) {
+	db := newTestStore(t)
+	enrollTestAgent(t, db, "agent-1", "srv-1", "credential")
+	ctx := context.Background()
+	if err := db.RecordServerReport(ctx, &models.Server{ID: "srv-other", OrgID: "org2"}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RecordServerReport(ctx, &models.Server{ID: "srv-default", OrgID: models.DefaultOrgID}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	client := control.NewStatusCache(control.NewEventBus(), nil, db)
+	s := &Server{
+		cfg:    &config.Config{},
+		store:  db,
+		client: client,
+		replay: control.NewReplayGuard(db, reportSignatureWindow),
+	}
+
+	tests := []struct {
+		name     string
+		serverID string
+		orgID    string
+		wantErr  error
+	}{
+		{name: "new server", serverID: "srv-new"},
+		{name: "server of the default organization", serverID: "srv-default"},
+		{name: "claimed organization is ignored", serverID: "srv-claimed", orgID: "org2"},
+		{name: "server of another organization", serverID: "srv-other", wantErr: errForeignServer},
+		{name: "server with an enrolled agent", serverID: "srv-1", wantErr: errInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := models.StatusEvent{ServerID: tt.serverID, OrgID: tt.orgID, Status: &models.Status{}, Time: time.Now()}
+			if err := s.ingestReport(ctx, &event, nil, nil, "test"); err != tt.wantErr {
+				t.Fatalf("ingestReport = %v, want %v", err, tt.wantErr)
+			}
+			status, _ := client.GetStatus(ctx, tt.serverID)
+			if cached := status != nil; cached != (tt.wantErr == nil) {
+				t.Errorf("status cached = %v, want %v", cached, tt.wantErr == nil)
+			}
+			if tt.wantErr == nil && event.OrgID != models.DefaultOrgID {
+				t.Errorf("org = %q, want %q", event.OrgID, models.DefaultOrgID)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// handleListServers lists the registered servers of the user's organization.
+func (s *Server) handleListServers(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	servers, err := s.store.ListServers(r.Context(), user.OrgID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list servers")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	for i := range servers {
+		s.setLiveness(&servers[i])
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(servers)
+}
+
+// handleGetServer returns a registered server.
+func (s *Server) handleGetServer(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	s.writeServer(w, r, user.OrgID, chi.URLParam(r, "id"))
+}
+
+// handleUpdateServer changes the editable attributes of a server. Only the
+// display name can be set before the server is registered.
+func (s *Server) handleUpdateServer(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		DisplayName    *string `json:"display_name"`
+		Notes          *string `json:"notes"`
+		Decommissioned *bool   `json:"decommissioned"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if req.DisplayName != nil {
+		if err := s.store.SetServerDisplayName(r.Context(), user.OrgID, id, strings.TrimSpace(*req.DisplayName)); err != nil {
+			log.Error().Err(err).Msg("failed to update server")
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.Notes != nil {
+		if err := s.store.SetServerNotes(r.Context(), user.OrgID, id, *req.Notes); err != nil {
+			log.Error().Err(err).Msg("failed to update server")
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.Decommissioned != nil {
+		var at *time.Time
+		if *req.Decommissioned {
+			now := time.Now()
+			at = &now
+		}
+		if err := s.store.SetServerDecommissioned(r.Context(), user.OrgID, id, at); err != nil {
+			log.Error().Err(err).Msg("failed to update server")
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		log.Info().Str("server_id", id).Str("user_id", user.ID).Bool("decommissioned", *req.Decommissioned).Msg("server decommission state changed")
+	}
+
+	s.writeServer(w, r, user.OrgID, id)
+}
+
+func (s *Server) writeServer(w http.ResponseWriter, r *http.Request, orgID, id string) {
+	server, err := s.store.GetServer(r.Context(), orgID, id)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get server")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if server == nil {
+		http.Error(w, "server not found", http.StatusNotFound)
+		return
+	}
+	s.setLiveness(server)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(server)
+}
+
+// setLiveness fills in the liveness state of server. Servers that have not
+// reported since the control plane started are offline.
+func (s *Server) setLiveness(server *models.Server) {
+	server.State = models.StateOffline
+	if l, ok := s.client.Liveness(server.ID); ok {
+		server.State = l.State
+		server.LastSeen = &l.ReportedAt
+	}
+}
+
+// handleIdentityConflicts lists reports of the user's organization that were
+// rejected because their agent identity conflicted with the agent already
+// known for the server.
+func (s *Server) handleIdentityConflicts(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit := 100
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 1000 {
+		limit = v
+	}
+
+	conflicts, err := s.store.ListIdentityConflicts(r.Context(), user.OrgID, limit)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list identity conflicts")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conflicts)
+}
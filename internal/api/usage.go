@@ -0,0 +1,204 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/control"
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// Periods of usage reports.
+const (
+	usagePeriodDay     = "day"
+	usagePeriodBilling = "billing"
+)
+
+// usageResponse is a usage report.
+type usageResponse struct {
+	By      string               `json:"by"`
+	Period  string               `json:"period"`
+	From    time.Time            `json:"from"`
+	To      time.Time            `json:"to"`
+	Records []models.UsageRecord `json:"records"`
+}
+
+// handleUsage reports the data transferred by the peers of the user's
+// organization, grouped by peer (the default), user, group, profile, server
+// or org, per day or per billing period (the default). from and to (dates,
+// RFC 3339 or Unix seconds) default to the current billing period and are
+// widened to whole periods.
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	params := r.URL.Query()
+	res := usageResponse{By: params.Get("by"), Period: params.Get("period")}
+	if res.By == "" {
+		res.By = models.UsageByPeer
+	}
+	if !slices.Contains(models.UsageGroupings, res.By) {
+		http.Error(w, fmt.Sprintf("unknown grouping %q, must be one of %s", res.By, strings.Join(models.UsageGroupings, ", ")), http.StatusBadRequest)
+		return
+	}
+	if res.Period == "" {
+		res.Period = usagePeriodBilling
+	}
+	if res.Period != usagePeriodDay && res.Period != usagePeriodBilling {
+		http.Error(w, fmt.Sprintf("unknown period %q, must be day or billing", res.Period), http.StatusBadRequest)
+		return
+	}
+	if res.From, res.To, err = s.parseUsageRange(params.Get("from"), params.Get("to"), res.Period); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	days, err := s.store.ListUsageDays(r.Context(), user.OrgID, res.From, res.To)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list usage")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	billingDay := 0
+	if res.Period == usagePeriodBilling {
+		billingDay = s.quotas.BillingDay()
+	}
+	res.Records = control.UsageReport(days, res.By, billingDay)
+	writeUsage(w, r, res)
+}
+
+// parseUsageRange returns the whole periods covering from and to.
+func (s *Server) parseUsageRange(fromParam, toParam, period string) (from, to time.Time, err error) {
+	now := time.Now().UTC()
+	billingDay := s.quotas.BillingDay()
+	from, to = control.BillingPeriod(now, billingDay)
+	if fromParam != "" {
+		if from, err = parseUsageTime(fromParam); err != nil {
+			return from, to, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if toParam != "" {
+		if to, err = parseUsageTime(toParam); err != nil {
+			return from, to, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	if !to.After(from) {
+		return from, to, errors.New("from must be before to")
+	}
+
+	if period == usagePeriodBilling {
+		from, _ = control.BillingPeriod(from, billingDay)
+		last, end := control.BillingPeriod(to, billingDay)
+		if to.After(last) {
+			to = end
+		} else {
+			to = last
+		}
+		return from, to, nil
+	}
+	from = from.UTC().Truncate(24 * time.Hour)
+	if day := to.UTC().Truncate(24 * time.Hour); day.Before(to) {
+		to = day.AddDate(0, 0, 1)
+	}
+	return from, to.UTC(), nil
+}
+
+func parseUsageTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	return parseQueryTime(v)
+}
+
+// writeUsage writes res as JSON, or as CSV with a row per record if the
+// client asked for it with format=csv or an Accept header.
+func writeUsage(w http.ResponseWriter, r *http.Request, res usageResponse) {
+	if r.URL.Query().Get("format") != "csv" && !strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	cw := csv.NewWriter(w)
+	cw.Write([]string{res.By, "period_start", "period_end", "receive_bytes", "transmit_bytes", "total_bytes"})
+	for _, rec := range res.Records {
+		cw.Write([]string{
+			rec.Key,
+			rec.PeriodStart.Format(time.RFC3339),
+			rec.PeriodEnd.Format(time.RFC3339),
+			strconv.FormatInt(rec.ReceiveBytes, 10),
+			strconv.FormatInt(rec.TransmitBytes, 10),
+			strconv.FormatInt(rec.TotalBytes, 10),
+		})
+	}
+	cw.Flush()
+}
+
+// handleListPeerOwners lists the users, groups and profiles peers are
+// attributed to.
+func (s *Server) handleListPeerOwners(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	owners, err := s.store.ListPeerOwners(r.Context(), user.OrgID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list peer owners")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(owners)
+}
+
+// handleSetPeerOwner attributes a peer's usage to a user, a group and a
+// profile. Clearing all three removes the attribution.
+func (s *Server) handleSetPeerOwner(w http.ResponseWriter, r *http.Request) {
+	publicKey, err := peerKeyParam(r)
+	if err != nil || publicKey == "" {
+		http.Error(w, "invalid public key", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		User    string `json:"user"`
+		Group   string `json:"group"`
+		Profile string `json:"profile"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	owner := models.PeerOwner{
+		OrgID:     user.OrgID,
+		PublicKey: publicKey,
+		User:      strings.TrimSpace(req.User),
+		Group:     strings.TrimSpace(req.Group),
+		Profile:   strings.TrimSpace(req.Profile),
+	}
+	if err := s.store.SetPeerOwner(r.Context(), owner); err != nil {
+		log.Error().Err(err).Msg("failed to set peer owner")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(owner)
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/auth"
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 500
+	minWebhookSecret     = 16
+)
+
+// webhookRequest is the editable part of a webhook.
+type webhookRequest struct {
+	URL     string   `json:"url"`
+	Events  []string `json:"events"`
+	Enabled bool     `json:"enabled"`
+	Secret  string   `json:"secret"`
+}
+
+// apply checks a request and applies it to wh. An empty secret keeps the
+// current one.
+func (req webhookRequest) apply(wh *models.Webhook) error {
+	u, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an http:// or https:// URL")
+	}
+	events := []string{}
+	for _, event := range req.Events {
+		if !slices.Contains(models.WebhookEvents, event) {
+			return fmt.Errorf("unknown event %q, must be one of %s", event, strings.Join(models.WebhookEvents, ", "))
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	if req.Secret != "" && len(req.Secret) < minWebhookSecret {
+		return fmt.Errorf("secret must be at least %d characters", minWebhookSecret)
+	}
+	wh.URL, wh.Events, wh.Enabled = u.String(), events, req.Enabled
+	if req.Secret != "" {
+		wh.Secret = req.Secret
+	}
+	return nil
+}
+
+func (s *Server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	webhooks, err := s.store.ListWebhooks(r.Context(), user.OrgID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list webhooks")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+// handleCreateWebhook registers an endpoint for the events of the user's
+// organization. Without a secret one is generated; either way it is only
+// returned here.
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	req := webhookRequest{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	var wh models.Webhook
+	if err := req.apply(&wh); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if wh.Secret == "" {
+		secret, err := auth.GenerateSecret()
+		if err != nil {
+			log.Error().Err(err).Msg("failed to generate webhook secret")
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		wh.Secret = secret
+	}
+
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	wh.ID = uuid.NewString()
+	wh.OrgID = user.OrgID
+	wh.CreatedAt = time.Now().UTC()
+	if err := s.store.CreateWebhook(r.Context(), &wh); err != nil {
+		log.Error().Err(err).Msg("failed to create webhook")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	log.Info().Str("user", user.Email).Str("webhook_id", wh.ID).Str("url", wh.URL).Msg("webhook created")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(wh)
+}
+
+// webhook returns the webhook of the URL if it belongs to the user's
+// organization, or writes an error and returns nil.
+func (s *Server) webhook(w http.ResponseWriter, r *http.Request) *models.Webhook {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil
+	}
+	wh, err := s.store.GetWebhook(r.Context(), user.OrgID, chi.URLParam(r, "id"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get webhook")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return nil
+	}
+	if wh == nil {
+		http.Error(w, "webhook not found", http.StatusNotFound)
+	}
+	return wh
+}
+
+func (s *Server) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	wh := s.webhook(w, r)
+	if wh == nil {
+		return
+	}
+	wh.Secret = ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(wh)
+}
+
+// handleUpdateWebhook changes the URL, events, secret and whether a webhook
+// is enabled. Fields left out keep their value.
+func (s *Server) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	wh := s.webhook(w, r)
+	if wh == nil {
+		return
+	}
+	req := webhookRequest{URL: wh.URL, Events: wh.Events, Enabled: wh.Enabled}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := req.apply(wh); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := s.store.UpdateWebhook(r.Context(), wh); err != nil {
+		log.Error().Err(err).Msg("failed to update webhook")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if req.Secret == "" {
+		wh.Secret = ""
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(wh)
+}
+
+func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	user, err := s.currentUser(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ok, err := s.store.DeleteWebhook(r.Context(), user.OrgID, chi.URLParam(r, "id"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete webhook")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "webhook not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListWebhookDeliveries returns the latest deliveries to a webhook,
+// newest first, at most limit.
+func (s *Server) handleListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit := defaultDeliveryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxDeliveryLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxDeliveryLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	wh := s.webhook(w, r)
+	if wh == nil {
+		return
+	}
+	deliveries, err := s.store.ListWebhookDeliveries(r.Context(), wh.ID, limit)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list webhook deliveries")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// handleGetWebhookDelivery returns a delivery with every attempt made.
+func (s *Server) handleGetWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	wh := s.webhook(w, r)
+	if wh == nil {
+		return
+	}
+	d, err := s.store.GetWebhookDelivery(r.Context(), wh.ID, chi.URLParam(r, "deliveryID"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get webhook delivery")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if d == nil {
+		http.Error(w, "delivery not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
+
+// handleRedeliverWebhook queues a delivery again, whatever its state, with a
+// fresh set of attempts. The payload and event ID stay the same, so
+// receivers can tell it is not a new event.
+func (s *Server) handleRedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	wh := s.webhook(w, r)
+	if wh == nil {
+		return
+	}
+	ok, err := s.store.RequeueWebhookDelivery(r.Context(), wh.ID, chi.URLParam(r, "deliveryID"), time.Now())
+	if err != nil {
+		log.Error().Err(err).Msg("failed to requeue webhook delivery")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "delivery not found", http.StatusNotFound)
+		return
+	}
+	s.webhooks.Check()
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -1,55 +1,493 @@
 package config
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/url"
 	"os"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
 )
 
 // Config holds application configuration.
 type Config struct {
-	DBPath      string
-	JWTSecret   string
-	WGInterface string
-	Port        string
-	ControlURL  string
-	AuthToken   string
-	ServerID    string
-	TLSCert     string
-	TLSKey      string
-	TLSAuto     bool
-	TLSSANs     []string
-	Insecure    bool
-	DisableAgent bool
-}
-
-// Load loads configuration from environment variables.
+	DBPath       string   `yaml:"db"`
+	JWTSecret    string   `yaml:"jwt_secret"`
+	WGInterface  string   `yaml:"wg_interface"`
+	Port         string   `yaml:"port"`
+	ControlURL   string   `yaml:"control_url"`
+	AuthToken    string   `yaml:"auth_token"`
+	ServerID     string   `yaml:"server_id"`
+	TLSCert      string   `yaml:"tls_cert" reload:"true"`
+	TLSKey       string   `yaml:"tls_key" reload:"true"`
+	TLSAuto      bool     `yaml:"tls_auto"`
+	TLSSANs      []string `yaml:"tls_sans"`
+	Insecure     bool     `yaml:"insecure_skip_verify"`
+	DisableAgent bool     `yaml:"disable_agent"`
+	// LogLevel is the minimum level of log messages.
+	LogLevel string `yaml:"log_level" reload:"true"`
+	// PollInterval is the agent report interval unless configured remotely.
+	PollInterval time.Duration `yaml:"poll_interval" reload:"true"`
+	// FullSnapshotEvery is the number of report intervals between full status snapshots.
+	FullSnapshotEvery int `yaml:"full_snapshot_every"`
+	// JoinToken is the one-time token an agent uses to enroll.
+	JoinToken string `yaml:"join_token"`
+	// CredentialsFile is where an enrolled agent keeps its credentials.
+	CredentialsFile string `yaml:"agent_credentials"`
+	// CACert and CAKey locate the internal CA used for agent client certificates.
+	CACert string `yaml:"ca_cert"`
+	CAKey  string `yaml:"ca_key"`
+	// ClientCertTTL is the lifetime of agent client certificates.
+	ClientCertTTL time.Duration `yaml:"client_cert_ttl"`
+	// RequireClientCert rejects agent reports that are not made with a client certificate.
+	RequireClientCert bool `yaml:"require_client_cert"`
+	// Transport selects how a remote agent talks to the control plane: "http",
+	// "channel", "grpc" or "nats".
+	Transport string `yaml:"transport"`
+	// GRPCPort is the port the control plane serves the gRPC agent service on.
+	// Empty disables it.
+	GRPCPort string `yaml:"grpc_port"`
+	// GRPCAddr is the host:port of the control plane's gRPC agent service.
+	GRPCAddr string `yaml:"grpc_addr"`
+	// NATSPort is the port of the NATS server embedded in the control plane.
+	// Empty disables it.
+	NATSPort string `yaml:"nats_port"`
+	// NATSURL is the NATS server agents connect to. A control plane given a URL
+	// uses that server instead of embedding one.
+	NATSURL string `yaml:"nats_url"`
+	// NATSDir is where the embedded NATS server stores its JetStream data.
+	NATSDir string `yaml:"nats_dir"`
+	// NATSCreds is a credentials file for an external NATS server.
+	NATSCreds string `yaml:"nats_creds"`
+	// RequireSignedReports rejects reports that are not signed with an enrolled agent key.
+	RequireSignedReports bool `yaml:"require_signed_reports"`
+	// IdentityFile is where the agent keeps its identity and signing key.
+	IdentityFile string `yaml:"agent_identity"`
+	// ReleaseDir is where the control plane stores uploaded agent releases.
+	ReleaseDir string `yaml:"release_dir"`
+	// ReleasePublicKey is the base64 Ed25519 key agent releases must be signed with.
+	ReleasePublicKey string `yaml:"release_public_key"`
+	// UpdateStateFile is where the agent tracks an update in progress.
+	UpdateStateFile string `yaml:"update_state"`
+	// UpdateDeadline is how long a new agent version has to report successfully
+	// before it is rolled back.
+	UpdateDeadline time.Duration `yaml:"update_deadline"`
+	// LocalAPI is the loopback address or "unix:<path>" socket the agent serves
+	// its local status and metrics API on. Empty disables it.
+	LocalAPI string `yaml:"local_api"`
+	// ReportSinks lists where the agent delivers status reports: "control",
+	// "file", "stdout" and "syslog".
+	ReportSinks []string `yaml:"report_sinks"`
+	// ReportFile is the JSONL file of the "file" sink. It is rotated once it
+	// exceeds ReportFileMaxMB, keeping ReportFileBackups old files.
+	ReportFile        string `yaml:"report_file"`
+	ReportFileMaxMB   int    `yaml:"report_file_max_mb"`
+	ReportFileBackups int    `yaml:"report_file_backups"`
+	// EndpointPolicy is how the agent redacts peer endpoints unless configured
+	// remotely, one of models.EndpointPolicies.
+	EndpointPolicy string `yaml:"endpoint_policy"`
+	// GeoIPDB is the MaxMind country database for the country endpoint policy.
+	GeoIPDB string `yaml:"geoip_db"`
+	// StaleAfter and OfflineAfter are how long the control plane waits for a
+	// report before it considers a server stale or offline.
+	StaleAfter   time.Duration `yaml:"stale_after" reload:"true"`
+	OfflineAfter time.Duration `yaml:"offline_after" reload:"true"`
+	// HistoryRawRetention, HistoryMinuteRetention and HistoryHourRetention are
+	// how long the control plane keeps raw, per-minute and hourly metric samples.
+	HistoryRawRetention    time.Duration `yaml:"history_raw_retention"`
+	HistoryMinuteRetention time.Duration `yaml:"history_minute_retention"`
+	HistoryHourRetention   time.Duration `yaml:"history_hour_retention"`
+	// BillingDay is the day of the month (UTC) on which billing periods for
+	// data usage start.
+	BillingDay int `yaml:"billing_day" reload:"true"`
+	// AlertRules are the conditions the control plane alerts on. Setting the
+	// list replaces the default rules.
+	AlertRules []models.AlertRule `yaml:"alert_rules" reload:"true"`
+	// SMTPAddr is the host:port of the SMTP server notifications and
+	// invitations are emailed through. Email is off without it.
+	SMTPAddr     string `yaml:"smtp_addr" reload:"true"`
+	SMTPUsername string `yaml:"smtp_username" reload:"true"`
+	SMTPPassword string `yaml:"smtp_password" reload:"true"`
+	SMTPFrom     string `yaml:"smtp_from" reload:"true"`
+	// SMTPTLS is how the SMTP connection is secured: starttls, tls or none.
+	SMTPTLS string `yaml:"smtp_tls" reload:"true"`
+	// EmailDigestWindow is how long notifications to a user are batched up
+	// into a digest after an email was sent to them.
+	EmailDigestWindow time.Duration `yaml:"email_digest_window" reload:"true"`
+	// PeerExpiryWarning is how long before a peer expires its organization
+	// is warned.
+	PeerExpiryWarning time.Duration `yaml:"peer_expiry_warning" reload:"true"`
+	// DashboardURL is the dashboard notifications link to. It defaults to
+	// ControlURL.
+	DashboardURL string `yaml:"dashboard_url" reload:"true"`
+}
+
+// ReportSinkNames are the supported report sinks.
+var ReportSinkNames = []string{"control", "file", "stdout", "syslog"}
+
+// Defaults returns the configuration used when nothing is set.
+func Defaults() *Config {
+	return &Config{
+		DBPath:            "sentra.db",
+		JWTSecret:         "dev-secret",
+		WGInterface:       "wg0",
+		Port:              "8080",
+		ControlURL:        "http://localhost:8080",
+		LogLevel:          "info",
+		PollInterval:      10 * time.Second,
+		FullSnapshotEvery: 30,
+		CredentialsFile:   "agent-credentials.json",
+		CACert:            "ca.pem",
+		CAKey:             "ca-key.pem",
+		ClientCertTTL:     24 * time.Hour,
+		Transport:         "http",
+		NATSDir:           "nats",
+		IdentityFile:      "agent-identity.json",
+		ReleaseDir:        "releases",
+		UpdateStateFile:   "agent-update.json",
+		UpdateDeadline:    2 * time.Minute,
+		ReportSinks:       []string{"control"},
+		ReportFile:        "agent-reports.jsonl",
+		ReportFileMaxMB:   10,
+		ReportFileBackups: 3,
+		EndpointPolicy:    models.EndpointKeep,
+		StaleAfter:        30 * time.Second,
+		OfflineAfter:      2 * time.Minute,
+
+		HistoryRawRetention:    24 * time.Hour,
+		HistoryMinuteRetention: 7 * 24 * time.Hour,
+		HistoryHourRetention:   365 * 24 * time.Hour,
+		BillingDay:             1,
+		AlertRules: []models.AlertRule{
+			{Name: "server-offline", Kind: models.AlertServerOffline, Severity: models.SeverityCritical},
+			{Name: "disk-full", Kind: models.AlertDisk, Severity: models.SeverityWarning, Threshold: 90, For: 5 * time.Minute},
+			{Name: "cert-expiry", Kind: models.AlertCertExpiry, Severity: models.SeverityWarning, Window: 6 * time.Hour},
+		},
+		SMTPTLS:           "starttls",
+		EmailDigestWindow: 5 * time.Minute,
+		PeerExpiryWarning: 72 * time.Hour,
+	}
+}
+
+// Load loads configuration from environment variables. Invalid values are
+// ignored; use LoadFile to have them reported.
 func Load() *Config {
-	sans := getEnv("SENTRA_TLS_SANS", "")
-	var sanList []string
-	if sans != "" {
-		sanList = strings.Split(sans, ",")
+	cfg := Defaults()
+	cfg.applyEnv()
+	return cfg
+}
+
+// LoadFile loads the YAML configuration file at path, if path is not empty,
+// applies environment variables on top and validates the result.
+func LoadFile(path string) (*Config, error) {
+	cfg := Defaults()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config: %w", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+	if errs := cfg.applyEnv(); len(errs) > 0 {
+		return nil, fmt.Errorf("config: %w", errors.Join(errs...))
 	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
 
-	return &Config{
-		DBPath:      getEnv("SENTRA_DB", "sentra.db"),
-		JWTSecret:   getEnv("SENTRA_JWT_SECRET", "dev-secret"),
-		WGInterface: getEnv("SENTRA_WG_INTERFACE", "wg0"),
-		Port:        getEnv("PORT", "8080"),
-		ControlURL:  getEnv("SENTRA_CONTROL_URL", "http://localhost:8080"),
-		AuthToken:   getEnv("SENTRA_AUTH_TOKEN", ""),
-		ServerID:    getEnv("SENTRA_SERVER_ID", "local"),
-		TLSCert:     getEnv("SENTRA_TLS_CERT", ""),
-		TLSKey:      getEnv("SENTRA_TLS_KEY", ""),
-		TLSAuto:     getEnv("SENTRA_TLS_AUTO", "false") == "true",
-		TLSSANs:     sanList,
-		Insecure:    getEnv("SENTRA_INSECURE_SKIP_VERIFY", "false") == "true",
-		DisableAgent: getEnv("SENTRA_DISABLE_AGENT", "false") == "true",
-	}
-}
-
-func getEnv(key, fallback string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return strings.TrimSpace(value)
-	}
-	return fallback
+// applyEnv overrides settings with the environment variables that are set.
+// It returns an error for every variable that cannot be parsed.
+func (c *Config) applyEnv() []error {
+	var errs []error
+	envString(&c.DBPath, "SENTRA_DB")
+	envString(&c.JWTSecret, "SENTRA_JWT_SECRET")
+	envString(&c.WGInterface, "SENTRA_WG_INTERFACE")
+	envString(&c.Port, "PORT")
+	envString(&c.ControlURL, "SENTRA_CONTROL_URL")
+	envString(&c.AuthToken, "SENTRA_AUTH_TOKEN")
+	envString(&c.ServerID, "SENTRA_SERVER_ID")
+	envString(&c.TLSCert, "SENTRA_TLS_CERT")
+	envString(&c.TLSKey, "SENTRA_TLS_KEY")
+	envBool(&c.TLSAuto, "SENTRA_TLS_AUTO")
+	if sans, ok := lookupEnv("SENTRA_TLS_SANS"); ok {
+		c.TLSSANs = nil
+		if sans != "" {
+			c.TLSSANs = strings.Split(sans, ",")
+		}
+	}
+	envBool(&c.Insecure, "SENTRA_INSECURE_SKIP_VERIFY")
+	envBool(&c.DisableAgent, "SENTRA_DISABLE_AGENT")
+	envString(&c.LogLevel, "SENTRA_LOG_LEVEL")
+	errs = append(errs, envDuration(&c.PollInterval, "SENTRA_POLL_INTERVAL"))
+	errs = append(errs, envInt(&c.FullSnapshotEvery, "SENTRA_FULL_SNAPSHOT_EVERY"))
+	envString(&c.JoinToken, "SENTRA_JOIN_TOKEN")
+	envString(&c.CredentialsFile, "SENTRA_AGENT_CREDENTIALS")
+	envString(&c.CACert, "SENTRA_CA_CERT")
+	envString(&c.CAKey, "SENTRA_CA_KEY")
+	errs = append(errs, envDuration(&c.ClientCertTTL, "SENTRA_CLIENT_CERT_TTL"))
+	envBool(&c.RequireClientCert, "SENTRA_REQUIRE_CLIENT_CERT")
+	envString(&c.Transport, "SENTRA_TRANSPORT")
+	envString(&c.GRPCPort, "SENTRA_GRPC_PORT")
+	envString(&c.GRPCAddr, "SENTRA_GRPC_ADDR")
+	envString(&c.NATSPort, "SENTRA_NATS_PORT")
+	envString(&c.NATSURL, "SENTRA_NATS_URL")
+	envString(&c.NATSDir, "SENTRA_NATS_DIR")
+	envString(&c.NATSCreds, "SENTRA_NATS_CREDS")
+	envBool(&c.RequireSignedReports, "SENTRA_REQUIRE_SIGNED_REPORTS")
+	envString(&c.IdentityFile, "SENTRA_AGENT_IDENTITY")
+	envString(&c.ReleaseDir, "SENTRA_RELEASE_DIR")
+	envString(&c.ReleasePublicKey, "SENTRA_RELEASE_PUBLIC_KEY")
+	envString(&c.UpdateStateFile, "SENTRA_UPDATE_STATE")
+	errs = append(errs, envDuration(&c.UpdateDeadline, "SENTRA_UPDATE_DEADLINE"))
+	envString(&c.LocalAPI, "SENTRA_AGENT_API")
+	if sinks, ok := lookupEnv("SENTRA_REPORT_SINKS"); ok {
+		c.ReportSinks = nil
+		for _, sink := range strings.Split(sinks, ",") {
+			if sink = strings.TrimSpace(sink); sink != "" {
+				c.ReportSinks = append(c.ReportSinks, sink)
+			}
+		}
+	}
+	envString(&c.ReportFile, "SENTRA_REPORT_FILE")
+	errs = append(errs, envInt(&c.ReportFileMaxMB, "SENTRA_REPORT_FILE_MAX_MB"))
+	errs = append(errs, envInt(&c.ReportFileBackups, "SENTRA_REPORT_FILE_BACKUPS"))
+	envString(&c.EndpointPolicy, "SENTRA_ENDPOINT_POLICY")
+	envString(&c.GeoIPDB, "SENTRA_GEOIP_DB")
+	errs = append(errs, envDuration(&c.StaleAfter, "SENTRA_STALE_AFTER"))
+	errs = append(errs, envDuration(&c.OfflineAfter, "SENTRA_OFFLINE_AFTER"))
+	errs = append(errs, envDuration(&c.HistoryRawRetention, "SENTRA_HISTORY_RAW_RETENTION"))
+	errs = append(errs, envDuration(&c.HistoryMinuteRetention, "SENTRA_HISTORY_MINUTE_RETENTION"))
+	errs = append(errs, envDuration(&c.HistoryHourRetention, "SENTRA_HISTORY_HOUR_RETENTION"))
+	errs = append(errs, envInt(&c.BillingDay, "SENTRA_BILLING_DAY"))
+	envString(&c.SMTPAddr, "SENTRA_SMTP_ADDR")
+	envString(&c.SMTPUsername, "SENTRA_SMTP_USERNAME")
+	envString(&c.SMTPPassword, "SENTRA_SMTP_PASSWORD")
+	envString(&c.SMTPFrom, "SENTRA_SMTP_FROM")
+	envString(&c.SMTPTLS, "SENTRA_SMTP_TLS")
+	errs = append(errs, envDuration(&c.EmailDigestWindow, "SENTRA_EMAIL_DIGEST_WINDOW"))
+	errs = append(errs, envDuration(&c.PeerExpiryWarning, "SENTRA_PEER_EXPIRY_WARNING"))
+	envString(&c.DashboardURL, "SENTRA_DASHBOARD_URL")
+
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return failed
+}
+
+// Validate checks the configuration and reports every invalid setting.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	port, err := strconv.Atoi(c.Port)
+	check(err == nil && port > 0 && port < 65536, "port: %q is not a valid port number", c.Port)
+	u, err := url.Parse(c.ControlURL)
+	check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+		"control_url: %q must be an http:// or https:// URL", c.ControlURL)
+	check(c.JWTSecret != "", "jwt_secret: must not be empty")
+	check((c.TLSCert == "") == (c.TLSKey == "") || c.TLSAuto, "tls_cert and tls_key: must be set together")
+	_, err = c.Level()
+	check(err == nil, "log_level: unknown level %q", c.LogLevel)
+	check(c.PollInterval >= time.Second && c.PollInterval <= time.Hour,
+		"poll_interval: %s is not between 1s and 1h", c.PollInterval)
+	check(c.FullSnapshotEvery >= 1, "full_snapshot_every: must be at least 1, got %d", c.FullSnapshotEvery)
+	check(c.ClientCertTTL >= time.Minute, "client_cert_ttl: %s is shorter than 1m", c.ClientCertTTL)
+	check(!c.RequireClientCert || c.TLSCert != "" || c.TLSAuto, "require_client_cert: needs tls_cert or tls_auto")
+	check(slices.Contains([]string{"http", "channel", "grpc", "nats"}, c.Transport), "transport: %q must be http, channel, grpc or nats", c.Transport)
+	check(c.Transport != "grpc" || c.GRPCAddr != "", "grpc_addr: must be set for the grpc transport")
+	if c.GRPCPort != "" {
+		port, err := strconv.Atoi(c.GRPCPort)
+		check(err == nil && port > 0 && port < 65536 && c.GRPCPort != c.Port,
+			"grpc_port: %q is not a valid port number distinct from port", c.GRPCPort)
+	}
+	check(c.Transport != "nats" || c.NATSURL != "", "nats_url: must be set for the nats transport")
+	if c.NATSPort != "" {
+		port, err := strconv.Atoi(c.NATSPort)
+		check(err == nil && port > 0 && port < 65536 && c.NATSPort != c.Port && c.NATSPort != c.GRPCPort,
+			"nats_port: %q is not a valid port number distinct from port and grpc_port", c.NATSPort)
+		check(c.NATSURL == "", "nats_port and nats_url: a control plane either embeds a NATS server or connects to one")
+	}
+	check(c.UpdateDeadline > 0, "update_deadline: must be positive, got %s", c.UpdateDeadline)
+	if c.LocalAPI != "" {
+		check(isLocalAddr(c.LocalAPI), "local_api: %q must be a loopback host:port or unix:<path>", c.LocalAPI)
+	}
+	check(len(c.ReportSinks) > 0, "report_sinks: must not be empty")
+	for i, sink := range c.ReportSinks {
+		check(slices.Contains(ReportSinkNames, sink), "report_sinks: unknown sink %q, must be one of %s", sink, strings.Join(ReportSinkNames, ", "))
+		check(!slices.Contains(c.ReportSinks[:i], sink), "report_sinks: %q is listed twice", sink)
+	}
+	if slices.Contains(c.ReportSinks, "file") {
+		check(c.ReportFile != "", "report_file: must be set for the file sink")
+		check(c.ReportFileMaxMB >= 0, "report_file_max_mb: must not be negative, got %d", c.ReportFileMaxMB)
+		check(c.ReportFileBackups >= 0, "report_file_backups: must not be negative, got %d", c.ReportFileBackups)
+	}
+	check(slices.Contains(models.EndpointPolicies, c.EndpointPolicy),
+		"endpoint_policy: %q must be one of %s", c.EndpointPolicy, strings.Join(models.EndpointPolicies, ", "))
+	check(c.EndpointPolicy != models.EndpointCountry || c.GeoIPDB != "", "geoip_db: must be set for the country endpoint policy")
+	check(c.StaleAfter >= time.Second, "stale_after: %s is shorter than 1s", c.StaleAfter)
+	check(c.OfflineAfter > c.StaleAfter, "offline_after: %s must be longer than stale_after", c.OfflineAfter)
+	// Samples are downsampled from the next finer resolution, which has to be
+	// kept until a bucket is complete.
+	check(c.HistoryRawRetention >= 5*time.Minute, "history_raw_retention: %s is shorter than 5m", c.HistoryRawRetention)
+	check(c.HistoryMinuteRetention >= 2*time.Hour && c.HistoryMinuteRetention >= c.HistoryRawRetention,
+		"history_minute_retention: %s must be at least 2h and history_raw_retention", c.HistoryMinuteRetention)
+	check(c.HistoryHourRetention >= c.HistoryMinuteRetention,
+		"history_hour_retention: %s must be at least history_minute_retention", c.HistoryHourRetention)
+	// Every month has the billing day.
+	check(c.BillingDay >= 1 && c.BillingDay <= 28, "billing_day: must be between 1 and 28, got %d", c.BillingDay)
+	for i, rule := range c.AlertRules {
+		check(rule.Name != "", "alert_rules[%d]: name must not be empty", i)
+		check(!slices.ContainsFunc(c.AlertRules[:i], func(r models.AlertRule) bool { return r.Name == rule.Name }),
+			"alert_rules: %q is listed twice", rule.Name)
+		check(slices.Contains(models.AlertKinds, rule.Kind),
+			"alert_rules[%d]: kind %q must be one of %s", i, rule.Kind, strings.Join(models.AlertKinds, ", "))
+		check(slices.Contains(models.Severities, rule.Severity),
+			"alert_rules[%d]: severity %q must be one of %s", i, rule.Severity, strings.Join(models.Severities, ", "))
+		switch rule.Kind {
+		case models.AlertCPU, models.AlertMemory, models.AlertDisk:
+			check(rule.Threshold >= 0 && rule.Threshold < 100, "alert_rules[%d]: threshold must be a percentage below 100, got %g", i, rule.Threshold)
+		case models.AlertPeerCountDrop:
+			check(rule.Threshold >= 1, "alert_rules[%d]: threshold must be at least 1 peer, got %g", i, rule.Threshold)
+		}
+		switch rule.Kind {
+		case models.AlertHandshakeAge, models.AlertPeerCountDrop, models.AlertCertExpiry:
+			check(rule.Window > 0, "alert_rules[%d]: window must be positive for %s", i, rule.Kind)
+		}
+		check(rule.For >= 0 && rule.Repeat >= 0, "alert_rules[%d]: for and repeat must not be negative", i)
+	}
+	if c.SMTPAddr != "" {
+		_, port, err := net.SplitHostPort(c.SMTPAddr)
+		check(err == nil && port != "", "smtp_addr: %q must be a host:port", c.SMTPAddr)
+		_, err = mail.ParseAddress(c.SMTPFrom)
+		check(err == nil, "smtp_from: %q must be an email address", c.SMTPFrom)
+	}
+	check(slices.Contains([]string{"starttls", "tls", "none"}, c.SMTPTLS), "smtp_tls: %q must be starttls, tls or none", c.SMTPTLS)
+	check(c.SMTPPassword == "" || c.SMTPUsername != "", "smtp_username: must be set with smtp_password")
+	check(c.EmailDigestWindow >= 0 && c.EmailDigestWindow <= 24*time.Hour,
+		"email_digest_window: %s is not between 0s and 24h", c.EmailDigestWindow)
+	check(c.PeerExpiryWarning > 0, "peer_expiry_warning: must be positive, got %s", c.PeerExpiryWarning)
+	if c.DashboardURL != "" {
+		u, err := url.Parse(c.DashboardURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"dashboard_url: %q must be an http:// or https:// URL", c.DashboardURL)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Dashboard returns the URL of the dashboard notifications link to.
+func (c *Config) Dashboard() string {
+	if c.DashboardURL != "" {
+		return strings.TrimSuffix(c.DashboardURL, "/")
+	}
+	return strings.TrimSuffix(c.ControlURL, "/")
+}
+
+// Level returns the zerolog level named by LogLevel.
+func (c *Config) Level() (zerolog.Level, error) {
+	level, err := zerolog.ParseLevel(c.LogLevel)
+	if err == nil && (level == zerolog.NoLevel || level == zerolog.Disabled) {
+		err = fmt.Errorf("unknown level %q", c.LogLevel)
+	}
+	return level, err
+}
+
+// RestartRequired lists the settings that differ between c and next but are
+// not applied on reload.
+func (c *Config) RestartRequired(next *Config) []string {
+	var names []string
+	cur, nxt := reflect.ValueOf(c).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < cur.NumField(); i++ {
+		field := cur.Type().Field(i)
+		if field.Tag.Get("reload") == "true" {
+			continue
+		}
+		if !reflect.DeepEqual(cur.Field(i).Interface(), nxt.Field(i).Interface()) {
+			names = append(names, field.Tag.Get("yaml"))
+		}
+	}
+	return names
+}
+
+// isLocalAddr reports whether addr is a Unix socket or a loopback host:port.
+func isLocalAddr(addr string) bool {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return path != ""
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return host == "localhost" || (ip != nil && ip.IsLoopback())
+}
+
+func lookupEnv(key string) (string, bool) {
+	value, ok := os.LookupEnv(key)
+	return strings.TrimSpace(value), ok
+}
+
+func envString(dst *string, key string) {
+	if value, ok := lookupEnv(key); ok {
+		*dst = value
+	}
+}
+
+func envBool(dst *bool, key string) {
+	if value, ok := lookupEnv(key); ok {
+		*dst = value == "true"
+	}
+}
+
+func envInt(dst *int, key string) error {
+	value, ok := lookupEnv(key)
+	if !ok || value == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%s: %q is not a number", key, value)
+	}
+	*dst = n
+	return nil
+}
+
+func envDuration(dst *time.Duration, key string) error {
+	value, ok := lookupEnv(key)
+	if !ok || value == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("%s: %q is not a duration", key, value)
+	}
+	*dst = d
+	return nil
 }
@@ -0,0 +1,147 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// ConfigStore persists remote agent configuration.
+type ConfigStore interface {
+	GetServerConfig(ctx context.Context, serverID string) (*models.ServerConfig, error)
+	GetConfigGroup(ctx context.Context, orgID, name string) (*models.ConfigGroup, error)
+	ListServerConfigsInGroup(ctx context.Context, orgID, group string) ([]models.ServerConfig, error)
+	EndpointSalt(ctx context.Context, orgID string) (string, error)
+}
+
+// Configs delivers remote configuration to agents when they connect, when it
+// changes and whenever an agent reports a configuration version that differs
+// from the desired one.
+type Configs struct {
+	store     ConfigStore
+	channels  *ChannelHub
+	inventory *Inventory
+
+	mu      sync.Mutex
+	pushing map[string]bool
+}
+
+func NewConfigs(bus *EventBus, store ConfigStore, channels *ChannelHub, inventory *Inventory) *Configs {
+	c := &Configs{store: store, channels: channels, inventory: inventory, pushing: make(map[string]bool)}
+	go c.listen(bus.Subscribe())
+	return c
+}
+
+// Desired returns the configuration serverID should run: its group's
+// document overridden by its own. It returns nil if the server has none.
+func (c *Configs) Desired(ctx context.Context, serverID string) (*models.ConfigUpdate, error) {
+	sc, err := c.store.GetServerConfig(ctx, serverID)
+	if err != nil || sc == nil {
+		return nil, err
+	}
+	var config models.AgentConfig
+	if sc.Group != "" {
+		g, err := c.store.GetConfigGroup(ctx, sc.OrgID, sc.Group)
+		if err != nil {
+			return nil, err
+		}
+		if g != nil {
+			config = g.Config
+		}
+	}
+	config = config.Merge(sc.Config)
+	return &models.ConfigUpdate{Version: config.Version(), Config: config}, nil
+}
+
+// Push sends the desired configuration to a connected agent.
+func (c *Configs) Push(ctx context.Context, serverID string) {
+	if !c.channels.Connected(serverID) {
+		return
+	}
+	c.mu.Lock()
+	if c.pushing[serverID] {
+		c.mu.Unlock()
+		return
+	}
+	c.pushing[serverID] = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pushing, serverID)
+		c.mu.Unlock()
+	}()
+
+	update, err := c.Desired(ctx, serverID)
+	if err != nil {
+		log.Error().Err(err).Str("server_id", serverID).Msg("failed to load agent config")
+		return
+	}
+	if update == nil {
+		return
+	}
+	// Agents need the salt for the hash endpoint policy, which may also be
+	// their local default.
+	if update.EndpointSalt, err = c.endpointSalt(ctx, serverID); err != nil {
+		log.Error().Err(err).Str("server_id", serverID).Msg("failed to load endpoint salt")
+		return
+	}
+
+	payload, _ := json.Marshal(update)
+	result, err := c.channels.SendCommand(ctx, serverID, models.Command{Name: models.CommandConfig, Payload: payload})
+	switch {
+	case errors.Is(err, ErrCapabilityMissing):
+		log.Debug().Err(err).Str("server_id", serverID).Msg("agent does not accept remote config")
+	case err != nil:
+		log.Warn().Err(err).Str("server_id", serverID).Msg("failed to push agent config")
+	case result.Error != "":
+		log.Warn().Str("server_id", serverID).Str("version", update.Version).Str("error", result.Error).Msg("agent rejected config")
+	default:
+		log.Info().Str("server_id", serverID).Str("version", update.Version).Msg("agent config applied")
+		var applied models.ConfigUpdate
+		if err := json.Unmarshal(result.Payload, &applied); err == nil {
+			c.inventory.SetConfig(serverID, applied)
+		}
+	}
+}
+
+func (c *Configs) endpointSalt(ctx context.Context, serverID string) (string, error) {
+	sc, err := c.store.GetServerConfig(ctx, serverID)
+	if err != nil || sc == nil {
+		return "", err
+	}
+	return c.store.EndpointSalt(ctx, sc.OrgID)
+}
+
+// PushGroup sends the desired configuration to all servers of a group.
+func (c *Configs) PushGroup(ctx context.Context, orgID, group string) {
+	members, err := c.store.ListServerConfigsInGroup(ctx, orgID, group)
+	if err != nil {
+		log.Error().Err(err).Str("group", group).Msg("failed to list config group members")
+		return
+	}
+	for _, m := range members {
+		go c.Push(context.Background(), m.ServerID)
+	}
+}
+
+// listen repairs drift announced in full snapshots.
+func (c *Configs) listen(ch <-chan models.StatusEvent) {
+	for event := range ch {
+		if event.Agent == nil || !event.Agent.HasCapability(models.CapabilityRemoteConfig) {
+			continue
+		}
+		update, err := c.Desired(context.Background(), event.ServerID)
+		if err != nil {
+			log.Error().Err(err).Str("server_id", event.ServerID).Msg("failed to load agent config")
+			continue
+		}
+		if update != nil && update.Version != event.Agent.ConfigVersion {
+			log.Info().Str("server_id", event.ServerID).Str("applied", event.Agent.ConfigVersion).Str("desired", update.Version).Msg("agent config drift")
+			go c.Push(context.Background(), event.ServerID)
+		}
+	}
+}
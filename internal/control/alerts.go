@@ -0,0 +1,520 @@
+package control
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// alertCheckInterval is how often alert rules are evaluated.
+	alertCheckInterval = 10 * time.Second
+	// peerConnectedWithin is how recent a peer's handshake must be for the
+	// peer to count as connected.
+	peerConnectedWithin = 3 * time.Minute
+	// alertNotifyTimeout bounds the delivery of one alert notification.
+	alertNotifyTimeout = 30 * time.Second
+	alertQueueSize     = 1000
+)
+
+// AlertStore persists alerts and tells what alert rules are evaluated on.
+type AlertStore interface {
+	CreateAlert(ctx context.Context, a *models.Alert) error
+	GetAlert(ctx context.Context, orgID, id string) (*models.Alert, error)
+	ResolveAlert(ctx context.Context, id string, at time.Time) error
+	AcknowledgeAlert(ctx context.Context, orgID, id, by string, at time.Time) (bool, error)
+	ListActiveAlerts(ctx context.Context) ([]models.Alert, error)
+	ListReportingServers(ctx context.Context) ([]models.Server, error)
+	ListCertificateExpiries(ctx context.Context) ([]models.CertExpiry, error)
+}
+
+// Alerts evaluates alert rules against the last known status of every
+// server. A condition that held for the rule's For duration fires an alert,
+// which is persisted and notified; it resolves, and is notified again, once
+// the condition no longer holds. There is at most one active alert per rule,
+// server and peer.
+type Alerts struct {
+	store         AlertStore
+	client        AgentClient
+	notifications *Notifications
+	// outbox holds the notifications waiting to be sent, in order, so that
+	// slow channels do not hold up evaluation.
+	outbox chan models.Notification
+	wake   chan struct{}
+
+	mu           sync.Mutex
+	rules        []models.AlertRule
+	offlineAfter time.Duration
+	// pending holds when conditions that have not fired yet started to
+	// hold, and active the alerts that fired, both by fingerprint.
+	pending map[string]time.Time
+	active  map[string]*activeAlert
+	// peerCounts holds the recent connected peer counts of every server.
+	peerCounts map[string][]peerCountSample
+}
+
+type activeAlert struct {
+	alert      models.Alert
+	notifiedAt time.Time
+}
+
+type peerCountSample struct {
+	at    time.Time
+	count int
+}
+
+// alertCondition is a rule's condition holding for a server or peer.
+type alertCondition struct {
+	rule      models.AlertRule
+	orgID     string
+	serverID  string
+	publicKey string
+	value     float64
+	message   string
+}
+
+func (c alertCondition) fingerprint() string {
+	return alertFingerprint(c.rule.Name, c.serverID, c.publicKey)
+}
+
+func alertFingerprint(rule, serverID, publicKey string) string {
+	return rule + "|" + serverID + "|" + publicKey
+}
+
+// NewAlerts loads the alerts that are still active. Liveness changes
+// published on bus have rules evaluated right away.
+func NewAlerts(ctx context.Context, bus *EventBus, store AlertStore, client AgentClient, notifications *Notifications) (*Alerts, error) {
+	active, err := store.ListActiveAlerts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	a := &Alerts{
+		store:         store,
+		client:        client,
+		notifications: notifications,
+		outbox:        make(chan models.Notification, alertQueueSize),
+		wake:          make(chan struct{}, 1),
+		offlineAfter:  defaultOfflineAfter,
+		pending:       make(map[string]time.Time),
+		active:        make(map[string]*activeAlert, len(active)),
+		peerCounts:    make(map[string][]peerCountSample),
+	}
+	for _, alert := range active {
+		a.active[alertFingerprint(alert.Rule, alert.ServerID, alert.PublicKey)] = &activeAlert{alert: alert, notifiedAt: alert.FiredAt}
+	}
+	go a.listen(bus)
+	return a, nil
+}
+
+func (a *Alerts) listen(bus *EventBus) {
+	for event := range bus.Subscribe() {
+		if event.StateChange != nil {
+			a.Check()
+		}
+	}
+}
+
+// SetRules replaces the rules. Alerts of rules that are gone resolve.
+func (a *Alerts) SetRules(rules []models.AlertRule) {
+	a.mu.Lock()
+	a.rules = slices.Clone(rules)
+	a.mu.Unlock()
+	a.Check()
+}
+
+// Rules returns the rules being evaluated.
+func (a *Alerts) Rules() []models.AlertRule {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return slices.Clone(a.rules)
+}
+
+// SetOfflineAfter sets how long a server that has not reported since the
+// control plane started may go without reporting before it is offline.
+func (a *Alerts) SetOfflineAfter(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.offlineAfter = d
+}
+
+// Check has rules evaluated soon.
+func (a *Alerts) Check() {
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run evaluates rules and sends the notifications of alerts until ctx is
+// cancelled.
+func (a *Alerts) Run(ctx context.Context) {
+	go a.deliver(ctx)
+	ticker := time.NewTicker(alertCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-a.wake:
+		}
+		a.evaluate(ctx, time.Now())
+	}
+}
+
+// Acknowledge records that user took note of an alert, which stops repeated
+// notifications. It returns nil if the organization has no such alert.
+func (a *Alerts) Acknowledge(ctx context.Context, orgID, id, user string) (*models.Alert, error) {
+	now := time.Now().UTC()
+	ok, err := a.store.AcknowledgeAlert(ctx, orgID, id, user, now)
+	if err != nil || !ok {
+		return nil, err
+	}
+	alert, err := a.store.GetAlert(ctx, orgID, id)
+	if err != nil || alert == nil {
+		return alert, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, active := range a.active {
+		if active.alert.ID == id {
+			active.alert.AcknowledgedAt, active.alert.AcknowledgedBy = alert.AcknowledgedAt, alert.AcknowledgedBy
+		}
+	}
+	return alert, nil
+}
+
+// deliver sends queued notifications until ctx is cancelled.
+func (a *Alerts) deliver(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-a.outbox:
+			notifyCtx, cancel := context.WithTimeout(ctx, alertNotifyTimeout)
+			a.notifications.Notify(notifyCtx, n)
+			cancel()
+		}
+	}
+}
+
+// evaluate fires alerts for conditions that held long enough, resolves
+// alerts whose condition no longer holds and repeats notifications. The
+// notifications are queued once a.mu is released.
+func (a *Alerts) evaluate(ctx context.Context, now time.Time) {
+	for _, n := range a.transition(ctx, now) {
+		select {
+		case a.outbox <- n:
+		default:
+			log.Error().Str("kind", n.Kind).Str("server_id", n.ServerID).Msg("alert notification queue is full, dropping notification")
+		}
+	}
+}
+
+// transition moves alerts between states and returns the notifications to
+// send about it.
+func (a *Alerts) transition(ctx context.Context, now time.Time) []models.Notification {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	conditions, outdated, err := a.conditions(ctx, now)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to evaluate alert rules")
+		return nil
+	}
+	var notifications []models.Notification
+	holding := make(map[string]alertCondition, len(conditions))
+	for _, c := range conditions {
+		holding[c.fingerprint()] = c
+	}
+
+	for fp := range a.pending {
+		if _, ok := holding[fp]; !ok {
+			delete(a.pending, fp)
+		}
+	}
+	for fp, c := range holding {
+		if active := a.active[fp]; active != nil {
+			active.alert.Value, active.alert.Message = c.value, c.message
+			continue
+		}
+		started, ok := a.pending[fp]
+		if !ok {
+			started = now
+			a.pending[fp] = now
+		}
+		if now.Sub(started) < c.rule.For {
+			continue
+		}
+		alert := models.Alert{
+			ID:        uuid.NewString(),
+			OrgID:     c.orgID,
+			Rule:      c.rule.Name,
+			Kind:      c.rule.Kind,
+			Severity:  c.rule.Severity,
+			ServerID:  c.serverID,
+			PublicKey: c.publicKey,
+			State:     models.AlertFiring,
+			Value:     c.value,
+			Message:   c.message,
+			StartedAt: started.UTC(),
+			FiredAt:   now.UTC(),
+		}
+		if err := a.store.CreateAlert(ctx, &alert); err != nil {
+			log.Error().Err(err).Str("rule", alert.Rule).Str("server_id", alert.ServerID).Msg("failed to record alert")
+			continue
+		}
+		delete(a.pending, fp)
+		a.active[fp] = &activeAlert{alert: alert, notifiedAt: now}
+		log.Warn().Str("rule", alert.Rule).Str("server_id", alert.ServerID).Str("public_key", alert.PublicKey).Msg(alert.Message)
+		notifications = append(notifications, alertNotification(models.NotifyAlertFiring, alert, now))
+	}
+
+	for fp, active := range a.active {
+		if _, ok := holding[fp]; ok {
+			rule, _ := a.rule(active.alert.Rule)
+			if rule.Repeat > 0 && active.alert.AcknowledgedAt == nil && now.Sub(active.notifiedAt) >= rule.Repeat {
+				active.notifiedAt = now
+				notifications = append(notifications, alertNotification(models.NotifyAlertFiring, active.alert, now))
+			}
+			continue
+		}
+		// The status of servers that are not online is out of date, so
+		// alerts on it stay until the server reports again.
+		if _, ok := a.rule(active.alert.Rule); ok && outdated[active.alert.ServerID] &&
+			active.alert.Kind != models.AlertServerOffline && active.alert.Kind != models.AlertCertExpiry {
+			continue
+		}
+		if err := a.store.ResolveAlert(ctx, active.alert.ID, now); err != nil {
+			log.Error().Err(err).Str("alert_id", active.alert.ID).Msg("failed to resolve alert")
+			continue
+		}
+		delete(a.active, fp)
+		resolvedAt := now.UTC()
+		alert := active.alert
+		alert.State, alert.ResolvedAt = models.AlertResolved, &resolvedAt
+		alert.Message = "resolved: " + alert.Message
+		log.Info().Str("rule", alert.Rule).Str("server_id", alert.ServerID).Str("public_key", alert.PublicKey).Msg(alert.Message)
+		notifications = append(notifications, alertNotification(models.NotifyAlertResolved, alert, now))
+	}
+	return notifications
+}
+
+func alertNotification(kind string, alert models.Alert, now time.Time) models.Notification {
+	return models.Notification{
+		Kind:      kind,
+		OrgID:     alert.OrgID,
+		Severity:  alert.Severity,
+		Message:   alert.Message,
+		ServerID:  alert.ServerID,
+		PublicKey: alert.PublicKey,
+		Time:      now.UTC(),
+		Data: map[string]any{
+			"alert_id": alert.ID,
+			"rule":     alert.Rule,
+			"kind":     alert.Kind,
+			"value":    alert.Value,
+		},
+	}
+}
+
+// rule returns the rule named name. The caller holds a.mu.
+func (a *Alerts) rule(name string) (models.AlertRule, bool) {
+	for _, r := range a.rules {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return models.AlertRule{}, false
+}
+
+// conditions returns the rule conditions that hold at now, and the servers
+// whose status is out of date: those that are not online, and those that
+// have not reported since the control plane started. The caller holds a.mu.
+func (a *Alerts) conditions(ctx context.Context, now time.Time) ([]alertCondition, map[string]bool, error) {
+	servers, err := a.store.ListReportingServers(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	var expiries []models.CertExpiry
+	if slices.ContainsFunc(a.rules, func(r models.AlertRule) bool { return r.Kind == models.AlertCertExpiry }) {
+		if expiries, err = a.store.ListCertificateExpiries(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var conditions []alertCondition
+	cached := make(map[string]bool)
+	outdated := make(map[string]bool)
+	for _, event := range a.client.GetAllStatuses() {
+		cached[event.ServerID] = true
+		outdated[event.ServerID] = event.State != models.StateOnline
+		if event.OrgID == "" {
+			event.OrgID = models.DefaultOrgID
+		}
+		connected := a.recordPeerCount(event, now)
+		for _, rule := range a.rules {
+			if len(rule.Servers) == 0 || slices.Contains(rule.Servers, event.ServerID) {
+				conditions = append(conditions, serverConditions(rule, event, connected, a.peerCounts[event.ServerID], now)...)
+			}
+		}
+	}
+
+	for _, server := range servers {
+		if cached[server.ID] {
+			continue
+		}
+		outdated[server.ID] = true
+		if now.Sub(*server.LastSeen) < a.offlineAfter {
+			continue
+		}
+		for _, rule := range a.rules {
+			if rule.Kind == models.AlertServerOffline && (len(rule.Servers) == 0 || slices.Contains(rule.Servers, server.ID)) {
+				conditions = append(conditions, offlineCondition(rule, server.OrgID, server.ID, *server.LastSeen, now))
+			}
+		}
+	}
+
+	for _, e := range expiries {
+		for _, rule := range a.rules {
+			if rule.Kind != models.AlertCertExpiry || (len(rule.Servers) > 0 && !slices.Contains(rule.Servers, e.ServerID)) {
+				continue
+			}
+			left := e.ExpiresAt.Sub(now)
+			if left >= rule.Window {
+				continue
+			}
+			message := fmt.Sprintf("agent certificate of server %s expires in %s", e.ServerID, formatAge(left))
+			if left <= 0 {
+				message = fmt.Sprintf("agent certificate of server %s expired %s ago", e.ServerID, formatAge(-left))
+			}
+			conditions = append(conditions, alertCondition{
+				rule:     rule,
+				orgID:    e.OrgID,
+				serverID: e.ServerID,
+				value:    left.Hours(),
+				message:  message,
+			})
+		}
+	}
+	return conditions, outdated, nil
+}
+
+// recordPeerCount samples the connected peers of an online server, keeps the
+// samples the peer count drop rules look back on and returns the count. The
+// caller holds a.mu.
+func (a *Alerts) recordPeerCount(event models.StatusEvent, now time.Time) int {
+	connected := 0
+	if event.Status != nil {
+		for _, p := range event.Status.Peers {
+			if !p.LatestHandshake.IsZero() && now.Sub(p.LatestHandshake) < peerConnectedWithin {
+				connected++
+			}
+		}
+	}
+	var window time.Duration
+	for _, rule := range a.rules {
+		if rule.Kind == models.AlertPeerCountDrop {
+			window = max(window, rule.Window)
+		}
+	}
+	if window == 0 || event.State != models.StateOnline {
+		delete(a.peerCounts, event.ServerID)
+		return connected
+	}
+	samples := append(a.peerCounts[event.ServerID], peerCountSample{at: now, count: connected})
+	for len(samples) > 0 && now.Sub(samples[0].at) > window {
+		samples = samples[1:]
+	}
+	a.peerCounts[event.ServerID] = samples
+	return connected
+}
+
+// serverConditions returns the conditions of rule that hold for the server
+// of event. Only offline servers are alerted on for being offline, and only
+// online servers for anything else, as the status of others is outdated.
+func serverConditions(rule models.AlertRule, event models.StatusEvent, connected int, samples []peerCountSample, now time.Time) []alertCondition {
+	if rule.Kind == models.AlertServerOffline {
+		if event.State == models.StateOffline {
+			return []alertCondition{offlineCondition(rule, event.OrgID, event.ServerID, event.Time, now)}
+		}
+		return nil
+	}
+	if event.State != models.StateOnline || event.Status == nil {
+		return nil
+	}
+
+	c := alertCondition{rule: rule, orgID: event.OrgID, serverID: event.ServerID}
+	system := event.Status.System
+	switch rule.Kind {
+	case models.AlertCPU, models.AlertMemory, models.AlertDisk:
+		name, value := "CPU", system.CPUPercent
+		switch rule.Kind {
+		case models.AlertMemory:
+			name, value = "memory", system.MemoryPercent
+		case models.AlertDisk:
+			name, value = "disk", system.DiskPercent
+		}
+		if value <= rule.Threshold {
+			return nil
+		}
+		c.value = value
+		c.message = fmt.Sprintf("%s usage of server %s is %.1f%% (threshold %g%%)", name, event.ServerID, value, rule.Threshold)
+		return []alertCondition{c}
+
+	case models.AlertHandshakeAge:
+		var conditions []alertCondition
+		for _, p := range event.Status.Peers {
+			age := now.Sub(p.LatestHandshake)
+			if p.LatestHandshake.IsZero() || age <= rule.Window {
+				continue
+			}
+			c.publicKey = p.PublicKey
+			c.value = age.Seconds()
+			c.message = fmt.Sprintf("peer %s of server %s last completed a handshake %s ago", p.PublicKey, event.ServerID, formatAge(age))
+			conditions = append(conditions, c)
+		}
+		return conditions
+
+	case models.AlertPeerCountDrop:
+		peak := connected
+		for _, s := range samples {
+			if now.Sub(s.at) <= rule.Window {
+				peak = max(peak, s.count)
+			}
+		}
+		if drop := peak - connected; float64(drop) >= rule.Threshold {
+			c.value = float64(drop)
+			c.message = fmt.Sprintf("server %s has %d connected peers, down from %d", event.ServerID, connected, peak)
+			return []alertCondition{c}
+		}
+	}
+	return nil
+}
+
+func offlineCondition(rule models.AlertRule, orgID, serverID string, reportedAt, now time.Time) alertCondition {
+	age := now.Sub(reportedAt)
+	return alertCondition{
+		rule:     rule,
+		orgID:    orgID,
+		serverID: serverID,
+		value:    age.Seconds(),
+		message:  fmt.Sprintf("server %s is offline, last report %s ago", serverID, formatAge(age)),
+	}
+}
+
+// formatAge renders a duration to the minute, or to the second below one.
+func formatAge(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+	return strings.TrimSuffix(d.Round(time.Minute).String(), "0s")
+}
@@ -2,11 +2,22 @@ package control
 
 import (
 	"context"
+	"errors"
 	"sync"
 
 	"time"
 
 	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrResyncRequired rejects a delta that cannot be applied until the
+	// agent sends a full snapshot.
+	ErrResyncRequired = errors.New("full status resync required")
+	// ErrIdentityConflict rejects a report from an agent identity that
+	// conflicts with the one known for its server.
+	ErrIdentityConflict = errors.New("conflicting agent identity")
 )
 
 type StatusBroadcaster interface {
@@ -14,32 +25,153 @@ type StatusBroadcaster interface {
 }
 
 type StatusCache struct {
-	mu          sync.RWMutex
-	statuses    map[string]*models.Status
-	bus         *EventBus
-	broadcaster StatusBroadcaster
+	mu            sync.RWMutex
+	statuses      map[string]*models.Status
+	seqs          map[string]uint64
+	resync        map[string]bool
+	owners        map[string]*serverOwner
+	conflicts     []models.IdentityConflict
+	conflictStore IdentityConflictStore
+	bus           *EventBus
+	broadcaster   StatusBroadcaster
+
+	// reported and states track the liveness of every cached server.
+	reported     map[string]time.Time
+	states       map[string]string
+	orgs         map[string]string
+	staleAfter   time.Duration
+	offlineAfter time.Duration
 }
 
-func NewStatusCache(bus *EventBus, broadcaster StatusBroadcaster) *StatusCache {
-	c := &StatusCache{
-		bus:         bus,
-		broadcaster: broadcaster,
-		statuses:    make(map[string]*models.Status),
+// NewStatusCache returns a cache of the status of every server. Reports are
+// handed to Ingest, which publishes the accepted ones on bus. Identity
+// conflicts are persisted in conflictStore.
+func NewStatusCache(bus *EventBus, broadcaster StatusBroadcaster, conflictStore IdentityConflictStore) *StatusCache {
+	return &StatusCache{
+		bus:           bus,
+		broadcaster:   broadcaster,
+		conflictStore: conflictStore,
+		statuses:      make(map[string]*models.Status),
+		seqs:          make(map[string]uint64),
+		resync:        make(map[string]bool),
+		owners:        make(map[string]*serverOwner),
+		reported:      make(map[string]time.Time),
+		states:        make(map[string]string),
+		orgs:          make(map[string]string),
+		staleAfter:    defaultStaleAfter,
+		offlineAfter:  defaultOfflineAfter,
+	}
+}
+
+// Ingest applies a report to the cache and publishes it on the bus. Reports
+// from a conflicting agent identity and deltas that cannot be applied are
+// rejected with ErrIdentityConflict and ErrResyncRequired and never reach the
+// bus, so its subscribers only see reports the cache accepted.
+func (c *StatusCache) Ingest(event models.StatusEvent) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	// Publishing under the lock keeps the bus in the order reports were
+	// applied.
+	c.mu.Lock()
+	conflict, ok := c.checkIdentity(event, time.Now())
+	var merged models.StatusEvent
+	var from string
+	err := ErrIdentityConflict
+	if ok {
+		merged, from, err = c.apply(event)
+	}
+	if err == nil {
+		c.bus.Publish(event)
+	}
+	c.mu.Unlock()
+	if conflict != nil {
+		c.recordConflict(conflict)
+	}
+	if err != nil {
+		return err
+	}
+
+	if from != models.StateOnline {
+		c.announce(merged, from)
+		return nil
+	}
+	if c.broadcaster != nil {
+		c.broadcaster.Broadcast(merged)
 	}
-	go c.listen()
-	return c
+	return nil
 }
 
-func (c *StatusCache) listen() {
-	ch := c.bus.Subscribe()
-	for event := range ch {
-		c.mu.Lock()
-		c.statuses[event.ServerID] = event.Status
-		c.mu.Unlock()
-		if c.broadcaster != nil {
-			c.broadcaster.Broadcast(event)
+// apply stores a full snapshot or merges a delta onto the last known status
+// of a server whose agent identity has been checked.
+// It returns the resulting full event and the liveness state the server was
+// in before. A delta that cannot be applied flags the server for a resync.
+// The caller holds c.mu.
+func (c *StatusCache) apply(event models.StatusEvent) (models.StatusEvent, string, error) {
+	id := event.ServerID
+	if !event.Delta {
+		c.statuses[id] = event.Status
+		c.seqs[id] = event.Seq
+		delete(c.resync, id)
+		event, from := c.markOnline(event)
+		return event, from, nil
+	}
+
+	base, ok := c.statuses[id]
+	if !ok || c.resync[id] || event.Seq != c.seqs[id]+1 {
+		if !c.resync[id] {
+			log.Warn().
+				Str("server_id", id).
+				Uint64("expected_seq", c.seqs[id]+1).
+				Uint64("seq", event.Seq).
+				Msg("status delta out of sequence, requesting resync")
+		}
+		c.resync[id] = true
+		return models.StatusEvent{}, "", ErrResyncRequired
+	}
+
+	status := mergeDelta(base, event)
+	c.statuses[id] = status
+	c.seqs[id] = event.Seq
+
+	event.Status = status
+	event.Delta = false
+	event.RemovedPeers = nil
+	event, from := c.markOnline(event)
+	return event, from, nil
+}
+
+// mergeDelta builds a new status from base and a delta event. The base status
+// is never modified since readers may still hold it.
+func mergeDelta(base *models.Status, event models.StatusEvent) *models.Status {
+	changed := make(map[string]models.Peer, len(event.Status.Peers))
+	for _, p := range event.Status.Peers {
+		changed[p.Key()] = p
+	}
+	removed := make(map[string]bool, len(event.RemovedPeers))
+	for _, key := range event.RemovedPeers {
+		removed[key] = true
+	}
+
+	status := *event.Status
+	status.Peers = make([]models.Peer, 0, len(base.Peers)+len(changed))
+	for _, p := range base.Peers {
+		if removed[p.Key()] {
+			continue
+		}
+		if np, ok := changed[p.Key()]; ok {
+			p = np
+			delete(changed, p.Key())
+		}
+		status.Peers = append(status.Peers, p)
+	}
+	// Whatever is left in changed was added since the last report.
+	for _, p := range event.Status.Peers {
+		if _, ok := changed[p.Key()]; ok {
+			status.Peers = append(status.Peers, p)
 		}
 	}
+	return &status
 }
 
 func (c *StatusCache) GetStatus(ctx context.Context, serverID string) (*models.Status, error) {
@@ -55,8 +187,10 @@ func (c *StatusCache) GetAllStatuses() []models.StatusEvent {
 	for id, status := range c.statuses {
 		events = append(events, models.StatusEvent{
 			ServerID: id,
+			OrgID:    c.orgs[id],
 			Status:   status,
-			Time:     time.Now(),
+			Time:     c.reported[id],
+			State:    c.states[id],
 		})
 	}
 	return events
@@ -0,0 +1,152 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+// peer returns a peer whose key is key and whose counter is rx.
+func peer(key string, rx int64) models.Peer {
+	return models.Peer{PublicKey: key, ReceiveBytes: rx}
+}
+
+func snapshot(seq uint64, peers ...models.Peer) models.StatusEvent {
+	return models.StatusEvent{ServerID: "srv-1", Seq: seq, Status: &models.Status{Peers: peers}}
+}
+
+func delta(seq uint64, removed []string, peers ...models.Peer) models.StatusEvent {
+	return models.StatusEvent{ServerID: "srv-1", Seq: seq, Delta: true, RemovedPeers: removed, Status: &models.Status{Peers: peers}}
+}
+
+// peerList describes peers as key=rx, in order.
+func peerList(peers []models.Peer) []string {
+	list := make([]string, 0, len(peers))
+	for _, p := range peers {
+		list = append(list, fmt.Sprintf("%s=%d", p.Key(), p.ReceiveBytes))
+	}
+	return list
+}
+
+func TestStatusCacheApply(t *testing.T) {
+	base := snapshot(1, peer("a", 1), peer("b", 1))
+	tests := []struct {
+		name   string
+		events []models.StatusEvent
+		// wantErr is what ingesting the last event returns.
+		wantErr   error
+		wantPeers []string
+	}{
+		{
+			name:      "full snapshot",
+			events:    []models.StatusEvent{base},
+			wantPeers: []string{"a=1", "b=1"},
+		},
+		{
+			name:      "peer changed",
+			events:    []models.StatusEvent{base, delta(2, nil, peer("a", 5))},
+			wantPeers: []string{"a=5", "b=1"},
+		},
+		{
+			name:      "peer added",
+			events:    []models.StatusEvent{base, delta(2, nil, peer("c", 1))},
+			wantPeers: []string{"a=1", "b=1", "c=1"},
+		},
+		{
+			name:      "peer on another interface added",
+			events:    []models.StatusEvent{base, delta(2, nil, models.Peer{Interface: "wg1", PublicKey: "a", ReceiveBytes: 7})},
+			wantPeers: []string{"a=1", "b=1", "wg1/a=7"},
+		},
+		{
+			name:      "peer removed",
+			events:    []models.StatusEvent{base, delta(2, []string{"b"})},
+			wantPeers: []string{"a=1"},
+		},
+		{
+			name:      "peers changed, added and removed",
+			events:    []models.StatusEvent{base, delta(2, []string{"a"}, peer("b", 3), peer("c", 1))},
+			wantPeers: []string{"b=3", "c=1"},
+		},
+		{
+			name:      "deltas in sequence",
+			events:    []models.StatusEvent{base, delta(2, nil, peer("a", 2)), delta(3, nil, peer("a", 3))},
+			wantPeers: []string{"a=3", "b=1"},
+		},
+		{
+			name:    "delta without snapshot",
+			events:  []models.StatusEvent{delta(1, nil, peer("a", 1))},
+			wantErr: ErrResyncRequired,
+		},
+		{
+			name:      "delta out of sequence",
+			events:    []models.StatusEvent{base, delta(3, nil, peer("a", 5))},
+			wantErr:   ErrResyncRequired,
+			wantPeers: []string{"a=1", "b=1"},
+		},
+		{
+			name:      "repeated delta",
+			events:    []models.StatusEvent{base, delta(2, nil, peer("a", 2)), delta(2, nil, peer("a", 5))},
+			wantErr:   ErrResyncRequired,
+			wantPeers: []string{"a=2", "b=1"},
+		},
+		{
+			name:      "delta in sequence after a gap waits for a snapshot",
+			events:    []models.StatusEvent{base, delta(3, nil, peer("a", 5)), delta(2, nil, peer("a", 2))},
+			wantErr:   ErrResyncRequired,
+			wantPeers: []string{"a=1", "b=1"},
+		},
+		{
+			name: "full snapshot clears resync",
+			events: []models.StatusEvent{
+				base,
+				delta(3, nil, peer("a", 5)),
+				snapshot(7, peer("a", 9)),
+				delta(8, nil, peer("b", 2)),
+			},
+			wantPeers: []string{"a=9", "b=2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewStatusCache(NewEventBus(), nil, nil)
+			ctx := context.Background()
+			last := len(tt.events) - 1
+			var first *models.Status
+			for i, e := range tt.events {
+				err := c.Ingest(e)
+				if i == last {
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("Ingest = %v, want %v", err, tt.wantErr)
+					}
+					break
+				}
+				if err != nil && !errors.Is(err, ErrResyncRequired) {
+					t.Fatalf("event %d: %v", i, err)
+				}
+				if i == 0 {
+					first, _ = c.GetStatus(ctx, "srv-1")
+				}
+			}
+
+			status, err := c.GetStatus(ctx, "srv-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			if status != nil {
+				got = peerList(status.Peers)
+			}
+			if !slices.Equal(got, tt.wantPeers) {
+				t.Errorf("peers = %v, want %v", got, tt.wantPeers)
+			}
+			// Deltas build a new status; readers of the old one keep it.
+			if first != nil && !slices.Equal(peerList(first.Peers), peerList(tt.events[0].Status.Peers)) {
+				t.Errorf("first status changed to %v", peerList(first.Peers))
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	sessionWriteWait      = 10 * time.Second
+	sessionPongWait       = 60 * time.Second
+	sessionPingPeriod     = (sessionPongWait * 9) / 10
+	sessionMaxMessageSize = 4 << 20
+	commandTimeout        = 30 * time.Second
+)
+
+var (
+	ErrAgentNotConnected = errors.New("agent not connected")
+	ErrSessionClosed     = errors.New("agent channel closed")
+	ErrCapabilityMissing = errors.New("agent lacks required capability")
+)
+
+// CommandTarget executes commands on an agent.
+type CommandTarget interface {
+	Execute(ctx context.Context, cmd models.Command) (models.CommandResult, error)
+}
+
+// LocalTarget executes commands in process, for the agent embedded in the control plane.
+type LocalTarget func(ctx context.Context, cmd models.Command) models.CommandResult
+
+func (f LocalTarget) Execute(ctx context.Context, cmd models.Command) (models.CommandResult, error) {
+	return f(ctx, cmd), nil
+}
+
+// ChannelHub tracks the agents that can currently receive commands. Commands
+// are refused if the inventory shows the agent lacks the needed capability.
+type ChannelHub struct {
+	inventory *Inventory
+
+	mu      sync.RWMutex
+	targets map[string]CommandTarget
+}
+
+func NewChannelHub(inventory *Inventory) *ChannelHub {
+	return &ChannelHub{inventory: inventory, targets: make(map[string]CommandTarget)}
+}
+
+// Register makes serverID reachable through target, replacing any previous target.
+func (h *ChannelHub) Register(serverID string, target CommandTarget) {
+	h.mu.Lock()
+	old := h.targets[serverID]
+	h.targets[serverID] = target
+	h.mu.Unlock()
+
+	// Close the connection the previous target was reached through.
+	if closer, ok := old.(interface{ Close() }); ok && old != target {
+		closer.Close()
+	}
+}
+
+// Unregister removes target if it is still the registered one for serverID.
+func (h *ChannelHub) Unregister(serverID string, target CommandTarget) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.targets[serverID] == target {
+		delete(h.targets, serverID)
+	}
+}
+
+// Connected reports whether commands can be sent to serverID.
+func (h *ChannelHub) Connected(serverID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	_, ok := h.targets[serverID]
+	return ok
+}
+
+// SendCommand executes cmd on the agent of serverID and waits for its result.
+// Without a deadline on ctx, the command times out after commandTimeout.
+func (h *ChannelHub) SendCommand(ctx context.Context, serverID string, cmd models.Command) (models.CommandResult, error) {
+	h.mu.RLock()
+	target, ok := h.targets[serverID]
+	h.mu.RUnlock()
+	if !ok {
+		return models.CommandResult{}, ErrAgentNotConnected
+	}
+	if h.inventory != nil {
+		if err := h.inventory.CheckCommand(serverID, cmd); err != nil {
+			return models.CommandResult{}, err
+		}
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, commandTimeout)
+		defer cancel()
+	}
+	return target.Execute(ctx, cmd)
+}
+
+// ReportFunc ingests a report message received on an agent channel and
+// returns the acknowledgement to send back.
+type ReportFunc func(ctx context.Context, msg models.ChannelMessage) models.ChannelMessage
+
+// AgentSession is the control plane end of an agent's persistent channel.
+type AgentSession struct {
+	conn     *websocket.Conn
+	serverID string
+	onReport ReportFunc
+	send     chan models.ChannelMessage
+	done     chan struct{}
+	once     sync.Once
+
+	mu      sync.Mutex
+	pending map[string]chan models.CommandResult
+}
+
+func NewAgentSession(conn *websocket.Conn, serverID string, onReport ReportFunc) *AgentSession {
+	return &AgentSession{
+		conn:     conn,
+		serverID: serverID,
+		onReport: onReport,
+		send:     make(chan models.ChannelMessage, 64),
+		done:     make(chan struct{}),
+		pending:  make(map[string]chan models.CommandResult),
+	}
+}
+
+// Run serves the session until the connection closes.
+func (s *AgentSession) Run(ctx context.Context) {
+	go s.writePump()
+	s.readPump(ctx)
+	s.Close()
+}
+
+// Close terminates the session. Pending commands fail with ErrSessionClosed.
+func (s *AgentSession) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.conn.Close()
+	})
+}
+
+func (s *AgentSession) readPump(ctx context.Context) {
+	s.conn.SetReadLimit(sessionMaxMessageSize)
+	s.conn.SetReadDeadline(time.Now().Add(sessionPongWait))
+	s.conn.SetPongHandler(func(string) error {
+		s.conn.SetReadDeadline(time.Now().Add(sessionPongWait))
+		return nil
+	})
+
+	for {
+		var msg models.ChannelMessage
+		if err := s.conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Warn().Err(err).Str("server_id", s.serverID).Msg("agent channel error")
+			}
+			return
+		}
+
+		switch msg.Type {
+		case models.ChannelReport:
+			if len(msg.Report) == 0 {
+				s.reply(models.ChannelMessage{Type: models.ChannelReportAck, ID: msg.ID, Error: "missing report"})
+				continue
+			}
+			ack := s.onReport(ctx, msg)
+			ack.Type = models.ChannelReportAck
+			ack.ID = msg.ID
+			s.reply(ack)
+		case models.ChannelCommandResult:
+			s.mu.Lock()
+			ch, ok := s.pending[msg.ID]
+			delete(s.pending, msg.ID)
+			s.mu.Unlock()
+			if ok && msg.Result != nil {
+				ch <- *msg.Result
+			}
+		default:
+			log.Warn().Str("type", msg.Type).Str("server_id", s.serverID).Msg("unexpected message on agent channel")
+		}
+	}
+}
+
+func (s *AgentSession) reply(msg models.ChannelMessage) {
+	select {
+	case s.send <- msg:
+	case <-s.done:
+	}
+}
+
+func (s *AgentSession) writePump() {
+	ticker := time.NewTicker(sessionPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case msg := <-s.send:
+			s.conn.SetWriteDeadline(time.Now().Add(sessionWriteWait))
+			if err := s.conn.WriteJSON(msg); err != nil {
+				s.Close()
+				return
+			}
+		case <-ticker.C:
+			s.conn.SetWriteDeadline(time.Now().Add(sessionWriteWait))
+			if err := s.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				s.Close()
+				return
+			}
+		}
+	}
+}
+
+// Execute sends a command to the agent and waits for its result.
+func (s *AgentSession) Execute(ctx context.Context, cmd models.Command) (models.CommandResult, error) {
+	id := uuid.NewString()
+	ch := make(chan models.CommandResult, 1)
+	s.mu.Lock()
+	s.pending[id] = ch
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, id)
+		s.mu.Unlock()
+	}()
+
+	select {
+	case s.send <- models.ChannelMessage{Type: models.ChannelCommand, ID: id, Command: &cmd}:
+	case <-s.done:
+		return models.CommandResult{}, ErrSessionClosed
+	case <-ctx.Done():
+		return models.CommandResult{}, ctx.Err()
+	}
+
+	select {
+	case result := <-ch:
+		return result, nil
+	case <-s.done:
+		return models.CommandResult{}, ErrSessionClosed
+	case <-ctx.Done():
+		return models.CommandResult{}, ctx.Err()
+	}
+}
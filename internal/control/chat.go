@@ -0,0 +1,352 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/ChronoCoders/sentra/internal/version"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	chatTimeout   = 10 * time.Second
+	chatQueueSize = 1000
+	chatWorkers   = 4
+)
+
+// Colors of chat messages. Messages about something that recovered are
+// green whatever their severity.
+var chatColors = map[string]string{
+	models.SeverityInfo:     "#36a2eb",
+	models.SeverityWarning:  "#f2a900",
+	models.SeverityCritical: "#d72b3f",
+	"good":                  "#2eb67d",
+}
+
+// chatTitles are the titles of messages, by notification kind.
+var chatTitles = map[string]string{
+	models.NotifyQuotaWarning:    "Quota warning",
+	models.NotifyQuotaExceeded:   "Quota exceeded",
+	models.NotifyQuotaResumed:    "Quota resumed",
+	models.NotifyAlertFiring:     "Alert firing",
+	models.NotifyAlertResolved:   "Alert resolved",
+	models.NotifyPeerExpiring:    "Peer expiring",
+	models.NotifyPeerExpired:     "Peer expired",
+	models.EventPeerConnected:    "Peer connected",
+	models.EventPeerDisconnected: "Peer disconnected",
+	models.EventPeerCreated:      "Peer created",
+	models.EventPeerRemoved:      "Peer removed",
+}
+
+// ChatStore tells which chat channels an organization has.
+type ChatStore interface {
+	ListChatChannels(ctx context.Context, orgID string) ([]models.ChatChannel, error)
+}
+
+// Chat is a notification channel that posts to the chat channels of an
+// organization, in the incoming webhook format of their chat tool. Each
+// channel's routing rules decide what it gets. Besides notifications it
+// posts the peer events published to webhooks. Posts are not retried.
+type Chat struct {
+	store ChatStore
+	http  *http.Client
+	queue chan models.Notification
+
+	mu           sync.Mutex
+	dashboardURL string
+}
+
+func NewChat(store ChatStore) *Chat {
+	return &Chat{
+		store: store,
+		http:  &http.Client{Timeout: chatTimeout},
+		queue: make(chan models.Notification, chatQueueSize),
+	}
+}
+
+// SetDashboardURL sets the dashboard messages link to.
+func (c *Chat) SetDashboardURL(u string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dashboardURL = strings.TrimSuffix(u, "/")
+}
+
+func (c *Chat) dashboard() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dashboardURL
+}
+
+// Notify queues a notification to be posted.
+func (c *Chat) Notify(ctx context.Context, n models.Notification) error {
+	select {
+	case c.queue <- n:
+		return nil
+	default:
+		return errors.New("chat queue is full")
+	}
+}
+
+// Event queues the peer events published to webhooks to be posted. It makes
+// Chat an EventObserver.
+func (c *Chat) Event(ctx context.Context, orgID, eventType string, data any) {
+	fields, ok := data.(map[string]any)
+	if !ok {
+		return
+	}
+	serverID, _ := fields["server_id"].(string)
+	publicKey, _ := fields["public_key"].(string)
+	n := models.Notification{
+		Kind:      eventType,
+		OrgID:     orgID,
+		Severity:  models.SeverityInfo,
+		ServerID:  serverID,
+		PublicKey: publicKey,
+		Time:      time.Now().UTC(),
+		Data:      fields,
+	}
+	switch eventType {
+	case models.EventPeerConnected:
+		n.Message = fmt.Sprintf("peer %s connected to %s", publicKey, serverID)
+	case models.EventPeerDisconnected:
+		n.Message = fmt.Sprintf("peer %s disconnected from %s", publicKey, serverID)
+	case models.EventPeerCreated:
+		n.Message = fmt.Sprintf("peer %s created on %s", publicKey, serverID)
+	case models.EventPeerRemoved:
+		n.Message = fmt.Sprintf("peer %s removed from %s", publicKey, serverID)
+	default:
+		// Servers going offline and alerts are posted as notifications.
+		return
+	}
+	if by, _ := fields["by"].(string); by != "" {
+		n.Message += " by " + by
+	}
+	if err := c.Notify(ctx, n); err != nil {
+		log.Error().Err(err).Str("event", eventType).Msg("failed to queue chat message")
+	}
+}
+
+// Run posts queued notifications until ctx is cancelled.
+func (c *Chat) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range chatWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case n := <-c.queue:
+					c.route(ctx, n)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// route posts a notification to every channel of its organization that
+// routes it.
+func (c *Chat) route(ctx context.Context, n models.Notification) {
+	orgID := n.OrgID
+	if orgID == "" {
+		orgID = models.DefaultOrgID
+	}
+	channels, err := c.store.ListChatChannels(ctx, orgID)
+	if err != nil {
+		log.Error().Err(err).Str("kind", n.Kind).Msg("failed to list chat channels")
+		return
+	}
+	for _, ch := range channels {
+		if !ch.Routes(n) {
+			continue
+		}
+		if err := c.Send(ctx, ch, n); err != nil {
+			log.Warn().Err(err).Str("channel", ch.Name).Str("kind", n.Kind).Msg("failed to post chat message")
+		}
+	}
+}
+
+// Send posts a notification to a channel right away, whatever its routing
+// rules.
+func (c *Chat) Send(ctx context.Context, ch models.ChatChannel, n models.Notification) error {
+	body, err := FormatChatMessage(ch.Type, n, c.dashboard())
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ch.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Sentra/"+version.Version)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// chatMessage is what a notification says, ahead of being formatted for a
+// chat tool.
+type chatMessage struct {
+	title, text, color string
+	// link is the dashboard page of the server, or the dashboard.
+	link   string
+	fields []chatField
+	time   time.Time
+}
+
+type chatField struct {
+	title, value, link string
+	short              bool
+}
+
+func newChatMessage(n models.Notification, dashboardURL string) chatMessage {
+	m := chatMessage{
+		title: chatTitles[n.Kind],
+		text:  n.Message,
+		color: chatColors[n.Severity],
+		link:  dashboardURL,
+		time:  n.Time,
+	}
+	if m.title == "" {
+		m.title = n.Kind
+	}
+	if m.color == "" {
+		m.color = chatColors[models.SeverityInfo]
+	}
+	switch n.Kind {
+	case models.NotifyAlertResolved, models.NotifyQuotaResumed, models.EventPeerConnected:
+		m.color = chatColors["good"]
+	}
+	if rule, _ := n.Data["rule"].(string); rule != "" {
+		m.title += ": " + rule
+	}
+
+	m.fields = append(m.fields, chatField{title: "Severity", value: n.Severity, short: true})
+	if n.ServerID != "" {
+		f := chatField{title: "Server", value: n.ServerID, short: true}
+		if dashboardURL != "" {
+			f.link = dashboardURL + "/#server=" + url.QueryEscape(n.ServerID)
+			m.link = f.link
+		}
+		m.fields = append(m.fields, f)
+	}
+	if n.PublicKey != "" {
+		f := chatField{title: "Peer", value: n.PublicKey}
+		if dashboardURL != "" && n.ServerID != "" {
+			f.link = dashboardURL + "/#server=" + url.QueryEscape(n.ServerID) + "&peer=" + url.QueryEscape(n.PublicKey)
+		}
+		m.fields = append(m.fields, f)
+	}
+	return m
+}
+
+// FormatChatMessage renders a notification as the incoming webhook payload of
+// a chat type.
+func FormatChatMessage(chatType string, n models.Notification, dashboardURL string) ([]byte, error) {
+	m := newChatMessage(n, dashboardURL)
+	switch chatType {
+	case models.ChatSlack, models.ChatMattermost:
+		return json.Marshal(slackPayload(chatType, m))
+	case models.ChatTeams:
+		return json.Marshal(teamsPayload(m))
+	}
+	return nil, fmt.Errorf("unknown chat type %q", chatType)
+}
+
+// slackPayload renders a message as a Slack attachment, which Mattermost
+// accepts as well. Links are written the way each of them expects.
+func slackPayload(chatType string, m chatMessage) map[string]any {
+	escape, link := slackEscape, func(text, u string) string { return "<" + u + "|" + slackEscape(text) + ">" }
+	if chatType == models.ChatMattermost {
+		escape, link = func(s string) string { return s }, func(text, u string) string { return "[" + text + "](" + u + ")" }
+	}
+	fields := make([]map[string]any, len(m.fields))
+	for i, f := range m.fields {
+		value := escape(f.value)
+		if f.link != "" {
+			value = link(f.value, f.link)
+		}
+		fields[i] = map[string]any{"title": f.title, "value": value, "short": f.short}
+	}
+	attachment := map[string]any{
+		"fallback": m.title + ": " + m.text,
+		"color":    m.color,
+		"title":    m.title,
+		"text":     escape(m.text),
+		"fields":   fields,
+		"footer":   "Sentra",
+		"ts":       m.time.Unix(),
+	}
+	if m.link != "" {
+		attachment["title_link"] = m.link
+	}
+	payload := map[string]any{"attachments": []any{attachment}}
+	if chatType == models.ChatMattermost {
+		payload["username"] = "Sentra"
+	}
+	return payload
+}
+
+// slackEscape escapes the characters Slack reads as markup.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// teamsPayload renders a message as an Adaptive Card, which Teams workflows
+// post to a channel.
+func teamsPayload(m chatMessage) map[string]any {
+	color := "Accent"
+	switch m.color {
+	case chatColors[models.SeverityCritical]:
+		color = "Attention"
+	case chatColors[models.SeverityWarning]:
+		color = "Warning"
+	case chatColors["good"]:
+		color = "Good"
+	}
+	facts := make([]map[string]string, len(m.fields))
+	for i, f := range m.fields {
+		facts[i] = map[string]string{"title": f.title, "value": f.value}
+	}
+	body := []any{
+		map[string]any{"type": "TextBlock", "text": m.title, "weight": "Bolder", "size": "Medium", "color": color, "wrap": true},
+		map[string]any{"type": "TextBlock", "text": m.text, "wrap": true},
+		map[string]any{"type": "FactSet", "facts": facts},
+		map[string]any{"type": "TextBlock", "text": m.time.UTC().Format(time.RFC1123), "isSubtle": true, "size": "Small", "wrap": true},
+	}
+	card := map[string]any{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body":    body,
+	}
+	if m.link != "" {
+		card["actions"] = []any{map[string]any{"type": "Action.OpenUrl", "title": "Open in Sentra", "url": m.link}}
+	}
+	return map[string]any{
+		"type": "message",
+		"attachments": []any{map[string]any{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content":     card,
+		}},
+	}
+}
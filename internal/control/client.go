@@ -10,4 +10,6 @@ type AgentClient interface {
 	GetStatus(ctx context.Context, serverID string) (*models.Status, error)
 	ListPeers(ctx context.Context, serverID string) ([]models.Peer, error)
 	GetAllStatuses() []models.StatusEvent
+	Ingest(event models.StatusEvent) error
+	Liveness(serverID string) (models.Liveness, bool)
 }
@@ -0,0 +1,488 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// How connections to the SMTP server are secured.
+const (
+	SMTPStartTLS = "starttls"
+	SMTPTLS      = "tls"
+	SMTPNoTLS    = "none"
+)
+
+const (
+	smtpTimeout = 30 * time.Second
+	// emailQueueSize is how many notifications may wait to be routed.
+	emailQueueSize = 1000
+	// emailFlushInterval is how often digests are checked for being due.
+	emailFlushInterval = 10 * time.Second
+	// emailDigestMax is how many notifications a digest lists.
+	emailDigestMax = 50
+)
+
+// SMTPConfig is how emails are sent. Mail is off without Addr.
+type SMTPConfig struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+	// TLS is SMTPStartTLS, SMTPTLS or SMTPNoTLS. Credentials are only sent
+	// over TLS, or to localhost.
+	TLS string
+}
+
+// EmailData is what email templates are rendered with.
+type EmailData struct {
+	OrgID        string
+	To           string
+	Name         string
+	DashboardURL string
+	// Notification is the notification of a single notification email, and
+	// the first one of a digest.
+	Notification  models.Notification
+	Notifications []models.Notification
+	// More is how many notifications of a digest were left out.
+	More       int
+	Invitation models.Invitation
+	AcceptURL  string
+}
+
+// EmailStore tells who to email and with which templates.
+type EmailStore interface {
+	ListUsers(ctx context.Context, orgID string) ([]models.User, error)
+	ListNotificationPreferences(ctx context.Context, orgID string) ([]models.NotificationPreference, error)
+	GetEmailTemplate(ctx context.Context, orgID, name string) (*models.EmailTemplate, error)
+}
+
+// Email is a notification channel that emails the users of an organization
+// who asked for it. The first notification to a user is sent right away;
+// notifications that follow within the digest window are batched up and sent
+// as a single digest when the window ends, so a flapping server sends a few
+// emails instead of hundreds.
+type Email struct {
+	store EmailStore
+	queue chan models.Notification
+
+	mu           sync.Mutex
+	smtp         SMTPConfig
+	digestWindow time.Duration
+	dashboardURL string
+
+	// recipients holds what was sent to whom recently. It is only used by
+	// Run.
+	recipients map[string]*emailRecipient
+}
+
+type emailRecipient struct {
+	user    models.User
+	sentAt  time.Time
+	pending []models.Notification
+}
+
+func NewEmail(store EmailStore) *Email {
+	return &Email{
+		store:      store,
+		queue:      make(chan models.Notification, emailQueueSize),
+		recipients: make(map[string]*emailRecipient),
+	}
+}
+
+// Configure sets how emails are sent, how long notifications are batched up
+// and the dashboard emails link to.
+func (e *Email) Configure(cfg SMTPConfig, digestWindow time.Duration, dashboardURL string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.smtp, e.digestWindow, e.dashboardURL = cfg, digestWindow, strings.TrimSuffix(dashboardURL, "/")
+}
+
+func (e *Email) settings() (SMTPConfig, time.Duration, string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.smtp, e.digestWindow, e.dashboardURL
+}
+
+// DashboardURL returns the dashboard emails link to, without a trailing
+// slash.
+func (e *Email) DashboardURL() string {
+	_, _, dashboardURL := e.settings()
+	return dashboardURL
+}
+
+// Enabled reports whether an SMTP server is configured.
+func (e *Email) Enabled() bool {
+	cfg, _, _ := e.settings()
+	return cfg.Addr != ""
+}
+
+// Notify queues a notification to be emailed.
+func (e *Email) Notify(ctx context.Context, n models.Notification) error {
+	if !e.Enabled() {
+		return nil
+	}
+	select {
+	case e.queue <- n:
+		return nil
+	default:
+		return errors.New("email queue is full")
+	}
+}
+
+// Run emails queued notifications and digests until ctx is cancelled.
+func (e *Email) Run(ctx context.Context) {
+	ticker := time.NewTicker(emailFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-e.queue:
+			e.route(ctx, n, time.Now())
+		case now := <-ticker.C:
+			e.flush(ctx, now)
+		}
+	}
+}
+
+// route sends a notification to every user of its organization whose
+// preference allows it, or adds it to their digest.
+func (e *Email) route(ctx context.Context, n models.Notification, now time.Time) {
+	orgID := n.OrgID
+	if orgID == "" {
+		orgID = models.DefaultOrgID
+	}
+	users, err := e.store.ListUsers(ctx, orgID)
+	if err != nil {
+		log.Error().Err(err).Str("kind", n.Kind).Msg("failed to list users to email")
+		return
+	}
+	prefs, err := e.store.ListNotificationPreferences(ctx, orgID)
+	if err != nil {
+		log.Error().Err(err).Str("kind", n.Kind).Msg("failed to list notification preferences")
+		return
+	}
+	prefOf := make(map[string]models.NotificationPreference, len(prefs))
+	for _, p := range prefs {
+		prefOf[p.UserID] = p
+	}
+
+	_, window, _ := e.settings()
+	for _, u := range users {
+		pref, ok := prefOf[u.ID]
+		if !ok {
+			pref = models.DefaultNotificationPreference(u)
+		}
+		if !pref.Email || !pref.Allows(n) {
+			continue
+		}
+		r := e.recipients[u.Email]
+		if r == nil {
+			r = &emailRecipient{}
+			e.recipients[u.Email] = r
+		}
+		r.user = u
+		if len(r.pending) == 0 && now.Sub(r.sentAt) >= window {
+			r.sentAt = now
+			e.sendNotifications(ctx, r.user, []models.Notification{n})
+			continue
+		}
+		r.pending = append(r.pending, n)
+	}
+}
+
+// flush sends the digests whose window ended and forgets recipients nothing
+// was sent to within the window.
+func (e *Email) flush(ctx context.Context, now time.Time) {
+	_, window, _ := e.settings()
+	for addr, r := range e.recipients {
+		if now.Sub(r.sentAt) < window {
+			continue
+		}
+		if len(r.pending) == 0 {
+			delete(e.recipients, addr)
+			continue
+		}
+		r.sentAt = now
+		pending := r.pending
+		r.pending = nil
+		e.sendNotifications(ctx, r.user, pending)
+	}
+}
+
+// sendNotifications emails a single notification, or a digest of several.
+func (e *Email) sendNotifications(ctx context.Context, u models.User, notifications []models.Notification) {
+	name := models.EmailNotification
+	if len(notifications) > 1 {
+		name = models.EmailDigest
+	}
+	data := EmailData{Notification: notifications[0], Notifications: notifications}
+	if len(notifications) > emailDigestMax {
+		data.Notifications, data.More = notifications[:emailDigestMax], len(notifications)-emailDigestMax
+	}
+	if err := e.send(ctx, u.OrgID, name, u.Email, u.Name, data); err != nil {
+		log.Error().Err(err).Str("to", u.Email).Int("notifications", len(notifications)).Msg("failed to send notification email")
+	}
+}
+
+// SendInvitation emails an invitation.
+func (e *Email) SendInvitation(ctx context.Context, inv models.Invitation, acceptURL string) error {
+	return e.send(ctx, inv.OrgID, models.EmailInvitation, inv.Email, inv.Name, EmailData{Invitation: inv, AcceptURL: acceptURL})
+}
+
+// SendTest emails a sample notification to u right away.
+func (e *Email) SendTest(ctx context.Context, u models.User) error {
+	n := SampleNotification(u.OrgID, time.Now())
+	return e.send(ctx, u.OrgID, models.EmailNotification, u.Email, u.Name, EmailData{Notification: n, Notifications: []models.Notification{n}})
+}
+
+// SampleNotification is what test messages and template checks show.
+func SampleNotification(orgID string, now time.Time) models.Notification {
+	return models.Notification{
+		Kind:     models.NotifyAlertFiring,
+		OrgID:    orgID,
+		Severity: models.SeverityWarning,
+		Message:  "This is a test notification from Sentra",
+		ServerID: "example-server",
+		Time:     now.UTC(),
+	}
+}
+
+func (e *Email) send(ctx context.Context, orgID, name, to, toName string, data EmailData) error {
+	cfg, _, dashboardURL := e.settings()
+	if cfg.Addr == "" {
+		return errors.New("no SMTP server is configured")
+	}
+	t, err := e.store.GetEmailTemplate(ctx, orgID, name)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		def := DefaultEmailTemplate(name)
+		t = &def
+	}
+	data.OrgID, data.To, data.Name, data.DashboardURL = orgID, to, toName, dashboardURL
+	subject, text, html, err := RenderEmail(*t, data)
+	if err != nil {
+		return fmt.Errorf("render %s template: %w", name, err)
+	}
+	msg, err := buildEmail(cfg.From, to, subject, text, html)
+	if err != nil {
+		return err
+	}
+	return sendMail(cfg, to, msg)
+}
+
+// defaultEmailTemplates are the built-in templates, by name.
+var defaultEmailTemplates = map[string]models.EmailTemplate{
+	models.EmailNotification: {
+		Subject: `[Sentra] {{.Notification.Severity}}: {{.Notification.Message}}`,
+		Text: `{{.Notification.Message}}
+
+Kind:     {{.Notification.Kind}}
+Severity: {{.Notification.Severity}}
+{{with .Notification.ServerID}}Server:   {{.}}
+{{end}}{{with .Notification.PublicKey}}Peer:     {{.}}
+{{end}}Time:     {{.Notification.Time.Format "2006-01-02 15:04:05 MST"}}
+{{with .DashboardURL}}
+{{.}}
+{{end}}`,
+		HTML: `<p><strong>{{.Notification.Message}}</strong></p>
+<table>
+<tr><td>Kind</td><td>{{.Notification.Kind}}</td></tr>
+<tr><td>Severity</td><td>{{.Notification.Severity}}</td></tr>
+{{with .Notification.ServerID}}<tr><td>Server</td><td>{{.}}</td></tr>
+{{end}}{{with .Notification.PublicKey}}<tr><td>Peer</td><td>{{.}}</td></tr>
+{{end}}<tr><td>Time</td><td>{{.Notification.Time.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+</table>
+{{with .DashboardURL}}<p><a href="{{.}}">Open the dashboard</a></p>
+{{end}}`,
+	},
+	models.EmailDigest: {
+		Subject: `[Sentra] {{len .Notifications}}{{if .More}}+{{end}} notifications`,
+		Text: `{{range .Notifications}}{{.Time.Format "2006-01-02 15:04:05 MST"}} [{{.Severity}}] {{.Message}}
+{{end}}{{if .More}}...and {{.More}} more
+{{end}}{{with .DashboardURL}}
+{{.}}
+{{end}}`,
+		HTML: `<ul>
+{{range .Notifications}}<li>{{.Time.Format "2006-01-02 15:04:05 MST"}} <strong>[{{.Severity}}]</strong> {{.Message}}</li>
+{{end}}</ul>
+{{if .More}}<p>...and {{.More}} more</p>
+{{end}}{{with .DashboardURL}}<p><a href="{{.}}">Open the dashboard</a></p>
+{{end}}`,
+	},
+	models.EmailInvitation: {
+		Subject: `You are invited to Sentra`,
+		Text: `{{.Invitation.InvitedBy}} invited you to join Sentra as {{.Invitation.Role}}.
+
+Accept the invitation before {{.Invitation.ExpiresAt.Format "2006-01-02 15:04 MST"}}:
+{{.AcceptURL}}
+`,
+		HTML: `<p>{{.Invitation.InvitedBy}} invited you to join Sentra as {{.Invitation.Role}}.</p>
+<p><a href="{{.AcceptURL}}">Accept the invitation</a> before {{.Invitation.ExpiresAt.Format "2006-01-02 15:04 MST"}}.</p>
+`,
+	},
+}
+
+// DefaultEmailTemplate returns the built-in template of a name.
+func DefaultEmailTemplate(name string) models.EmailTemplate {
+	t := defaultEmailTemplates[name]
+	t.Name, t.Default = name, true
+	return t
+}
+
+// RenderEmail renders a template with data.
+func RenderEmail(t models.EmailTemplate, data EmailData) (subject, text, html string, err error) {
+	var buf bytes.Buffer
+	render := func(source string) (string, error) {
+		tmpl, err := texttemplate.New(t.Name).Option("missingkey=error").Parse(source)
+		if err != nil {
+			return "", err
+		}
+		buf.Reset()
+		err = tmpl.Execute(&buf, data)
+		return buf.String(), err
+	}
+	if subject, err = render(t.Subject); err != nil {
+		return "", "", "", fmt.Errorf("subject: %w", err)
+	}
+	// A subject is a single header line.
+	subject = strings.Join(strings.Fields(subject), " ")
+	if text, err = render(t.Text); err != nil {
+		return "", "", "", fmt.Errorf("text: %w", err)
+	}
+	if t.HTML != "" {
+		tmpl, err := htmltemplate.New(t.Name).Option("missingkey=error").Parse(t.HTML)
+		if err != nil {
+			return "", "", "", fmt.Errorf("html: %w", err)
+		}
+		buf.Reset()
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", "", "", fmt.Errorf("html: %w", err)
+		}
+		html = buf.String()
+	}
+	return subject, text, html, nil
+}
+
+// buildEmail builds a message with a text part and, if html is set, an
+// alternative HTML part.
+func buildEmail(from, to, subject, text, html string) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(key, value string) { fmt.Fprintf(&buf, "%s: %s\r\n", key, value) }
+	header("From", from)
+	header("To", to)
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+uuid.NewString()+"@sentra>")
+	header("MIME-Version", "1.0")
+
+	mw := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+	parts := [][2]string{{"text/plain", text}}
+	if html != "" {
+		parts = append(parts, [2]string{"text/html", html})
+	}
+	for _, part := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part[0] + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(w)
+		if _, err := qw.Write([]byte(part[1])); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sendMail delivers a message to a single recipient.
+func sendMail(cfg SMTPConfig, to string, msg []byte) error {
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return err
+	}
+	tlsConfig := &tls.Config{ServerName: host}
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	var conn net.Conn
+	if cfg.TLS == SMTPTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", cfg.Addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", cfg.Addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if cfg.TLS == SMTPStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, host)); err != nil {
+			return err
+		}
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return err
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
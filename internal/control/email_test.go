@@ -0,0 +1,349 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+// smtpSink is an SMTP server that accepts every message and keeps the
+// recipient and subject of each.
+type smtpSink struct {
+	ln net.Listener
+
+	mu   sync.Mutex
+	sent []sentEmail
+}
+
+type sentEmail struct {
+	to, subject string
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpSink{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+	tc := textproto.NewConn(conn)
+	tc.PrintfLine("220 sink")
+	var to string
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "RCPT":
+			to = strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			tc.PrintfLine("250 ok")
+		case "DATA":
+			tc.PrintfLine("354 go ahead")
+			data, err := tc.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(string(data))))
+			if err != nil {
+				tc.PrintfLine("554 %v", err)
+				continue
+			}
+			subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+			s.mu.Lock()
+			s.sent = append(s.sent, sentEmail{to: to, subject: subject})
+			s.mu.Unlock()
+			tc.PrintfLine("250 ok")
+		case "QUIT":
+			tc.PrintfLine("221 bye")
+			return
+		default:
+			tc.PrintfLine("250 ok")
+		}
+	}
+}
+
+// take returns the messages received since the last call.
+func (s *smtpSink) take() []sentEmail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sent := s.sent
+	s.sent = nil
+	return sent
+}
+
+type fakeEmailStore struct {
+	users []models.User
+	prefs []models.NotificationPreference
+}
+
+func (f *fakeEmailStore) ListUsers(ctx context.Context, orgID string) ([]models.User, error) {
+	return f.users, nil
+}
+
+func (f *fakeEmailStore) ListNotificationPreferences(ctx context.Context, orgID string) ([]models.NotificationPreference, error) {
+	return f.prefs, nil
+}
+
+func (f *fakeEmailStore) GetEmailTemplate(ctx context.Context, orgID, name string) (*models.EmailTemplate, error) {
+	return nil, nil
+}
+
+func TestEmailDigestBatching(t *testing.T) {
+	const window = 10 * time.Minute
+	admin := models.User{ID: "u1", OrgID: models.DefaultOrgID, Email: "admin@example.com", Role: "admin"}
+	member := models.User{ID: "u2", OrgID: models.DefaultOrgID, Email: "member@example.com", Role: "user"}
+	critical := models.NotificationPreference{UserID: admin.ID, Email: true, MinSeverity: models.SeverityCritical}
+
+	tests := []struct {
+		name          string
+		prefs         []models.NotificationPreference
+		notifications int
+		severity      string
+		// flushAfter is when flush runs after the notifications were routed.
+		flushAfter time.Duration
+		// wantNow is what is sent right away, wantFlush what flush sends.
+		wantNow   []string
+		wantFlush []string
+	}{
+		{
+			name:          "single notification is sent right away",
+			notifications: 1,
+			flushAfter:    window,
+			wantNow:       []string{"[Sentra] warning: n0"},
+		},
+		{
+			name:          "notifications within the window are batched",
+			notifications: 3,
+			flushAfter:    window,
+			wantNow:       []string{"[Sentra] warning: n0"},
+			wantFlush:     []string{"[Sentra] 2 notifications"},
+		},
+		{
+			name:          "single pending notification is not a digest",
+			notifications: 2,
+			flushAfter:    window,
+			wantNow:       []string{"[Sentra] warning: n0"},
+			wantFlush:     []string{"[Sentra] warning: n1"},
+		},
+		{
+			name:          "digest waits for the window to end",
+			notifications: 3,
+			flushAfter:    window - time.Second,
+			wantNow:       []string{"[Sentra] warning: n0"},
+		},
+		{
+			name:          "digest is capped",
+			notifications: emailDigestMax + 2,
+			flushAfter:    window,
+			wantNow:       []string{"[Sentra] warning: n0"},
+			wantFlush:     []string{fmt.Sprintf("[Sentra] %d+ notifications", emailDigestMax)},
+		},
+		{
+			name:          "preference filters by severity",
+			prefs:         []models.NotificationPreference{critical},
+			notifications: 3,
+			flushAfter:    window,
+		},
+		{
+			name:          "preference allows severe notifications",
+			prefs:         []models.NotificationPreference{critical},
+			notifications: 1,
+			severity:      models.SeverityCritical,
+			flushAfter:    window,
+			wantNow:       []string{"[Sentra] critical: n0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := newSMTPSink(t)
+			e := NewEmail(&fakeEmailStore{users: []models.User{admin, member}, prefs: tt.prefs})
+			e.Configure(SMTPConfig{Addr: sink.ln.Addr().String(), From: "sentra@example.com", TLS: SMTPNoTLS}, window, "")
+
+			severity := tt.severity
+			if severity == "" {
+				severity = models.SeverityWarning
+			}
+			ctx := context.Background()
+			start := time.Now()
+			for i := range tt.notifications {
+				e.route(ctx, models.Notification{
+					Kind:     models.NotifyAlertFiring,
+					Severity: severity,
+					Message:  fmt.Sprintf("n%d", i),
+					Time:     start,
+				}, start.Add(time.Duration(i)*time.Second))
+			}
+			checkSent(t, "routed", sink.take(), admin.Email, tt.wantNow)
+
+			e.flush(ctx, start.Add(tt.flushAfter))
+			checkSent(t, "flushed", sink.take(), admin.Email, tt.wantFlush)
+		})
+	}
+}
+
+func TestEmailForgetsIdleRecipients(t *testing.T) {
+	const window = 10 * time.Minute
+	sink := newSMTPSink(t)
+	admin := models.User{ID: "u1", OrgID: models.DefaultOrgID, Email: "admin@example.com", Role: "admin"}
+	e := NewEmail(&fakeEmailStore{users: []models.User{admin}})
+	e.Configure(SMTPConfig{Addr: sink.ln.Addr().String(), From: "sentra@example.com", TLS: SMTPNoTLS}, window, "")
+
+	ctx := context.Background()
+	start := time.Now()
+	n := models.Notification{Kind: models.NotifyAlertFiring, Severity: models.SeverityWarning, Message: "n0", Time: start}
+	e.route(ctx, n, start)
+	e.flush(ctx, start.Add(window))
+	if len(e.recipients) != 0 {
+		t.Errorf("recipients after idle window = %d, want 0", len(e.recipients))
+	}
+
+	// Without a digest pending the next notification goes out right away.
+	n.Message = "n1"
+	e.route(ctx, n, start.Add(window+time.Second))
+	checkSent(t, "routed", sink.take(), admin.Email, []string{"[Sentra] warning: n0", "[Sentra] warning: n1"})
+}
+
+func checkSent(t *testing.T, when string, sent []sentEmail, to string, want []string) {
+	t.Helper()
+	if len(sent) != len(want) {
+		t.Fatalf("%s: sent %d emails %v, want %d", when, len(sent), sent, len(want))
+	}
+	for i, m := range sent {
+		if m.to != to {
+			t.Errorf("%s: email %d sent to %q, want %q", when, i, m.to, to)
+		}
+		if m.subject != want[i] {
+			t.Errorf("%s: email %d subject = %q, want %q", when, i, m.subject, want[i])
+		}
+	}
+}
+
+func TestRenderEmail(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+	n := models.Notification{
+		Kind:     models.NotifyAlertFiring,
+		Severity: models.SeverityCritical,
+		Message:  "Handshake <stale>",
+		ServerID: "srv-1",
+		Time:     at,
+	}
+	tests := []struct {
+		name        string
+		template    models.EmailTemplate
+		data        EmailData
+		wantSubject string
+		wantText    []string
+		wantHTML    []string
+		wantErr     bool
+	}{
+		{
+			name:        "notification",
+			template:    DefaultEmailTemplate(models.EmailNotification),
+			data:        EmailData{Notification: n, Notifications: []models.Notification{n}, DashboardURL: "https://sentra.example.com"},
+			wantSubject: "[Sentra] critical: Handshake <stale>",
+			wantText:    []string{"Handshake <stale>", "Server:   srv-1", "2026-03-01 12:30:00 UTC", "https://sentra.example.com"},
+			wantHTML:    []string{"Handshake &lt;stale&gt;", "<td>srv-1</td>", `<a href="https://sentra.example.com">`},
+		},
+		{
+			name:        "digest",
+			template:    DefaultEmailTemplate(models.EmailDigest),
+			data:        EmailData{Notification: n, Notifications: []models.Notification{n, n}},
+			wantSubject: "[Sentra] 2 notifications",
+			wantText:    []string{"2026-03-01 12:30:00 UTC [critical] Handshake <stale>\n2026-03-01 12:30:00 UTC [critical]"},
+			wantHTML:    []string{"<li>2026-03-01 12:30:00 UTC <strong>[critical]</strong> Handshake &lt;stale&gt;</li>"},
+		},
+		{
+			name:        "digest with more",
+			template:    DefaultEmailTemplate(models.EmailDigest),
+			data:        EmailData{Notification: n, Notifications: []models.Notification{n, n}, More: 3},
+			wantSubject: "[Sentra] 2+ notifications",
+			wantText:    []string{"...and 3 more"},
+			wantHTML:    []string{"<p>...and 3 more</p>"},
+		},
+		{
+			name:     "invitation",
+			template: DefaultEmailTemplate(models.EmailInvitation),
+			data: EmailData{
+				Invitation: models.Invitation{InvitedBy: "admin@sentra.io", Role: "viewer", ExpiresAt: at},
+				AcceptURL:  "https://sentra.example.com/invite?token=a&b",
+			},
+			wantSubject: "You are invited to Sentra",
+			wantText:    []string{"admin@sentra.io invited you to join Sentra as viewer.", "2026-03-01 12:30 UTC", "https://sentra.example.com/invite?token=a&b"},
+			wantHTML:    []string{`href="https://sentra.example.com/invite?token=a&amp;b"`},
+		},
+		{
+			name:        "subject is a single line",
+			template:    models.EmailTemplate{Subject: "Hello\n  {{.Name}}\t!\n", Text: "{{.To}}"},
+			data:        EmailData{Name: "Ada", To: "ada@example.com"},
+			wantSubject: "Hello Ada !",
+			wantText:    []string{"ada@example.com"},
+		},
+		{
+			name:     "unknown field",
+			template: models.EmailTemplate{Subject: "{{.Nope}}", Text: "text"},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid html",
+			template: models.EmailTemplate{Subject: "subject", Text: "text", HTML: "{{if}}"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, text, html, err := RenderEmail(tt.template, tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("RenderEmail succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RenderEmail: %v", err)
+			}
+			if subject != tt.wantSubject {
+				t.Errorf("subject = %q, want %q", subject, tt.wantSubject)
+			}
+			for _, want := range tt.wantText {
+				if !strings.Contains(text, want) {
+					t.Errorf("text %q does not contain %q", text, want)
+				}
+			}
+			for _, want := range tt.wantHTML {
+				if !strings.Contains(html, want) {
+					t.Errorf("html %q does not contain %q", html, want)
+				}
+			}
+			if tt.template.HTML == "" && html != "" {
+				t.Errorf("html = %q, want none", html)
+			}
+		})
+	}
+}
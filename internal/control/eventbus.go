@@ -1,27 +1,40 @@
 package control
 
 import (
+	"sync"
+
 	"github.com/ChronoCoders/sentra/internal/models"
 )
 
+// EventBus delivers every published StatusEvent to all subscribers. Reports
+// are published by the StatusCache once it accepted them, along with the
+// liveness state changes of servers.
 type EventBus struct {
-	ch chan models.StatusEvent
+	mu   sync.RWMutex
+	subs []chan models.StatusEvent
 }
 
 func NewEventBus() *EventBus {
-	return &EventBus{
-		ch: make(chan models.StatusEvent, 100),
-	}
+	return &EventBus{}
 }
 
 func (b *EventBus) Publish(event models.StatusEvent) {
-	select {
-	case b.ch <- event:
-	default:
-		// Drop event if buffer full
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, ch := range b.subs {
+		select {
+		case ch <- event:
+		default:
+			// Drop event if subscriber buffer full
+		}
 	}
 }
 
+// Subscribe returns a new channel receiving all events published from now on.
 func (b *EventBus) Subscribe() <-chan models.StatusEvent {
-	return b.ch
+	ch := make(chan models.StatusEvent, 100)
+	b.mu.Lock()
+	b.subs = append(b.subs, ch)
+	b.mu.Unlock()
+	return ch
 }
@@ -0,0 +1,115 @@
+package control
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// peerExpiryCheckInterval is how often peer expiries are checked.
+	peerExpiryCheckInterval  = time.Minute
+	defaultPeerExpiryWarning = 72 * time.Hour
+)
+
+// PeerExpiryStore tells which peer expiries are due and records them being
+// notified.
+type PeerExpiryStore interface {
+	ListPendingPeerExpiries(ctx context.Context, now time.Time, warnWithin time.Duration) ([]models.PeerExpiry, error)
+	MarkPeerExpiry(ctx context.Context, e *models.PeerExpiry) error
+}
+
+// PeerExpiries warns organizations of peers that are about to expire and
+// tells them once they did. Each is notified once per expiry set.
+type PeerExpiries struct {
+	store         PeerExpiryStore
+	notifications *Notifications
+	wake          chan struct{}
+
+	mu         sync.Mutex
+	warnWithin time.Duration
+}
+
+func NewPeerExpiries(store PeerExpiryStore, notifications *Notifications) *PeerExpiries {
+	return &PeerExpiries{
+		store:         store,
+		notifications: notifications,
+		wake:          make(chan struct{}, 1),
+		warnWithin:    defaultPeerExpiryWarning,
+	}
+}
+
+// SetWarnWithin sets how long before a peer expires it is warned about.
+func (p *PeerExpiries) SetWarnWithin(d time.Duration) {
+	p.mu.Lock()
+	p.warnWithin = d
+	p.mu.Unlock()
+	p.Check()
+}
+
+// Check has expiries checked soon.
+func (p *PeerExpiries) Check() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run checks expiries until ctx is cancelled.
+func (p *PeerExpiries) Run(ctx context.Context) {
+	ticker := time.NewTicker(peerExpiryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p.wake:
+		}
+		p.check(ctx, time.Now().UTC())
+	}
+}
+
+func (p *PeerExpiries) check(ctx context.Context, now time.Time) {
+	p.mu.Lock()
+	warnWithin := p.warnWithin
+	p.mu.Unlock()
+
+	expiries, err := p.store.ListPendingPeerExpiries(ctx, now, warnWithin)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list peer expiries")
+		return
+	}
+	for _, e := range expiries {
+		n := models.Notification{
+			OrgID:     e.OrgID,
+			Severity:  models.SeverityWarning,
+			PublicKey: e.PublicKey,
+			Time:      now,
+			Data:      map[string]any{"expires_at": e.ExpiresAt},
+		}
+		if e.ExpiresAt.After(now) {
+			n.Kind = models.NotifyPeerExpiring
+			n.Message = fmt.Sprintf("peer %s expires in %s", e.PublicKey, formatAge(e.ExpiresAt.Sub(now)))
+			e.WarnedAt = &now
+		} else {
+			// A peer that expired before it was warned about is only
+			// reported as expired.
+			n.Kind = models.NotifyPeerExpired
+			n.Message = fmt.Sprintf("peer %s expired", e.PublicKey)
+			if e.WarnedAt == nil {
+				e.WarnedAt = &now
+			}
+			e.ExpiredAt = &now
+		}
+		if err := p.store.MarkPeerExpiry(ctx, &e); err != nil {
+			log.Error().Err(err).Str("public_key", e.PublicKey).Msg("failed to mark peer expiry")
+			continue
+		}
+		p.notifications.Notify(ctx, n)
+	}
+}
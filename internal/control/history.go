@@ -0,0 +1,210 @@
+package control
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// historyFlushInterval is how often buffered samples are written.
+	historyFlushInterval = 5 * time.Second
+	// historyCompactInterval is how often samples are downsampled and pruned.
+	historyCompactInterval = time.Minute
+	// maxPendingSamples bounds the samples buffered while the store is slow.
+	// The oldest ones are dropped first.
+	maxPendingSamples = 100000
+)
+
+// HistoryStore persists metric samples.
+type HistoryStore interface {
+	InsertMetricSamples(ctx context.Context, servers []models.ServerSample, peers []models.PeerSample) error
+	DownsampleMetrics(ctx context.Context, from, to int, start, end time.Time) error
+	LatestMetricTime(ctx context.Context, resolution int) (time.Time, error)
+	PruneMetrics(ctx context.Context, resolution int, cutoff time.Time) (int64, error)
+}
+
+// HistoryRetention is how long samples of each resolution are kept.
+type HistoryRetention struct {
+	Raw    time.Duration
+	Minute time.Duration
+	Hour   time.Duration
+}
+
+// History records the system metrics and peer counters of every report as
+// raw samples, and downsamples them into minute and hour samples. Samples are
+// buffered and written in batches off the report path.
+type History struct {
+	store     HistoryStore
+	retention HistoryRetention
+
+	mu      sync.Mutex
+	servers []models.ServerSample
+	peers   []models.PeerSample
+	// counters holds the last sampled counters of every peer, keyed by server
+	// ID and peer key, so that idle peers are not sampled again.
+	counters map[[2]string]models.PeerSample
+	dropped  int
+}
+
+// NewHistory samples the reports on bus. Run writes the samples to store.
+func NewHistory(bus *EventBus, store HistoryStore, retention HistoryRetention) *History {
+	h := &History{store: store, retention: retention, counters: make(map[[2]string]models.PeerSample)}
+	go h.listen(bus.Subscribe())
+	return h
+}
+
+func (h *History) listen(ch <-chan models.StatusEvent) {
+	for event := range ch {
+		if event.Status == nil || event.StateChange != nil {
+			continue
+		}
+		h.sample(event)
+	}
+}
+
+func (h *History) sample(event models.StatusEvent) {
+	at := event.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	sys := event.Status.System
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.servers = append(h.servers, models.ServerSample{
+		ServerID:      event.ServerID,
+		Time:          at,
+		CPUPercent:    sys.CPUPercent,
+		MemoryUsed:    sys.MemoryUsed,
+		MemoryPercent: sys.MemoryPercent,
+		DiskUsed:      sys.DiskUsed,
+		DiskPercent:   sys.DiskPercent,
+		LoadAverage:   sys.LoadAverage,
+		NetBytesSent:  sys.NetBytesSent,
+		NetBytesRecv:  sys.NetBytesRecv,
+	})
+	// Deltas only carry the peers that changed.
+	for _, p := range event.Status.Peers {
+		key := [2]string{event.ServerID, p.Key()}
+		s := models.PeerSample{
+			ServerID:        event.ServerID,
+			PeerKey:         p.Key(),
+			Time:            at,
+			ReceiveBytes:    p.ReceiveBytes,
+			TransmitBytes:   p.TransmitBytes,
+			LatestHandshake: p.LatestHandshake,
+		}
+		if prev, ok := h.counters[key]; ok && prev.ReceiveBytes == s.ReceiveBytes &&
+			prev.TransmitBytes == s.TransmitBytes && prev.LatestHandshake.Equal(s.LatestHandshake) {
+			continue
+		}
+		h.counters[key] = s
+		h.peers = append(h.peers, s)
+	}
+	for _, key := range event.RemovedPeers {
+		delete(h.counters, [2]string{event.ServerID, key})
+	}
+
+	if n := len(h.servers) + len(h.peers) - maxPendingSamples; n > 0 {
+		h.dropped += n
+		if drop := min(n, len(h.peers)); drop > 0 {
+			h.peers = h.peers[drop:]
+			n -= drop
+		}
+		h.servers = h.servers[min(n, len(h.servers)):]
+	}
+}
+
+// Run writes buffered samples and maintains the downsampled history until
+// ctx is cancelled. Pending samples are written before it returns.
+func (h *History) Run(ctx context.Context) {
+	flush := time.NewTicker(historyFlushInterval)
+	defer flush.Stop()
+	compact := time.NewTicker(historyCompactInterval)
+	defer compact.Stop()
+
+	next := map[int]time.Time{}
+	for _, res := range []int{models.ResolutionMinute, models.ResolutionHour} {
+		latest, err := h.store.LatestMetricTime(ctx, res)
+		if err != nil {
+			log.Error().Err(err).Int("resolution", res).Msg("failed to load metric history")
+		}
+		// The newest bucket may have been aggregated while incomplete.
+		next[res] = latest
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			h.flush(context.Background())
+			return
+		case <-flush.C:
+			h.flush(ctx)
+		case now := <-compact.C:
+			h.compact(ctx, now, next)
+		}
+	}
+}
+
+func (h *History) flush(ctx context.Context) {
+	h.mu.Lock()
+	servers, peers, dropped := h.servers, h.peers, h.dropped
+	h.servers, h.peers, h.dropped = nil, nil, 0
+	h.mu.Unlock()
+
+	if dropped > 0 {
+		log.Warn().Int("samples", dropped).Msg("metric history fell behind, dropped samples")
+	}
+	if len(servers) == 0 && len(peers) == 0 {
+		return
+	}
+	if err := h.store.InsertMetricSamples(ctx, servers, peers); err != nil {
+		log.Error().Err(err).Int("samples", len(servers)+len(peers)).Msg("failed to store metric history")
+	}
+}
+
+// compact aggregates complete buckets since the last run and deletes samples
+// that are past their retention. next holds the start of the first bucket
+// not aggregated yet, per resolution.
+func (h *History) compact(ctx context.Context, now time.Time, next map[int]time.Time) {
+	// Minute buckets are complete once their samples have been flushed, hour
+	// buckets once their minutes have been aggregated.
+	settled := now.Add(-2 * historyFlushInterval)
+	if h.downsample(ctx, next, models.ResolutionRaw, models.ResolutionMinute, settled.Truncate(time.Minute)) {
+		h.downsample(ctx, next, models.ResolutionMinute, models.ResolutionHour, next[models.ResolutionMinute].Truncate(time.Hour))
+	}
+
+	retention := map[int]time.Duration{
+		models.ResolutionRaw:    h.retention.Raw,
+		models.ResolutionMinute: h.retention.Minute,
+		models.ResolutionHour:   h.retention.Hour,
+	}
+	for res, keep := range retention {
+		deleted, err := h.store.PruneMetrics(ctx, res, now.Add(-keep))
+		if err != nil {
+			log.Error().Err(err).Int("resolution", res).Msg("failed to prune metric history")
+			continue
+		}
+		if deleted > 0 {
+			log.Debug().Int("resolution", res).Int64("samples", deleted).Msg("pruned metric history")
+		}
+	}
+}
+
+// downsample aggregates the buckets of resolution to from next[to] up to end.
+func (h *History) downsample(ctx context.Context, next map[int]time.Time, from, to int, end time.Time) bool {
+	start := next[to]
+	if !end.After(start) {
+		return true
+	}
+	if err := h.store.DownsampleMetrics(ctx, from, to, start, end); err != nil {
+		log.Error().Err(err).Int("resolution", to).Msg("failed to downsample metric history")
+		return false
+	}
+	next[to] = end
+	return true
+}
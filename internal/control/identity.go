@@ -0,0 +1,118 @@
+package control
+
+import (
+	"context"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// identityTakeoverAfter is how long the known agent of a server must have
+	// been silent before another agent identity may take the server over.
+	identityTakeoverAfter = 5 * time.Minute
+	// maxRecentConflicts bounds the conflicts kept to flag only the first of
+	// a burst.
+	maxRecentConflicts = 100
+)
+
+// IdentityConflictStore persists identity conflicts.
+type IdentityConflictStore interface {
+	AddIdentityConflict(ctx context.Context, c *models.IdentityConflict) error
+}
+
+// serverOwner is the agent identity currently reporting for a server.
+type serverOwner struct {
+	agentID    string
+	attributes map[string]string
+	lastSeen   time.Time
+}
+
+// checkIdentity decides whether event may update its server. Reports from a
+// different agent identity, or from the same identity on another machine, are
+// flagged as conflicts instead of being merged. Reports without an identity
+// are only merged while no identity reported for the server. A newly flagged
+// conflict is returned for the caller to record once it released c.mu. The
+// caller holds c.mu.
+func (c *StatusCache) checkIdentity(event models.StatusEvent, now time.Time) (*models.IdentityConflict, bool) {
+	id := event.ServerID
+	owner, ok := c.owners[id]
+	switch {
+	case event.AgentID == "":
+		// Legacy agents do not have an identity, so they cannot be told apart
+		// from an agent forging reports for a server that has one.
+		if ok {
+			return c.addConflict(models.ConflictServerID, owner, event, now), false
+		}
+		return nil, true
+	case !ok:
+	case owner.agentID == event.AgentID:
+		known := owner.attributes[models.AttributeMachineID]
+		claimed := event.Attributes[models.AttributeMachineID]
+		if known != "" && claimed != "" && known != claimed {
+			return c.addConflict(models.ConflictMachine, owner, event, now), false
+		}
+	case now.Sub(owner.lastSeen) < identityTakeoverAfter:
+		return c.addConflict(models.ConflictServerID, owner, event, now), false
+	default:
+		log.Warn().
+			Str("server_id", id).
+			Str("previous_agent_id", owner.agentID).
+			Str("agent_id", event.AgentID).
+			Msg("server taken over by new agent identity")
+	}
+
+	attrs := event.Attributes
+	if attrs == nil && ok {
+		attrs = owner.attributes
+	}
+	c.owners[id] = &serverOwner{agentID: event.AgentID, attributes: attrs, lastSeen: now}
+	return nil, true
+}
+
+// addConflict flags a conflict, or returns nil if it is part of a burst that
+// was already flagged.
+func (c *StatusCache) addConflict(kind string, owner *serverOwner, event models.StatusEvent, now time.Time) *models.IdentityConflict {
+	// Only flag the first of a burst of conflicting reports.
+	for i := len(c.conflicts) - 1; i >= 0; i-- {
+		prev := c.conflicts[i]
+		if prev.ServerID == event.ServerID && prev.Kind == kind && prev.ClaimingAgentID == event.AgentID &&
+			now.Sub(prev.Time) < identityTakeoverAfter {
+			return nil
+		}
+	}
+
+	log.Warn().
+		Str("kind", kind).
+		Str("server_id", event.ServerID).
+		Str("known_agent_id", owner.agentID).
+		Str("claiming_agent_id", event.AgentID).
+		Msg("conflicting agent identity, report rejected")
+
+	conflict := models.IdentityConflict{
+		OrgID:             event.OrgID,
+		ServerID:          event.ServerID,
+		Kind:              kind,
+		KnownAgentID:      owner.agentID,
+		ClaimingAgentID:   event.AgentID,
+		KnownAttributes:   owner.attributes,
+		ClaimedAttributes: event.Attributes,
+		Time:              now.UTC(),
+	}
+	c.conflicts = append(c.conflicts, conflict)
+	if len(c.conflicts) > maxRecentConflicts {
+		c.conflicts = c.conflicts[len(c.conflicts)-maxRecentConflicts:]
+	}
+	return &conflict
+}
+
+// recordConflict persists a flagged conflict.
+func (c *StatusCache) recordConflict(conflict *models.IdentityConflict) {
+	if c.conflictStore == nil {
+		return
+	}
+	if err := c.conflictStore.AddIdentityConflict(context.Background(), conflict); err != nil {
+		log.Error().Err(err).Str("server_id", conflict.ServerID).Msg("failed to store identity conflict")
+	}
+}
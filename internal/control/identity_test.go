@@ -0,0 +1,114 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+func TestCheckIdentity(t *testing.T) {
+	report := func(agentID, machineID string) models.StatusEvent {
+		e := models.StatusEvent{ServerID: "srv-1", AgentID: agentID, Status: &models.Status{}}
+		if machineID != "" {
+			e.Attributes = map[string]string{models.AttributeMachineID: machineID}
+		}
+		return e
+	}
+	tests := []struct {
+		name    string
+		reports []models.StatusEvent
+		// since is how long before the last report the others were sent.
+		since        time.Duration
+		wantOK       bool
+		wantConflict string
+	}{
+		{
+			name:    "first identity owns the server",
+			reports: []models.StatusEvent{report("agent-1", "m1")},
+			wantOK:  true,
+		},
+		{
+			name:    "owner reports again",
+			reports: []models.StatusEvent{report("agent-1", "m1"), report("agent-1", "m1")},
+			wantOK:  true,
+		},
+		{
+			name:         "owner reports from another machine",
+			reports:      []models.StatusEvent{report("agent-1", "m1"), report("agent-1", "m2")},
+			wantConflict: models.ConflictMachine,
+		},
+		{
+			name:         "another identity reports",
+			reports:      []models.StatusEvent{report("agent-1", "m1"), report("agent-2", "m1")},
+			wantConflict: models.ConflictServerID,
+		},
+		{
+			name:    "another identity takes over a silent server",
+			reports: []models.StatusEvent{report("agent-1", "m1"), report("agent-2", "m1")},
+			since:   identityTakeoverAfter,
+			wantOK:  true,
+		},
+		{
+			name:    "report without identity for a server without owner",
+			reports: []models.StatusEvent{report("", ""), report("", "")},
+			wantOK:  true,
+		},
+		{
+			name:         "report without identity for an owned server",
+			reports:      []models.StatusEvent{report("agent-1", "m1"), report("", "")},
+			wantConflict: models.ConflictServerID,
+		},
+		{
+			name:         "report without identity for a silent owned server",
+			reports:      []models.StatusEvent{report("agent-1", "m1"), report("", "")},
+			since:        identityTakeoverAfter,
+			wantConflict: models.ConflictServerID,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewStatusCache(NewEventBus(), nil, nil)
+			now := time.Now()
+			last := len(tt.reports) - 1
+			for _, e := range tt.reports[:last] {
+				if _, ok := c.checkIdentity(e, now.Add(-tt.since)); !ok {
+					t.Fatalf("report of %q rejected", e.AgentID)
+				}
+			}
+
+			conflict, ok := c.checkIdentity(tt.reports[last], now)
+			if ok != tt.wantOK {
+				t.Errorf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			var kind string
+			if conflict != nil {
+				kind = conflict.Kind
+			}
+			if kind != tt.wantConflict {
+				t.Errorf("conflict = %q, want %q", kind, tt.wantConflict)
+			}
+		})
+	}
+}
+
+func TestIngestRejectsReportWithoutIdentity(t *testing.T) {
+	c := NewStatusCache(NewEventBus(), nil, nil)
+	owned := models.StatusEvent{ServerID: "srv-1", AgentID: "agent-1", Status: &models.Status{PublicKey: "pk-1"}}
+	if err := c.Ingest(owned); err != nil {
+		t.Fatal(err)
+	}
+	forged := models.StatusEvent{ServerID: "srv-1", Status: &models.Status{PublicKey: "pk-forged"}}
+	if err := c.Ingest(forged); !errors.Is(err, ErrIdentityConflict) {
+		t.Fatalf("Ingest = %v, want %v", err, ErrIdentityConflict)
+	}
+	status, err := c.GetStatus(context.Background(), "srv-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.PublicKey != "pk-1" {
+		t.Errorf("cached public key = %q, want %q", status.PublicKey, "pk-1")
+	}
+}
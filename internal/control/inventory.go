@@ -0,0 +1,124 @@
+package control
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// InventoryStore persists the fleet inventory.
+type InventoryStore interface {
+	UpsertAgentInventory(ctx context.Context, inv *models.AgentInventory) error
+	ListAgentInventory(ctx context.Context) ([]models.AgentInventory, error)
+}
+
+// Inventory keeps track of the agent version and capabilities of every server,
+// as announced in full status snapshots.
+type Inventory struct {
+	store InventoryStore
+
+	mu     sync.RWMutex
+	agents map[string]models.AgentInventory
+}
+
+// NewInventory loads the persisted inventory and keeps it up to date from the bus.
+func NewInventory(ctx context.Context, bus *EventBus, store InventoryStore) (*Inventory, error) {
+	list, err := store.ListAgentInventory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inv := &Inventory{store: store, agents: make(map[string]models.AgentInventory, len(list))}
+	for _, a := range list {
+		inv.agents[a.ServerID] = a
+	}
+	go inv.listen(bus.Subscribe())
+	return inv, nil
+}
+
+func (inv *Inventory) listen(ch <-chan models.StatusEvent) {
+	for event := range ch {
+		if event.Agent == nil {
+			continue
+		}
+		entry := models.AgentInventory{
+			ServerID:  event.ServerID,
+			OrgID:     event.OrgID,
+			AgentID:   event.AgentID,
+			Hostname:  event.Attributes[models.AttributeHostname],
+			AgentInfo: *event.Agent,
+			UpdatedAt: event.Time.UTC(),
+		}
+
+		inv.mu.Lock()
+		prev, known := inv.agents[event.ServerID]
+		inv.agents[event.ServerID] = entry
+		inv.mu.Unlock()
+
+		if known && prev.Version != entry.Version {
+			log.Info().Str("server_id", entry.ServerID).Str("from", prev.Version).Str("to", entry.Version).Msg("agent version changed")
+		}
+		if err := inv.store.UpsertAgentInventory(context.Background(), &entry); err != nil {
+			log.Error().Err(err).Str("server_id", entry.ServerID).Msg("failed to store agent inventory")
+		}
+	}
+}
+
+// SetConfig records the configuration an agent confirmed outside of a full
+// snapshot, such as in the answer to config.apply.
+func (inv *Inventory) SetConfig(serverID string, update models.ConfigUpdate) {
+	inv.mu.Lock()
+	entry, ok := inv.agents[serverID]
+	if ok {
+		entry.ConfigVersion, entry.Config = update.Version, &update.Config
+		inv.agents[serverID] = entry
+	}
+	inv.mu.Unlock()
+	if !ok {
+		return
+	}
+	if err := inv.store.UpsertAgentInventory(context.Background(), &entry); err != nil {
+		log.Error().Err(err).Str("server_id", serverID).Msg("failed to store agent inventory")
+	}
+}
+
+// Get returns the inventory entry of a server.
+func (inv *Inventory) Get(serverID string) (models.AgentInventory, bool) {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+	a, ok := inv.agents[serverID]
+	return a, ok
+}
+
+// List returns all inventory entries ordered by server ID.
+func (inv *Inventory) List() []models.AgentInventory {
+	inv.mu.RLock()
+	list := make([]models.AgentInventory, 0, len(inv.agents))
+	for _, a := range inv.agents {
+		list = append(list, a)
+	}
+	inv.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ServerID < list[j].ServerID })
+	return list
+}
+
+// CheckCommand returns an error if the agent of serverID cannot run cmd.
+func (inv *Inventory) CheckCommand(serverID string, cmd models.Command) error {
+	capability := models.CommandCapability(cmd.Name)
+	if capability == "" {
+		return nil
+	}
+	a, ok := inv.Get(serverID)
+	if !ok {
+		return fmt.Errorf("%w: agent of server %s has not reported its capabilities, %s requires %s",
+			ErrCapabilityMissing, serverID, cmd.Name, capability)
+	}
+	if !a.HasCapability(capability) {
+		return fmt.Errorf("%w: agent %s on server %s lacks %s required by %s",
+			ErrCapabilityMissing, a.Version, serverID, capability, cmd.Name)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package control
+
+import (
+	"context"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultStaleAfter   = 30 * time.Second
+	defaultOfflineAfter = 2 * time.Minute
+	// livenessCheckInterval is how often servers that stopped reporting are
+	// checked for a state change.
+	livenessCheckInterval = 5 * time.Second
+)
+
+// DecommissionStore tells which servers have been decommissioned.
+type DecommissionStore interface {
+	ServerDecommissioned(ctx context.Context, serverID string) (bool, error)
+}
+
+// SetThresholds sets how long a server may go without reporting before it is
+// considered stale and offline.
+func (c *StatusCache) SetThresholds(staleAfter, offlineAfter time.Duration) {
+	c.mu.Lock()
+	c.staleAfter, c.offlineAfter = staleAfter, offlineAfter
+	c.mu.Unlock()
+}
+
+// Liveness returns the liveness of a cached server.
+func (c *StatusCache) Liveness(serverID string) (models.Liveness, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	state, ok := c.states[serverID]
+	if !ok {
+		return models.Liveness{}, false
+	}
+	return models.Liveness{State: state, ReportedAt: c.reported[serverID]}, true
+}
+
+// markOnline records a report of event's server and returns the event with
+// its state, along with the state the server was in before. The caller holds
+// c.mu.
+func (c *StatusCache) markOnline(event models.StatusEvent) (models.StatusEvent, string) {
+	id := event.ServerID
+	from := c.states[id]
+	c.reported[id] = event.Time
+	c.states[id] = models.StateOnline
+	c.orgs[id] = event.OrgID
+	event.State = models.StateOnline
+	return event, from
+}
+
+// stateAt derives the liveness state of a server that last reported at
+// reportedAt. The caller holds c.mu.
+func (c *StatusCache) stateAt(reportedAt, now time.Time) string {
+	switch age := now.Sub(reportedAt); {
+	case age >= c.offlineAfter:
+		return models.StateOffline
+	case age >= c.staleAfter:
+		return models.StateStale
+	default:
+		return models.StateOnline
+	}
+}
+
+// Watch moves servers that stopped reporting to the stale and offline states
+// until ctx is cancelled. Decommissioned servers are evicted from the cache
+// once they are offline.
+func (c *StatusCache) Watch(ctx context.Context, store DecommissionStore) {
+	ticker := time.NewTicker(livenessCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.checkLiveness(ctx, store, now)
+		}
+	}
+}
+
+func (c *StatusCache) checkLiveness(ctx context.Context, store DecommissionStore, now time.Time) {
+	type change struct {
+		event models.StatusEvent
+		from  string
+	}
+	var changes []change
+	var offline []string
+
+	c.mu.Lock()
+	for id, reportedAt := range c.reported {
+		from, to := c.states[id], c.stateAt(reportedAt, now)
+		if to == models.StateOffline {
+			offline = append(offline, id)
+		}
+		if to == from {
+			continue
+		}
+		c.states[id] = to
+		changes = append(changes, change{
+			event: models.StatusEvent{
+				ServerID: id,
+				OrgID:    c.orgs[id],
+				Status:   c.statuses[id],
+				Time:     reportedAt,
+				State:    to,
+			},
+			from: from,
+		})
+	}
+	c.mu.Unlock()
+
+	for _, ch := range changes {
+		c.announce(ch.event, ch.from)
+	}
+	if store == nil {
+		return
+	}
+	for _, id := range offline {
+		decommissioned, err := store.ServerDecommissioned(ctx, id)
+		if err != nil {
+			log.Error().Err(err).Str("server_id", id).Msg("failed to check server decommission state")
+			continue
+		}
+		if decommissioned {
+			c.evict(id)
+		}
+	}
+}
+
+// announce publishes the move of event's server from state from to
+// event.State on the bus and to dashboards.
+func (c *StatusCache) announce(event models.StatusEvent, from string) {
+	event.StateChange = &models.StateChange{From: from, To: event.State}
+	log.Info().Str("server_id", event.ServerID).Str("from", from).Str("to", event.State).Time("reported_at", event.Time).Msg("server state changed")
+	c.bus.Publish(event)
+	if c.broadcaster != nil && event.Status != nil {
+		c.broadcaster.Broadcast(event)
+	}
+}
+
+// evict forgets an offline server. Its identity owner is kept so that the
+// server ID cannot be taken over earlier than usual.
+func (c *StatusCache) evict(serverID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.states[serverID] != models.StateOffline {
+		return
+	}
+	delete(c.statuses, serverID)
+	delete(c.seqs, serverID)
+	delete(c.resync, serverID)
+	delete(c.reported, serverID)
+	delete(c.states, serverID)
+	delete(c.orgs, serverID)
+	log.Info().Str("server_id", serverID).Msg("decommissioned server evicted from status cache")
+}
@@ -0,0 +1,44 @@
+package control
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// Notifier delivers notifications over a channel, such as dashboards. It
+// must not block for long; slow channels queue notifications themselves.
+type Notifier interface {
+	Notify(ctx context.Context, n models.Notification) error
+}
+
+// Notifications fans notifications out to every registered channel.
+type Notifications struct {
+	mu       sync.RWMutex
+	channels map[string]Notifier
+}
+
+func NewNotifications() *Notifications {
+	return &Notifications{channels: make(map[string]Notifier)}
+}
+
+// Register adds or replaces a channel.
+func (n *Notifications) Register(name string, notifier Notifier) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.channels[name] = notifier
+}
+
+// Notify sends a notification to every channel. A failing channel does not
+// keep it from the others.
+func (n *Notifications) Notify(ctx context.Context, notification models.Notification) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	for name, notifier := range n.channels {
+		if err := notifier.Notify(ctx, notification); err != nil {
+			log.Error().Err(err).Str("channel", name).Str("kind", notification.Kind).Msg("failed to send notification")
+		}
+	}
+}
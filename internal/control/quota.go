@@ -0,0 +1,443 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// quotaCheckInterval is how often usage is checked against quotas.
+const quotaCheckInterval = 30 * time.Second
+
+// QuotaStore persists quotas and what has been done about them.
+type QuotaStore interface {
+	ListQuotaOrgs(ctx context.Context) ([]string, error)
+	ListQuotas(ctx context.Context, orgID string) ([]models.Quota, error)
+	ListQuotaOverrides(ctx context.Context, orgID string) ([]models.QuotaOverride, error)
+	DeleteExpiredQuotaOverrides(ctx context.Context, now time.Time) error
+	ListPeerOwners(ctx context.Context, orgID string) ([]models.PeerOwner, error)
+	PeerUsageTotals(ctx context.Context, orgID string, from, to time.Time) (map[string]int64, error)
+	ListQuotaStates(ctx context.Context, orgID string) ([]models.QuotaState, error)
+	SetQuotaState(ctx context.Context, st *models.QuotaState) error
+	ListPeerSuspensions(ctx context.Context, orgID string) ([]models.PeerSuspension, error)
+	AddPeerSuspension(ctx context.Context, ps *models.PeerSuspension) error
+	DeletePeerSuspension(ctx context.Context, serverID, iface, publicKey string) error
+}
+
+// Quotas holds peers to the data quotas of their organization. It warns as
+// a peer's usage in the billing period crosses the quota's warning
+// thresholds, and once the quota is used up either only flags the peer or
+// suspends it on every server. A peer is suspended by clearing its allowed
+// IPs, which stops its traffic but keeps its keys; they are restored when a
+// new billing period starts or an override raises or lifts its quota.
+type Quotas struct {
+	store         QuotaStore
+	client        AgentClient
+	channels      *ChannelHub
+	notifications *Notifications
+
+	mu         sync.Mutex
+	billingDay int
+	wake       chan struct{}
+}
+
+// peerQuota is the quota a peer is held to.
+type peerQuota struct {
+	status models.QuotaStatus
+	warn   []int
+}
+
+func NewQuotas(store QuotaStore, client AgentClient, channels *ChannelHub, notifications *Notifications) *Quotas {
+	return &Quotas{
+		store:         store,
+		client:        client,
+		channels:      channels,
+		notifications: notifications,
+		billingDay:    1,
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+// SetBillingDay sets the day of the month billing periods start on.
+func (q *Quotas) SetBillingDay(day int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.billingDay = day
+}
+
+// BillingDay returns the day of the month billing periods start on.
+func (q *Quotas) BillingDay() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.billingDay
+}
+
+func (q *Quotas) period(now time.Time) (start, end time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return BillingPeriod(now, q.billingDay)
+}
+
+// Check has quotas enforced soon, e.g. after they changed.
+func (q *Quotas) Check() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run enforces quotas until ctx is cancelled.
+func (q *Quotas) Run(ctx context.Context) {
+	ticker := time.NewTicker(quotaCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+		q.enforce(ctx, time.Now())
+	}
+}
+
+// Status returns where the peers of an organization that are held to a quota
+// or suspended stand in the current billing period.
+func (q *Quotas) Status(ctx context.Context, orgID string) ([]models.QuotaStatus, error) {
+	peers, err := q.evaluate(ctx, orgID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	list := make([]models.QuotaStatus, len(peers))
+	for i, p := range peers {
+		list[i] = p.status
+	}
+	return list, nil
+}
+
+// evaluate compares the usage of every peer that is held to a quota or
+// suspended with its quota.
+func (q *Quotas) evaluate(ctx context.Context, orgID string, now time.Time) ([]peerQuota, error) {
+	start, end := q.period(now)
+	quotas, err := q.store.ListQuotas(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := q.store.ListQuotaOverrides(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	owners, err := q.store.ListPeerOwners(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	suspensions, err := q.store.ListPeerSuspensions(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	totals, err := q.store.PeerUsageTotals(ctx, orgID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	byTarget := make(map[[2]string]*models.Quota, len(quotas))
+	keys := make(map[string]bool)
+	for i, quota := range quotas {
+		byTarget[[2]string{quota.Scope, quota.Target}] = &quotas[i]
+		if quota.Scope == models.QuotaScopePeer {
+			keys[quota.Target] = true
+		}
+	}
+	ownerOf := make(map[string]models.PeerOwner, len(owners))
+	for _, o := range owners {
+		ownerOf[o.PublicKey] = o
+		if byTarget[[2]string{models.QuotaScopeGroup, o.Group}] != nil || byTarget[[2]string{models.QuotaScopeProfile, o.Profile}] != nil {
+			keys[o.PublicKey] = true
+		}
+	}
+	overrideOf := make(map[string]*models.QuotaOverride)
+	for i, o := range overrides {
+		if o.ExpiresAt.After(now) {
+			overrideOf[o.PublicKey] = &overrides[i]
+			keys[o.PublicKey] = true
+		}
+	}
+	suspended := make(map[string][]models.PeerSuspension)
+	for _, ps := range suspensions {
+		suspended[ps.PublicKey] = append(suspended[ps.PublicKey], ps)
+		keys[ps.PublicKey] = true
+	}
+
+	peers := make([]peerQuota, 0, len(keys))
+	for key := range keys {
+		owner := ownerOf[key]
+		p := peerQuota{
+			status: models.QuotaStatus{
+				PublicKey:   key,
+				Action:      models.QuotaActionFlag,
+				PeriodStart: start,
+				PeriodEnd:   end,
+				UsedBytes:   totals[key],
+				Suspensions: suspended[key],
+			},
+			warn: models.DefaultQuotaWarnPercents,
+		}
+		for _, target := range [][2]string{
+			{models.QuotaScopePeer, key},
+			{models.QuotaScopeGroup, owner.Group},
+			{models.QuotaScopeProfile, owner.Profile},
+		} {
+			if target[1] == "" {
+				continue
+			}
+			if quota := byTarget[target]; quota != nil {
+				limit := quota.LimitBytes
+				p.status.QuotaID, p.status.Action, p.status.LimitBytes, p.warn = quota.ID, quota.Action, &limit, quota.WarnPercents
+				break
+			}
+		}
+		if o := overrideOf[key]; o != nil {
+			p.status.Override, p.status.LimitBytes = o, o.LimitBytes
+		}
+		if limit := p.status.LimitBytes; limit != nil {
+			p.status.Exceeded = p.status.UsedBytes >= *limit
+			if *limit > 0 {
+				p.status.Percent = float64(p.status.UsedBytes) * 100 / float64(*limit)
+			} else {
+				p.status.Percent = 100
+			}
+		}
+		peers = append(peers, p)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].status.PublicKey < peers[j].status.PublicKey })
+	return peers, nil
+}
+
+// enforce warns about, suspends and resumes the peers of every organization
+// with quotas.
+func (q *Quotas) enforce(ctx context.Context, now time.Time) {
+	if err := q.store.DeleteExpiredQuotaOverrides(ctx, now); err != nil {
+		log.Error().Err(err).Msg("failed to delete expired quota overrides")
+	}
+	orgs, err := q.store.ListQuotaOrgs(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list organizations with quotas")
+		return
+	}
+	for _, orgID := range orgs {
+		if err := q.enforceOrg(ctx, orgID, now); err != nil {
+			log.Error().Err(err).Str("org_id", orgID).Msg("failed to enforce quotas")
+		}
+	}
+}
+
+func (q *Quotas) enforceOrg(ctx context.Context, orgID string, now time.Time) error {
+	peers, err := q.evaluate(ctx, orgID, now)
+	if err != nil {
+		return err
+	}
+	list, err := q.store.ListQuotaStates(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	states := make(map[string]models.QuotaState, len(list))
+	for _, st := range list {
+		states[st.PublicKey] = st
+	}
+
+	// Where every peer of the organization currently is.
+	type placement struct {
+		serverID string
+		peer     models.Peer
+	}
+	live := make(map[string][]placement)
+	for _, event := range q.client.GetAllStatuses() {
+		eventOrg := event.OrgID
+		if eventOrg == "" {
+			eventOrg = models.DefaultOrgID
+		}
+		if event.Status == nil || eventOrg != orgID {
+			continue
+		}
+		for _, peer := range event.Status.Peers {
+			live[peer.PublicKey] = append(live[peer.PublicKey], placement{serverID: event.ServerID, peer: peer})
+		}
+	}
+
+	for _, p := range peers {
+		status := p.status
+		st, ok := states[status.PublicKey]
+		// Quotas start over with every billing period.
+		fresh := !ok || !st.PeriodStart.Equal(status.PeriodStart)
+		if fresh {
+			st = models.QuotaState{OrgID: orgID, PublicKey: status.PublicKey, PeriodStart: status.PeriodStart}
+		}
+		prev := st
+
+		if status.LimitBytes != nil {
+			crossed := 0
+			for _, percent := range p.warn {
+				if status.Percent >= float64(percent) && percent > crossed {
+					crossed = percent
+				}
+			}
+			switch {
+			case status.Exceeded && st.ExceededAt == nil:
+				st.ExceededAt, st.WarnedPercent = &now, 100
+				q.notify(ctx, orgID, models.NotifyQuotaExceeded, status, now)
+			case !status.Exceeded && st.ExceededAt != nil:
+				// An override raised the quota.
+				st.ExceededAt, st.WarnedPercent = nil, crossed
+			case !status.Exceeded && crossed > st.WarnedPercent:
+				st.WarnedPercent = crossed
+				q.notify(ctx, orgID, models.NotifyQuotaWarning, status, now)
+			}
+		}
+		if fresh || st.WarnedPercent != prev.WarnedPercent || (st.ExceededAt == nil) != (prev.ExceededAt == nil) {
+			if err := q.store.SetQuotaState(ctx, &st); err != nil {
+				return err
+			}
+		}
+
+		if status.Exceeded && status.Action == models.QuotaActionSuspend {
+			for _, pl := range live[status.PublicKey] {
+				if len(pl.peer.AllowedIPs) == 0 || isSuspended(status.Suspensions, pl.serverID, pl.peer.Interface) {
+					continue
+				}
+				if err := q.suspend(ctx, orgID, pl.serverID, pl.peer, now); err != nil {
+					log.Error().Err(err).Str("server_id", pl.serverID).Str("public_key", status.PublicKey).Msg("failed to suspend peer")
+					continue
+				}
+				log.Warn().Str("server_id", pl.serverID).Str("public_key", status.PublicKey).Msg("suspended peer over its data quota")
+			}
+			continue
+		}
+
+		resumed := false
+		for _, ps := range status.Suspensions {
+			if err := q.resume(ctx, ps); err != nil {
+				log.Error().Err(err).Str("server_id", ps.ServerID).Str("public_key", ps.PublicKey).Msg("failed to resume peer")
+				continue
+			}
+			log.Info().Str("server_id", ps.ServerID).Str("public_key", ps.PublicKey).Msg("resumed peer")
+			resumed = true
+		}
+		if resumed {
+			q.notify(ctx, orgID, models.NotifyQuotaResumed, status, now)
+		}
+	}
+	return nil
+}
+
+func isSuspended(suspensions []models.PeerSuspension, serverID, iface string) bool {
+	for _, ps := range suspensions {
+		if ps.ServerID == serverID && ps.Interface == iface {
+			return true
+		}
+	}
+	return false
+}
+
+// suspend clears the allowed IPs of a peer on a server, after recording them
+// to be restored.
+func (q *Quotas) suspend(ctx context.Context, orgID, serverID string, peer models.Peer, now time.Time) error {
+	ps := models.PeerSuspension{
+		ServerID:    serverID,
+		Interface:   peer.Interface,
+		PublicKey:   peer.PublicKey,
+		OrgID:       orgID,
+		AllowedIPs:  peer.AllowedIPs,
+		SuspendedAt: now,
+	}
+	if err := q.store.AddPeerSuspension(ctx, &ps); err != nil {
+		return err
+	}
+	if err := q.setAllowedIPs(ctx, serverID, peer.Interface, peer.PublicKey, []string{}); err != nil {
+		// Try again with the next check.
+		if err := q.store.DeletePeerSuspension(ctx, serverID, peer.Interface, peer.PublicKey); err != nil {
+			log.Error().Err(err).Msg("failed to delete peer suspension")
+		}
+		return err
+	}
+	return nil
+}
+
+// resume restores the allowed IPs of a suspended peer.
+func (q *Quotas) resume(ctx context.Context, ps models.PeerSuspension) error {
+	if err := q.setAllowedIPs(ctx, ps.ServerID, ps.Interface, ps.PublicKey, ps.AllowedIPs); err != nil {
+		return err
+	}
+	return q.store.DeletePeerSuspension(ctx, ps.ServerID, ps.Interface, ps.PublicKey)
+}
+
+// setAllowedIPs replaces the allowed IPs of a peer, leaving the rest of its
+// configuration as it is.
+func (q *Quotas) setAllowedIPs(ctx context.Context, serverID, iface, publicKey string, allowedIPs []string) error {
+	payload, err := json.Marshal(models.PeerConfig{Interface: iface, PublicKey: publicKey, AllowedIPs: allowedIPs})
+	if err != nil {
+		return err
+	}
+	result, err := q.channels.SendCommand(ctx, serverID, models.Command{Name: models.CommandAddPeer, Payload: payload})
+	if err != nil {
+		return err
+	}
+	if result.Error != "" {
+		return errors.New(result.Error)
+	}
+	return nil
+}
+
+func (q *Quotas) notify(ctx context.Context, orgID, kind string, status models.QuotaStatus, now time.Time) {
+	n := models.Notification{
+		Kind:      kind,
+		OrgID:     orgID,
+		Severity:  models.SeverityWarning,
+		PublicKey: status.PublicKey,
+		Time:      now,
+		Data: map[string]any{
+			"used_bytes": status.UsedBytes,
+			"percent":    status.Percent,
+			"action":     status.Action,
+			"period_end": status.PeriodEnd,
+		},
+	}
+	if status.LimitBytes != nil {
+		n.Data["limit_bytes"] = *status.LimitBytes
+	}
+	used := formatBytes(status.UsedBytes)
+	switch kind {
+	case models.NotifyQuotaWarning:
+		n.Message = fmt.Sprintf("Peer %s used %.0f%% of its data quota (%s of %s)", status.PublicKey, status.Percent, used, formatBytes(*status.LimitBytes))
+	case models.NotifyQuotaExceeded:
+		n.Message = fmt.Sprintf("Peer %s used up its data quota of %s", status.PublicKey, formatBytes(*status.LimitBytes))
+		if status.Action == models.QuotaActionSuspend {
+			n.Severity = models.SeverityCritical
+			n.Message += " and is suspended until " + status.PeriodEnd.Format(time.DateOnly)
+		}
+	case models.NotifyQuotaResumed:
+		n.Severity = models.SeverityInfo
+		n.Message = fmt.Sprintf("Peer %s was resumed after %s of use", status.PublicKey, used)
+	}
+	q.notifications.Notify(ctx, n)
+}
+
+// formatBytes formats a byte count with a binary unit.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
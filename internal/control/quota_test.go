@@ -0,0 +1,322 @@
+package control
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+type fakeQuotaStore struct {
+	quotas      []models.Quota
+	overrides   []models.QuotaOverride
+	owners      []models.PeerOwner
+	days        []models.UsageDay
+	states      map[string]models.QuotaState
+	suspensions []models.PeerSuspension
+}
+
+func (f *fakeQuotaStore) ListQuotaOrgs(ctx context.Context) ([]string, error) {
+	return []string{models.DefaultOrgID}, nil
+}
+
+func (f *fakeQuotaStore) ListQuotas(ctx context.Context, orgID string) ([]models.Quota, error) {
+	return f.quotas, nil
+}
+
+func (f *fakeQuotaStore) ListQuotaOverrides(ctx context.Context, orgID string) ([]models.QuotaOverride, error) {
+	return f.overrides, nil
+}
+
+func (f *fakeQuotaStore) DeleteExpiredQuotaOverrides(ctx context.Context, now time.Time) error {
+	f.overrides = slices.DeleteFunc(f.overrides, func(o models.QuotaOverride) bool { return !o.ExpiresAt.After(now) })
+	return nil
+}
+
+func (f *fakeQuotaStore) ListPeerOwners(ctx context.Context, orgID string) ([]models.PeerOwner, error) {
+	return f.owners, nil
+}
+
+func (f *fakeQuotaStore) PeerUsageTotals(ctx context.Context, orgID string, from, to time.Time) (map[string]int64, error) {
+	totals := make(map[string]int64)
+	for _, d := range f.days {
+		if !d.Day.Before(from) && d.Day.Before(to) {
+			totals[d.PublicKey] += d.ReceiveBytes + d.TransmitBytes
+		}
+	}
+	return totals, nil
+}
+
+func (f *fakeQuotaStore) ListQuotaStates(ctx context.Context, orgID string) ([]models.QuotaState, error) {
+	var list []models.QuotaState
+	for _, st := range f.states {
+		list = append(list, st)
+	}
+	return list, nil
+}
+
+func (f *fakeQuotaStore) SetQuotaState(ctx context.Context, st *models.QuotaState) error {
+	f.states[st.PublicKey] = *st
+	return nil
+}
+
+func (f *fakeQuotaStore) ListPeerSuspensions(ctx context.Context, orgID string) ([]models.PeerSuspension, error) {
+	return slices.Clone(f.suspensions), nil
+}
+
+func (f *fakeQuotaStore) AddPeerSuspension(ctx context.Context, ps *models.PeerSuspension) error {
+	f.suspensions = append(f.suspensions, *ps)
+	return nil
+}
+
+func (f *fakeQuotaStore) DeletePeerSuspension(ctx context.Context, serverID, iface, publicKey string) error {
+	f.suspensions = slices.DeleteFunc(f.suspensions, func(ps models.PeerSuspension) bool {
+		return ps.ServerID == serverID && ps.Interface == iface && ps.PublicKey == publicKey
+	})
+	return nil
+}
+
+// fakeTarget is an agent that records the commands it is sent.
+type fakeTarget struct {
+	serverID string
+	sent     *[]string
+	// fail is the error the agent answers with, if any.
+	fail string
+}
+
+func (t *fakeTarget) Execute(ctx context.Context, cmd models.Command) (models.CommandResult, error) {
+	*t.sent = append(*t.sent, fmt.Sprintf("%s %s %s", t.serverID, cmd.Name, cmd.Payload))
+	return models.CommandResult{Error: t.fail}, nil
+}
+
+type notificationRecorder struct {
+	kinds []string
+}
+
+func (n *notificationRecorder) Notify(ctx context.Context, notification models.Notification) error {
+	n.kinds = append(n.kinds, notification.Kind)
+	return nil
+}
+
+func TestQuotaEnforcement(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	period := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	lastPeriod := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	quota := func(action string) models.Quota {
+		return models.Quota{ID: "q1", OrgID: models.DefaultOrgID, Scope: models.QuotaScopePeer, Target: "pk-a", LimitBytes: 100, WarnPercents: []int{80}, Action: action}
+	}
+	used := func(day time.Time, n int64) []models.UsageDay {
+		return []models.UsageDay{{OrgID: models.DefaultOrgID, ServerID: "srv-1", PublicKey: "pk-a", Day: day, ReceiveBytes: n}}
+	}
+	suspended := func(at time.Time) []models.PeerSuspension {
+		return []models.PeerSuspension{{ServerID: "srv-1", PublicKey: "pk-a", OrgID: models.DefaultOrgID, AllowedIPs: []string{"10.0.0.2/32"}, SuspendedAt: at}}
+	}
+	limit := func(n int64) *int64 { return &n }
+	live := []string{"10.0.0.2/32"}
+
+	const (
+		suspend = `srv-1 peer.add {"public_key":"pk-a","allowed_ips":[]}`
+		resume  = `srv-1 peer.add {"public_key":"pk-a","allowed_ips":["10.0.0.2/32"]}`
+	)
+	tests := []struct {
+		name        string
+		quotas      []models.Quota
+		overrides   []models.QuotaOverride
+		days        []models.UsageDay
+		suspensions []models.PeerSuspension
+		// allowedIPs are those the agent reports for the peer.
+		allowedIPs []string
+		// fail is the error the agent answers commands with.
+		fail string
+
+		wantCommands      []string
+		wantNotifications []string
+		wantSuspended     bool
+	}{
+		{
+			name:       "peer within its quota",
+			quotas:     []models.Quota{quota(models.QuotaActionSuspend)},
+			days:       used(period, 50),
+			allowedIPs: live,
+		},
+		{
+			name:              "peer crosses a warning threshold",
+			quotas:            []models.Quota{quota(models.QuotaActionSuspend)},
+			days:              used(period, 85),
+			allowedIPs:        live,
+			wantNotifications: []string{models.NotifyQuotaWarning},
+		},
+		{
+			name:              "peer over a flagging quota is not suspended",
+			quotas:            []models.Quota{quota(models.QuotaActionFlag)},
+			days:              used(period, 100),
+			allowedIPs:        live,
+			wantNotifications: []string{models.NotifyQuotaExceeded},
+		},
+		{
+			name:              "peer over a suspending quota is suspended",
+			quotas:            []models.Quota{quota(models.QuotaActionSuspend)},
+			days:              used(period, 120),
+			allowedIPs:        live,
+			wantCommands:      []string{suspend},
+			wantNotifications: []string{models.NotifyQuotaExceeded},
+			wantSuspended:     true,
+		},
+		{
+			name:              "suspension the agent refused is dropped",
+			quotas:            []models.Quota{quota(models.QuotaActionSuspend)},
+			days:              used(period, 120),
+			allowedIPs:        live,
+			fail:              "wg: device busy",
+			wantCommands:      []string{suspend},
+			wantNotifications: []string{models.NotifyQuotaExceeded},
+		},
+		{
+			name:              "suspended peer is not suspended again",
+			quotas:            []models.Quota{quota(models.QuotaActionSuspend)},
+			days:              used(period, 120),
+			suspensions:       suspended(period),
+			allowedIPs:        []string{},
+			wantNotifications: []string{models.NotifyQuotaExceeded},
+			wantSuspended:     true,
+		},
+		{
+			name:              "suspended peer is resumed when a new period starts",
+			quotas:            []models.Quota{quota(models.QuotaActionSuspend)},
+			days:              used(lastPeriod, 120),
+			suspensions:       suspended(lastPeriod),
+			allowedIPs:        []string{},
+			wantCommands:      []string{resume},
+			wantNotifications: []string{models.NotifyQuotaResumed},
+		},
+		{
+			name:              "override raises the quota of a suspended peer",
+			quotas:            []models.Quota{quota(models.QuotaActionSuspend)},
+			overrides:         []models.QuotaOverride{{OrgID: models.DefaultOrgID, PublicKey: "pk-a", LimitBytes: limit(200), ExpiresAt: now.Add(time.Hour)}},
+			days:              used(period, 120),
+			suspensions:       suspended(period),
+			allowedIPs:        []string{},
+			wantCommands:      []string{resume},
+			wantNotifications: []string{models.NotifyQuotaResumed},
+		},
+		{
+			name:              "override lifts the quota of a suspended peer",
+			quotas:            []models.Quota{quota(models.QuotaActionSuspend)},
+			overrides:         []models.QuotaOverride{{OrgID: models.DefaultOrgID, PublicKey: "pk-a", ExpiresAt: now.Add(time.Hour)}},
+			days:              used(period, 120),
+			suspensions:       suspended(period),
+			allowedIPs:        []string{},
+			wantCommands:      []string{resume},
+			wantNotifications: []string{models.NotifyQuotaResumed},
+		},
+		{
+			name:              "override that is too low keeps the peer suspended",
+			quotas:            []models.Quota{quota(models.QuotaActionSuspend)},
+			overrides:         []models.QuotaOverride{{OrgID: models.DefaultOrgID, PublicKey: "pk-a", LimitBytes: limit(110), ExpiresAt: now.Add(time.Hour)}},
+			days:              used(period, 120),
+			suspensions:       suspended(period),
+			allowedIPs:        []string{},
+			wantNotifications: []string{models.NotifyQuotaExceeded},
+			wantSuspended:     true,
+		},
+		{
+			name:              "expired override no longer applies",
+			quotas:            []models.Quota{quota(models.QuotaActionSuspend)},
+			overrides:         []models.QuotaOverride{{OrgID: models.DefaultOrgID, PublicKey: "pk-a", ExpiresAt: now}},
+			days:              used(period, 120),
+			allowedIPs:        live,
+			wantCommands:      []string{suspend},
+			wantNotifications: []string{models.NotifyQuotaExceeded},
+			wantSuspended:     true,
+		},
+		{
+			name:              "override holds a peer without a quota to a limit",
+			overrides:         []models.QuotaOverride{{OrgID: models.DefaultOrgID, PublicKey: "pk-a", LimitBytes: limit(100), ExpiresAt: now.Add(time.Hour)}},
+			days:              used(period, 120),
+			allowedIPs:        live,
+			wantNotifications: []string{models.NotifyQuotaExceeded},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeQuotaStore{
+				quotas:      tt.quotas,
+				overrides:   tt.overrides,
+				days:        tt.days,
+				states:      make(map[string]models.QuotaState),
+				suspensions: tt.suspensions,
+			}
+			client := NewStatusCache(NewEventBus(), nil, nil)
+			peer := models.Peer{PublicKey: "pk-a", AllowedIPs: tt.allowedIPs}
+			if err := client.Ingest(models.StatusEvent{OrgID: models.DefaultOrgID, ServerID: "srv-1", Status: &models.Status{Peers: []models.Peer{peer}}}); err != nil {
+				t.Fatal(err)
+			}
+			var sent []string
+			channels := NewChannelHub(nil)
+			channels.Register("srv-1", &fakeTarget{serverID: "srv-1", sent: &sent, fail: tt.fail})
+			notifications := NewNotifications()
+			recorder := &notificationRecorder{}
+			notifications.Register("test", recorder)
+
+			q := NewQuotas(store, client, channels, notifications)
+			q.enforce(context.Background(), now)
+
+			if !slices.Equal(sent, tt.wantCommands) {
+				t.Errorf("commands = %q, want %q", sent, tt.wantCommands)
+			}
+			if !slices.Equal(recorder.kinds, tt.wantNotifications) {
+				t.Errorf("notifications = %v, want %v", recorder.kinds, tt.wantNotifications)
+			}
+			if got := len(store.suspensions) > 0; got != tt.wantSuspended {
+				t.Errorf("suspended = %v, want %v", got, tt.wantSuspended)
+			}
+			if tt.wantSuspended && !slices.Equal(store.suspensions[0].AllowedIPs, live) {
+				t.Errorf("allowed IPs to restore = %v, want %v", store.suspensions[0].AllowedIPs, live)
+			}
+		})
+	}
+}
+
+func TestQuotaSuspendsPeerOnEveryServer(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	store := &fakeQuotaStore{
+		quotas: []models.Quota{{ID: "q1", OrgID: models.DefaultOrgID, Scope: models.QuotaScopeGroup, Target: "staff", LimitBytes: 100, Action: models.QuotaActionSuspend}},
+		owners: []models.PeerOwner{{OrgID: models.DefaultOrgID, PublicKey: "pk-a", Group: "staff"}},
+		days: []models.UsageDay{
+			{OrgID: models.DefaultOrgID, ServerID: "srv-1", PublicKey: "pk-a", Day: now.Truncate(24 * time.Hour), ReceiveBytes: 60},
+			{OrgID: models.DefaultOrgID, ServerID: "srv-2", PublicKey: "pk-a", Day: now.Truncate(24 * time.Hour), TransmitBytes: 60},
+		},
+		states: make(map[string]models.QuotaState),
+	}
+	client := NewStatusCache(NewEventBus(), nil, nil)
+	var sent []string
+	channels := NewChannelHub(nil)
+	for _, id := range []string{"srv-1", "srv-2", "srv-3"} {
+		peers := []models.Peer{{Interface: "wg1", PublicKey: "pk-a", AllowedIPs: []string{"10.0.0.2/32"}}}
+		if id == "srv-3" {
+			peers = []models.Peer{{PublicKey: "pk-b", AllowedIPs: []string{"10.0.0.3/32"}}}
+		}
+		if err := client.Ingest(models.StatusEvent{ServerID: id, Status: &models.Status{Peers: peers}}); err != nil {
+			t.Fatal(err)
+		}
+		channels.Register(id, &fakeTarget{serverID: id, sent: &sent})
+	}
+
+	q := NewQuotas(store, client, channels, NewNotifications())
+	q.enforce(context.Background(), now)
+
+	slices.Sort(sent)
+	want := []string{
+		`srv-1 peer.add {"interface":"wg1","public_key":"pk-a","allowed_ips":[]}`,
+		`srv-2 peer.add {"interface":"wg1","public_key":"pk-a","allowed_ips":[]}`,
+	}
+	if !slices.Equal(sent, want) {
+		t.Errorf("commands = %q, want %q", sent, want)
+	}
+	if len(store.suspensions) != 2 {
+		t.Errorf("suspensions = %+v, want one per server", store.suspensions)
+	}
+}
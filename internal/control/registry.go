@@ -0,0 +1,125 @@
+package control
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// lastSeenInterval is how often the last-seen time of a server that keeps
+// reporting the same identity is written to the store.
+const lastSeenInterval = time.Minute
+
+// RegistryStore persists the server registry.
+type RegistryStore interface {
+	RecordServerReport(ctx context.Context, srv *models.Server, seen time.Time) error
+}
+
+// Registry registers every server that reports on the bus and keeps its
+// identity and last-seen time up to date in the store.
+type Registry struct {
+	store RegistryStore
+
+	mu      sync.Mutex
+	written map[string]registryEntry
+}
+
+type registryEntry struct {
+	server models.Server
+	at     time.Time
+}
+
+// NewRegistry records the servers reporting on bus in store.
+func NewRegistry(bus *EventBus, store RegistryStore) *Registry {
+	r := &Registry{store: store, written: make(map[string]registryEntry)}
+	go r.listen(bus.Subscribe())
+	return r
+}
+
+func (r *Registry) listen(ch <-chan models.StatusEvent) {
+	for event := range ch {
+		srv, ok := serverFromEvent(event)
+		if !ok {
+			continue
+		}
+		seen := event.Time
+		if seen.IsZero() {
+			seen = time.Now()
+		}
+		if !r.due(srv, seen) {
+			continue
+		}
+		if err := r.store.RecordServerReport(context.Background(), &srv, seen); err != nil {
+			log.Error().Err(err).Str("server_id", srv.ID).Msg("failed to record server")
+			r.forget(srv.ID)
+		}
+	}
+}
+
+// due reports whether srv has to be written, either because its identity
+// changed or because its last-seen time is stale.
+func (r *Registry) due(srv models.Server, seen time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prev, ok := r.written[srv.ID]
+	merged := mergeServer(prev.server, srv)
+	if ok && merged == prev.server && seen.Sub(prev.at) < lastSeenInterval {
+		return false
+	}
+	r.written[srv.ID] = registryEntry{server: merged, at: seen}
+	return true
+}
+
+func (r *Registry) forget(serverID string) {
+	r.mu.Lock()
+	delete(r.written, serverID)
+	r.mu.Unlock()
+}
+
+// serverFromEvent extracts what a report tells about its server. Deltas may
+// leave fields empty.
+func serverFromEvent(event models.StatusEvent) (models.Server, bool) {
+	if event.ServerID == "" || event.StateChange != nil {
+		return models.Server{}, false
+	}
+	srv := models.Server{ID: event.ServerID, OrgID: event.OrgID}
+	if srv.OrgID == "" {
+		srv.OrgID = models.DefaultOrgID
+	}
+	srv.Hostname = event.Attributes[models.AttributeHostname]
+	if status := event.Status; status != nil {
+		if status.System.Hostname != "" {
+			srv.Hostname = status.System.Hostname
+		}
+		srv.PublicKey, srv.ListenPort = status.PublicKey, status.ListenPort
+	}
+	// Peers reach the server at the address its reports come from.
+	if ap, err := netip.ParseAddrPort(event.RemoteAddr); err == nil && srv.ListenPort != 0 {
+		srv.Endpoint = net.JoinHostPort(ap.Addr().Unmap().String(), strconv.Itoa(srv.ListenPort))
+	}
+	return srv, true
+}
+
+// mergeServer returns prev updated with the non-empty fields of next.
+func mergeServer(prev, next models.Server) models.Server {
+	out := next
+	if out.Hostname == "" {
+		out.Hostname = prev.Hostname
+	}
+	if out.PublicKey == "" {
+		out.PublicKey = prev.PublicKey
+	}
+	if out.Endpoint == "" {
+		out.Endpoint = prev.Endpoint
+	}
+	if out.ListenPort == 0 {
+		out.ListenPort = prev.ListenPort
+	}
+	return out
+}
@@ -0,0 +1,65 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrStaleReport    = errors.New("report timestamp outside allowed window")
+	ErrReplayedReport = errors.New("report nonce already used")
+)
+
+// NonceStore remembers the nonces of signed reports.
+type NonceStore interface {
+	UseReportNonce(ctx context.Context, key, nonce string, expiresAt time.Time) (bool, error)
+	DeleteExpiredReportNonces(ctx context.Context, now time.Time) error
+}
+
+// ReplayGuard rejects signed reports that are too old or whose nonce has been
+// seen before. Nonces are kept in the store, so that replays are still caught
+// after a restart, for as long as their timestamp is within the allowed
+// window, after which the timestamp check alone rejects them.
+type ReplayGuard struct {
+	store  NonceStore
+	window time.Duration
+
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+func NewReplayGuard(store NonceStore, window time.Duration) *ReplayGuard {
+	return &ReplayGuard{store: store, window: window}
+}
+
+// Check accepts a nonce for the given key once within the window around now.
+func (g *ReplayGuard) Check(ctx context.Context, key, nonce string, timestamp, now time.Time) error {
+	if timestamp.Before(now.Add(-g.window)) || timestamp.After(now.Add(g.window)) {
+		return ErrStaleReport
+	}
+
+	g.mu.Lock()
+	purge := now.Sub(g.lastPurge) > g.window
+	if purge {
+		g.lastPurge = now
+	}
+	g.mu.Unlock()
+	if purge {
+		if err := g.store.DeleteExpiredReportNonces(ctx, now); err != nil {
+			log.Error().Err(err).Msg("failed to delete expired report nonces")
+		}
+	}
+
+	ok, err := g.store.UseReportNonce(ctx, key, nonce, timestamp.Add(g.window))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrReplayedReport
+	}
+	return nil
+}
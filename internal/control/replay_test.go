@@ -0,0 +1,135 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/store"
+)
+
+func openNonceStore(t *testing.T, path string) *store.Store {
+	t.Helper()
+	db, err := store.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestReplayGuard(t *testing.T) {
+	const window = 5 * time.Minute
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	type check struct {
+		key, nonce string
+		// age is how old the report's timestamp is.
+		age time.Duration
+		// restart reopens the store with a new guard before the check.
+		restart bool
+		wantErr error
+	}
+	tests := []struct {
+		name   string
+		checks []check
+	}{
+		{
+			name:   "fresh nonce",
+			checks: []check{{key: "agent-1", nonce: "n1"}},
+		},
+		{
+			name: "duplicate nonce",
+			checks: []check{
+				{key: "agent-1", nonce: "n1"},
+				{key: "agent-1", nonce: "n1", wantErr: ErrReplayedReport},
+			},
+		},
+		{
+			name: "duplicate nonce after a restart",
+			checks: []check{
+				{key: "agent-1", nonce: "n1"},
+				{key: "agent-1", nonce: "n1", restart: true, wantErr: ErrReplayedReport},
+			},
+		},
+		{
+			name: "nonce of another agent",
+			checks: []check{
+				{key: "agent-1", nonce: "n1"},
+				{key: "agent-2", nonce: "n1"},
+			},
+		},
+		{
+			name: "timestamp before the window",
+			checks: []check{
+				{key: "agent-1", nonce: "n1", age: window + time.Second, wantErr: ErrStaleReport},
+				// A stale report does not use up its nonce.
+				{key: "agent-1", nonce: "n1"},
+			},
+		},
+		{
+			name:   "timestamp after the window",
+			checks: []check{{key: "agent-1", nonce: "n1", age: -window - time.Second, wantErr: ErrStaleReport}},
+		},
+		{
+			name:   "timestamp at the edge of the window",
+			checks: []check{{key: "agent-1", nonce: "n1", age: window}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "sentra.db")
+			db := openNonceStore(t, path)
+			guard := NewReplayGuard(db, window)
+			for i, c := range tt.checks {
+				if c.restart {
+					db.Close()
+					db = openNonceStore(t, path)
+					guard = NewReplayGuard(db, window)
+				}
+				err := guard.Check(context.Background(), c.key, c.nonce, now.Add(-c.age), now)
+				if !errors.Is(err, c.wantErr) {
+					t.Fatalf("check %d: Check = %v, want %v", i, err, c.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestReplayGuardPurge(t *testing.T) {
+	const window = 5 * time.Minute
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	db := openNonceStore(t, filepath.Join(t.TempDir(), "sentra.db"))
+	guard := NewReplayGuard(db, window)
+
+	if err := guard.Check(ctx, "agent-1", "n1", now, now); err != nil {
+		t.Fatal(err)
+	}
+	// Once its timestamp left the window, the nonce is only rejected as
+	// stale.
+	later := now.Add(window + time.Second)
+	if err := guard.Check(ctx, "agent-1", "n1", now, later); !errors.Is(err, ErrStaleReport) {
+		t.Fatalf("Check = %v, want %v", err, ErrStaleReport)
+	}
+
+	// Purging runs at most once per window.
+	if err := guard.Check(ctx, "agent-1", "n2", now.Add(window), now.Add(window)); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := db.UseReportNonce(ctx, "agent-1", "n1", later); err != nil || ok {
+		t.Fatalf("nonce purged before a window passed: %v, %v", ok, err)
+	}
+
+	purgeAt := now.Add(2*window + time.Second)
+	if err := guard.Check(ctx, "agent-1", "n3", purgeAt, purgeAt); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := db.UseReportNonce(ctx, "agent-1", "n1", purgeAt); err != nil || !ok {
+		t.Errorf("expired nonce not purged: %v, %v", ok, err)
+	}
+	if ok, err := db.UseReportNonce(ctx, "agent-1", "n3", purgeAt); err != nil || ok {
+		t.Errorf("nonce within the window purged: %v, %v", ok, err)
+	}
+}
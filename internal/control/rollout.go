@@ -0,0 +1,296 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// updateCommandTimeout covers the agent downloading and installing a release.
+	updateCommandTimeout = 5 * time.Minute
+	// rolloutTargetTimeout bounds how long an agent may take to come back
+	// with the new version after accepting an update.
+	rolloutTargetTimeout = 15 * time.Minute
+	rolloutSweepInterval = time.Minute
+)
+
+var (
+	ErrNoRolloutTargets  = errors.New("no agents eligible for the rollout")
+	ErrRolloutState      = errors.New("rollout is not in the required state")
+	ErrCanaryIncomplete  = errors.New("canary stage has not succeeded")
+	ErrUnknownCanaryHost = errors.New("canary server is not eligible")
+)
+
+// RolloutStore persists releases and rollout progress.
+type RolloutStore interface {
+	GetReleaseFor(ctx context.Context, version, goos, goarch string) (*models.Release, error)
+	GetRollout(ctx context.Context, id string) (*models.Rollout, error)
+	SetRolloutStatus(ctx context.Context, id, status string, at time.Time) error
+	SetRolloutTargetStatus(ctx context.Context, rolloutID, serverID, status, errMsg string, at time.Time) error
+	ListUpdatingTargets(ctx context.Context, serverID string) ([]models.RolloutTarget, error)
+	ListTargetsByStatus(ctx context.Context, status string) ([]models.RolloutTarget, error)
+}
+
+// Rollouts delivers agent releases to the fleet and tracks every agent until
+// it reports the new version, rolls back or times out.
+type Rollouts struct {
+	store     RolloutStore
+	channels  *ChannelHub
+	inventory *Inventory
+}
+
+// NewRollouts watches the bus for agents coming back after an update.
+func NewRollouts(ctx context.Context, bus *EventBus, store RolloutStore, channels *ChannelHub, inventory *Inventory) *Rollouts {
+	r := &Rollouts{store: store, channels: channels, inventory: inventory}
+	go r.listen(bus.Subscribe())
+	go r.sweep(ctx)
+	return r
+}
+
+// Plan builds a rollout of version for the agents of orgID. Canary servers are
+// either given explicitly or the first canaryCount eligible servers. Agents
+// that cannot self-update or have no release for their platform are skipped.
+func (r *Rollouts) Plan(ctx context.Context, orgID, version string, canary []string, canaryCount int) (*models.Rollout, error) {
+	now := time.Now().UTC()
+	rollout := &models.Rollout{
+		OrgID:     orgID,
+		Version:   version,
+		Status:    models.RolloutCanary,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	var eligible []string
+	for _, a := range r.inventory.List() {
+		if a.OrgID != orgID || a.Version == version {
+			continue
+		}
+		t := models.RolloutTarget{
+			ServerID:    a.ServerID,
+			Stage:       models.StageGeneral,
+			Status:      models.TargetPending,
+			FromVersion: a.Version,
+			UpdatedAt:   now,
+		}
+		rel, err := r.store.GetReleaseFor(ctx, version, a.OS, a.Arch)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case !a.HasCapability(models.CapabilitySelfUpdate):
+			t.Status, t.Error = models.TargetSkipped, "agent does not support self-update"
+		case rel == nil:
+			t.Status, t.Error = models.TargetSkipped, fmt.Sprintf("no release for %s/%s", a.OS, a.Arch)
+		default:
+			eligible = append(eligible, a.ServerID)
+		}
+		rollout.Targets = append(rollout.Targets, t)
+	}
+	if len(eligible) == 0 {
+		return nil, ErrNoRolloutTargets
+	}
+
+	if len(canary) == 0 {
+		if canaryCount < 1 {
+			canaryCount = 1
+		}
+		canary = eligible[:min(canaryCount, len(eligible))]
+	}
+	for _, id := range canary {
+		i := sort.SearchStrings(eligible, id)
+		if i == len(eligible) || eligible[i] != id {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownCanaryHost, id)
+		}
+		for j := range rollout.Targets {
+			if rollout.Targets[j].ServerID == id {
+				rollout.Targets[j].Stage = models.StageCanary
+			}
+		}
+	}
+	return rollout, nil
+}
+
+// Dispatch sends the update command to the pending targets of a stage.
+func (r *Rollouts) Dispatch(rollout *models.Rollout, stage string) {
+	for _, t := range rollout.Targets {
+		if t.Stage == stage && t.Status == models.TargetPending {
+			go r.update(rollout.ID, rollout.Version, t.ServerID)
+		}
+	}
+}
+
+// Promote starts the general stage once every canary succeeded.
+func (r *Rollouts) Promote(ctx context.Context, rollout *models.Rollout) error {
+	if rollout.Status != models.RolloutCanary {
+		return ErrRolloutState
+	}
+	for _, t := range rollout.Targets {
+		if t.Stage == models.StageCanary && t.Status != models.TargetSucceeded {
+			return fmt.Errorf("%w: %s is %s", ErrCanaryIncomplete, t.ServerID, t.Status)
+		}
+	}
+	if err := r.store.SetRolloutStatus(ctx, rollout.ID, models.RolloutActive, time.Now().UTC()); err != nil {
+		return err
+	}
+	rollout.Status = models.RolloutActive
+	log.Info().Str("rollout_id", rollout.ID).Str("version", rollout.Version).Msg("rollout promoted")
+
+	r.Dispatch(rollout, models.StageGeneral)
+	r.checkCompleted(ctx, rollout.ID)
+	return nil
+}
+
+// Cancel stops a rollout. Agents already updating are still tracked.
+func (r *Rollouts) Cancel(ctx context.Context, rollout *models.Rollout) error {
+	if rollout.Status != models.RolloutCanary && rollout.Status != models.RolloutActive {
+		return ErrRolloutState
+	}
+	now := time.Now().UTC()
+	if err := r.store.SetRolloutStatus(ctx, rollout.ID, models.RolloutCancelled, now); err != nil {
+		return err
+	}
+	for _, t := range rollout.Targets {
+		if t.Status == models.TargetPending {
+			if err := r.store.SetRolloutTargetStatus(ctx, rollout.ID, t.ServerID, models.TargetCancelled, "", now); err != nil {
+				return err
+			}
+		}
+	}
+	log.Info().Str("rollout_id", rollout.ID).Msg("rollout cancelled")
+	return nil
+}
+
+// update sends the release to one agent.
+func (r *Rollouts) update(rolloutID, version, serverID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), updateCommandTimeout)
+	defer cancel()
+
+	fail := func(msg string) {
+		log.Warn().Str("rollout_id", rolloutID).Str("server_id", serverID).Str("error", msg).Msg("agent update failed")
+		r.setTarget(rolloutID, serverID, models.TargetFailed, msg)
+		r.checkCompleted(ctx, rolloutID)
+	}
+
+	a, ok := r.inventory.Get(serverID)
+	if !ok {
+		fail("agent is not in the inventory")
+		return
+	}
+	rel, err := r.store.GetReleaseFor(ctx, version, a.OS, a.Arch)
+	if err != nil || rel == nil {
+		fail(fmt.Sprintf("no release for %s/%s", a.OS, a.Arch))
+		return
+	}
+
+	// Mark the target first, the agent may report the new version before
+	// the command result arrives.
+	r.setTarget(rolloutID, serverID, models.TargetUpdating, "")
+	payload, _ := json.Marshal(models.UpdateRequest{
+		RolloutID: rolloutID,
+		Version:   rel.Version,
+		URL:       "/api/agent/releases/" + rel.ID + "/download",
+		SHA256:    rel.SHA256,
+		Signature: rel.Signature,
+	})
+	result, err := r.channels.SendCommand(ctx, serverID, models.Command{Name: models.CommandUpdate, Payload: payload})
+	switch {
+	case errors.Is(err, ErrSessionClosed):
+		// The agent restarts right after answering; the result may be lost.
+		// Its next report decides.
+	case err != nil:
+		fail(err.Error())
+	case result.Error != "":
+		fail(result.Error)
+	default:
+		log.Info().Str("rollout_id", rolloutID).Str("server_id", serverID).Str("version", version).Msg("agent accepted update")
+	}
+}
+
+func (r *Rollouts) listen(ch <-chan models.StatusEvent) {
+	for event := range ch {
+		if event.Agent == nil {
+			continue
+		}
+		ctx := context.Background()
+		targets, err := r.store.ListUpdatingTargets(ctx, event.ServerID)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to list updating rollout targets")
+			continue
+		}
+		for _, t := range targets {
+			rollout, err := r.store.GetRollout(ctx, t.RolloutID)
+			if err != nil || rollout == nil {
+				continue
+			}
+			switch {
+			case event.Agent.Version == rollout.Version:
+				log.Info().Str("rollout_id", rollout.ID).Str("server_id", t.ServerID).Str("version", rollout.Version).Msg("agent updated")
+				r.setTarget(rollout.ID, t.ServerID, models.TargetSucceeded, "")
+			case event.Agent.RolledBackFrom == rollout.Version:
+				msg := fmt.Sprintf("agent rolled back to %s", event.Agent.Version)
+				log.Warn().Str("rollout_id", rollout.ID).Str("server_id", t.ServerID).Msg(msg)
+				r.setTarget(rollout.ID, t.ServerID, models.TargetRolledBack, msg)
+			default:
+				continue
+			}
+			r.checkCompleted(ctx, rollout.ID)
+		}
+	}
+}
+
+// sweep fails targets whose agent never came back with the new version.
+func (r *Rollouts) sweep(ctx context.Context) {
+	ticker := time.NewTicker(rolloutSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			targets, err := r.store.ListTargetsByStatus(ctx, models.TargetUpdating)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to list updating rollout targets")
+				continue
+			}
+			for _, t := range targets {
+				if time.Since(t.UpdatedAt) < rolloutTargetTimeout {
+					continue
+				}
+				r.setTarget(t.RolloutID, t.ServerID, models.TargetFailed,
+					fmt.Sprintf("agent did not report the new version within %s", rolloutTargetTimeout))
+				r.checkCompleted(ctx, t.RolloutID)
+			}
+		}
+	}
+}
+
+// checkCompleted completes an active rollout once all targets are done.
+func (r *Rollouts) checkCompleted(ctx context.Context, rolloutID string) {
+	rollout, err := r.store.GetRollout(ctx, rolloutID)
+	if err != nil || rollout == nil || rollout.Status != models.RolloutActive {
+		return
+	}
+	for _, t := range rollout.Targets {
+		if !t.Done() {
+			return
+		}
+	}
+	if err := r.store.SetRolloutStatus(ctx, rolloutID, models.RolloutCompleted, time.Now().UTC()); err != nil {
+		log.Error().Err(err).Str("rollout_id", rolloutID).Msg("failed to complete rollout")
+		return
+	}
+	log.Info().Str("rollout_id", rolloutID).Str("version", rollout.Version).Msg("rollout completed")
+}
+
+func (r *Rollouts) setTarget(rolloutID, serverID, status, errMsg string) {
+	if err := r.store.SetRolloutTargetStatus(context.Background(), rolloutID, serverID, status, errMsg, time.Now().UTC()); err != nil {
+		log.Error().Err(err).Str("rollout_id", rolloutID).Str("server_id", serverID).Msg("failed to update rollout target")
+	}
+}
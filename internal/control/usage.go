@@ -0,0 +1,251 @@
+package control
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// usageFlushInterval is how often accounted usage is written.
+const usageFlushInterval = 10 * time.Second
+
+// UsageStore persists peer usage.
+type UsageStore interface {
+	ListUsageCounters(ctx context.Context) ([]models.UsageCounter, error)
+	RecordUsage(ctx context.Context, counters []models.UsageCounter, days []models.UsageDay) error
+}
+
+// Usage accounts the data transferred by every peer from the growth of its
+// transfer counters, and rolls it up per day. A counter that went down was
+// reset, e.g. by an interface restart, and counts from zero. Usage is
+// attributed to the day the agent observed the counters, so reports that
+// arrive late land on the right day; reports older than the counters already
+// accounted are covered by those and skipped.
+type Usage struct {
+	store UsageStore
+
+	mu       sync.Mutex
+	counters map[[2]string]models.UsageCounter
+	// dirty and days hold what has not been written yet.
+	dirty map[[2]string]bool
+	days  map[usageDayKey]*models.UsageDay
+}
+
+type usageDayKey struct {
+	serverID, peer string
+	day            time.Time
+}
+
+// NewUsage loads the accounted counters and accounts the reports on bus. Run
+// writes the usage to store.
+func NewUsage(ctx context.Context, bus *EventBus, store UsageStore) (*Usage, error) {
+	list, err := store.ListUsageCounters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	u := &Usage{
+		store:    store,
+		counters: make(map[[2]string]models.UsageCounter, len(list)),
+		dirty:    make(map[[2]string]bool),
+		days:     make(map[usageDayKey]*models.UsageDay),
+	}
+	for _, c := range list {
+		u.counters[[2]string{c.ServerID, c.Peer}] = c
+	}
+	go u.listen(bus.Subscribe())
+	return u, nil
+}
+
+func (u *Usage) listen(ch <-chan models.StatusEvent) {
+	for event := range ch {
+		if event.Status == nil || event.StateChange != nil {
+			continue
+		}
+		u.account(event)
+	}
+}
+
+func (u *Usage) account(event models.StatusEvent) {
+	at := event.ObservedAt
+	if at.IsZero() {
+		at = event.Time
+	}
+	orgID := event.OrgID
+	if orgID == "" {
+		orgID = models.DefaultOrgID
+	}
+	day := at.UTC().Truncate(24 * time.Hour)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	// Deltas only carry the peers that changed.
+	for _, p := range event.Status.Peers {
+		key := [2]string{event.ServerID, p.Key()}
+		prev, ok := u.counters[key]
+		if ok && !at.After(prev.ObservedAt) {
+			continue
+		}
+		u.counters[key] = models.UsageCounter{
+			ServerID:      event.ServerID,
+			Peer:          p.Key(),
+			OrgID:         orgID,
+			PublicKey:     p.PublicKey,
+			ReceiveBytes:  p.ReceiveBytes,
+			TransmitBytes: p.TransmitBytes,
+			ObservedAt:    at,
+		}
+		u.dirty[key] = true
+		if !ok {
+			// The first counters seen are the baseline.
+			continue
+		}
+
+		rx, tx := growth(prev.ReceiveBytes, p.ReceiveBytes), growth(prev.TransmitBytes, p.TransmitBytes)
+		if rx == 0 && tx == 0 {
+			continue
+		}
+		dk := usageDayKey{serverID: event.ServerID, peer: p.Key(), day: day}
+		d, ok := u.days[dk]
+		if !ok {
+			d = &models.UsageDay{OrgID: orgID, ServerID: event.ServerID, Peer: p.Key(), PublicKey: p.PublicKey, Day: day}
+			u.days[dk] = d
+		}
+		d.ReceiveBytes += rx
+		d.TransmitBytes += tx
+	}
+}
+
+// growth returns how much a counter grew from prev to cur, counting from
+// zero if it was reset in between.
+func growth(prev, cur int64) int64 {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
+
+// Run writes accounted usage until ctx is cancelled, and once more before
+// it returns.
+func (u *Usage) Run(ctx context.Context) {
+	ticker := time.NewTicker(usageFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			u.flush(context.Background())
+			return
+		case <-ticker.C:
+			u.flush(ctx)
+		}
+	}
+}
+
+func (u *Usage) flush(ctx context.Context) {
+	u.mu.Lock()
+	counters := make([]models.UsageCounter, 0, len(u.dirty))
+	for key := range u.dirty {
+		counters = append(counters, u.counters[key])
+	}
+	days := make([]models.UsageDay, 0, len(u.days))
+	for _, d := range u.days {
+		days = append(days, *d)
+	}
+	pendingDirty, pendingDays := u.dirty, u.days
+	u.dirty, u.days = make(map[[2]string]bool), make(map[usageDayKey]*models.UsageDay)
+	u.mu.Unlock()
+
+	if len(counters) == 0 && len(days) == 0 {
+		return
+	}
+	if err := u.store.RecordUsage(ctx, counters, days); err != nil {
+		log.Error().Err(err).Msg("failed to store peer usage, retrying")
+		u.restore(pendingDirty, pendingDays)
+	}
+}
+
+// restore puts usage that could not be written back to be written with the
+// next flush.
+func (u *Usage) restore(dirty map[[2]string]bool, days map[usageDayKey]*models.UsageDay) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for key := range dirty {
+		u.dirty[key] = true
+	}
+	for key, d := range days {
+		if cur, ok := u.days[key]; ok {
+			cur.ReceiveBytes += d.ReceiveBytes
+			cur.TransmitBytes += d.TransmitBytes
+			continue
+		}
+		u.days[key] = d
+	}
+}
+
+// BillingPeriod returns the billing period containing t, which starts on
+// billingDay of a month (UTC).
+func BillingPeriod(t time.Time, billingDay int) (start, end time.Time) {
+	t = t.UTC()
+	start = time.Date(t.Year(), t.Month(), billingDay, 0, 0, 0, 0, time.UTC)
+	if t.Before(start) {
+		start = start.AddDate(0, -1, 0)
+	}
+	return start, start.AddDate(0, 1, 0)
+}
+
+// UsageReport sums up daily usage per period, by day or by billing period if
+// billingDay is set, and per grouping key.
+func UsageReport(days []models.UsageDay, by string, billingDay int) []models.UsageRecord {
+	type recordKey struct {
+		start time.Time
+		key   string
+	}
+	records := make(map[recordKey]*models.UsageRecord)
+	for _, d := range days {
+		start, end := d.Day, d.Day.AddDate(0, 0, 1)
+		if billingDay > 0 {
+			start, end = BillingPeriod(d.Day, billingDay)
+		}
+
+		var key string
+		switch by {
+		case models.UsageByUser:
+			key = d.User
+		case models.UsageByGroup:
+			key = d.Group
+		case models.UsageByProfile:
+			key = d.Profile
+		case models.UsageByServer:
+			key = d.ServerID
+		case models.UsageByOrg:
+			key = d.OrgID
+		default:
+			key = d.PublicKey
+		}
+
+		rk := recordKey{start: start, key: key}
+		r, ok := records[rk]
+		if !ok {
+			r = &models.UsageRecord{Key: key, PeriodStart: start, PeriodEnd: end}
+			records[rk] = r
+		}
+		r.ReceiveBytes += d.ReceiveBytes
+		r.TransmitBytes += d.TransmitBytes
+		r.TotalBytes += d.ReceiveBytes + d.TransmitBytes
+	}
+
+	list := make([]models.UsageRecord, 0, len(records))
+	for _, r := range records {
+		list = append(list, *r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].PeriodStart.Equal(list[j].PeriodStart) {
+			return list[i].PeriodStart.Before(list[j].PeriodStart)
+		}
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
@@ -0,0 +1,205 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+type fakeUsageStore struct {
+	counters []models.UsageCounter
+	// fail makes the next RecordUsage calls fail.
+	fail int
+	// recording runs while RecordUsage writes.
+	recording func()
+	recorded  []models.UsageDay
+	written   []models.UsageCounter
+}
+
+func (f *fakeUsageStore) ListUsageCounters(ctx context.Context) ([]models.UsageCounter, error) {
+	return f.counters, nil
+}
+
+func (f *fakeUsageStore) RecordUsage(ctx context.Context, counters []models.UsageCounter, days []models.UsageDay) error {
+	if f.recording != nil {
+		f.recording()
+	}
+	if f.fail > 0 {
+		f.fail--
+		return errors.New("database is locked")
+	}
+	f.written = append(f.written, counters...)
+	f.recorded = append(f.recorded, days...)
+	return nil
+}
+
+// usageReport is a report of the counters of peer "a" observed at.
+func usageReport(at time.Time, rx, tx int64) models.StatusEvent {
+	return models.StatusEvent{
+		ServerID:   "srv-1",
+		Status:     &models.Status{Peers: []models.Peer{{PublicKey: "a", ReceiveBytes: rx, TransmitBytes: tx}}},
+		ObservedAt: at,
+		Time:       at,
+	}
+}
+
+// usageDays sums the recorded usage per day as received and transmitted
+// bytes.
+func usageDays(days []models.UsageDay) map[string][2]int64 {
+	sums := make(map[string][2]int64)
+	for _, d := range days {
+		k := d.Day.Format(time.DateOnly)
+		sum := sums[k]
+		sums[k] = [2]int64{sum[0] + d.ReceiveBytes, sum[1] + d.TransmitBytes}
+	}
+	return sums
+}
+
+func TestUsageAccounting(t *testing.T) {
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	at := func(h, m int) time.Time { return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute) }
+	tests := []struct {
+		name string
+		// counters are the accounted counters loaded from the store.
+		counters []models.UsageCounter
+		reports  []models.StatusEvent
+		want     map[string][2]int64
+	}{
+		{
+			name:    "first counters are the baseline",
+			reports: []models.StatusEvent{usageReport(at(1, 0), 100, 10)},
+			want:    map[string][2]int64{},
+		},
+		{
+			name:    "growth is accounted",
+			reports: []models.StatusEvent{usageReport(at(1, 0), 100, 10), usageReport(at(1, 1), 150, 20), usageReport(at(1, 2), 400, 20)},
+			want:    map[string][2]int64{"2026-03-01": {300, 10}},
+		},
+		{
+			name:    "reset counter counts from zero",
+			reports: []models.StatusEvent{usageReport(at(1, 0), 100, 10), usageReport(at(1, 1), 150, 20), usageReport(at(1, 2), 30, 5)},
+			want:    map[string][2]int64{"2026-03-01": {80, 15}},
+		},
+		{
+			name:    "usage lands on the day it was observed",
+			reports: []models.StatusEvent{usageReport(at(23, 0), 100, 10), usageReport(at(23, 30), 150, 10), usageReport(at(24, 30), 250, 30)},
+			want:    map[string][2]int64{"2026-03-01": {50, 0}, "2026-03-02": {100, 20}},
+		},
+		{
+			name: "late report is accounted on its day",
+			reports: []models.StatusEvent{
+				usageReport(at(23, 0), 100, 10),
+				func() models.StatusEvent {
+					// Queued while the control plane was unreachable.
+					e := usageReport(at(23, 30), 150, 10)
+					e.Time = at(26, 0)
+					return e
+				}(),
+			},
+			want: map[string][2]int64{"2026-03-01": {50, 0}},
+		},
+		{
+			name:    "out of order report is skipped",
+			reports: []models.StatusEvent{usageReport(at(1, 0), 100, 10), usageReport(at(1, 2), 200, 10), usageReport(at(1, 1), 150, 10), usageReport(at(1, 3), 300, 10)},
+			want:    map[string][2]int64{"2026-03-01": {200, 0}},
+		},
+		{
+			name:    "repeated report is skipped",
+			reports: []models.StatusEvent{usageReport(at(1, 0), 100, 10), usageReport(at(1, 1), 150, 10), usageReport(at(1, 1), 150, 10)},
+			want:    map[string][2]int64{"2026-03-01": {50, 0}},
+		},
+		{
+			name: "report without observation time uses its time",
+			reports: []models.StatusEvent{
+				usageReport(at(1, 0), 100, 10),
+				func() models.StatusEvent {
+					e := usageReport(time.Time{}, 150, 10)
+					e.Time = at(25, 0)
+					return e
+				}(),
+			},
+			want: map[string][2]int64{"2026-03-02": {50, 0}},
+		},
+		{
+			name:     "stored counters are the baseline",
+			counters: []models.UsageCounter{{ServerID: "srv-1", Peer: "a", ReceiveBytes: 100, TransmitBytes: 10, ObservedAt: at(1, 0)}},
+			reports:  []models.StatusEvent{usageReport(at(1, 1), 150, 15)},
+			want:     map[string][2]int64{"2026-03-01": {50, 5}},
+		},
+		{
+			name:     "report older than the stored counters is skipped",
+			counters: []models.UsageCounter{{ServerID: "srv-1", Peer: "a", ReceiveBytes: 100, TransmitBytes: 10, ObservedAt: at(1, 0)}},
+			reports:  []models.StatusEvent{usageReport(at(0, 59), 90, 10), usageReport(at(1, 1), 150, 10)},
+			want:     map[string][2]int64{"2026-03-01": {50, 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := &fakeUsageStore{counters: tt.counters}
+			u, err := NewUsage(ctx, NewEventBus(), store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range tt.reports {
+				u.account(e)
+			}
+			u.flush(ctx)
+
+			got := usageDays(store.recorded)
+			if len(got) != len(tt.want) {
+				t.Fatalf("usage = %v, want %v", got, tt.want)
+			}
+			for k, want := range tt.want {
+				if got[k] != want {
+					t.Errorf("usage on %s = %v, want %v", k, got[k], want)
+				}
+			}
+		})
+	}
+}
+
+func TestUsageRestoredAfterFailedFlush(t *testing.T) {
+	ctx := context.Background()
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	store := &fakeUsageStore{fail: 1}
+	u, err := NewUsage(ctx, NewEventBus(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u.account(usageReport(day.Add(time.Hour), 100, 10))
+	u.account(usageReport(day.Add(2*time.Hour), 150, 20))
+	u.flush(ctx)
+	if len(store.recorded) != 0 || len(store.written) != 0 {
+		t.Fatalf("failed flush recorded %v", store.recorded)
+	}
+
+	// Usage accounted in the meantime is written together with the usage
+	// that could not be written, also while the write that fails is running.
+	u.account(usageReport(day.Add(3*time.Hour), 175, 20))
+	store.fail = 1
+	store.recording = func() {
+		store.recording = nil
+		u.account(usageReport(day.Add(4*time.Hour), 200, 25))
+	}
+	u.flush(ctx)
+	u.flush(ctx)
+	got := usageDays(store.recorded)
+	if want := [2]int64{100, 15}; len(got) != 1 || got["2026-03-01"] != want {
+		t.Errorf("usage = %v, want %v on 2026-03-01", got, want)
+	}
+	if len(store.written) != 1 || store.written[0].ReceiveBytes != 200 {
+		t.Errorf("counters written = %+v, want the last counters of the peer", store.written)
+	}
+
+	// Written usage is not written again.
+	store.recorded, store.written = nil, nil
+	u.flush(ctx)
+	if len(store.recorded) != 0 || len(store.written) != 0 {
+		t.Errorf("second flush recorded %v and %v", store.recorded, store.written)
+	}
+}
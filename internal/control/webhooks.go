@@ -0,0 +1,376 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/ChronoCoders/sentra/internal/version"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// webhookDeliveryInterval is how often due deliveries are looked for.
+	webhookDeliveryInterval = 5 * time.Second
+	// webhookPeerCheckInterval is how often peers are checked for having
+	// connected or disconnected.
+	webhookPeerCheckInterval = 10 * time.Second
+	webhookTimeout           = 10 * time.Second
+	webhookWorkers           = 4
+	webhookBatch             = 100
+	// A failed delivery is retried after webhookRetryBase, doubling up to
+	// webhookRetryMax, until it was attempted webhookMaxAttempts times.
+	webhookRetryBase   = 30 * time.Second
+	webhookRetryMax    = time.Hour
+	webhookMaxAttempts = 10
+	// Deliveries are kept for webhookRetention once they are done.
+	webhookRetention = 30 * 24 * time.Hour
+)
+
+// WebhookStore persists webhooks and their deliveries.
+type WebhookStore interface {
+	ListWebhooks(ctx context.Context, orgID string) ([]models.Webhook, error)
+	GetWebhook(ctx context.Context, orgID, id string) (*models.Webhook, error)
+	CreateWebhookDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) error
+	ListDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, d *models.WebhookDelivery, a *models.WebhookAttempt) error
+	DeleteWebhookDeliveries(ctx context.Context, before time.Time) error
+}
+
+// EventObserver is told about every event published to webhooks, whether
+// or not a webhook subscribed to it. It must not block.
+type EventObserver interface {
+	Event(ctx context.Context, orgID, eventType string, data any)
+}
+
+// Webhooks delivers events to the webhooks of the organization they happened
+// in. Every event is stored as a delivery per subscribed webhook before it is
+// POSTed, so deliveries survive restarts, and failed deliveries are retried
+// with exponential backoff.
+//
+// Deliveries are signed with the webhook's secret: the X-Sentra-Signature
+// header carries v1=, the hex HMAC-SHA256 of the X-Sentra-Timestamp header
+// (Unix seconds), a dot and the body.
+type Webhooks struct {
+	store  WebhookStore
+	client AgentClient
+	http   *http.Client
+	wake   chan struct{}
+
+	mu        sync.Mutex
+	observers []EventObserver
+
+	// peers holds the connected peers of every online server by key, once
+	// the server has been seen. It is only used by Run.
+	peers map[string]map[string]models.Peer
+}
+
+func NewWebhooks(bus *EventBus, store WebhookStore, client AgentClient) *Webhooks {
+	w := &Webhooks{
+		store:  store,
+		client: client,
+		http:   &http.Client{Timeout: webhookTimeout},
+		wake:   make(chan struct{}, 1),
+		peers:  make(map[string]map[string]models.Peer),
+	}
+	go w.listen(bus)
+	return w
+}
+
+// listen publishes servers going offline.
+func (w *Webhooks) listen(bus *EventBus) {
+	for event := range bus.Subscribe() {
+		if event.StateChange == nil || event.StateChange.To != models.StateOffline {
+			continue
+		}
+		orgID := event.OrgID
+		if orgID == "" {
+			orgID = models.DefaultOrgID
+		}
+		w.Publish(context.Background(), orgID, models.EventServerOffline, map[string]any{
+			"server_id":   event.ServerID,
+			"reported_at": event.Time.UTC(),
+		})
+	}
+}
+
+// Notify publishes alerts firing and resolving. It makes Webhooks a
+// notification channel.
+func (w *Webhooks) Notify(ctx context.Context, n models.Notification) error {
+	switch n.Kind {
+	case models.NotifyAlertFiring:
+		w.Publish(ctx, n.OrgID, models.EventAlertFired, n)
+	case models.NotifyAlertResolved:
+		w.Publish(ctx, n.OrgID, models.EventAlertResolved, n)
+	}
+	return nil
+}
+
+// Observe has o told about every event published from now on.
+func (w *Webhooks) Observe(o EventObserver) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.observers = append(w.observers, o)
+}
+
+// Publish queues an event for every enabled webhook of the organization that
+// subscribed to its type.
+func (w *Webhooks) Publish(ctx context.Context, orgID, eventType string, data any) {
+	w.mu.Lock()
+	observers := w.observers
+	w.mu.Unlock()
+	for _, o := range observers {
+		o.Event(ctx, orgID, eventType, data)
+	}
+
+	webhooks, err := w.store.ListWebhooks(ctx, orgID)
+	if err != nil {
+		log.Error().Err(err).Str("event", eventType).Msg("failed to list webhooks")
+		return
+	}
+	webhooks = slices.DeleteFunc(webhooks, func(wh models.Webhook) bool {
+		return !wh.Enabled || (len(wh.Events) > 0 && !slices.Contains(wh.Events, eventType))
+	})
+	if len(webhooks) == 0 {
+		return
+	}
+
+	now := time.Now().UTC()
+	envelope := models.WebhookEnvelope{
+		Version: models.WebhookVersion,
+		ID:      uuid.NewString(),
+		Type:    eventType,
+		OrgID:   orgID,
+		Time:    now,
+		Data:    data,
+	}
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		log.Error().Err(err).Str("event", eventType).Msg("failed to encode webhook event")
+		return
+	}
+	deliveries := make([]models.WebhookDelivery, len(webhooks))
+	for i, wh := range webhooks {
+		deliveries[i] = models.WebhookDelivery{
+			ID:            uuid.NewString(),
+			WebhookID:     wh.ID,
+			OrgID:         orgID,
+			EventID:       envelope.ID,
+			EventType:     eventType,
+			Payload:       payload,
+			State:         models.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		}
+	}
+	if err := w.store.CreateWebhookDeliveries(ctx, deliveries); err != nil {
+		log.Error().Err(err).Str("event", eventType).Msg("failed to queue webhook deliveries")
+		return
+	}
+	w.Check()
+}
+
+// Check has due deliveries made soon.
+func (w *Webhooks) Check() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run makes deliveries and watches peers until ctx is cancelled.
+func (w *Webhooks) Run(ctx context.Context) {
+	deliveries := time.NewTicker(webhookDeliveryInterval)
+	defer deliveries.Stop()
+	peers := time.NewTicker(webhookPeerCheckInterval)
+	defer peers.Stop()
+	var cleaned time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-peers.C:
+			w.checkPeers(ctx, now)
+			continue
+		case <-deliveries.C:
+		case <-w.wake:
+		}
+		now := time.Now()
+		w.deliver(ctx, now)
+		if now.Sub(cleaned) >= time.Hour {
+			cleaned = now
+			if err := w.store.DeleteWebhookDeliveries(ctx, now.Add(-webhookRetention)); err != nil {
+				log.Error().Err(err).Msg("failed to delete old webhook deliveries")
+			}
+		}
+	}
+}
+
+// checkPeers publishes the peers of online servers that connected or
+// disconnected since the last check. A peer is connected while its latest
+// handshake is recent.
+func (w *Webhooks) checkPeers(ctx context.Context, now time.Time) {
+	seen := make(map[string]bool)
+	for _, event := range w.client.GetAllStatuses() {
+		if event.State != models.StateOnline || event.Status == nil {
+			// What peers do is unknown until the server reports again.
+			continue
+		}
+		seen[event.ServerID] = true
+		orgID := event.OrgID
+		if orgID == "" {
+			orgID = models.DefaultOrgID
+		}
+		connected := make(map[string]models.Peer)
+		for _, p := range event.Status.Peers {
+			if !p.LatestHandshake.IsZero() && now.Sub(p.LatestHandshake) < peerConnectedWithin {
+				connected[p.Key()] = p
+			}
+		}
+		before, ok := w.peers[event.ServerID]
+		w.peers[event.ServerID] = connected
+		if !ok {
+			continue
+		}
+		for key, p := range connected {
+			if _, ok := before[key]; !ok {
+				w.Publish(ctx, orgID, models.EventPeerConnected, peerEventData(event.ServerID, p))
+			}
+		}
+		for key, p := range before {
+			if _, ok := connected[key]; !ok {
+				w.Publish(ctx, orgID, models.EventPeerDisconnected, peerEventData(event.ServerID, p))
+			}
+		}
+	}
+	for id := range w.peers {
+		if !seen[id] {
+			delete(w.peers, id)
+		}
+	}
+}
+
+func peerEventData(serverID string, p models.Peer) map[string]any {
+	return map[string]any{
+		"server_id":        serverID,
+		"interface":        p.Interface,
+		"public_key":       p.PublicKey,
+		"endpoint":         p.Endpoint,
+		"latest_handshake": p.LatestHandshake.UTC(),
+	}
+}
+
+// deliver makes the deliveries that are due, a few at a time.
+func (w *Webhooks) deliver(ctx context.Context, now time.Time) {
+	due, err := w.store.ListDueWebhookDeliveries(ctx, now, webhookBatch)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list due webhook deliveries")
+		return
+	}
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, webhookWorkers)
+	for i := range due {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(d *models.WebhookDelivery) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			w.attempt(ctx, d)
+		}(&due[i])
+	}
+	wg.Wait()
+}
+
+// attempt POSTs a delivery once and records the outcome.
+func (w *Webhooks) attempt(ctx context.Context, d *models.WebhookDelivery) {
+	start := time.Now()
+	a := models.WebhookAttempt{DeliveryID: d.ID, Time: start.UTC()}
+	wh, err := w.store.GetWebhook(ctx, "", d.WebhookID)
+	switch {
+	case err != nil:
+		log.Error().Err(err).Str("webhook_id", d.WebhookID).Msg("failed to get webhook")
+		return
+	case wh == nil:
+		// Removed along with its deliveries.
+		return
+	case !wh.Enabled:
+		a.Error = "webhook disabled"
+	default:
+		a.StatusCode, err = w.post(ctx, wh, d, start)
+		if err != nil {
+			a.Error = err.Error()
+		}
+	}
+	a.DurationMS = time.Since(start).Milliseconds()
+
+	d.Attempts++
+	switch {
+	case a.Error == "":
+		d.State = models.DeliverySucceeded
+	case d.Attempts >= webhookMaxAttempts || !wh.Enabled:
+		d.State = models.DeliveryFailed
+		log.Warn().Str("webhook_id", wh.ID).Str("delivery_id", d.ID).Str("error", a.Error).Msg("webhook delivery failed")
+	default:
+		d.NextAttemptAt = start.Add(webhookBackoff(d.Attempts))
+	}
+	if err := w.store.RecordWebhookAttempt(ctx, d, &a); err != nil {
+		log.Error().Err(err).Str("delivery_id", d.ID).Msg("failed to record webhook attempt")
+	}
+}
+
+// post sends a delivery and returns the response status.
+func (w *Webhooks) post(ctx context.Context, wh *models.Webhook, d *models.WebhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Sentra-Webhook/"+version.Version)
+	req.Header.Set("X-Sentra-Event", d.EventType)
+	req.Header.Set("X-Sentra-Delivery", d.ID)
+	req.Header.Set("X-Sentra-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Sentra-Signature", "v1="+signWebhook(wh.Secret, timestamp, d.Payload))
+
+	resp, err := w.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// signWebhook returns the hex HMAC-SHA256 a delivery of body at timestamp is
+// signed with.
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff returns how long to wait before retrying a delivery that
+// failed attempts times.
+func webhookBackoff(attempts int) time.Duration {
+	d := webhookRetryBase
+	for i := 1; i < attempts && d < webhookRetryMax; i++ {
+		d *= 2
+	}
+	return min(d, webhookRetryMax)
+}
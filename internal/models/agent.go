@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// JoinToken is a one-time secret an admin hands to a new agent so it can enroll.
+// Only the hash of the secret is stored.
+type JoinToken struct {
+	ID        string     `json:"id" db:"id"`
+	OrgID     string     `json:"org_id" db:"org_id"`
+	ServerID  string     `json:"server_id" db:"server_id"`
+	CreatedBy string     `json:"created_by" db:"created_by"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Agent is an enrolled agent. Each agent has its own credential and may only
+// report for the server it was enrolled for.
+type Agent struct {
+	ID       string `json:"id" db:"id"`
+	OrgID    string `json:"org_id" db:"org_id"`
+	ServerID string `json:"server_id" db:"server_id"`
+	Hostname string `json:"hostname" db:"hostname"`
+	// SigningKey is the base64 Ed25519 public key the agent signs reports with.
+	SigningKey string     `json:"signing_key,omitempty" db:"signing_key"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// AgentCertificate records a client certificate issued to an agent by the internal CA.
+type AgentCertificate struct {
+	Serial    string     `json:"serial" db:"serial"`
+	AgentID   string     `json:"agent_id" db:"agent_id"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// Security event kinds.
+const (
+	SecurityInvalidSignature = "invalid_signature"
+	SecurityMissingSignature = "missing_signature"
+	SecurityReplayedReport   = "replayed_report"
+	SecurityStaleReport      = "stale_report"
+)
+
+// SecurityEvent records a security relevant incident such as a report that
+// failed signature verification.
+type SecurityEvent struct {
+	ID         int64     `json:"id" db:"id"`
+	OrgID      string    `json:"org_id" db:"org_id"`
+	AgentID    string    `json:"agent_id" db:"agent_id"`
+	ServerID   string    `json:"server_id" db:"server_id"`
+	Kind       string    `json:"kind" db:"kind"`
+	Detail     string    `json:"detail" db:"detail"`
+	RemoteAddr string    `json:"remote_addr" db:"remote_addr"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Collectors an agent can enable.
+const (
+	CollectorWireGuard = "wireguard"
+	CollectorHost      = "host"
+	CollectorCPU       = "cpu"
+	CollectorMemory    = "memory"
+	CollectorDisk      = "disk"
+	CollectorLoad      = "load"
+	CollectorNetwork   = "network"
+)
+
+// Collectors lists all collectors, which agents enable by default.
+var Collectors = []string{
+	CollectorWireGuard, CollectorHost, CollectorCPU, CollectorMemory,
+	CollectorDisk, CollectorLoad, CollectorNetwork,
+}
+
+var logLevels = []string{"trace", "debug", "info", "warn", "error"}
+
+// Endpoint policies decide how agents redact peer endpoints before reporting.
+const (
+	// EndpointKeep reports endpoints as they are.
+	EndpointKeep = "keep"
+	// EndpointDrop reports no endpoints.
+	EndpointDrop = "drop"
+	// EndpointTruncate reports the /24 (IPv4) or /48 (IPv6) network of an endpoint.
+	EndpointTruncate = "truncate"
+	// EndpointHash reports a keyed hash of the endpoint address, salted per organization.
+	EndpointHash = "hash"
+	// EndpointCountry reports the ISO country code of the endpoint address
+	// from the agent's local GeoIP database.
+	EndpointCountry = "country"
+)
+
+// EndpointPolicies lists the endpoint policies.
+var EndpointPolicies = []string{EndpointKeep, EndpointDrop, EndpointTruncate, EndpointHash, EndpointCountry}
+
+// Agent config limits.
+const (
+	MinPollInterval = 1
+	MaxPollInterval = 3600
+)
+
+// AgentConfig is a remote agent configuration document. Empty fields are
+// inherited: a server's document overrides its group's, which overrides the
+// agent's local defaults.
+type AgentConfig struct {
+	// PollInterval is the report interval in seconds.
+	PollInterval int      `json:"poll_interval_seconds,omitempty"`
+	Collectors   []string `json:"collectors,omitempty"`
+	LogLevel     string   `json:"log_level,omitempty"`
+	// Interfaces are the WireGuard interfaces to monitor, the first is the primary one.
+	Interfaces []string `json:"interfaces,omitempty"`
+	// EndpointPolicy is one of EndpointPolicies.
+	EndpointPolicy string `json:"endpoint_policy,omitempty"`
+}
+
+// Merge returns c with the fields set in override replaced.
+func (c AgentConfig) Merge(override AgentConfig) AgentConfig {
+	if override.PollInterval != 0 {
+		c.PollInterval = override.PollInterval
+	}
+	if len(override.Collectors) > 0 {
+		c.Collectors = override.Collectors
+	}
+	if override.LogLevel != "" {
+		c.LogLevel = override.LogLevel
+	}
+	if len(override.Interfaces) > 0 {
+		c.Interfaces = override.Interfaces
+	}
+	if override.EndpointPolicy != "" {
+		c.EndpointPolicy = override.EndpointPolicy
+	}
+	return c
+}
+
+// Validate checks the values that are set.
+func (c AgentConfig) Validate() error {
+	if c.PollInterval != 0 && (c.PollInterval < MinPollInterval || c.PollInterval > MaxPollInterval) {
+		return fmt.Errorf("poll_interval_seconds must be between %d and %d", MinPollInterval, MaxPollInterval)
+	}
+	for _, name := range c.Collectors {
+		if !slices.Contains(Collectors, name) {
+			return fmt.Errorf("unknown collector %q", name)
+		}
+	}
+	if c.LogLevel != "" && !slices.Contains(logLevels, c.LogLevel) {
+		return fmt.Errorf("unknown log_level %q", c.LogLevel)
+	}
+	for _, iface := range c.Interfaces {
+		if iface == "" {
+			return fmt.Errorf("empty interface name")
+		}
+	}
+	if c.EndpointPolicy != "" && !slices.Contains(EndpointPolicies, c.EndpointPolicy) {
+		return fmt.Errorf("unknown endpoint_policy %q", c.EndpointPolicy)
+	}
+	return nil
+}
+
+// Version identifies the content of a configuration.
+func (c AgentConfig) Version() string {
+	data, _ := json.Marshal(c)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+// ConfigGroup is a configuration shared by the servers assigned to it.
+type ConfigGroup struct {
+	OrgID     string      `json:"org_id" db:"org_id"`
+	Name      string      `json:"name" db:"name"`
+	Config    AgentConfig `json:"config" db:"config"`
+	UpdatedAt time.Time   `json:"updated_at" db:"updated_at"`
+}
+
+// ServerConfig is the configuration of one server and its group assignment.
+type ServerConfig struct {
+	ServerID  string      `json:"server_id" db:"server_id"`
+	OrgID     string      `json:"org_id" db:"org_id"`
+	Group     string      `json:"group,omitempty" db:"group_name"`
+	Config    AgentConfig `json:"config" db:"config"`
+	UpdatedAt time.Time   `json:"updated_at" db:"updated_at"`
+}
+
+// ConfigUpdate is the payload of the config.apply command.
+type ConfigUpdate struct {
+	Version string      `json:"version"`
+	Config  AgentConfig `json:"config"`
+	// EndpointSalt is the organization's salt for the hash endpoint policy.
+	// It is only sent to agents.
+	EndpointSalt string `json:"endpoint_salt,omitempty"`
+}
@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// Kinds of alert rules.
+const (
+	// AlertServerOffline fires while a server is offline.
+	AlertServerOffline = "server_offline"
+	// AlertCPU, AlertMemory and AlertDisk fire while a server's usage is over
+	// Threshold percent.
+	AlertCPU    = "cpu_percent"
+	AlertMemory = "memory_percent"
+	AlertDisk   = "disk_percent"
+	// AlertHandshakeAge fires for every peer whose latest handshake is older
+	// than Window. Peers that never completed a handshake are left out.
+	AlertHandshakeAge = "peer_handshake_age"
+	// AlertPeerCountDrop fires while a server has at least Threshold fewer
+	// connected peers than it had at any time within Window.
+	AlertPeerCountDrop = "peer_count_drop"
+	// AlertCertExpiry fires while the client certificate of a server's agent
+	// expires within Window.
+	AlertCertExpiry = "cert_expiry"
+)
+
+// AlertKinds are the supported kinds of alert rules.
+var AlertKinds = []string{AlertServerOffline, AlertCPU, AlertMemory, AlertDisk, AlertHandshakeAge, AlertPeerCountDrop, AlertCertExpiry}
+
+// AlertRule describes a condition to alert on. An alert fires once the
+// condition held for For, and resolves when it no longer holds.
+type AlertRule struct {
+	Name      string        `yaml:"name" json:"name"`
+	Kind      string        `yaml:"kind" json:"kind"`
+	Severity  string        `yaml:"severity" json:"severity"`
+	Threshold float64       `yaml:"threshold,omitempty" json:"threshold,omitempty"`
+	Window    time.Duration `yaml:"window,omitempty" json:"window,omitempty"`
+	For       time.Duration `yaml:"for,omitempty" json:"for,omitempty"`
+	// Repeat is how often a firing alert is notified again until it is
+	// acknowledged, or zero to notify once.
+	Repeat time.Duration `yaml:"repeat,omitempty" json:"repeat,omitempty"`
+	// Servers limits the rule to some servers; empty for all.
+	Servers []string `yaml:"servers,omitempty" json:"servers,omitempty"`
+}
+
+// States of alerts.
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// Alert is a rule that fired for a server, or a peer of a server.
+type Alert struct {
+	ID        string  `json:"id"`
+	OrgID     string  `json:"org_id"`
+	Rule      string  `json:"rule"`
+	Kind      string  `json:"kind"`
+	Severity  string  `json:"severity"`
+	ServerID  string  `json:"server_id"`
+	PublicKey string  `json:"public_key,omitempty"`
+	State     string  `json:"state"`
+	Value     float64 `json:"value"`
+	Message   string  `json:"message"`
+	// StartedAt is when the condition started to hold, FiredAt when it had
+	// held for long enough.
+	StartedAt      time.Time  `json:"started_at"`
+	FiredAt        time.Time  `json:"fired_at"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string     `json:"acknowledged_by,omitempty"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+}
+
+// AlertFilter selects alerts from the history. Zero fields match all.
+type AlertFilter struct {
+	State    string
+	ServerID string
+	Severity string
+	From, To time.Time
+	Limit    int
+}
+
+// CertExpiry is when the newest client certificate of a server's agent
+// expires.
+type CertExpiry struct {
+	OrgID     string
+	ServerID  string
+	AgentID   string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Types of chat channels, by the incoming webhook format they post in.
+const (
+	ChatSlack      = "slack"
+	ChatMattermost = "mattermost"
+	ChatTeams      = "teams"
+)
+
+// ChatTypes are the supported chat channel types.
+var ChatTypes = []string{ChatSlack, ChatMattermost, ChatTeams}
+
+// ChatKinds are what chat channels can be routed: every notification kind
+// and the peer events.
+var ChatKinds = append(slices.Clone(NotifyKinds), EventPeerConnected, EventPeerDisconnected, EventPeerCreated, EventPeerRemoved)
+
+// ChatChannel posts notifications to the incoming webhook of a chat tool.
+// Its routing rules narrow down what is posted.
+type ChatChannel struct {
+	ID    string `json:"id"`
+	OrgID string `json:"org_id"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	// URL is the incoming webhook, which lets anyone post to the channel. It
+	// is only returned when the channel is created.
+	URL     string `json:"url,omitempty"`
+	Enabled bool   `json:"enabled"`
+	// MinSeverity is the least severe notification posted.
+	MinSeverity string `json:"min_severity"`
+	// Kinds are the notification kinds posted, empty for all.
+	Kinds []string `json:"kinds"`
+	// Servers are the servers whose notifications are posted, empty for all.
+	Servers   []string  `json:"servers"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Routes reports whether n is posted to the channel.
+func (c ChatChannel) Routes(n Notification) bool {
+	return c.Enabled && SeverityAtLeast(n.Severity, c.MinSeverity) &&
+		(len(c.Kinds) == 0 || slices.Contains(c.Kinds, n.Kind)) &&
+		(len(c.Servers) == 0 || slices.Contains(c.Servers, n.ServerID))
+}
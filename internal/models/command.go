@@ -0,0 +1,57 @@
+package models
+
+import "encoding/json"
+
+// Message types exchanged on the agent channel.
+const (
+	ChannelReport        = "report"
+	ChannelReportAck     = "report_ack"
+	ChannelCommand       = "command"
+	ChannelCommandResult = "command_result"
+)
+
+// Commands understood by agents.
+const (
+	CommandAddPeer    = "peer.add"
+	CommandRemovePeer = "peer.remove"
+	CommandUpdate     = "agent.update"
+	CommandConfig     = "config.apply"
+)
+
+// ChannelMessage is the envelope of every message sent over the persistent
+// agent channel. ID correlates a report with its acknowledgement and a command
+// with its result.
+type ChannelMessage struct {
+	Type      string           `json:"type"`
+	ID        string           `json:"id"`
+	Report    json.RawMessage  `json:"report,omitempty"`
+	Signature *ReportSignature `json:"signature,omitempty"`
+	Command   *Command         `json:"command,omitempty"`
+	Result    *CommandResult   `json:"result,omitempty"`
+	// Resync is set on a report acknowledgement when the control plane needs a full snapshot.
+	Resync bool   `json:"resync,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Command is an instruction sent from the control plane to an agent.
+type Command struct {
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// CommandResult is the agent's response to a Command.
+type CommandResult struct {
+	Error   string          `json:"error,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// PeerConfig describes a peer to add to or update on a WireGuard interface.
+type PeerConfig struct {
+	// Interface is the WireGuard interface, or empty for the agent's primary one.
+	Interface    string   `json:"interface,omitempty"`
+	PublicKey    string   `json:"public_key"`
+	PresharedKey string   `json:"preshared_key,omitempty"`
+	Endpoint     string   `json:"endpoint,omitempty"`
+	AllowedIPs   []string `json:"allowed_ips"`
+	KeepAlive    int      `json:"persistent_keepalive,omitempty"` // Interval in seconds
+}
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// Names of email templates.
+const (
+	// EmailNotification renders a single notification.
+	EmailNotification = "notification"
+	// EmailDigest renders the notifications batched up for a user.
+	EmailDigest = "digest"
+	// EmailInvitation invites someone to join an organization.
+	EmailInvitation = "invitation"
+)
+
+// EmailTemplateNames are the templates organizations can edit.
+var EmailTemplateNames = []string{EmailNotification, EmailDigest, EmailInvitation}
+
+// EmailTemplate renders an email. Subject and Text are text/template, HTML is
+// html/template source. Default marks a built-in template the organization
+// has not replaced.
+type EmailTemplate struct {
+	OrgID     string    `json:"org_id"`
+	Name      string    `json:"name"`
+	Subject   string    `json:"subject"`
+	Text      string    `json:"text"`
+	HTML      string    `json:"html"`
+	Default   bool      `json:"default"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// Invitation lets someone create a user in an organization with a single-use
+// token sent to their email address.
+type Invitation struct {
+	ID         string     `json:"id"`
+	OrgID      string     `json:"org_id"`
+	Email      string     `json:"email"`
+	Name       string     `json:"name,omitempty"`
+	Role       string     `json:"role"`
+	InvitedBy  string     `json:"invited_by"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+}
+
+// PeerExpiry is when a peer's access ends. Its organization is warned ahead
+// of time and told once it expired.
+type PeerExpiry struct {
+	OrgID     string     `json:"org_id"`
+	PublicKey string     `json:"public_key"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	WarnedAt  *time.Time `json:"warned_at,omitempty"`
+	ExpiredAt *time.Time `json:"expired_at,omitempty"`
+}
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// Agent capabilities.
+const (
+	CapabilityPeerManagement = "peer_management"
+	CapabilityMultiInterface = "multi_interface"
+	CapabilityFirewall       = "firewall"
+	CapabilitySystemMetrics  = "system_metrics"
+	CapabilitySelfUpdate     = "self_update"
+	CapabilityRemoteConfig   = "remote_config"
+)
+
+// commandCapabilities maps commands to the capability an agent needs to run them.
+var commandCapabilities = map[string]string{
+	CommandAddPeer:    CapabilityPeerManagement,
+	CommandRemovePeer: CapabilityPeerManagement,
+	CommandUpdate:     CapabilitySelfUpdate,
+	CommandConfig:     CapabilityRemoteConfig,
+}
+
+// CommandCapability returns the capability required by a command, or "".
+func CommandCapability(name string) string {
+	return commandCapabilities[name]
+}
+
+// AgentInfo describes the agent software. It is sent with full snapshots.
+type AgentInfo struct {
+	Version         string   `json:"version"`
+	ProtocolVersion int      `json:"protocol_version"`
+	Capabilities    []string `json:"capabilities"`
+	GoVersion       string   `json:"go_version"`
+	OS              string   `json:"os"`
+	Arch            string   `json:"arch"`
+	// ConfigVersion is the version of the applied remote configuration, empty
+	// if none was received. Config holds the effective values.
+	ConfigVersion string       `json:"config_version,omitempty"`
+	Config        *AgentConfig `json:"config,omitempty"`
+	// RolledBackFrom is set after the agent rolled back a failed update to this version.
+	RolledBackFrom string `json:"rolled_back_from,omitempty"`
+}
+
+// AgentInventory is the fleet inventory entry of a server's agent.
+type AgentInventory struct {
+	ServerID  string    `json:"server_id" db:"server_id"`
+	OrgID     string    `json:"org_id" db:"org_id"`
+	AgentID   string    `json:"agent_id" db:"agent_id"`
+	Hostname  string    `json:"hostname" db:"hostname"`
+	AgentInfo           // Stored as individual columns
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// HasCapability reports whether the agent announced capability.
+func (i *AgentInfo) HasCapability(capability string) bool {
+	for _, c := range i.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package models
+
+import "time"
+
+// Resolutions of stored metric samples in seconds. Raw samples are stored as
+// reported and downsampled into minute and hour samples.
+const (
+	ResolutionRaw    = 0
+	ResolutionMinute = 60
+	ResolutionHour   = 3600
+)
+
+// ServerSample is a sample of a server's system metrics. Gauges of
+// downsampled samples are averages, counters the highest value.
+type ServerSample struct {
+	ServerID      string    `json:"server_id"`
+	Time          time.Time `json:"time"`
+	CPUPercent    float64   `json:"cpu_percent"`
+	MemoryUsed    uint64    `json:"memory_used"`
+	MemoryPercent float64   `json:"memory_percent"`
+	DiskUsed      uint64    `json:"disk_used"`
+	DiskPercent   float64   `json:"disk_percent"`
+	LoadAverage   float64   `json:"load_average"`
+	NetBytesSent  uint64    `json:"net_bytes_sent"`
+	NetBytesRecv  uint64    `json:"net_bytes_recv"`
+}
+
+// PeerSample is a sample of a peer's transfer counters and handshake. Peers
+// are only sampled when one of them changed.
+type PeerSample struct {
+	ServerID        string    `json:"server_id"`
+	PeerKey         string    `json:"peer"` // See Peer.Key
+	Time            time.Time `json:"time"`
+	ReceiveBytes    int64     `json:"receive_bytes"`
+	TransmitBytes   int64     `json:"transmit_bytes"`
+	LatestHandshake time.Time `json:"latest_handshake"`
+}
+
+// Metrics that can be queried from the history of servers and peers.
+var (
+	ServerMetrics = []string{"cpu_percent", "memory_used", "memory_percent", "disk_used", "disk_percent",
+		"load_average", "net_bytes_sent", "net_bytes_recv"}
+	PeerMetrics = []string{"receive_bytes", "transmit_bytes", "latest_handshake"}
+)
+
+// MetricPoint aggregates the samples of one metric within a bucket starting
+// at Time.
+type MetricPoint struct {
+	Time   time.Time
+	Metric string
+	Min    float64
+	Avg    float64
+	Max    float64
+}
+
+// MetricSeries holds the aggregates of one metric for every bucket of a
+// MetricsResult. Buckets without samples are null.
+type MetricSeries struct {
+	Metric string     `json:"metric"`
+	Min    []*float64 `json:"min"`
+	Avg    []*float64 `json:"avg"`
+	Max    []*float64 `json:"max"`
+}
+
+// MetricsResult is the history of a server or peer, aligned on buckets of
+// Step seconds. Resolution is the tier the samples were read from.
+type MetricsResult struct {
+	ServerID   string         `json:"server_id"`
+	Peer       string         `json:"peer,omitempty"`
+	From       time.Time      `json:"from"`
+	To         time.Time      `json:"to"`
+	Step       int            `json:"step"`
+	Resolution int            `json:"resolution"`
+	Timestamps []time.Time    `json:"timestamps"`
+	Series     []MetricSeries `json:"series"`
+}
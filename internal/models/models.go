@@ -9,6 +9,10 @@ type Organization struct {
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
+// DefaultOrgID is the organization created on first start. Servers reported
+// without an organization, such as the built-in agent's, belong to it.
+const DefaultOrgID = "org1"
+
 // User represents an authenticated user.
 type User struct {
 	ID        string    `json:"id" db:"id"`
@@ -22,16 +26,26 @@ type User struct {
 
 // Server represents a VPN server (Control Plane).
 type Server struct {
-	ID        string    `json:"id" db:"id"`
-	OrgID     string    `json:"org_id" db:"org_id"`
-	Hostname  string    `json:"hostname" db:"hostname"`
-	PublicKey string    `json:"public_key" db:"public_key"`
-	Endpoint  string    `json:"endpoint" db:"endpoint"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID          string    `json:"id" db:"id"`
+	OrgID       string    `json:"org_id" db:"org_id"`
+	Hostname    string    `json:"hostname" db:"hostname"`
+	DisplayName string    `json:"display_name" db:"display_name"` // Editable, independent of ID
+	PublicKey   string    `json:"public_key" db:"public_key"`
+	Endpoint    string    `json:"endpoint" db:"endpoint"`
+	ListenPort  int       `json:"listen_port" db:"listen_port"`
+	Notes       string    `json:"notes" db:"notes"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	// LastSeen is when the server last reported, nil if it never did.
+	LastSeen *time.Time `json:"last_seen,omitempty" db:"last_seen"`
+	// DecommissionedAt is set once an admin retired the server.
+	DecommissionedAt *time.Time `json:"decommissioned_at,omitempty" db:"decommissioned_at"`
+	// State is the liveness state of the server. It is not stored.
+	State string `json:"state,omitempty" db:"-"`
 }
 
 // Peer represents a WireGuard client.
 type Peer struct {
+	Interface       string    `json:"interface,omitempty" db:"interface"`
 	PublicKey       string    `json:"public_key" db:"public_key"`
 	Endpoint        string    `json:"endpoint" db:"endpoint"`
 	AllowedIPs      []string  `json:"allowed_ips" db:"allowed_ips"`
@@ -62,11 +76,35 @@ type SystemInfo struct {
 	NetBytesRecv  uint64  `json:"net_bytes_recv"`
 }
 
+// Key identifies a peer within a status report. The same public key may be
+// configured on several interfaces.
+func (p Peer) Key() string {
+	if p.Interface == "" {
+		return p.PublicKey
+	}
+	return p.Interface + "/" + p.PublicKey
+}
+
+// InterfaceStatus describes one monitored WireGuard interface.
+type InterfaceStatus struct {
+	Name       string `json:"name"`
+	PublicKey  string `json:"public_key,omitempty"`
+	ListenPort int    `json:"listen_port,omitempty"`
+	PeerCount  int    `json:"peer_count"`
+	Error      string `json:"error,omitempty"`
+}
+
 // Status represents the current WireGuard interface status and system metrics.
+// Interface, PublicKey and ListenPort describe the primary interface; Peers
+// holds the peers of all monitored interfaces.
 type Status struct {
-	Interface  string     `json:"interface"`
-	PublicKey  string     `json:"public_key"`
-	ListenPort int        `json:"listen_port"`
-	Peers      []Peer     `json:"peers"`
-	System     SystemInfo `json:"system"`
+	Interface  string            `json:"interface"`
+	PublicKey  string            `json:"public_key"`
+	ListenPort int               `json:"listen_port"`
+	Interfaces []InterfaceStatus `json:"interfaces,omitempty"`
+	Peers      []Peer            `json:"peers"`
+	System     SystemInfo        `json:"system"`
+	// EndpointPolicy is the policy the agent redacted peer endpoints with,
+	// empty for agents that do not redact.
+	EndpointPolicy string `json:"endpoint_policy,omitempty"`
 }
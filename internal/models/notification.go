@@ -0,0 +1,83 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Severities of notifications.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Severities are the supported severities, from the least to the most severe.
+var Severities = []string{SeverityInfo, SeverityWarning, SeverityCritical}
+
+// Kinds of notifications.
+const (
+	NotifyQuotaWarning  = "quota.warning"
+	NotifyQuotaExceeded = "quota.exceeded"
+	NotifyQuotaResumed  = "quota.resumed"
+	NotifyAlertFiring   = "alert.firing"
+	NotifyAlertResolved = "alert.resolved"
+	NotifyPeerExpiring  = "peer.expiring"
+	NotifyPeerExpired   = "peer.expired"
+)
+
+// NotifyKinds are the kinds of notifications users can subscribe to.
+var NotifyKinds = []string{
+	NotifyQuotaWarning, NotifyQuotaExceeded, NotifyQuotaResumed,
+	NotifyAlertFiring, NotifyAlertResolved, NotifyPeerExpiring, NotifyPeerExpired,
+}
+
+// SeverityAtLeast reports whether severity is min or more severe. Unknown
+// severities count as the least severe.
+func SeverityAtLeast(severity, min string) bool {
+	return slices.Index(Severities, severity) >= slices.Index(Severities, min)
+}
+
+// Notification tells the people running an organization about something that
+// needs their attention.
+type Notification struct {
+	Kind      string    `json:"kind"`
+	OrgID     string    `json:"org_id"`
+	Severity  string    `json:"severity"`
+	Message   string    `json:"message"`
+	ServerID  string    `json:"server_id,omitempty"`
+	PublicKey string    `json:"public_key,omitempty"`
+	Time      time.Time `json:"time"`
+	// Data carries details specific to the kind.
+	Data map[string]any `json:"data,omitempty"`
+}
+
+// NotificationPreference is how a user wants to be notified. Users without
+// one get DefaultNotificationPreference.
+type NotificationPreference struct {
+	UserID string `json:"user_id"`
+	OrgID  string `json:"org_id"`
+	// Email turns email notifications on.
+	Email bool `json:"email"`
+	// MinSeverity is the least severe notification sent.
+	MinSeverity string `json:"min_severity"`
+	// Kinds are the notification kinds sent, empty for all.
+	Kinds []string `json:"kinds"`
+}
+
+// DefaultNotificationPreference returns the preference of a user that did
+// not set one: admins get warnings and worse by email.
+func DefaultNotificationPreference(u User) NotificationPreference {
+	return NotificationPreference{
+		UserID:      u.ID,
+		OrgID:       u.OrgID,
+		Email:       u.Role == "admin",
+		MinSeverity: SeverityWarning,
+		Kinds:       []string{},
+	}
+}
+
+// Allows reports whether n is sent to the user.
+func (p NotificationPreference) Allows(n Notification) bool {
+	return SeverityAtLeast(n.Severity, p.MinSeverity) && (len(p.Kinds) == 0 || slices.Contains(p.Kinds, n.Kind))
+}
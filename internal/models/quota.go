@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// Scopes of quotas. A group or profile quota applies to each of its peers
+// on its own.
+const (
+	QuotaScopePeer    = "peer"
+	QuotaScopeGroup   = "group"
+	QuotaScopeProfile = "profile"
+)
+
+// QuotaScopes are the supported quota scopes, from the most to the least
+// specific. A peer is held to the quota of the most specific scope it falls
+// under.
+var QuotaScopes = []string{QuotaScopePeer, QuotaScopeGroup, QuotaScopeProfile}
+
+// Actions taken when a peer uses up its quota.
+const (
+	QuotaActionSuspend = "suspend"
+	QuotaActionFlag    = "flag"
+)
+
+// DefaultQuotaWarnPercents are the warning thresholds of quotas that do not
+// set their own.
+var DefaultQuotaWarnPercents = []int{80, 90}
+
+// Quota caps the data, received and transmitted, a peer may transfer per
+// billing period. Target is a public key, group or profile name depending on
+// Scope.
+type Quota struct {
+	ID           string    `json:"id"`
+	OrgID        string    `json:"org_id"`
+	Scope        string    `json:"scope"`
+	Target       string    `json:"target"`
+	LimitBytes   int64     `json:"limit_bytes"`
+	WarnPercents []int     `json:"warn_percents"`
+	Action       string    `json:"action"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// QuotaOverride replaces the quota of a peer until it expires. A nil
+// LimitBytes lifts the quota.
+type QuotaOverride struct {
+	OrgID      string    `json:"org_id"`
+	PublicKey  string    `json:"public_key"`
+	LimitBytes *int64    `json:"limit_bytes"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// QuotaState is what has been done about a peer's quota in a billing period.
+type QuotaState struct {
+	OrgID         string
+	PublicKey     string
+	PeriodStart   time.Time
+	WarnedPercent int
+	ExceededAt    *time.Time
+}
+
+// PeerSuspension records a peer that was suspended on a server, with the
+// allowed IPs to restore when it is resumed.
+type PeerSuspension struct {
+	ServerID    string    `json:"server_id"`
+	Interface   string    `json:"interface,omitempty"`
+	PublicKey   string    `json:"public_key"`
+	OrgID       string    `json:"org_id"`
+	AllowedIPs  []string  `json:"allowed_ips"`
+	SuspendedAt time.Time `json:"suspended_at"`
+}
+
+// QuotaStatus is where a peer stands against its quota in the current
+// billing period.
+type QuotaStatus struct {
+	PublicKey   string           `json:"public_key"`
+	QuotaID     string           `json:"quota_id,omitempty"`
+	Override    *QuotaOverride   `json:"override,omitempty"`
+	Action      string           `json:"action"`
+	PeriodStart time.Time        `json:"period_start"`
+	PeriodEnd   time.Time        `json:"period_end"`
+	UsedBytes   int64            `json:"used_bytes"`
+	LimitBytes  *int64           `json:"limit_bytes"`
+	Percent     float64          `json:"percent"`
+	Exceeded    bool             `json:"exceeded"`
+	Suspensions []PeerSuspension `json:"suspensions,omitempty"`
+}
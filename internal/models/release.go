@@ -0,0 +1,86 @@
+package models
+
+import "time"
+
+// Release is an agent binary hosted by the control plane for one platform.
+// Signature is the base64 Ed25519 signature of the release made with the
+// offline release key; see signing.SignRelease.
+type Release struct {
+	ID        string    `json:"id" db:"id"`
+	Version   string    `json:"version" db:"version"`
+	OS        string    `json:"os" db:"os"`
+	Arch      string    `json:"arch" db:"arch"`
+	SHA256    string    `json:"sha256" db:"sha256"`
+	Signature string    `json:"signature" db:"signature"`
+	Size      int64     `json:"size" db:"size"`
+	CreatedBy string    `json:"created_by" db:"created_by"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Rollout states.
+const (
+	RolloutCanary    = "canary"
+	RolloutActive    = "active"
+	RolloutCompleted = "completed"
+	RolloutCancelled = "cancelled"
+)
+
+// Rollout moves a set of agents to a release version, first a canary group and
+// then, once promoted, everyone else.
+type Rollout struct {
+	ID        string          `json:"id" db:"id"`
+	OrgID     string          `json:"org_id" db:"org_id"`
+	Version   string          `json:"version" db:"version"`
+	Status    string          `json:"status" db:"status"`
+	CreatedBy string          `json:"created_by" db:"created_by"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at" db:"updated_at"`
+	Targets   []RolloutTarget `json:"targets,omitempty"`
+}
+
+// Rollout stages.
+const (
+	StageCanary  = "canary"
+	StageGeneral = "general"
+)
+
+// Rollout target states.
+const (
+	TargetPending    = "pending"
+	TargetUpdating   = "updating"
+	TargetSucceeded  = "succeeded"
+	TargetFailed     = "failed"
+	TargetRolledBack = "rolled_back"
+	TargetSkipped    = "skipped"
+	TargetCancelled  = "cancelled"
+)
+
+// RolloutTarget is the progress of one server's agent within a rollout.
+type RolloutTarget struct {
+	RolloutID   string    `json:"rollout_id" db:"rollout_id"`
+	ServerID    string    `json:"server_id" db:"server_id"`
+	Stage       string    `json:"stage" db:"stage"`
+	Status      string    `json:"status" db:"status"`
+	FromVersion string    `json:"from_version" db:"from_version"`
+	Error       string    `json:"error,omitempty" db:"error"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Done reports whether the target reached a final state.
+func (t *RolloutTarget) Done() bool {
+	switch t.Status {
+	case TargetPending, TargetUpdating:
+		return false
+	}
+	return true
+}
+
+// UpdateRequest is the payload of the agent.update command.
+type UpdateRequest struct {
+	RolloutID string `json:"rollout_id"`
+	Version   string `json:"version"`
+	// URL is the download path of the release, relative to the control URL.
+	URL       string `json:"url"`
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature"`
+}
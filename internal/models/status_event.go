@@ -2,9 +2,94 @@ package models
 
 import "time"
 
+// Well-known keys of StatusEvent.Attributes.
+const (
+	AttributeHostname  = "hostname"
+	AttributeMachineID = "machine_id"
+)
+
+// Liveness states of a server, derived from the time since its last report.
+const (
+	StateOnline  = "online"
+	StateStale   = "stale"
+	StateOffline = "offline"
+)
+
+// StateChange announces that a server moved to another liveness state.
+type StateChange struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+}
+
+// Liveness is what the control plane knows about the reports of a server.
+type Liveness struct {
+	State      string    `json:"state"`
+	ReportedAt time.Time `json:"reported_at"`
+}
+
 type StatusEvent struct {
 	ServerID string    `json:"server_id"`
 	OrgID    string    `json:"org_id"`
 	Status   *Status   `json:"status"`
 	Time     time.Time `json:"time"`
+
+	// AgentID is the stable identity of the reporting agent. Attributes describe
+	// the machine it runs on.
+	AgentID    string            `json:"agent_id,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// Agent describes the agent software. It is only sent with full snapshots.
+	Agent *AgentInfo `json:"agent,omitempty"`
+
+	// Seq increases by one with every report sent by an agent. Legacy agents leave it at zero.
+	Seq uint64 `json:"seq,omitempty"`
+	// Delta marks an incremental report: Status.Peers only carries peers that were
+	// added or changed since the previous report, and RemovedPeers lists the keys
+	// (see Peer.Key) of peers that disappeared. A report without Delta is a full snapshot.
+	Delta        bool     `json:"delta,omitempty"`
+	RemovedPeers []string `json:"removed_peers,omitempty"`
+
+	// RemoteAddr is the address the control plane received the report from.
+	// It is not part of the report and is empty for the built-in agent.
+	RemoteAddr string `json:"-"`
+	// ObservedAt is when the agent read the status, as opposed to Time, when
+	// the control plane received it. It is never later than Time.
+	ObservedAt time.Time `json:"-"`
+
+	// State is the liveness state of the server, set by the control plane on
+	// events it sends to dashboards.
+	State string `json:"state,omitempty"`
+	// StateChange marks an event that announces a liveness change instead of
+	// a report. It carries the last known status, and Time is the time of the
+	// last report.
+	StateChange *StateChange `json:"state_change,omitempty"`
+}
+
+// ReportSignature is an agent's Ed25519 signature over the canonical form of a
+// StatusEvent, bound to a timestamp and a single-use nonce.
+type ReportSignature struct {
+	Timestamp int64  `json:"timestamp"` // Unix seconds
+	Nonce     string `json:"nonce"`
+	Signature string `json:"signature"` // Base64
 }
+
+// IdentityConflict is raised when a report's agent identity does not match
+// the agent already known for a server.
+type IdentityConflict struct {
+	ID                int64             `json:"id"`
+	OrgID             string            `json:"org_id"`
+	ServerID          string            `json:"server_id"`
+	Kind              string            `json:"kind"`
+	KnownAgentID      string            `json:"known_agent_id"`
+	ClaimingAgentID   string            `json:"claiming_agent_id"`
+	KnownAttributes   map[string]string `json:"known_attributes,omitempty"`
+	ClaimedAttributes map[string]string `json:"claimed_attributes,omitempty"`
+	Time              time.Time         `json:"time"`
+}
+
+// Identity conflict kinds.
+const (
+	// ConflictServerID: two agents with different identities report for the same server.
+	ConflictServerID = "duplicate_server_id"
+	// ConflictMachine: one agent identity reports from two different machines.
+	ConflictMachine = "duplicate_identity"
+)
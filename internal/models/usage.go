@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// Groupings of usage reports.
+const (
+	UsageByPeer    = "peer"
+	UsageByUser    = "user"
+	UsageByGroup   = "group"
+	UsageByProfile = "profile"
+	UsageByServer  = "server"
+	UsageByOrg     = "org"
+)
+
+// UsageGroupings are the supported groupings of usage reports.
+var UsageGroupings = []string{UsageByPeer, UsageByUser, UsageByGroup, UsageByProfile, UsageByServer, UsageByOrg}
+
+// PeerOwner attributes the usage of a peer, identified by its public key
+// across servers, to a user and a group of an organization. Profile classifies
+// the peer, e.g. as a guest, for quotas.
+type PeerOwner struct {
+	OrgID     string `json:"org_id"`
+	PublicKey string `json:"public_key"`
+	User      string `json:"user"`
+	Group     string `json:"group"`
+	Profile   string `json:"profile"`
+}
+
+// UsageCounter holds the last transfer counters accounted for a peer of a
+// server (see Peer.Key).
+type UsageCounter struct {
+	ServerID      string
+	Peer          string
+	OrgID         string
+	PublicKey     string
+	ReceiveBytes  int64
+	TransmitBytes int64
+	ObservedAt    time.Time
+}
+
+// UsageDay is the data a peer of a server transferred on a day (UTC). User,
+// Group and Profile are filled in from the peer's owner when reading.
+type UsageDay struct {
+	OrgID         string
+	ServerID      string
+	Peer          string
+	PublicKey     string
+	Day           time.Time
+	ReceiveBytes  int64
+	TransmitBytes int64
+	User          string
+	Group         string
+	Profile       string
+}
+
+// UsageRecord is the data transferred within a period by the peers grouped
+// under Key.
+type UsageRecord struct {
+	Key           string    `json:"key"`
+	PeriodStart   time.Time `json:"period_start"`
+	PeriodEnd     time.Time `json:"period_end"`
+	ReceiveBytes  int64     `json:"receive_bytes"`
+	TransmitBytes int64     `json:"transmit_bytes"`
+	TotalBytes    int64     `json:"total_bytes"`
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Types of events delivered to webhooks.
+const (
+	EventPeerConnected    = "peer.connected"
+	EventPeerDisconnected = "peer.disconnected"
+	EventPeerCreated      = "peer.created"
+	EventPeerRemoved      = "peer.removed"
+	EventServerOffline    = "server.offline"
+	EventAlertFired       = "alert.fired"
+	EventAlertResolved    = "alert.resolved"
+)
+
+// WebhookEvents are the event types webhooks can subscribe to.
+var WebhookEvents = []string{
+	EventPeerConnected, EventPeerDisconnected, EventPeerCreated, EventPeerRemoved,
+	EventServerOffline, EventAlertFired, EventAlertResolved,
+}
+
+// WebhookVersion is the version of the envelope events are delivered in.
+const WebhookVersion = "1"
+
+// Webhook is an endpoint of an organization that events are POSTed to.
+type Webhook struct {
+	ID    string `json:"id"`
+	OrgID string `json:"org_id"`
+	URL   string `json:"url"`
+	// Secret signs deliveries. It is only returned when the webhook is
+	// created or given a new secret.
+	Secret string `json:"secret,omitempty"`
+	// Events are the event types delivered, empty for all.
+	Events    []string  `json:"events"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookEnvelope is the body of every delivery.
+type WebhookEnvelope struct {
+	Version string    `json:"version"`
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	OrgID   string    `json:"org_id"`
+	Time    time.Time `json:"time"`
+	Data    any       `json:"data"`
+}
+
+// States of webhook deliveries.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is an event to be delivered to a webhook. Pending
+// deliveries are retried at NextAttemptAt until they succeed or run out of
+// attempts.
+type WebhookDelivery struct {
+	ID            string          `json:"id"`
+	WebhookID     string          `json:"webhook_id"`
+	OrgID         string          `json:"org_id"`
+	EventID       string          `json:"event_id"`
+	EventType     string          `json:"event_type"`
+	Payload       json.RawMessage `json:"payload"`
+	State         string          `json:"state"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+	// AttemptLog lists the attempts made, oldest first. It is only filled in
+	// for a single delivery.
+	AttemptLog []WebhookAttempt `json:"attempt_log,omitempty"`
+}
+
+// WebhookAttempt is one try at a delivery. StatusCode is zero when no
+// response was received.
+type WebhookAttempt struct {
+	DeliveryID string    `json:"delivery_id"`
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+}
@@ -0,0 +1,105 @@
+// Package natsbus carries the agent protocol over NATS. Every agent has its
+// own subjects, scoped by organization and server:
+//
+//	sentra.<org>.<server>.status    reports, kept in a JetStream stream until acknowledged
+//	sentra.<org>.<server>.hello     published by the agent whenever it connects
+//	sentra.<org>.<server>.resync    the control plane needs a full snapshot
+//	sentra.<org>.<server>.commands  command requests answered by the agent
+//
+// Messages are the protobuf messages of package agentpb.
+package natsbus
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Subject kinds.
+const (
+	KindStatus   = "status"
+	KindHello    = "hello"
+	KindResync   = "resync"
+	KindCommands = "commands"
+)
+
+const (
+	subjectPrefix = "sentra"
+
+	// StreamName is the JetStream stream holding agent reports.
+	StreamName = "SENTRA_REPORTS"
+	// ConsumerName is the durable consumer the control plane reads reports with.
+	ConsumerName = "control"
+	// AgentHeader carries the ID of the agent that published a message.
+	AgentHeader = "Sentra-Agent"
+)
+
+// Subject returns the subject of kind for a server of an organization.
+func Subject(orgID, serverID, kind string) string {
+	return subjectPrefix + "." + encodeToken(orgID) + "." + encodeToken(serverID) + "." + kind
+}
+
+// AllServers returns the subject matching kind for every server.
+func AllServers(kind string) string {
+	return subjectPrefix + ".*.*." + kind
+}
+
+// ParseSubject splits a subject built by Subject.
+func ParseSubject(subject string) (orgID, serverID, kind string, ok bool) {
+	parts := strings.Split(subject, ".")
+	if len(parts) != 4 || parts[0] != subjectPrefix {
+		return "", "", "", false
+	}
+	orgID, ok1 := decodeToken(parts[1])
+	serverID, ok2 := decodeToken(parts[2])
+	if !ok1 || !ok2 {
+		return "", "", "", false
+	}
+	return orgID, serverID, parts[3], true
+}
+
+// InboxPrefix is the prefix of an agent's reply subjects. Agents may only
+// subscribe below their own prefix.
+func InboxPrefix(agentID string) string {
+	return "_INBOX." + encodeToken(agentID)
+}
+
+// IDs are used as subject tokens as is if they only contain safe characters,
+// anything else (e.g. the dots of a hostname) is base64 encoded behind a '~'.
+func encodeToken(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_')
+	}) < 0 {
+		return s
+	}
+	return "~" + base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func decodeToken(token string) (string, bool) {
+	encoded, ok := strings.CutPrefix(token, "~")
+	if !ok {
+		return token, token != ""
+	}
+	s, err := base64.RawURLEncoding.DecodeString(encoded)
+	return string(s), err == nil
+}
+
+// EnsureStream creates or updates the report stream. Reports are removed once
+// the control plane acknowledged them, or after maxAge, when their signature
+// would be rejected as stale anyway.
+func EnsureStream(ctx context.Context, js jetstream.JetStream, maxAge time.Duration) (jetstream.Stream, error) {
+	return js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:      StreamName,
+		Subjects:  []string{AllServers(KindStatus)},
+		Retention: jetstream.WorkQueuePolicy,
+		Storage:   jetstream.FileStorage,
+		Discard:   jetstream.DiscardOld,
+		MaxAge:    maxAge,
+		// An agent that cannot reach the control plane for long only needs
+		// its latest reports to catch up.
+		MaxMsgsPerSubject: 100,
+	})
+}
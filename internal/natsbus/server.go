@@ -0,0 +1,127 @@
+package natsbus
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/auth"
+	"github.com/ChronoCoders/sentra/internal/models"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+)
+
+// AuthFunc identifies a connecting agent by its client certificate or its
+// credential. It returns nil if neither belongs to an enrolled agent.
+type AuthFunc func(state *tls.ConnectionState, credential string) (*models.Agent, error)
+
+// ServerConfig configures an embedded NATS server.
+type ServerConfig struct {
+	// Host and Port the server accepts agents on. Without a port the server
+	// only accepts in-process connections.
+	Host string
+	Port int
+	// StoreDir holds the JetStream data. Empty uses a temporary directory.
+	StoreDir  string
+	TLSConfig *tls.Config
+	Auth      AuthFunc
+}
+
+// Server is a NATS server embedded in the control plane.
+type Server struct {
+	ns    *server.Server
+	token string
+}
+
+// StartServer starts an embedded NATS server with JetStream and waits until
+// it accepts connections.
+func StartServer(cfg ServerConfig) (*Server, error) {
+	if cfg.Auth == nil {
+		return nil, errors.New("nats server requires an agent authenticator")
+	}
+	// The control plane connects with a credential of its own.
+	token, err := auth.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &server.Options{
+		ServerName:                 "sentra-control",
+		Host:                       cfg.Host,
+		Port:                       cfg.Port,
+		DontListen:                 cfg.Port == 0,
+		JetStream:                  true,
+		StoreDir:                   cfg.StoreDir,
+		TLSConfig:                  cfg.TLSConfig,
+		NoSigs:                     true,
+		NoLog:                      true,
+		CustomClientAuthentication: &authenticator{token: token, auth: cfg.Auth},
+	}
+	if opts.Host == "" {
+		opts.Host = "0.0.0.0"
+	}
+	ns, err := server.NewServer(opts)
+	if err != nil {
+		return nil, err
+	}
+	ns.Start()
+	if !ns.ReadyForConnections(10 * time.Second) {
+		ns.Shutdown()
+		return nil, errors.New("nats server did not start")
+	}
+	return &Server{ns: ns, token: token}, nil
+}
+
+// Connect returns an in-process connection allowed to use every subject.
+func (s *Server) Connect(opts ...nats.Option) (*nats.Conn, error) {
+	opts = append(opts, nats.InProcessServer(s.ns), nats.Token(s.token), nats.Name("sentra-control"))
+	return nats.Connect("", opts...)
+}
+
+// Shutdown stops the server.
+func (s *Server) Shutdown() {
+	s.ns.Shutdown()
+	s.ns.WaitForShutdown()
+}
+
+type authenticator struct {
+	token string
+	auth  AuthFunc
+}
+
+func (a *authenticator) Check(c server.ClientAuthentication) bool {
+	credential := c.GetOpts().Token
+	if subtle.ConstantTimeCompare([]byte(credential), []byte(a.token)) == 1 {
+		c.RegisterUser(&server.User{Username: "control"})
+		return true
+	}
+
+	agent, err := a.auth(c.GetTLSConnectionState(), credential)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to authenticate NATS client")
+		return false
+	}
+	if agent == nil {
+		log.Warn().Str("remote_addr", c.RemoteAddress().String()).Msg("NATS client rejected")
+		return false
+	}
+	c.RegisterUser(&server.User{Username: agent.ID, Permissions: AgentPermissions(agent)})
+	return true
+}
+
+// AgentPermissions limits an agent to its own subjects and reply inbox.
+func AgentPermissions(agent *models.Agent) *server.Permissions {
+	subject := func(kind string) string { return Subject(agent.OrgID, agent.ServerID, kind) }
+	return &server.Permissions{
+		Publish: &server.SubjectPermission{
+			Allow: []string{subject(KindStatus), subject(KindHello)},
+		},
+		Subscribe: &server.SubjectPermission{
+			Allow: []string{subject(KindResync), subject(KindCommands), InboxPrefix(agent.ID) + ".>"},
+		},
+		// Allows answering command requests.
+		Response: &server.ResponsePermission{MaxMsgs: 1, Expires: time.Minute},
+	}
+}
@@ -0,0 +1,37 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const releasePrefix = "sentra-release-v1\n"
+
+var ErrInvalidReleaseSignature = errors.New("invalid release signature")
+
+// ReleaseCanonical returns the bytes that are signed for an agent release. The
+// version and platform are bound to the checksum so a signed binary cannot be
+// offered as a different version.
+func ReleaseCanonical(version, goos, goarch, sha256Hex string) []byte {
+	return []byte(releasePrefix + version + "\n" + goos + "\n" + goarch + "\n" + strings.ToLower(sha256Hex))
+}
+
+// SignRelease signs a release with the release key.
+func SignRelease(key ed25519.PrivateKey, version, goos, goarch, sha256Hex string) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, ReleaseCanonical(version, goos, goarch, sha256Hex)))
+}
+
+// VerifyRelease checks a release signature against the release public key.
+func VerifyRelease(pub ed25519.PublicKey, version, goos, goarch, sha256Hex, signature string) error {
+	raw, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || signature == "" {
+		return fmt.Errorf("%w: malformed signature", ErrInvalidReleaseSignature)
+	}
+	if !ed25519.Verify(pub, ReleaseCanonical(version, goos, goarch, sha256Hex), raw) {
+		return fmt.Errorf("%w: signature mismatch", ErrInvalidReleaseSignature)
+	}
+	return nil
+}
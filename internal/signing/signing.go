@@ -0,0 +1,79 @@
+// Package signing signs and verifies agent status reports.
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+const canonicalPrefix = "sentra-report-v2\n"
+
+var ErrInvalidSignature = errors.New("invalid report signature")
+
+// Canonical returns the bytes that are signed for a report: a version prefix,
+// the timestamp, the nonce and the report payload exactly as it is sent.
+// Signing the payload rather than a re-encoding of the decoded event keeps
+// signatures valid when agent and control plane versions differ.
+func Canonical(payload []byte, timestamp int64, nonce string) []byte {
+	buf := make([]byte, 0, len(canonicalPrefix)+len(payload)+64)
+	buf = append(buf, canonicalPrefix...)
+	buf = strconv.AppendInt(buf, timestamp, 10)
+	buf = append(buf, '\n')
+	buf = append(buf, nonce...)
+	buf = append(buf, '\n')
+	return append(buf, payload...)
+}
+
+// Sign signs a report payload with a fresh nonce and the current time.
+func Sign(key ed25519.PrivateKey, payload []byte) (*models.ReportSignature, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sig := &models.ReportSignature{
+		Timestamp: time.Now().Unix(),
+		Nonce:     base64.RawURLEncoding.EncodeToString(nonce),
+	}
+	sig.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, Canonical(payload, sig.Timestamp, sig.Nonce)))
+	return sig, nil
+}
+
+// Verify checks sig against a report payload and pub. It does not check
+// freshness or replays; see control.ReplayGuard.
+func Verify(pub ed25519.PublicKey, payload []byte, sig *models.ReportSignature) error {
+	if sig == nil || sig.Nonce == "" || sig.Signature == "" {
+		return fmt.Errorf("%w: missing signature", ErrInvalidSignature)
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: malformed signature", ErrInvalidSignature)
+	}
+	if !ed25519.Verify(pub, Canonical(payload, sig.Timestamp, sig.Nonce), raw) {
+		return fmt.Errorf("%w: signature mismatch", ErrInvalidSignature)
+	}
+	return nil
+}
+
+// EncodePublicKey returns the base64 form in which public keys are exchanged.
+func EncodePublicKey(pub ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(pub)
+}
+
+// DecodePublicKey parses a base64 encoded Ed25519 public key.
+func DecodePublicKey(s string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid ed25519 public key length")
+	}
+	return ed25519.PublicKey(raw), nil
+}
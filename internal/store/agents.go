@@ -0,0 +1,262 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+// ErrInvalidJoinToken is returned when a join token is unknown, expired or already used.
+var ErrInvalidJoinToken = errors.New("invalid or expired join token")
+
+// ErrForeignServer is returned when a server ID is taken by another
+// organization.
+var ErrForeignServer = errors.New("server belongs to another organization")
+
+func (s *Store) CreateJoinToken(ctx context.Context, t *models.JoinToken, tokenHash string) error {
+	query := `INSERT INTO join_tokens (id, token_hash, org_id, server_id, created_by, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, t.ID, tokenHash, t.OrgID, t.ServerID, t.CreatedBy, t.ExpiresAt, t.CreatedAt)
+	return err
+}
+
+func (s *Store) ListJoinTokens(ctx context.Context, orgID string) ([]models.JoinToken, error) {
+	query := `SELECT id, org_id, server_id, created_by, expires_at, used_at, created_at FROM join_tokens WHERE org_id = ? ORDER BY created_at DESC`
+	rows, err := s.db.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []models.JoinToken{}
+	for rows.Next() {
+		var t models.JoinToken
+		var usedAt sql.NullTime
+		if err := rows.Scan(&t.ID, &t.OrgID, &t.ServerID, &t.CreatedBy, &t.ExpiresAt, &usedAt, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		if usedAt.Valid {
+			t.UsedAt = &usedAt.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *Store) DeleteJoinToken(ctx context.Context, orgID, id string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM join_tokens WHERE id = ? AND org_id = ?`, id, orgID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// EnrollAgent consumes a join token and creates an agent bound to the token's
+// server in a single transaction. The server record is created if needed; a
+// server of another organization fails with ErrForeignServer.
+func (s *Store) EnrollAgent(ctx context.Context, tokenHash string, a *models.Agent, credentialHash string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var t models.JoinToken
+	var usedAt sql.NullTime
+	row := tx.QueryRowContext(ctx, `SELECT id, org_id, server_id, expires_at, used_at FROM join_tokens WHERE token_hash = ?`, tokenHash)
+	if err := row.Scan(&t.ID, &t.OrgID, &t.ServerID, &t.ExpiresAt, &usedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrInvalidJoinToken
+		}
+		return err
+	}
+	if usedAt.Valid || !a.CreatedAt.Before(t.ExpiresAt) {
+		return ErrInvalidJoinToken
+	}
+
+	res, err := tx.ExecContext(ctx, `UPDATE join_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL`, a.CreatedAt, t.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return ErrInvalidJoinToken
+	}
+
+	a.OrgID = t.OrgID
+	a.ServerID = t.ServerID
+
+	var serverOrgID string
+	err = tx.QueryRowContext(ctx, `SELECT org_id FROM servers WHERE id = ?`, a.ServerID).Scan(&serverOrgID)
+	switch {
+	case err == sql.ErrNoRows:
+		serverQuery := `INSERT INTO servers (id, org_id, hostname) VALUES (?, ?, ?)`
+		if _, err := tx.ExecContext(ctx, serverQuery, a.ServerID, a.OrgID, a.Hostname); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case serverOrgID != a.OrgID:
+		return ErrForeignServer
+	}
+
+	agentQuery := `INSERT INTO agents (id, org_id, server_id, credential_hash, hostname, signing_key, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	if _, err := tx.ExecContext(ctx, agentQuery, a.ID, a.OrgID, a.ServerID, credentialHash, a.Hostname, a.SigningKey, a.CreatedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAgentByCredential returns the agent owning the credential hash, or nil.
+func (s *Store) GetAgentByCredential(ctx context.Context, credentialHash string) (*models.Agent, error) {
+	query := `SELECT id, org_id, server_id, hostname, signing_key, created_at, revoked_at FROM agents WHERE credential_hash = ?`
+	return scanAgent(s.db.QueryRowContext(ctx, query, credentialHash))
+}
+
+func (s *Store) GetAgent(ctx context.Context, id string) (*models.Agent, error) {
+	query := `SELECT id, org_id, server_id, hostname, signing_key, created_at, revoked_at FROM agents WHERE id = ?`
+	return scanAgent(s.db.QueryRowContext(ctx, query, id))
+}
+
+func (s *Store) ListAgents(ctx context.Context, orgID string) ([]models.Agent, error) {
+	query := `SELECT id, org_id, server_id, hostname, signing_key, created_at, revoked_at FROM agents WHERE org_id = ? ORDER BY created_at`
+	rows, err := s.db.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	agents := []models.Agent{}
+	for rows.Next() {
+		a, err := scanAgent(rows)
+		if err != nil {
+			return nil, err
+		}
+		agents = append(agents, *a)
+	}
+	return agents, rows.Err()
+}
+
+// RevokeAgent marks a single agent and all of its certificates as revoked.
+// Other agents, even for the same server, are not affected.
+func (s *Store) RevokeAgent(ctx context.Context, orgID, id string, at time.Time) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE agents SET revoked_at = ? WHERE id = ? AND org_id = ? AND revoked_at IS NULL`, at, id, orgID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE agent_certificates SET revoked_at = ? WHERE agent_id = ? AND revoked_at IS NULL`, at, id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// ServerHasAgent reports whether an agent that is not revoked is enrolled for
+// the server with the given ID.
+func (s *Store) ServerHasAgent(ctx context.Context, serverID string) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM agents WHERE server_id = ? AND revoked_at IS NULL`, serverID).Scan(&n)
+	return n > 0, err
+}
+
+// SetAgentSigningKey registers the signing key of an agent that enrolled
+// without one. An existing key is never replaced.
+func (s *Store) SetAgentSigningKey(ctx context.Context, id, key string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE agents SET signing_key = ? WHERE id = ? AND (signing_key IS NULL OR signing_key = '')`, key, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) AddAgentCertificate(ctx context.Context, c *models.AgentCertificate) error {
+	query := `INSERT INTO agent_certificates (serial, agent_id, expires_at, created_at) VALUES (?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, c.Serial, c.AgentID, c.ExpiresAt, c.CreatedAt)
+	return err
+}
+
+// GetAgentCertificate returns the issued certificate with the given serial, or nil.
+func (s *Store) GetAgentCertificate(ctx context.Context, serial string) (*models.AgentCertificate, error) {
+	query := `SELECT serial, agent_id, expires_at, created_at, revoked_at FROM agent_certificates WHERE serial = ?`
+	c := &models.AgentCertificate{}
+	var revokedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, query, serial).Scan(&c.Serial, &c.AgentID, &c.ExpiresAt, &c.CreatedAt, &revokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if revokedAt.Valid {
+		c.RevokedAt = &revokedAt.Time
+	}
+	return c, nil
+}
+
+// RevokeAgentCertificates revokes all certificates of an agent except the one
+// with keepSerial. It is used after a renewal so old certificates stop working.
+func (s *Store) RevokeAgentCertificates(ctx context.Context, agentID, keepSerial string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE agent_certificates SET revoked_at = ? WHERE agent_id = ? AND serial != ? AND revoked_at IS NULL`, at, agentID, keepSerial)
+	return err
+}
+
+// ListRevokedCertificates returns revoked certificates that have not expired yet.
+func (s *Store) ListRevokedCertificates(ctx context.Context, now time.Time) ([]models.AgentCertificate, error) {
+	query := `SELECT serial, agent_id, expires_at, created_at, revoked_at FROM agent_certificates WHERE revoked_at IS NOT NULL`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	certs := []models.AgentCertificate{}
+	for rows.Next() {
+		var c models.AgentCertificate
+		var revokedAt sql.NullTime
+		if err := rows.Scan(&c.Serial, &c.AgentID, &c.ExpiresAt, &c.CreatedAt, &revokedAt); err != nil {
+			return nil, err
+		}
+		if !c.ExpiresAt.After(now) {
+			continue
+		}
+		c.RevokedAt = &revokedAt.Time
+		certs = append(certs, c)
+	}
+	return certs, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAgent(row rowScanner) (*models.Agent, error) {
+	a := &models.Agent{}
+	var hostname, signingKey sql.NullString
+	var revokedAt sql.NullTime
+	if err := row.Scan(&a.ID, &a.OrgID, &a.ServerID, &hostname, &signingKey, &a.CreatedAt, &revokedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	a.Hostname = hostname.String
+	a.SigningKey = signingKey.String
+	if revokedAt.Valid {
+		a.RevokedAt = &revokedAt.Time
+	}
+	return a, nil
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+const alertColumns = `id, org_id, rule, kind, severity, server_id, public_key, value, message,
+	started_at, fired_at, acknowledged_at, acknowledged_by, resolved_at`
+
+func scanAlert(row rowScanner) (*models.Alert, error) {
+	var a models.Alert
+	var acknowledgedAt, resolvedAt sql.NullTime
+	if err := row.Scan(&a.ID, &a.OrgID, &a.Rule, &a.Kind, &a.Severity, &a.ServerID, &a.PublicKey, &a.Value, &a.Message,
+		&a.StartedAt, &a.FiredAt, &acknowledgedAt, &a.AcknowledgedBy, &resolvedAt); err != nil {
+		return nil, err
+	}
+	a.State = models.AlertFiring
+	if acknowledgedAt.Valid {
+		a.AcknowledgedAt = &acknowledgedAt.Time
+	}
+	if resolvedAt.Valid {
+		a.ResolvedAt = &resolvedAt.Time
+		a.State = models.AlertResolved
+	}
+	return &a, nil
+}
+
+func (s *Store) listAlerts(ctx context.Context, where string, args ...any) ([]models.Alert, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+alertColumns+` FROM alerts `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []models.Alert{}
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, *a)
+	}
+	return alerts, rows.Err()
+}
+
+func (s *Store) CreateAlert(ctx context.Context, a *models.Alert) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO alerts (`+alertColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.ID, a.OrgID, a.Rule, a.Kind, a.Severity, a.ServerID, a.PublicKey, a.Value, a.Message,
+		a.StartedAt, a.FiredAt, a.AcknowledgedAt, a.AcknowledgedBy, a.ResolvedAt)
+	return err
+}
+
+func (s *Store) GetAlert(ctx context.Context, orgID, id string) (*models.Alert, error) {
+	a, err := scanAlert(s.db.QueryRowContext(ctx, `SELECT `+alertColumns+` FROM alerts WHERE org_id = ? AND id = ?`, orgID, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return a, err
+}
+
+// ListAlerts returns the alerts of an organization that match filter, the
+// most recently fired first.
+func (s *Store) ListAlerts(ctx context.Context, orgID string, filter models.AlertFilter) ([]models.Alert, error) {
+	where := `WHERE org_id = ?`
+	args := []any{orgID}
+	switch filter.State {
+	case models.AlertFiring:
+		where += ` AND resolved_at IS NULL`
+	case models.AlertResolved:
+		where += ` AND resolved_at IS NOT NULL`
+	}
+	if filter.ServerID != "" {
+		where += ` AND server_id = ?`
+		args = append(args, filter.ServerID)
+	}
+	if filter.Severity != "" {
+		where += ` AND severity = ?`
+		args = append(args, filter.Severity)
+	}
+	if !filter.From.IsZero() {
+		where += ` AND fired_at >= ?`
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		where += ` AND fired_at < ?`
+		args = append(args, filter.To.UTC())
+	}
+	where += ` ORDER BY fired_at DESC`
+	if filter.Limit > 0 {
+		where += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+	return s.listAlerts(ctx, where, args...)
+}
+
+// ListActiveAlerts returns the alerts of every organization that have not
+// resolved.
+func (s *Store) ListActiveAlerts(ctx context.Context) ([]models.Alert, error) {
+	return s.listAlerts(ctx, `WHERE resolved_at IS NULL ORDER BY fired_at`)
+}
+
+// ResolveAlert marks an alert resolved at at.
+func (s *Store) ResolveAlert(ctx context.Context, id string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE alerts SET resolved_at = ? WHERE id = ? AND resolved_at IS NULL`, at.UTC(), id)
+	return err
+}
+
+// AcknowledgeAlert records that by took note of an alert. Acknowledging it
+// again keeps the first acknowledgement.
+func (s *Store) AcknowledgeAlert(ctx context.Context, orgID, id, by string, at time.Time) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE alerts SET acknowledged_at = COALESCE(acknowledged_at, ?),
+		acknowledged_by = CASE WHEN acknowledged_at IS NULL THEN ? ELSE acknowledged_by END
+		WHERE org_id = ? AND id = ?`, at.UTC(), by, orgID, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ListCertificateExpiries returns when the newest unrevoked certificate of
+// every active agent expires.
+func (s *Store) ListCertificateExpiries(ctx context.Context) ([]models.CertExpiry, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT a.org_id, a.server_id, a.id, c.expires_at
+		FROM agents a JOIN agent_certificates c ON c.agent_id = a.id
+		WHERE a.revoked_at IS NULL AND c.revoked_at IS NULL
+		ORDER BY a.id, c.expires_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	expiries := []models.CertExpiry{}
+	for rows.Next() {
+		var e models.CertExpiry
+		if err := rows.Scan(&e.OrgID, &e.ServerID, &e.AgentID, &e.ExpiresAt); err != nil {
+			return nil, err
+		}
+		if n := len(expiries); n > 0 && expiries[n-1].AgentID == e.AgentID {
+			continue
+		}
+		expiries = append(expiries, e)
+	}
+	return expiries, rows.Err()
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+const chatChannelColumns = `id, org_id, name, type, url, enabled, min_severity, kinds, servers, created_at`
+
+func scanChatChannel(row rowScanner) (*models.ChatChannel, error) {
+	var c models.ChatChannel
+	var kinds, servers string
+	if err := row.Scan(&c.ID, &c.OrgID, &c.Name, &c.Type, &c.URL, &c.Enabled, &c.MinSeverity, &kinds, &servers, &c.CreatedAt); err != nil {
+		return nil, err
+	}
+	c.Kinds, c.Servers = []string{}, []string{}
+	if kinds != "" {
+		c.Kinds = strings.Split(kinds, ",")
+	}
+	if servers != "" {
+		c.Servers = strings.Split(servers, ",")
+	}
+	return &c, nil
+}
+
+func (s *Store) ListChatChannels(ctx context.Context, orgID string) ([]models.ChatChannel, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+chatChannelColumns+` FROM chat_channels WHERE org_id = ? ORDER BY name`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels := []models.ChatChannel{}
+	for rows.Next() {
+		c, err := scanChatChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, *c)
+	}
+	return channels, rows.Err()
+}
+
+func (s *Store) GetChatChannel(ctx context.Context, orgID, id string) (*models.ChatChannel, error) {
+	c, err := scanChatChannel(s.db.QueryRowContext(ctx, `SELECT `+chatChannelColumns+` FROM chat_channels WHERE org_id = ? AND id = ?`, orgID, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return c, err
+}
+
+func (s *Store) CreateChatChannel(ctx context.Context, c *models.ChatChannel) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO chat_channels (`+chatChannelColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.ID, c.OrgID, c.Name, c.Type, c.URL, c.Enabled, c.MinSeverity, strings.Join(c.Kinds, ","), strings.Join(c.Servers, ","), c.CreatedAt)
+	return err
+}
+
+// UpdateChatChannel changes everything about a channel but when it was
+// created.
+func (s *Store) UpdateChatChannel(ctx context.Context, c *models.ChatChannel) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE chat_channels SET name = ?, type = ?, url = ?, enabled = ?, min_severity = ?, kinds = ?, servers = ?
+		WHERE org_id = ? AND id = ?`,
+		c.Name, c.Type, c.URL, c.Enabled, c.MinSeverity, strings.Join(c.Kinds, ","), strings.Join(c.Servers, ","), c.OrgID, c.ID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) DeleteChatChannel(ctx context.Context, orgID, id string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM chat_channels WHERE org_id = ? AND id = ?`, orgID, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+func (s *Store) ListConfigGroups(ctx context.Context, orgID string) ([]models.ConfigGroup, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT org_id, name, config, updated_at FROM config_groups WHERE org_id = ? ORDER BY name`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []models.ConfigGroup{}
+	for rows.Next() {
+		var g models.ConfigGroup
+		var config string
+		if err := rows.Scan(&g.OrgID, &g.Name, &config, &g.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(config), &g.Config); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+func (s *Store) GetConfigGroup(ctx context.Context, orgID, name string) (*models.ConfigGroup, error) {
+	var g models.ConfigGroup
+	var config string
+	row := s.db.QueryRowContext(ctx, `SELECT org_id, name, config, updated_at FROM config_groups WHERE org_id = ? AND name = ?`, orgID, name)
+	if err := row.Scan(&g.OrgID, &g.Name, &config, &g.UpdatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(config), &g.Config); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (s *Store) UpsertConfigGroup(ctx context.Context, g *models.ConfigGroup) error {
+	config, err := json.Marshal(g.Config)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO config_groups (org_id, name, config, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(org_id, name) DO UPDATE SET config = excluded.config, updated_at = excluded.updated_at`
+	_, err = s.db.ExecContext(ctx, query, g.OrgID, g.Name, string(config), g.UpdatedAt)
+	return err
+}
+
+func (s *Store) DeleteConfigGroup(ctx context.Context, orgID, name string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM config_groups WHERE org_id = ? AND name = ?`, orgID, name)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) GetServerConfig(ctx context.Context, serverID string) (*models.ServerConfig, error) {
+	configs, err := s.listServerConfigs(ctx, `WHERE server_id = ?`, serverID)
+	if err != nil || len(configs) == 0 {
+		return nil, err
+	}
+	return &configs[0], nil
+}
+
+func (s *Store) ListServerConfigs(ctx context.Context, orgID string) ([]models.ServerConfig, error) {
+	return s.listServerConfigs(ctx, `WHERE org_id = ? ORDER BY server_id`, orgID)
+}
+
+// ListServerConfigsInGroup returns the servers assigned to a group.
+func (s *Store) ListServerConfigsInGroup(ctx context.Context, orgID, group string) ([]models.ServerConfig, error) {
+	return s.listServerConfigs(ctx, `WHERE org_id = ? AND group_name = ? ORDER BY server_id`, orgID, group)
+}
+
+func (s *Store) listServerConfigs(ctx context.Context, where string, args ...any) ([]models.ServerConfig, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT server_id, org_id, group_name, config, updated_at FROM server_configs `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	configs := []models.ServerConfig{}
+	for rows.Next() {
+		var c models.ServerConfig
+		var group sql.NullString
+		var config string
+		if err := rows.Scan(&c.ServerID, &c.OrgID, &group, &config, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		c.Group = group.String
+		if err := json.Unmarshal([]byte(config), &c.Config); err != nil {
+			return nil, err
+		}
+		configs = append(configs, c)
+	}
+	return configs, rows.Err()
+}
+
+func (s *Store) UpsertServerConfig(ctx context.Context, c *models.ServerConfig) error {
+	config, err := json.Marshal(c.Config)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO server_configs (server_id, org_id, group_name, config, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(server_id) DO UPDATE SET org_id = excluded.org_id, group_name = excluded.group_name, config = excluded.config, updated_at = excluded.updated_at`
+	_, err = s.db.ExecContext(ctx, query, c.ServerID, c.OrgID, c.Group, string(config), c.UpdatedAt)
+	return err
+}
+
+// EndpointSalt returns the salt agents of an organization hash peer endpoints
+// with, creating it on first use.
+func (s *Store) EndpointSalt(ctx context.Context, orgID string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	if _, err := s.db.ExecContext(ctx, `INSERT INTO endpoint_salts (org_id, salt) VALUES (?, ?) ON CONFLICT(org_id) DO NOTHING`,
+		orgID, base64.RawURLEncoding.EncodeToString(b)); err != nil {
+		return "", err
+	}
+	var salt string
+	err := s.db.QueryRowContext(ctx, `SELECT salt FROM endpoint_salts WHERE org_id = ?`, orgID).Scan(&salt)
+	return salt, err
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+func (s *Store) UpsertAgentInventory(ctx context.Context, inv *models.AgentInventory) error {
+	var config []byte
+	if inv.Config != nil {
+		var err error
+		if config, err = json.Marshal(inv.Config); err != nil {
+			return err
+		}
+	}
+	query := `INSERT INTO agent_inventory (server_id, org_id, agent_id, hostname, version, protocol_version, capabilities, go_version, os, arch, config_version, config, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(server_id) DO UPDATE SET
+			org_id = excluded.org_id,
+			agent_id = excluded.agent_id,
+			hostname = excluded.hostname,
+			version = excluded.version,
+			protocol_version = excluded.protocol_version,
+			capabilities = excluded.capabilities,
+			go_version = excluded.go_version,
+			os = excluded.os,
+			arch = excluded.arch,
+			config_version = excluded.config_version,
+			config = excluded.config,
+			updated_at = excluded.updated_at`
+	_, err := s.db.ExecContext(ctx, query,
+		inv.ServerID, inv.OrgID, inv.AgentID, inv.Hostname, inv.Version, inv.ProtocolVersion,
+		strings.Join(inv.Capabilities, ","), inv.GoVersion, inv.OS, inv.Arch, inv.ConfigVersion, string(config), inv.UpdatedAt)
+	return err
+}
+
+// ListAgentInventory returns the inventory of all servers.
+func (s *Store) ListAgentInventory(ctx context.Context) ([]models.AgentInventory, error) {
+	query := `SELECT server_id, org_id, agent_id, hostname, version, protocol_version, capabilities, go_version, os, arch, config_version, config, updated_at FROM agent_inventory ORDER BY server_id`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	inventory := []models.AgentInventory{}
+	for rows.Next() {
+		var inv models.AgentInventory
+		var orgID, agentID, hostname, capabilities, configVersion, config sql.NullString
+		if err := rows.Scan(&inv.ServerID, &orgID, &agentID, &hostname, &inv.Version, &inv.ProtocolVersion,
+			&capabilities, &inv.GoVersion, &inv.OS, &inv.Arch, &configVersion, &config, &inv.UpdatedAt); err != nil {
+			return nil, err
+		}
+		inv.OrgID, inv.AgentID, inv.Hostname = orgID.String, agentID.String, hostname.String
+		inv.ConfigVersion = configVersion.String
+		if config.String != "" {
+			inv.Config = &models.AgentConfig{}
+			if err := json.Unmarshal([]byte(config.String), inv.Config); err != nil {
+				return nil, err
+			}
+		}
+		inv.Capabilities = []string{}
+		if capabilities.String != "" {
+			inv.Capabilities = strings.Split(capabilities.String, ",")
+		}
+		inventory = append(inventory, inv)
+	}
+	return inventory, rows.Err()
+}
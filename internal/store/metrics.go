@@ -0,0 +1,229 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+// Metric samples refer to their server or peer through metric_series and keep
+// timestamps as Unix seconds, which keeps a year of samples compact.
+
+// InsertMetricSamples stores a batch of raw samples in one transaction.
+func (s *Store) InsertMetricSamples(ctx context.Context, servers []models.ServerSample, peers []models.PeerSample) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	series := make(map[[2]string]int64)
+	seriesID := func(serverID, peerKey string) (int64, error) {
+		key := [2]string{serverID, peerKey}
+		if id, ok := series[key]; ok {
+			return id, nil
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO metric_series (server_id, peer_key) VALUES (?, ?) ON CONFLICT DO NOTHING`, serverID, peerKey)
+		if err != nil {
+			return 0, err
+		}
+		var id int64
+		err = tx.QueryRowContext(ctx, `SELECT id FROM metric_series WHERE server_id = ? AND peer_key = ?`, serverID, peerKey).Scan(&id)
+		series[key] = id
+		return id, err
+	}
+
+	serverStmt, err := tx.PrepareContext(ctx, `INSERT OR REPLACE INTO server_metrics
+		(series_id, resolution, ts, cpu_percent, memory_used, memory_percent, disk_used, disk_percent, load_average, net_bytes_sent, net_bytes_recv)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer serverStmt.Close()
+	for _, m := range servers {
+		id, err := seriesID(m.ServerID, "")
+		if err != nil {
+			return err
+		}
+		_, err = serverStmt.ExecContext(ctx, id, models.ResolutionRaw, m.Time.Unix(), m.CPUPercent, int64(m.MemoryUsed), m.MemoryPercent,
+			int64(m.DiskUsed), m.DiskPercent, m.LoadAverage, int64(m.NetBytesSent), int64(m.NetBytesRecv))
+		if err != nil {
+			return err
+		}
+	}
+
+	peerStmt, err := tx.PrepareContext(ctx, `INSERT OR REPLACE INTO peer_metrics
+		(series_id, resolution, ts, receive_bytes, transmit_bytes, latest_handshake) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer peerStmt.Close()
+	for _, m := range peers {
+		id, err := seriesID(m.ServerID, m.PeerKey)
+		if err != nil {
+			return err
+		}
+		_, err = peerStmt.ExecContext(ctx, id, models.ResolutionRaw, m.Time.Unix(), m.ReceiveBytes, m.TransmitBytes, unixOrZero(m.LatestHandshake))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DownsampleMetrics aggregates the samples of resolution from in [start, end)
+// into samples of resolution to. Buckets that were aggregated before are
+// replaced.
+func (s *Store) DownsampleMetrics(ctx context.Context, from, to int, start, end time.Time) error {
+	if to <= from {
+		return fmt.Errorf("cannot downsample resolution %d into %d", from, to)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	args := []any{to, to, to, from, start.Unix(), end.Unix(), to}
+	_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO server_metrics
+		(series_id, resolution, ts, cpu_percent, memory_used, memory_percent, disk_used, disk_percent, load_average, net_bytes_sent, net_bytes_recv)
+		SELECT m.series_id, ?, m.ts / ? * ?, AVG(m.cpu_percent), CAST(AVG(m.memory_used) AS INTEGER), AVG(m.memory_percent),
+			CAST(AVG(m.disk_used) AS INTEGER), AVG(m.disk_percent), AVG(m.load_average), MAX(m.net_bytes_sent), MAX(m.net_bytes_recv)
+		FROM metric_series s JOIN server_metrics m ON m.series_id = s.id
+		WHERE m.resolution = ? AND m.ts >= ? AND m.ts < ?
+		GROUP BY m.series_id, m.ts / ?`, args...)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO peer_metrics
+		(series_id, resolution, ts, receive_bytes, transmit_bytes, latest_handshake)
+		SELECT m.series_id, ?, m.ts / ? * ?, MAX(m.receive_bytes), MAX(m.transmit_bytes), MAX(m.latest_handshake)
+		FROM metric_series s JOIN peer_metrics m ON m.series_id = s.id
+		WHERE m.resolution = ? AND m.ts >= ? AND m.ts < ?
+		GROUP BY m.series_id, m.ts / ?`, args...)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// LatestMetricTime returns the time of the newest sample of resolution, or the
+// zero time if there is none.
+func (s *Store) LatestMetricTime(ctx context.Context, resolution int) (time.Time, error) {
+	var ts sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `SELECT MAX(ts) FROM (
+		SELECT MAX(ts) AS ts FROM server_metrics WHERE resolution = ?
+		UNION ALL SELECT MAX(ts) FROM peer_metrics WHERE resolution = ?)`, resolution, resolution).Scan(&ts)
+	if err != nil || !ts.Valid {
+		return time.Time{}, err
+	}
+	return time.Unix(ts.Int64, 0).UTC(), nil
+}
+
+// PruneMetrics deletes the samples of resolution taken before cutoff.
+func (s *Store) PruneMetrics(ctx context.Context, resolution int, cutoff time.Time) (int64, error) {
+	var deleted int64
+	for _, table := range []string{"server_metrics", "peer_metrics"} {
+		// Selecting the series lets SQLite use the primary key.
+		res, err := s.db.ExecContext(ctx, `DELETE FROM `+table+`
+			WHERE series_id IN (SELECT id FROM metric_series) AND resolution = ? AND ts < ?`, resolution, cutoff.Unix())
+		if err != nil {
+			return deleted, err
+		}
+		n, _ := res.RowsAffected()
+		deleted += n
+	}
+	return deleted, nil
+}
+
+// QueryServerMetrics aggregates the samples of a server at resolution taken
+// in [from, to) into buckets of step seconds.
+func (s *Store) QueryServerMetrics(ctx context.Context, serverID string, resolution int, from, to time.Time, step int, metrics []string) ([]models.MetricPoint, error) {
+	return s.queryMetrics(ctx, "server_metrics", models.ServerMetrics, `s.server_id = ? AND s.peer_key = ''`, []any{serverID},
+		resolution, from, to, step, metrics)
+}
+
+// QueryPeerMetrics is QueryServerMetrics for a peer of a server. Without an
+// interface, samples of the public key on every interface are aggregated.
+func (s *Store) QueryPeerMetrics(ctx context.Context, serverID, iface, publicKey string, resolution int, from, to time.Time, step int, metrics []string) ([]models.MetricPoint, error) {
+	match, args := `s.server_id = ? AND (s.peer_key = ? OR s.peer_key LIKE ?)`, []any{serverID, publicKey, "%/" + publicKey}
+	if iface != "" {
+		match, args = `s.server_id = ? AND s.peer_key = ?`, []any{serverID, models.Peer{Interface: iface, PublicKey: publicKey}.Key()}
+	}
+	return s.queryMetrics(ctx, "peer_metrics", models.PeerMetrics, match, args, resolution, from, to, step, metrics)
+}
+
+func (s *Store) queryMetrics(ctx context.Context, table string, known []string, match string, args []any,
+	resolution int, from, to time.Time, step int, metrics []string) ([]models.MetricPoint, error) {
+	if step <= 0 {
+		return nil, fmt.Errorf("invalid step %d", step)
+	}
+	var cols []string
+	for _, metric := range metrics {
+		if !slices.Contains(known, metric) {
+			return nil, fmt.Errorf("unknown metric %q", metric)
+		}
+		col := "m." + metric
+		if metric == "latest_handshake" {
+			// Peers without a handshake report zero.
+			col = "NULLIF(" + col + ", 0)"
+		}
+		cols = append(cols, fmt.Sprintf("MIN(%[1]s), AVG(%[1]s), MAX(%[1]s)", col))
+	}
+	if len(cols) == 0 {
+		return nil, nil
+	}
+
+	query := `SELECT m.ts / ? * ? AS bucket, ` + strings.Join(cols, ", ") + `
+		FROM metric_series s JOIN ` + table + ` m ON m.series_id = s.id
+		WHERE ` + match + ` AND m.resolution = ? AND m.ts >= ? AND m.ts < ?
+		GROUP BY bucket ORDER BY bucket`
+	args = append([]any{step, step}, args...)
+	args = append(args, resolution, from.Unix(), to.Unix())
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []models.MetricPoint{}
+	values := make([]sql.NullFloat64, 3*len(metrics))
+	dest := make([]any, 1+len(values))
+	var bucket int64
+	dest[0] = &bucket
+	for i := range values {
+		dest[i+1] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		for i, metric := range metrics {
+			lo, avg, hi := values[3*i], values[3*i+1], values[3*i+2]
+			if !avg.Valid {
+				continue
+			}
+			points = append(points, models.MetricPoint{
+				Time:   time.Unix(bucket, 0).UTC(),
+				Metric: metric,
+				Min:    lo.Float64,
+				Avg:    avg.Float64,
+				Max:    hi.Float64,
+			})
+		}
+	}
+	return points, rows.Err()
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
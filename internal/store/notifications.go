@@ -0,0 +1,275 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+// ErrInvalidInvitation is returned when an invitation token is unknown,
+// expired or already used.
+var ErrInvalidInvitation = errors.New("invalid or expired invitation")
+
+// ErrUserExists is returned when an invitation is accepted for an email
+// address that already has a user.
+var ErrUserExists = errors.New("user already exists")
+
+// ListEmailTemplates returns the templates an organization replaced.
+func (s *Store) ListEmailTemplates(ctx context.Context, orgID string) ([]models.EmailTemplate, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT org_id, name, subject, text_body, html_body, updated_at FROM email_templates
+		WHERE org_id = ? ORDER BY name`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []models.EmailTemplate{}
+	for rows.Next() {
+		var t models.EmailTemplate
+		if err := rows.Scan(&t.OrgID, &t.Name, &t.Subject, &t.Text, &t.HTML, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
+
+// GetEmailTemplate returns the template an organization replaced, or nil.
+func (s *Store) GetEmailTemplate(ctx context.Context, orgID, name string) (*models.EmailTemplate, error) {
+	var t models.EmailTemplate
+	err := s.db.QueryRowContext(ctx, `SELECT org_id, name, subject, text_body, html_body, updated_at FROM email_templates
+		WHERE org_id = ? AND name = ?`, orgID, name).Scan(&t.OrgID, &t.Name, &t.Subject, &t.Text, &t.HTML, &t.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *Store) SetEmailTemplate(ctx context.Context, t *models.EmailTemplate) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO email_templates (org_id, name, subject, text_body, html_body, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(org_id, name) DO UPDATE SET subject = excluded.subject, text_body = excluded.text_body,
+			html_body = excluded.html_body, updated_at = excluded.updated_at`,
+		t.OrgID, t.Name, t.Subject, t.Text, t.HTML, t.UpdatedAt.UTC())
+	return err
+}
+
+// DeleteEmailTemplate goes back to the built-in template.
+func (s *Store) DeleteEmailTemplate(ctx context.Context, orgID, name string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM email_templates WHERE org_id = ? AND name = ?`, orgID, name)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ListNotificationPreferences returns the preferences the users of an
+// organization set.
+func (s *Store) ListNotificationPreferences(ctx context.Context, orgID string) ([]models.NotificationPreference, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT user_id, org_id, email, min_severity, kinds FROM notification_preferences WHERE org_id = ?`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prefs := []models.NotificationPreference{}
+	for rows.Next() {
+		p, err := scanNotificationPreference(rows)
+		if err != nil {
+			return nil, err
+		}
+		prefs = append(prefs, *p)
+	}
+	return prefs, rows.Err()
+}
+
+// GetNotificationPreference returns the preference a user set, or nil.
+func (s *Store) GetNotificationPreference(ctx context.Context, userID string) (*models.NotificationPreference, error) {
+	p, err := scanNotificationPreference(s.db.QueryRowContext(ctx,
+		`SELECT user_id, org_id, email, min_severity, kinds FROM notification_preferences WHERE user_id = ?`, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return p, err
+}
+
+func scanNotificationPreference(row rowScanner) (*models.NotificationPreference, error) {
+	var p models.NotificationPreference
+	var kinds string
+	if err := row.Scan(&p.UserID, &p.OrgID, &p.Email, &p.MinSeverity, &kinds); err != nil {
+		return nil, err
+	}
+	p.Kinds = []string{}
+	if kinds != "" {
+		p.Kinds = strings.Split(kinds, ",")
+	}
+	return &p, nil
+}
+
+func (s *Store) SetNotificationPreference(ctx context.Context, p *models.NotificationPreference) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO notification_preferences (user_id, org_id, email, min_severity, kinds)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET org_id = excluded.org_id, email = excluded.email,
+			min_severity = excluded.min_severity, kinds = excluded.kinds`,
+		p.UserID, p.OrgID, p.Email, p.MinSeverity, strings.Join(p.Kinds, ","))
+	return err
+}
+
+const invitationColumns = `id, org_id, email, name, role, invited_by, expires_at, created_at, accepted_at`
+
+func scanInvitation(row rowScanner) (*models.Invitation, error) {
+	var inv models.Invitation
+	var acceptedAt sql.NullTime
+	if err := row.Scan(&inv.ID, &inv.OrgID, &inv.Email, &inv.Name, &inv.Role, &inv.InvitedBy, &inv.ExpiresAt, &inv.CreatedAt,
+		&acceptedAt); err != nil {
+		return nil, err
+	}
+	if acceptedAt.Valid {
+		inv.AcceptedAt = &acceptedAt.Time
+	}
+	return &inv, nil
+}
+
+func (s *Store) CreateInvitation(ctx context.Context, inv *models.Invitation, tokenHash string) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO invitations (id, org_id, email, name, role, token_hash, invited_by, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		inv.ID, inv.OrgID, inv.Email, inv.Name, inv.Role, tokenHash, inv.InvitedBy, inv.ExpiresAt.UTC(), inv.CreatedAt.UTC())
+	return err
+}
+
+func (s *Store) ListInvitations(ctx context.Context, orgID string) ([]models.Invitation, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+invitationColumns+` FROM invitations WHERE org_id = ? ORDER BY created_at DESC`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []models.Invitation{}
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *inv)
+	}
+	return invitations, rows.Err()
+}
+
+func (s *Store) DeleteInvitation(ctx context.Context, orgID, id string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM invitations WHERE org_id = ? AND id = ?`, orgID, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// AcceptInvitation uses up the invitation of tokenHash to create u in the
+// invitation's organization with its email address and role.
+func (s *Store) AcceptInvitation(ctx context.Context, tokenHash string, u *models.User) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	inv, err := scanInvitation(tx.QueryRowContext(ctx, `SELECT `+invitationColumns+` FROM invitations WHERE token_hash = ?`, tokenHash))
+	if err == sql.ErrNoRows {
+		return ErrInvalidInvitation
+	}
+	if err != nil {
+		return err
+	}
+	if inv.AcceptedAt != nil || !u.CreatedAt.Before(inv.ExpiresAt) {
+		return ErrInvalidInvitation
+	}
+	var count int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE email = ?`, inv.Email).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrUserExists
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE invitations SET accepted_at = ? WHERE id = ?`, u.CreatedAt.UTC(), inv.ID); err != nil {
+		return err
+	}
+	u.OrgID, u.Email, u.Role = inv.OrgID, inv.Email, inv.Role
+	if u.Name == "" {
+		u.Name = inv.Name
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO users (id, org_id, email, name, role, password, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		u.ID, u.OrgID, u.Email, u.Name, u.Role, u.Password, u.CreatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) ListPeerExpiries(ctx context.Context, orgID string) ([]models.PeerExpiry, error) {
+	return s.listPeerExpiries(ctx, `WHERE org_id = ? ORDER BY expires_at`, orgID)
+}
+
+// ListPendingPeerExpiries returns the expiries of every organization that
+// are due to be warned about or reported at now.
+func (s *Store) ListPendingPeerExpiries(ctx context.Context, now time.Time, warnWithin time.Duration) ([]models.PeerExpiry, error) {
+	return s.listPeerExpiries(ctx, `WHERE (warned_at IS NULL AND expires_at <= ?) OR (expired_at IS NULL AND expires_at <= ?)
+		ORDER BY expires_at`, now.Add(warnWithin).UTC(), now.UTC())
+}
+
+func (s *Store) listPeerExpiries(ctx context.Context, where string, args ...any) ([]models.PeerExpiry, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT org_id, public_key, expires_at, warned_at, expired_at FROM peer_expiries `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	expiries := []models.PeerExpiry{}
+	for rows.Next() {
+		var e models.PeerExpiry
+		var warnedAt, expiredAt sql.NullTime
+		if err := rows.Scan(&e.OrgID, &e.PublicKey, &e.ExpiresAt, &warnedAt, &expiredAt); err != nil {
+			return nil, err
+		}
+		if warnedAt.Valid {
+			e.WarnedAt = &warnedAt.Time
+		}
+		if expiredAt.Valid {
+			e.ExpiredAt = &expiredAt.Time
+		}
+		expiries = append(expiries, e)
+	}
+	return expiries, rows.Err()
+}
+
+// SetPeerExpiry sets when a peer expires. A changed expiry is warned about
+// and reported again.
+func (s *Store) SetPeerExpiry(ctx context.Context, e *models.PeerExpiry) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO peer_expiries (org_id, public_key, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT(org_id, public_key) DO UPDATE SET expires_at = excluded.expires_at, warned_at = NULL, expired_at = NULL`,
+		e.OrgID, e.PublicKey, e.ExpiresAt.UTC())
+	return err
+}
+
+// MarkPeerExpiry records that a peer's expiry was warned about or reported.
+func (s *Store) MarkPeerExpiry(ctx context.Context, e *models.PeerExpiry) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE peer_expiries SET warned_at = ?, expired_at = ? WHERE org_id = ? AND public_key = ?`,
+		e.WarnedAt, e.ExpiredAt, e.OrgID, e.PublicKey)
+	return err
+}
+
+func (s *Store) DeletePeerExpiry(ctx context.Context, orgID, publicKey string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM peer_expiries WHERE org_id = ? AND public_key = ?`, orgID, publicKey)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
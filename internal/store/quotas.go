@@ -0,0 +1,261 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+const quotaColumns = `id, org_id, scope, target, limit_bytes, warn_percents, action, created_at`
+
+func scanQuota(row rowScanner) (*models.Quota, error) {
+	var q models.Quota
+	var warn string
+	if err := row.Scan(&q.ID, &q.OrgID, &q.Scope, &q.Target, &q.LimitBytes, &warn, &q.Action, &q.CreatedAt); err != nil {
+		return nil, err
+	}
+	q.WarnPercents = []int{}
+	for _, v := range strings.Split(warn, ",") {
+		if p, err := strconv.Atoi(v); err == nil {
+			q.WarnPercents = append(q.WarnPercents, p)
+		}
+	}
+	return &q, nil
+}
+
+func joinPercents(percents []int) string {
+	list := make([]string, len(percents))
+	for i, p := range percents {
+		list[i] = strconv.Itoa(p)
+	}
+	return strings.Join(list, ",")
+}
+
+func (s *Store) ListQuotas(ctx context.Context, orgID string) ([]models.Quota, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+quotaColumns+` FROM quotas WHERE org_id = ? ORDER BY scope, target`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quotas := []models.Quota{}
+	for rows.Next() {
+		q, err := scanQuota(rows)
+		if err != nil {
+			return nil, err
+		}
+		quotas = append(quotas, *q)
+	}
+	return quotas, rows.Err()
+}
+
+func (s *Store) GetQuota(ctx context.Context, orgID, id string) (*models.Quota, error) {
+	q, err := scanQuota(s.db.QueryRowContext(ctx, `SELECT `+quotaColumns+` FROM quotas WHERE org_id = ? AND id = ?`, orgID, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return q, err
+}
+
+// GetQuotaFor returns the quota of a scope and target, or nil.
+func (s *Store) GetQuotaFor(ctx context.Context, orgID, scope, target string) (*models.Quota, error) {
+	q, err := scanQuota(s.db.QueryRowContext(ctx, `SELECT `+quotaColumns+` FROM quotas WHERE org_id = ? AND scope = ? AND target = ?`,
+		orgID, scope, target))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return q, err
+}
+
+func (s *Store) CreateQuota(ctx context.Context, q *models.Quota) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO quotas (`+quotaColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		q.ID, q.OrgID, q.Scope, q.Target, q.LimitBytes, joinPercents(q.WarnPercents), q.Action, q.CreatedAt)
+	return err
+}
+
+// UpdateQuota changes the limit, warnings and action of a quota.
+func (s *Store) UpdateQuota(ctx context.Context, q *models.Quota) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE quotas SET limit_bytes = ?, warn_percents = ?, action = ? WHERE org_id = ? AND id = ?`,
+		q.LimitBytes, joinPercents(q.WarnPercents), q.Action, q.OrgID, q.ID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) DeleteQuota(ctx context.Context, orgID, id string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM quotas WHERE org_id = ? AND id = ?`, orgID, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ListQuotaOrgs returns the organizations that have quotas, overrides or
+// suspended peers.
+func (s *Store) ListQuotaOrgs(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT org_id FROM quotas UNION SELECT org_id FROM quota_overrides
+		UNION SELECT org_id FROM peer_suspensions`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []string{}
+	for rows.Next() {
+		var orgID string
+		if err := rows.Scan(&orgID); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, orgID)
+	}
+	return orgs, rows.Err()
+}
+
+func (s *Store) ListQuotaOverrides(ctx context.Context, orgID string) ([]models.QuotaOverride, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT org_id, public_key, limit_bytes, expires_at, reason, created_at
+		FROM quota_overrides WHERE org_id = ? ORDER BY public_key`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := []models.QuotaOverride{}
+	for rows.Next() {
+		var o models.QuotaOverride
+		var limit sql.NullInt64
+		if err := rows.Scan(&o.OrgID, &o.PublicKey, &limit, &o.ExpiresAt, &o.Reason, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		if limit.Valid {
+			o.LimitBytes = &limit.Int64
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, rows.Err()
+}
+
+func (s *Store) SetQuotaOverride(ctx context.Context, o *models.QuotaOverride) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO quota_overrides (org_id, public_key, limit_bytes, expires_at, reason, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(org_id, public_key) DO UPDATE SET limit_bytes = excluded.limit_bytes, expires_at = excluded.expires_at,
+			reason = excluded.reason, created_at = excluded.created_at`,
+		o.OrgID, o.PublicKey, o.LimitBytes, o.ExpiresAt, o.Reason, o.CreatedAt)
+	return err
+}
+
+func (s *Store) DeleteQuotaOverride(ctx context.Context, orgID, publicKey string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM quota_overrides WHERE org_id = ? AND public_key = ?`, orgID, publicKey)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteExpiredQuotaOverrides removes the overrides that expired before now.
+func (s *Store) DeleteExpiredQuotaOverrides(ctx context.Context, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM quota_overrides WHERE expires_at <= ?`, now)
+	return err
+}
+
+// PeerUsageTotals returns the bytes every peer of an organization transferred
+// on the days in [from, to), summed over servers, by public key.
+func (s *Store) PeerUsageTotals(ctx context.Context, orgID string, from, to time.Time) (map[string]int64, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT public_key, SUM(receive_bytes + transmit_bytes) FROM peer_usage_daily
+		WHERE org_id = ? AND day >= ? AND day < ? GROUP BY public_key`,
+		orgID, from.UTC().Format(usageDayFormat), to.UTC().Format(usageDayFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := make(map[string]int64)
+	for rows.Next() {
+		var publicKey string
+		var total int64
+		if err := rows.Scan(&publicKey, &total); err != nil {
+			return nil, err
+		}
+		totals[publicKey] = total
+	}
+	return totals, rows.Err()
+}
+
+func (s *Store) ListQuotaStates(ctx context.Context, orgID string) ([]models.QuotaState, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT org_id, public_key, period_start, warned_percent, exceeded_at FROM quota_states WHERE org_id = ?`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := []models.QuotaState{}
+	for rows.Next() {
+		var st models.QuotaState
+		var exceededAt sql.NullTime
+		if err := rows.Scan(&st.OrgID, &st.PublicKey, &st.PeriodStart, &st.WarnedPercent, &exceededAt); err != nil {
+			return nil, err
+		}
+		if exceededAt.Valid {
+			st.ExceededAt = &exceededAt.Time
+		}
+		states = append(states, st)
+	}
+	return states, rows.Err()
+}
+
+func (s *Store) SetQuotaState(ctx context.Context, st *models.QuotaState) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO quota_states (org_id, public_key, period_start, warned_percent, exceeded_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(org_id, public_key) DO UPDATE SET period_start = excluded.period_start,
+			warned_percent = excluded.warned_percent, exceeded_at = excluded.exceeded_at`,
+		st.OrgID, st.PublicKey, st.PeriodStart, st.WarnedPercent, st.ExceededAt)
+	return err
+}
+
+func (s *Store) ListPeerSuspensions(ctx context.Context, orgID string) ([]models.PeerSuspension, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT server_id, interface, public_key, org_id, allowed_ips, suspended_at
+		FROM peer_suspensions WHERE org_id = ? ORDER BY public_key, server_id, interface`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suspensions := []models.PeerSuspension{}
+	for rows.Next() {
+		var ps models.PeerSuspension
+		var allowedIPs string
+		if err := rows.Scan(&ps.ServerID, &ps.Interface, &ps.PublicKey, &ps.OrgID, &allowedIPs, &ps.SuspendedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(allowedIPs), &ps.AllowedIPs); err != nil {
+			return nil, err
+		}
+		suspensions = append(suspensions, ps)
+	}
+	return suspensions, rows.Err()
+}
+
+func (s *Store) AddPeerSuspension(ctx context.Context, ps *models.PeerSuspension) error {
+	allowedIPs, err := json.Marshal(ps.AllowedIPs)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO peer_suspensions (server_id, interface, public_key, org_id, allowed_ips, suspended_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		ps.ServerID, ps.Interface, ps.PublicKey, ps.OrgID, string(allowedIPs), ps.SuspendedAt)
+	return err
+}
+
+func (s *Store) DeletePeerSuspension(ctx context.Context, serverID, iface, publicKey string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM peer_suspensions WHERE server_id = ? AND interface = ? AND public_key = ?`,
+		serverID, iface, publicKey)
+	return err
+}
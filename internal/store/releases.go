@@ -0,0 +1,171 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+const releaseColumns = `id, version, os, arch, sha256, signature, size, created_by, created_at`
+
+func scanRelease(row interface{ Scan(...any) error }) (*models.Release, error) {
+	var r models.Release
+	var createdBy sql.NullString
+	if err := row.Scan(&r.ID, &r.Version, &r.OS, &r.Arch, &r.SHA256, &r.Signature, &r.Size, &createdBy, &r.CreatedAt); err != nil {
+		return nil, err
+	}
+	r.CreatedBy = createdBy.String
+	return &r, nil
+}
+
+func (s *Store) CreateRelease(ctx context.Context, r *models.Release) error {
+	query := `INSERT INTO releases (` + releaseColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, r.ID, r.Version, r.OS, r.Arch, r.SHA256, r.Signature, r.Size, r.CreatedBy, r.CreatedAt)
+	return err
+}
+
+func (s *Store) ListReleases(ctx context.Context) ([]models.Release, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+releaseColumns+` FROM releases ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	releases := []models.Release{}
+	for rows.Next() {
+		r, err := scanRelease(rows)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, *r)
+	}
+	return releases, rows.Err()
+}
+
+func (s *Store) GetRelease(ctx context.Context, id string) (*models.Release, error) {
+	r, err := scanRelease(s.db.QueryRowContext(ctx, `SELECT `+releaseColumns+` FROM releases WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return r, err
+}
+
+// GetReleaseFor returns the release of version for a platform.
+func (s *Store) GetReleaseFor(ctx context.Context, version, goos, goarch string) (*models.Release, error) {
+	query := `SELECT ` + releaseColumns + ` FROM releases WHERE version = ? AND os = ? AND arch = ?`
+	r, err := scanRelease(s.db.QueryRowContext(ctx, query, version, goos, goarch))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return r, err
+}
+
+// CreateRollout stores a rollout together with its targets.
+func (s *Store) CreateRollout(ctx context.Context, r *models.Rollout) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO rollouts (id, org_id, version, status, created_by, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		r.ID, r.OrgID, r.Version, r.Status, r.CreatedBy, r.CreatedAt, r.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	for _, t := range r.Targets {
+		_, err = tx.ExecContext(ctx, `INSERT INTO rollout_targets (rollout_id, server_id, stage, status, from_version, error, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			r.ID, t.ServerID, t.Stage, t.Status, t.FromVersion, t.Error, t.UpdatedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) ListRollouts(ctx context.Context, orgID string) ([]models.Rollout, error) {
+	query := `SELECT id, org_id, version, status, created_by, created_at, updated_at FROM rollouts WHERE org_id = ? ORDER BY created_at DESC`
+	rows, err := s.db.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rollouts := []models.Rollout{}
+	for rows.Next() {
+		var r models.Rollout
+		var createdBy sql.NullString
+		if err := rows.Scan(&r.ID, &r.OrgID, &r.Version, &r.Status, &createdBy, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		r.CreatedBy = createdBy.String
+		rollouts = append(rollouts, r)
+	}
+	return rollouts, rows.Err()
+}
+
+// GetRollout returns a rollout with its targets.
+func (s *Store) GetRollout(ctx context.Context, id string) (*models.Rollout, error) {
+	var r models.Rollout
+	var createdBy sql.NullString
+	row := s.db.QueryRowContext(ctx, `SELECT id, org_id, version, status, created_by, created_at, updated_at FROM rollouts WHERE id = ?`, id)
+	if err := row.Scan(&r.ID, &r.OrgID, &r.Version, &r.Status, &createdBy, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	r.CreatedBy = createdBy.String
+
+	targets, err := s.listRolloutTargets(ctx, `WHERE rollout_id = ? ORDER BY stage, server_id`, id)
+	if err != nil {
+		return nil, err
+	}
+	r.Targets = targets
+	return &r, nil
+}
+
+// ListUpdatingTargets returns the targets of serverID waiting for the agent to
+// come back with a new version.
+func (s *Store) ListUpdatingTargets(ctx context.Context, serverID string) ([]models.RolloutTarget, error) {
+	return s.listRolloutTargets(ctx, `WHERE server_id = ? AND status = ?`, serverID, models.TargetUpdating)
+}
+
+// ListTargetsByStatus returns the targets of all rollouts in a status.
+func (s *Store) ListTargetsByStatus(ctx context.Context, status string) ([]models.RolloutTarget, error) {
+	return s.listRolloutTargets(ctx, `WHERE status = ?`, status)
+}
+
+func (s *Store) listRolloutTargets(ctx context.Context, where string, args ...any) ([]models.RolloutTarget, error) {
+	query := `SELECT rollout_id, server_id, stage, status, from_version, error, updated_at FROM rollout_targets ` + where
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	targets := []models.RolloutTarget{}
+	for rows.Next() {
+		var t models.RolloutTarget
+		var fromVersion, errMsg sql.NullString
+		if err := rows.Scan(&t.RolloutID, &t.ServerID, &t.Stage, &t.Status, &fromVersion, &errMsg, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		t.FromVersion, t.Error = fromVersion.String, errMsg.String
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
+func (s *Store) SetRolloutStatus(ctx context.Context, id, status string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE rollouts SET status = ?, updated_at = ? WHERE id = ?`, status, at, id)
+	return err
+}
+
+func (s *Store) SetRolloutTargetStatus(ctx context.Context, rolloutID, serverID, status, errMsg string, at time.Time) error {
+	query := `UPDATE rollout_targets SET status = ?, error = ?, updated_at = ? WHERE rollout_id = ? AND server_id = ?`
+	_, err := s.db.ExecContext(ctx, query, status, errMsg, at, rolloutID, serverID)
+	return err
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+func (s *Store) AddSecurityEvent(ctx context.Context, e *models.SecurityEvent) error {
+	query := `INSERT INTO security_events (org_id, agent_id, server_id, kind, detail, remote_addr, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	res, err := s.db.ExecContext(ctx, query, e.OrgID, e.AgentID, e.ServerID, e.Kind, e.Detail, e.RemoteAddr, e.CreatedAt)
+	if err != nil {
+		return err
+	}
+	e.ID, err = res.LastInsertId()
+	return err
+}
+
+// ListSecurityEvents returns the most recent security events of an organization.
+func (s *Store) ListSecurityEvents(ctx context.Context, orgID string, limit int) ([]models.SecurityEvent, error) {
+	query := `SELECT id, org_id, agent_id, server_id, kind, detail, remote_addr, created_at FROM security_events WHERE org_id = ? ORDER BY id DESC LIMIT ?`
+	rows, err := s.db.QueryContext(ctx, query, orgID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.SecurityEvent{}
+	for rows.Next() {
+		var e models.SecurityEvent
+		var agentID, serverID, detail, remoteAddr sql.NullString
+		if err := rows.Scan(&e.ID, &e.OrgID, &agentID, &serverID, &e.Kind, &detail, &remoteAddr, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.AgentID, e.ServerID, e.Detail, e.RemoteAddr = agentID.String, serverID.String, detail.String, remoteAddr.String
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (s *Store) AddIdentityConflict(ctx context.Context, c *models.IdentityConflict) error {
+	known, err := json.Marshal(c.KnownAttributes)
+	if err != nil {
+		return err
+	}
+	claimed, err := json.Marshal(c.ClaimedAttributes)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO identity_conflicts (org_id, server_id, kind, known_agent_id, claiming_agent_id, known_attributes, claimed_attributes, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	res, err := s.db.ExecContext(ctx, query, c.OrgID, c.ServerID, c.Kind, c.KnownAgentID, c.ClaimingAgentID, string(known), string(claimed), c.Time.UTC())
+	if err != nil {
+		return err
+	}
+	c.ID, err = res.LastInsertId()
+	return err
+}
+
+// ListIdentityConflicts returns the most recent identity conflicts of an
+// organization.
+func (s *Store) ListIdentityConflicts(ctx context.Context, orgID string, limit int) ([]models.IdentityConflict, error) {
+	query := `SELECT id, org_id, server_id, kind, known_agent_id, claiming_agent_id, known_attributes, claimed_attributes, created_at
+		FROM identity_conflicts WHERE org_id = ? ORDER BY id DESC LIMIT ?`
+	rows, err := s.db.QueryContext(ctx, query, orgID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conflicts := []models.IdentityConflict{}
+	for rows.Next() {
+		var c models.IdentityConflict
+		var known, claimed string
+		if err := rows.Scan(&c.ID, &c.OrgID, &c.ServerID, &c.Kind, &c.KnownAgentID, &c.ClaimingAgentID, &known, &claimed, &c.Time); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(known), &c.KnownAttributes); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(claimed), &c.ClaimedAttributes); err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, c)
+	}
+	return conflicts, rows.Err()
+}
+
+// UseReportNonce records the nonce of a signed report until expiresAt. It
+// reports false if the agent already used the nonce.
+func (s *Store) UseReportNonce(ctx context.Context, agentID, nonce string, expiresAt time.Time) (bool, error) {
+	query := `INSERT INTO report_nonces (agent_id, nonce, expires_at) VALUES (?, ?, ?) ON CONFLICT(agent_id, nonce) DO NOTHING`
+	res, err := s.db.ExecContext(ctx, query, agentID, nonce, expiresAt.UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// DeleteExpiredReportNonces forgets the nonces that expired before now.
+func (s *Store) DeleteExpiredReportNonces(ctx context.Context, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM report_nonces WHERE expires_at < ?`, now.UTC())
+	return err
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+const serverColumns = `id, org_id, hostname, display_name, public_key, endpoint, listen_port, notes, created_at, last_seen, decommissioned_at`
+
+// RecordServerReport registers a server from one of its reports, or refreshes
+// its identity and last-seen time. Empty values keep what is already known,
+// and servers of another organization are left alone.
+func (s *Store) RecordServerReport(ctx context.Context, srv *models.Server, seen time.Time) error {
+	query := `INSERT INTO servers (id, org_id, hostname, public_key, endpoint, listen_port, last_seen) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			hostname = COALESCE(NULLIF(excluded.hostname, ''), servers.hostname),
+			public_key = COALESCE(NULLIF(excluded.public_key, ''), servers.public_key),
+			endpoint = COALESCE(NULLIF(excluded.endpoint, ''), servers.endpoint),
+			listen_port = COALESCE(NULLIF(excluded.listen_port, 0), servers.listen_port),
+			last_seen = excluded.last_seen
+		WHERE servers.org_id = excluded.org_id`
+	_, err := s.db.ExecContext(ctx, query, srv.ID, srv.OrgID, srv.Hostname, srv.PublicKey, srv.Endpoint, srv.ListenPort, seen.UTC())
+	return err
+}
+
+// SetServerDisplayName sets the human-friendly name of a server, creating the
+// server record if it does not exist yet.
+func (s *Store) SetServerDisplayName(ctx context.Context, orgID, id, displayName string) error {
+	query := `INSERT INTO servers (id, org_id, display_name) VALUES (?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET display_name = excluded.display_name WHERE servers.org_id = excluded.org_id`
+	_, err := s.db.ExecContext(ctx, query, id, orgID, displayName)
+	return err
+}
+
+// SetServerNotes replaces the free-form notes of a registered server.
+func (s *Store) SetServerNotes(ctx context.Context, orgID, id, notes string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE servers SET notes = ? WHERE id = ? AND org_id = ?`, notes, id, orgID)
+	return err
+}
+
+// SetServerDecommissioned marks a registered server as decommissioned at the
+// given time, or returns it to service if at is nil.
+func (s *Store) SetServerDecommissioned(ctx context.Context, orgID, id string, at *time.Time) error {
+	var value any
+	if at != nil {
+		value = at.UTC()
+	}
+	_, err := s.db.ExecContext(ctx, `UPDATE servers SET decommissioned_at = ? WHERE id = ? AND org_id = ?`, value, id, orgID)
+	return err
+}
+
+// ServerDecommissioned reports whether the server with the given ID has been
+// decommissioned.
+func (s *Store) ServerDecommissioned(ctx context.Context, id string) (bool, error) {
+	var decommissioned bool
+	err := s.db.QueryRowContext(ctx, `SELECT decommissioned_at IS NOT NULL FROM servers WHERE id = ?`, id).Scan(&decommissioned)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return decommissioned, err
+}
+
+// ServerOrgID returns the organization of the server with the given ID, or an
+// empty string if it does not exist.
+func (s *Store) ServerOrgID(ctx context.Context, id string) (string, error) {
+	var orgID string
+	err := s.db.QueryRowContext(ctx, `SELECT org_id FROM servers WHERE id = ?`, id).Scan(&orgID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return orgID, err
+}
+
+// GetServer returns the server record, or nil if it does not exist.
+func (s *Store) GetServer(ctx context.Context, orgID, id string) (*models.Server, error) {
+	query := `SELECT ` + serverColumns + ` FROM servers WHERE id = ? AND org_id = ?`
+	return scanServer(s.db.QueryRowContext(ctx, query, id, orgID))
+}
+
+// ListServers returns the servers of an organization ordered by ID.
+func (s *Store) ListServers(ctx context.Context, orgID string) ([]models.Server, error) {
+	return s.listServers(ctx, `WHERE org_id = ? ORDER BY id`, orgID)
+}
+
+// ListReportingServers returns the servers of every organization that have
+// reported and are not decommissioned.
+func (s *Store) ListReportingServers(ctx context.Context) ([]models.Server, error) {
+	return s.listServers(ctx, `WHERE last_seen IS NOT NULL AND decommissioned_at IS NULL ORDER BY id`)
+}
+
+func (s *Store) listServers(ctx context.Context, where string, args ...any) ([]models.Server, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+serverColumns+` FROM servers `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	servers := []models.Server{}
+	for rows.Next() {
+		srv, err := scanServer(rows)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, *srv)
+	}
+	return servers, rows.Err()
+}
+
+func scanServer(row rowScanner) (*models.Server, error) {
+	srv := &models.Server{}
+	var hostname, displayName, publicKey, endpoint, notes sql.NullString
+	var listenPort sql.NullInt64
+	var lastSeen, decommissionedAt sql.NullTime
+	err := row.Scan(&srv.ID, &srv.OrgID, &hostname, &displayName, &publicKey, &endpoint, &listenPort, &notes,
+		&srv.CreatedAt, &lastSeen, &decommissionedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	srv.Hostname, srv.DisplayName, srv.PublicKey, srv.Endpoint = hostname.String, displayName.String, publicKey.String, endpoint.String
+	srv.ListenPort, srv.Notes = int(listenPort.Int64), notes.String
+	if lastSeen.Valid {
+		srv.LastSeen = &lastSeen.Time
+	}
+	if decommissionedAt.Valid {
+		srv.DecommissionedAt = &decommissionedAt.Time
+	}
+	return srv, nil
+}
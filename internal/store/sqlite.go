@@ -15,7 +15,8 @@ type Store struct {
 }
 
 func New(path string) (*Store, error) {
-	db, err := sql.Open("sqlite", path)
+	// Several bus subscribers write concurrently; wait for locks instead of failing.
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open db: %w", err)
 	}
@@ -31,6 +32,15 @@ func New(path string) (*Store, error) {
 	// Simple migration
 	_, _ = db.Exec("ALTER TABLE users ADD COLUMN role TEXT DEFAULT 'viewer'")
 	_, _ = db.Exec("ALTER TABLE users ADD COLUMN password TEXT DEFAULT ''")
+	_, _ = db.Exec("ALTER TABLE agents ADD COLUMN signing_key TEXT DEFAULT ''")
+	_, _ = db.Exec("ALTER TABLE servers ADD COLUMN display_name TEXT DEFAULT ''")
+	_, _ = db.Exec("ALTER TABLE servers ADD COLUMN listen_port INTEGER DEFAULT 0")
+	_, _ = db.Exec("ALTER TABLE servers ADD COLUMN notes TEXT DEFAULT ''")
+	_, _ = db.Exec("ALTER TABLE servers ADD COLUMN last_seen DATETIME")
+	_, _ = db.Exec("ALTER TABLE servers ADD COLUMN decommissioned_at DATETIME")
+	_, _ = db.Exec("ALTER TABLE agent_inventory ADD COLUMN config_version TEXT DEFAULT ''")
+	_, _ = db.Exec("ALTER TABLE agent_inventory ADD COLUMN config TEXT DEFAULT ''")
+	_, _ = db.Exec("ALTER TABLE peer_owners ADD COLUMN profile_name TEXT NOT NULL DEFAULT ''")
 
 	// Ensure admin has a password
 	hash, _ := bcrypt.GenerateFromPassword([]byte("admin"), bcrypt.DefaultCost)
@@ -60,9 +70,14 @@ func initSchema(db *sql.DB) error {
 			id TEXT PRIMARY KEY,
 			org_id TEXT NOT NULL,
 			hostname TEXT,
+			display_name TEXT DEFAULT '',
 			public_key TEXT,
 			endpoint TEXT,
+			listen_port INTEGER DEFAULT 0,
+			notes TEXT DEFAULT '',
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			last_seen DATETIME,
+			decommissioned_at DATETIME,
 			FOREIGN KEY(org_id) REFERENCES organizations(id)
 		);`,
 		`CREATE TABLE IF NOT EXISTS peers (
@@ -73,6 +88,319 @@ func initSchema(db *sql.DB) error {
 			receive_bytes INTEGER,
 			transmit_bytes INTEGER
 		);`,
+		`CREATE TABLE IF NOT EXISTS join_tokens (
+			id TEXT PRIMARY KEY,
+			token_hash TEXT NOT NULL UNIQUE,
+			org_id TEXT NOT NULL,
+			server_id TEXT NOT NULL,
+			created_by TEXT,
+			expires_at DATETIME NOT NULL,
+			used_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY(org_id) REFERENCES organizations(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS agents (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL,
+			server_id TEXT NOT NULL,
+			credential_hash TEXT NOT NULL UNIQUE,
+			hostname TEXT,
+			signing_key TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			revoked_at DATETIME,
+			FOREIGN KEY(org_id) REFERENCES organizations(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS agent_certificates (
+			serial TEXT PRIMARY KEY,
+			agent_id TEXT NOT NULL,
+			expires_at DATETIME NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			revoked_at DATETIME,
+			FOREIGN KEY(agent_id) REFERENCES agents(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS agent_inventory (
+			server_id TEXT PRIMARY KEY,
+			org_id TEXT,
+			agent_id TEXT,
+			hostname TEXT,
+			version TEXT,
+			protocol_version INTEGER,
+			capabilities TEXT,
+			go_version TEXT,
+			os TEXT,
+			arch TEXT,
+			config_version TEXT,
+			config TEXT,
+			updated_at DATETIME
+		);`,
+		`CREATE TABLE IF NOT EXISTS releases (
+			id TEXT PRIMARY KEY,
+			version TEXT NOT NULL,
+			os TEXT NOT NULL,
+			arch TEXT NOT NULL,
+			sha256 TEXT NOT NULL,
+			signature TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			created_by TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(version, os, arch)
+		);`,
+		`CREATE TABLE IF NOT EXISTS rollouts (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL,
+			version TEXT NOT NULL,
+			status TEXT NOT NULL,
+			created_by TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS rollout_targets (
+			rollout_id TEXT NOT NULL,
+			server_id TEXT NOT NULL,
+			stage TEXT NOT NULL,
+			status TEXT NOT NULL,
+			from_version TEXT,
+			error TEXT,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(rollout_id, server_id),
+			FOREIGN KEY(rollout_id) REFERENCES rollouts(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS config_groups (
+			org_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			config TEXT NOT NULL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(org_id, name)
+		);`,
+		`CREATE TABLE IF NOT EXISTS endpoint_salts (
+			org_id TEXT PRIMARY KEY,
+			salt TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS server_configs (
+			server_id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL,
+			group_name TEXT,
+			config TEXT NOT NULL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS metric_series (
+			id INTEGER PRIMARY KEY,
+			server_id TEXT NOT NULL,
+			peer_key TEXT NOT NULL DEFAULT '',
+			UNIQUE(server_id, peer_key)
+		);`,
+		`CREATE TABLE IF NOT EXISTS server_metrics (
+			series_id INTEGER NOT NULL,
+			resolution INTEGER NOT NULL,
+			ts INTEGER NOT NULL,
+			cpu_percent REAL,
+			memory_used INTEGER,
+			memory_percent REAL,
+			disk_used INTEGER,
+			disk_percent REAL,
+			load_average REAL,
+			net_bytes_sent INTEGER,
+			net_bytes_recv INTEGER,
+			PRIMARY KEY(series_id, resolution, ts)
+		) WITHOUT ROWID;`,
+		`CREATE TABLE IF NOT EXISTS peer_metrics (
+			series_id INTEGER NOT NULL,
+			resolution INTEGER NOT NULL,
+			ts INTEGER NOT NULL,
+			receive_bytes INTEGER,
+			transmit_bytes INTEGER,
+			latest_handshake INTEGER,
+			PRIMARY KEY(series_id, resolution, ts)
+		) WITHOUT ROWID;`,
+		`CREATE TABLE IF NOT EXISTS peer_usage_counters (
+			server_id TEXT NOT NULL,
+			peer TEXT NOT NULL,
+			org_id TEXT NOT NULL,
+			public_key TEXT NOT NULL,
+			receive_bytes INTEGER NOT NULL,
+			transmit_bytes INTEGER NOT NULL,
+			observed_at INTEGER NOT NULL,
+			PRIMARY KEY(server_id, peer)
+		);`,
+		`CREATE TABLE IF NOT EXISTS peer_usage_daily (
+			server_id TEXT NOT NULL,
+			peer TEXT NOT NULL,
+			day TEXT NOT NULL,
+			org_id TEXT NOT NULL,
+			public_key TEXT NOT NULL,
+			receive_bytes INTEGER NOT NULL,
+			transmit_bytes INTEGER NOT NULL,
+			PRIMARY KEY(server_id, peer, day)
+		);`,
+		`CREATE INDEX IF NOT EXISTS peer_usage_daily_org_day ON peer_usage_daily(org_id, day);`,
+		`CREATE TABLE IF NOT EXISTS peer_owners (
+			org_id TEXT NOT NULL,
+			public_key TEXT NOT NULL,
+			user_name TEXT NOT NULL DEFAULT '',
+			group_name TEXT NOT NULL DEFAULT '',
+			PRIMARY KEY(org_id, public_key)
+		);`,
+		`CREATE TABLE IF NOT EXISTS quotas (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL,
+			scope TEXT NOT NULL,
+			target TEXT NOT NULL,
+			limit_bytes INTEGER NOT NULL,
+			warn_percents TEXT NOT NULL DEFAULT '',
+			action TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(org_id, scope, target)
+		);`,
+		`CREATE TABLE IF NOT EXISTS quota_overrides (
+			org_id TEXT NOT NULL,
+			public_key TEXT NOT NULL,
+			limit_bytes INTEGER,
+			expires_at DATETIME NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(org_id, public_key)
+		);`,
+		`CREATE TABLE IF NOT EXISTS quota_states (
+			org_id TEXT NOT NULL,
+			public_key TEXT NOT NULL,
+			period_start DATETIME NOT NULL,
+			warned_percent INTEGER NOT NULL DEFAULT 0,
+			exceeded_at DATETIME,
+			PRIMARY KEY(org_id, public_key)
+		);`,
+		`CREATE TABLE IF NOT EXISTS peer_suspensions (
+			server_id TEXT NOT NULL,
+			interface TEXT NOT NULL,
+			public_key TEXT NOT NULL,
+			org_id TEXT NOT NULL,
+			allowed_ips TEXT NOT NULL,
+			suspended_at DATETIME NOT NULL,
+			PRIMARY KEY(server_id, interface, public_key)
+		);`,
+		`CREATE TABLE IF NOT EXISTS alerts (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL,
+			rule TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			severity TEXT NOT NULL,
+			server_id TEXT NOT NULL DEFAULT '',
+			public_key TEXT NOT NULL DEFAULT '',
+			value REAL NOT NULL DEFAULT 0,
+			message TEXT NOT NULL DEFAULT '',
+			started_at DATETIME NOT NULL,
+			fired_at DATETIME NOT NULL,
+			acknowledged_at DATETIME,
+			acknowledged_by TEXT NOT NULL DEFAULT '',
+			resolved_at DATETIME
+		);`,
+		`CREATE INDEX IF NOT EXISTS alerts_org_fired ON alerts(org_id, fired_at);`,
+		`CREATE TABLE IF NOT EXISTS webhooks (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			events TEXT NOT NULL DEFAULT '',
+			enabled INTEGER NOT NULL DEFAULT 1,
+			created_at DATETIME NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id TEXT PRIMARY KEY,
+			webhook_id TEXT NOT NULL,
+			org_id TEXT NOT NULL,
+			event_id TEXT NOT NULL,
+			event_type TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			state TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at DATETIME NOT NULL,
+			created_at DATETIME NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS webhook_deliveries_due ON webhook_deliveries(state, next_attempt_at);`,
+		`CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at);`,
+		`CREATE TABLE IF NOT EXISTS webhook_attempts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			delivery_id TEXT NOT NULL,
+			time DATETIME NOT NULL,
+			status_code INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			duration_ms INTEGER NOT NULL DEFAULT 0
+		);`,
+		`CREATE INDEX IF NOT EXISTS webhook_attempts_delivery ON webhook_attempts(delivery_id);`,
+		`CREATE TABLE IF NOT EXISTS email_templates (
+			org_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			text_body TEXT NOT NULL,
+			html_body TEXT NOT NULL,
+			updated_at DATETIME NOT NULL,
+			PRIMARY KEY(org_id, name)
+		);`,
+		`CREATE TABLE IF NOT EXISTS notification_preferences (
+			user_id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL,
+			email INTEGER NOT NULL,
+			min_severity TEXT NOT NULL,
+			kinds TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE TABLE IF NOT EXISTS invitations (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL,
+			email TEXT NOT NULL,
+			name TEXT NOT NULL DEFAULT '',
+			role TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			invited_by TEXT NOT NULL,
+			expires_at DATETIME NOT NULL,
+			created_at DATETIME NOT NULL,
+			accepted_at DATETIME
+		);`,
+		`CREATE TABLE IF NOT EXISTS peer_expiries (
+			org_id TEXT NOT NULL,
+			public_key TEXT NOT NULL,
+			expires_at DATETIME NOT NULL,
+			warned_at DATETIME,
+			expired_at DATETIME,
+			PRIMARY KEY(org_id, public_key)
+		);`,
+		`CREATE TABLE IF NOT EXISTS chat_channels (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			type TEXT NOT NULL,
+			url TEXT NOT NULL,
+			enabled INTEGER NOT NULL DEFAULT 1,
+			min_severity TEXT NOT NULL,
+			kinds TEXT NOT NULL DEFAULT '',
+			servers TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS security_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			org_id TEXT,
+			agent_id TEXT,
+			server_id TEXT,
+			kind TEXT NOT NULL,
+			detail TEXT,
+			remote_addr TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS identity_conflicts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			org_id TEXT NOT NULL,
+			server_id TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			known_agent_id TEXT NOT NULL,
+			claiming_agent_id TEXT NOT NULL,
+			known_attributes TEXT NOT NULL DEFAULT '{}',
+			claimed_attributes TEXT NOT NULL DEFAULT '{}',
+			created_at DATETIME NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS report_nonces (
+			agent_id TEXT NOT NULL,
+			nonce TEXT NOT NULL,
+			expires_at DATETIME NOT NULL,
+			PRIMARY KEY (agent_id, nonce)
+		);`,
 	}
 
 	for _, q := range queries {
@@ -100,6 +428,21 @@ func (s *Store) CreateUser(ctx context.Context, u *models.User) error {
 	return err
 }
 
+func (s *Store) GetUserByID(ctx context.Context, id string) (*models.User, error) {
+	query := `SELECT id, org_id, email, name, role, password, created_at FROM users WHERE id = ?`
+	row := s.db.QueryRowContext(ctx, query, id)
+
+	u := &models.User{}
+
+	if err := row.Scan(&u.ID, &u.OrgID, &u.Email, &u.Name, &u.Role, &u.Password, &u.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return u, nil
+}
+
 func (s *Store) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `SELECT id, org_id, email, name, role, password, created_at FROM users WHERE email = ?`
 	row := s.db.QueryRowContext(ctx, query, email)
@@ -115,6 +458,25 @@ func (s *Store) GetUserByEmail(ctx context.Context, email string) (*models.User,
 	return u, nil
 }
 
+// ListUsers returns the users of an organization ordered by email.
+func (s *Store) ListUsers(ctx context.Context, orgID string) ([]models.User, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, org_id, email, name, role, created_at FROM users WHERE org_id = ? ORDER BY email`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.OrgID, &u.Email, &u.Name, &u.Role, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
 func (s *Store) Close() error {
 	return s.db.Close()
 }
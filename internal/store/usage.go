@@ -0,0 +1,125 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+// usageDayFormat is how days of usage are stored.
+const usageDayFormat = "2006-01-02"
+
+// ListUsageCounters returns the last accounted counters of every peer.
+func (s *Store) ListUsageCounters(ctx context.Context) ([]models.UsageCounter, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT server_id, peer, org_id, public_key, receive_bytes, transmit_bytes, observed_at FROM peer_usage_counters`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counters := []models.UsageCounter{}
+	for rows.Next() {
+		var c models.UsageCounter
+		var observedAt int64
+		if err := rows.Scan(&c.ServerID, &c.Peer, &c.OrgID, &c.PublicKey, &c.ReceiveBytes, &c.TransmitBytes, &observedAt); err != nil {
+			return nil, err
+		}
+		c.ObservedAt = time.Unix(observedAt, 0).UTC()
+		counters = append(counters, c)
+	}
+	return counters, rows.Err()
+}
+
+// RecordUsage stores the latest counters and adds the usage of days in one
+// transaction, so that usage is never counted twice.
+func (s *Store) RecordUsage(ctx context.Context, counters []models.UsageCounter, days []models.UsageDay) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, c := range counters {
+		_, err := tx.ExecContext(ctx, `INSERT INTO peer_usage_counters (server_id, peer, org_id, public_key, receive_bytes, transmit_bytes, observed_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(server_id, peer) DO UPDATE SET org_id = excluded.org_id, receive_bytes = excluded.receive_bytes,
+				transmit_bytes = excluded.transmit_bytes, observed_at = excluded.observed_at`,
+			c.ServerID, c.Peer, c.OrgID, c.PublicKey, c.ReceiveBytes, c.TransmitBytes, c.ObservedAt.Unix())
+		if err != nil {
+			return err
+		}
+	}
+	for _, d := range days {
+		_, err := tx.ExecContext(ctx, `INSERT INTO peer_usage_daily (server_id, peer, day, org_id, public_key, receive_bytes, transmit_bytes)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(server_id, peer, day) DO UPDATE SET receive_bytes = receive_bytes + excluded.receive_bytes,
+				transmit_bytes = transmit_bytes + excluded.transmit_bytes`,
+			d.ServerID, d.Peer, d.Day.UTC().Format(usageDayFormat), d.OrgID, d.PublicKey, d.ReceiveBytes, d.TransmitBytes)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListUsageDays returns the daily usage of an organization's peers on the
+// days in [from, to), with their owners.
+func (s *Store) ListUsageDays(ctx context.Context, orgID string, from, to time.Time) ([]models.UsageDay, error) {
+	query := `SELECT d.server_id, d.peer, d.day, d.public_key, d.receive_bytes, d.transmit_bytes, COALESCE(o.user_name, ''), COALESCE(o.group_name, ''), COALESCE(o.profile_name, '')
+		FROM peer_usage_daily d LEFT JOIN peer_owners o ON o.org_id = d.org_id AND o.public_key = d.public_key
+		WHERE d.org_id = ? AND d.day >= ? AND d.day < ?
+		ORDER BY d.day`
+	rows, err := s.db.QueryContext(ctx, query, orgID, from.UTC().Format(usageDayFormat), to.UTC().Format(usageDayFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []models.UsageDay{}
+	for rows.Next() {
+		d := models.UsageDay{OrgID: orgID}
+		var day string
+		if err := rows.Scan(&d.ServerID, &d.Peer, &day, &d.PublicKey, &d.ReceiveBytes, &d.TransmitBytes, &d.User, &d.Group, &d.Profile); err != nil {
+			return nil, err
+		}
+		if d.Day, err = time.Parse(usageDayFormat, day); err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+// SetPeerOwner attributes a peer to a user, group and profile. Clearing all
+// three removes the attribution.
+func (s *Store) SetPeerOwner(ctx context.Context, owner models.PeerOwner) error {
+	if owner.User == "" && owner.Group == "" && owner.Profile == "" {
+		_, err := s.db.ExecContext(ctx, `DELETE FROM peer_owners WHERE org_id = ? AND public_key = ?`, owner.OrgID, owner.PublicKey)
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `INSERT INTO peer_owners (org_id, public_key, user_name, group_name, profile_name) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(org_id, public_key) DO UPDATE SET user_name = excluded.user_name, group_name = excluded.group_name,
+			profile_name = excluded.profile_name`,
+		owner.OrgID, owner.PublicKey, owner.User, owner.Group, owner.Profile)
+	return err
+}
+
+// ListPeerOwners returns the peer attributions of an organization.
+func (s *Store) ListPeerOwners(ctx context.Context, orgID string) ([]models.PeerOwner, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT public_key, user_name, group_name, profile_name FROM peer_owners WHERE org_id = ? ORDER BY public_key`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	owners := []models.PeerOwner{}
+	for rows.Next() {
+		o := models.PeerOwner{OrgID: orgID}
+		if err := rows.Scan(&o.PublicKey, &o.User, &o.Group, &o.Profile); err != nil {
+			return nil, err
+		}
+		owners = append(owners, o)
+	}
+	return owners, rows.Err()
+}
@@ -0,0 +1,238 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/ChronoCoders/sentra/internal/models"
+)
+
+const webhookColumns = `id, org_id, url, secret, events, enabled, created_at`
+
+func scanWebhook(row rowScanner) (*models.Webhook, error) {
+	var wh models.Webhook
+	var events string
+	if err := row.Scan(&wh.ID, &wh.OrgID, &wh.URL, &wh.Secret, &events, &wh.Enabled, &wh.CreatedAt); err != nil {
+		return nil, err
+	}
+	wh.Events = []string{}
+	if events != "" {
+		wh.Events = strings.Split(events, ",")
+	}
+	return &wh, nil
+}
+
+func (s *Store) ListWebhooks(ctx context.Context, orgID string) ([]models.Webhook, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE org_id = ? ORDER BY created_at`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		wh, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *wh)
+	}
+	return webhooks, rows.Err()
+}
+
+// GetWebhook returns a webhook of an organization, or of any organization if
+// orgID is empty.
+func (s *Store) GetWebhook(ctx context.Context, orgID, id string) (*models.Webhook, error) {
+	wh, err := scanWebhook(s.db.QueryRowContext(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = ? AND (? = '' OR org_id = ?)`,
+		id, orgID, orgID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return wh, err
+}
+
+func (s *Store) CreateWebhook(ctx context.Context, wh *models.Webhook) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO webhooks (`+webhookColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		wh.ID, wh.OrgID, wh.URL, wh.Secret, strings.Join(wh.Events, ","), wh.Enabled, wh.CreatedAt)
+	return err
+}
+
+// UpdateWebhook changes the URL, secret, events and whether a webhook is
+// enabled.
+func (s *Store) UpdateWebhook(ctx context.Context, wh *models.Webhook) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE webhooks SET url = ?, secret = ?, events = ?, enabled = ? WHERE org_id = ? AND id = ?`,
+		wh.URL, wh.Secret, strings.Join(wh.Events, ","), wh.Enabled, wh.OrgID, wh.ID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteWebhook removes a webhook along with its deliveries.
+func (s *Store) DeleteWebhook(ctx context.Context, orgID, id string) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM webhooks WHERE org_id = ? AND id = ?`, orgID, id)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM webhook_attempts WHERE delivery_id IN (SELECT id FROM webhook_deliveries WHERE webhook_id = ?)`, id); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+const deliveryColumns = `id, webhook_id, org_id, event_id, event_type, payload, state, attempts, next_attempt_at, created_at`
+
+func scanWebhookDelivery(row rowScanner) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var payload string
+	if err := row.Scan(&d.ID, &d.WebhookID, &d.OrgID, &d.EventID, &d.EventType, &payload, &d.State, &d.Attempts,
+		&d.NextAttemptAt, &d.CreatedAt); err != nil {
+		return nil, err
+	}
+	d.Payload = []byte(payload)
+	return &d, nil
+}
+
+func (s *Store) listWebhookDeliveries(ctx context.Context, where string, args ...any) ([]models.WebhookDelivery, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+deliveryColumns+` FROM webhook_deliveries `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+// CreateWebhookDeliveries records deliveries to be made.
+func (s *Store) CreateWebhookDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, d := range deliveries {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO webhook_deliveries (`+deliveryColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			d.ID, d.WebhookID, d.OrgID, d.EventID, d.EventType, string(d.Payload), d.State, d.Attempts,
+			d.NextAttemptAt.UTC(), d.CreatedAt.UTC()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListDueWebhookDeliveries returns up to limit pending deliveries whose next
+// attempt is due at now, the longest waiting first.
+func (s *Store) ListDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	return s.listWebhookDeliveries(ctx, `WHERE state = ? AND next_attempt_at <= ? ORDER BY next_attempt_at LIMIT ?`,
+		models.DeliveryPending, now.UTC(), limit)
+}
+
+// ListWebhookDeliveries returns the latest deliveries to a webhook, newest
+// first.
+func (s *Store) ListWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]models.WebhookDelivery, error) {
+	return s.listWebhookDeliveries(ctx, `WHERE webhook_id = ? ORDER BY created_at DESC LIMIT ?`, webhookID, limit)
+}
+
+// GetWebhookDelivery returns a delivery to a webhook with its attempts.
+func (s *Store) GetWebhookDelivery(ctx context.Context, webhookID, id string) (*models.WebhookDelivery, error) {
+	d, err := scanWebhookDelivery(s.db.QueryRowContext(ctx, `SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE webhook_id = ? AND id = ?`,
+		webhookID, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT delivery_id, time, status_code, error, duration_ms FROM webhook_attempts
+		WHERE delivery_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	d.AttemptLog = []models.WebhookAttempt{}
+	for rows.Next() {
+		var a models.WebhookAttempt
+		if err := rows.Scan(&a.DeliveryID, &a.Time, &a.StatusCode, &a.Error, &a.DurationMS); err != nil {
+			return nil, err
+		}
+		d.AttemptLog = append(d.AttemptLog, a)
+	}
+	return d, rows.Err()
+}
+
+// RecordWebhookAttempt records an attempt at a delivery along with the
+// delivery's resulting state.
+func (s *Store) RecordWebhookAttempt(ctx context.Context, d *models.WebhookDelivery, a *models.WebhookAttempt) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO webhook_attempts (delivery_id, time, status_code, error, duration_ms) VALUES (?, ?, ?, ?, ?)`,
+		a.DeliveryID, a.Time.UTC(), a.StatusCode, a.Error, a.DurationMS); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE webhook_deliveries SET state = ?, attempts = ?, next_attempt_at = ? WHERE id = ?`,
+		d.State, d.Attempts, d.NextAttemptAt.UTC(), d.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RequeueWebhookDelivery makes a delivery pending again with a fresh set of
+// attempts, the first one due at at.
+func (s *Store) RequeueWebhookDelivery(ctx context.Context, webhookID, id string, at time.Time) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE webhook_deliveries SET state = ?, attempts = 0, next_attempt_at = ? WHERE webhook_id = ? AND id = ?`,
+		models.DeliveryPending, at.UTC(), webhookID, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteWebhookDeliveries removes the deliveries, and their attempts, that
+// were created before before and are no longer pending.
+func (s *Store) DeleteWebhookDeliveries(ctx context.Context, before time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const old = `SELECT id FROM webhook_deliveries WHERE created_at < ? AND state != ?`
+	if _, err := tx.ExecContext(ctx, `DELETE FROM webhook_attempts WHERE delivery_id IN (`+old+`)`, before.UTC(), models.DeliveryPending); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE created_at < ? AND state != ?`, before.UTC(), models.DeliveryPending); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,54 @@
+package tls
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync"
+)
+
+// CertReloader serves a certificate key pair that can be replaced while the
+// server keeps running. Existing connections keep the certificate they were
+// established with.
+type CertReloader struct {
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	certPath string
+	keyPath  string
+}
+
+// NewCertReloader loads the key pair at certPath and keyPath.
+func NewCertReloader(certPath, keyPath string) (*CertReloader, error) {
+	r := &CertReloader{}
+	if err := r.Reload(certPath, keyPath); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the key pair at certPath and keyPath. The current certificate
+// is kept if the new one cannot be loaded.
+func (r *CertReloader) Reload(certPath, keyPath string) error {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate %s: %w", certPath, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.certPath, r.keyPath = certPath, keyPath
+	return nil
+}
+
+// Paths returns the files the current certificate was loaded from.
+func (r *CertReloader) Paths() (certPath, keyPath string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.certPath, r.keyPath
+}
+
+// GetCertificate is used as tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
@@ -0,0 +1,12 @@
+// Package version holds build and protocol version information.
+package version
+
+// Version is the release version, set at build time with
+// -ldflags "-X github.com/ChronoCoders/sentra/internal/version.Version=v1.2.3".
+var Version = "dev"
+
+// ProtocolVersion is the version of the agent to control plane protocol. It
+// is increased whenever a change is not understood by older peers.
+//
+//	2: peers carry their interface and removed peers are keyed by Peer.Key.
+const ProtocolVersion = 2
@@ -6,8 +6,17 @@ import (
 	"github.com/ChronoCoders/sentra/internal/models"
 )
 
+// Manager reads and configures WireGuard interfaces. The first interface is
+// the primary one; peer operations without an interface apply to it.
 type Manager interface {
 	GetStatus(ctx context.Context) (*models.Status, error)
 	ListPeers(ctx context.Context) ([]models.Peer, error)
+	// AddPeer adds a peer or replaces the configuration of an existing one.
+	AddPeer(ctx context.Context, peer models.PeerConfig) error
+	RemovePeer(ctx context.Context, iface, publicKey string) error
+	// Interfaces returns the monitored interfaces.
+	Interfaces() []string
+	// SetInterfaces replaces the monitored interfaces. All must exist.
+	SetInterfaces(ifaces []string) error
 	Close() error
 }
@@ -2,7 +2,12 @@ package wireguard
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/ChronoCoders/sentra/internal/models"
 	"golang.zx2c4.com/wireguard/wgctrl"
@@ -11,7 +16,9 @@ import (
 
 type WGManager struct {
 	client *wgctrl.Client
-	iface  string
+
+	mu     sync.RWMutex
+	ifaces []string
 }
 
 func NewWGManager(iface string) (*WGManager, error) {
@@ -19,46 +26,163 @@ func NewWGManager(iface string) (*WGManager, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to open wgctrl: %w", err)
 	}
-	return &WGManager{client: c, iface: iface}, nil
+	return &WGManager{client: c, ifaces: []string{iface}}, nil
 }
 
 func (m *WGManager) Close() error {
 	return m.client.Close()
 }
 
+func (m *WGManager) Interfaces() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Clone(m.ifaces)
+}
+
+func (m *WGManager) SetInterfaces(ifaces []string) error {
+	if len(ifaces) == 0 {
+		return errors.New("at least one interface is required")
+	}
+	for _, iface := range ifaces {
+		if _, err := m.client.Device(iface); err != nil {
+			return fmt.Errorf("failed to get device %s: %w", iface, err)
+		}
+	}
+	m.mu.Lock()
+	m.ifaces = slices.Clone(ifaces)
+	m.mu.Unlock()
+	return nil
+}
+
+// iface returns name, or the primary interface if name is empty.
+func (m *WGManager) iface(name string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if name == "" {
+		return m.ifaces[0], nil
+	}
+	if !slices.Contains(m.ifaces, name) {
+		return "", fmt.Errorf("interface %s is not managed by this agent", name)
+	}
+	return name, nil
+}
+
+// GetStatus reports all interfaces. The top-level interface fields describe
+// the primary interface, which must be available; other interfaces that
+// cannot be read are reported with their error.
 func (m *WGManager) GetStatus(ctx context.Context) (*models.Status, error) {
-	d, err := m.client.Device(m.iface)
+	ifaces := m.Interfaces()
+	status := &models.Status{Peers: []models.Peer{}}
+	for i, name := range ifaces {
+		d, err := m.client.Device(name)
+		if err != nil {
+			if i == 0 {
+				return nil, fmt.Errorf("failed to get device %s: %w", name, err)
+			}
+			status.Interfaces = append(status.Interfaces, models.InterfaceStatus{Name: name, Error: err.Error()})
+			continue
+		}
+		if i == 0 {
+			status.Interface = d.Name
+			status.PublicKey = d.PublicKey.String()
+			status.ListenPort = d.ListenPort
+		}
+		status.Interfaces = append(status.Interfaces, models.InterfaceStatus{
+			Name:       d.Name,
+			PublicKey:  d.PublicKey.String(),
+			ListenPort: d.ListenPort,
+			PeerCount:  len(d.Peers),
+		})
+		for _, p := range d.Peers {
+			status.Peers = append(status.Peers, mapPeer(d.Name, p))
+		}
+	}
+	return status, nil
+}
+
+func (m *WGManager) ListPeers(ctx context.Context) ([]models.Peer, error) {
+	status, err := m.GetStatus(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get device %s: %w", m.iface, err)
+		return nil, err
 	}
+	return status.Peers, nil
+}
 
-	peers := make([]models.Peer, len(d.Peers))
-	for i, p := range d.Peers {
-		peers[i] = mapPeer(p)
+func (m *WGManager) AddPeer(ctx context.Context, peer models.PeerConfig) error {
+	iface, err := m.iface(peer.Interface)
+	if err != nil {
+		return err
+	}
+	cfg, err := peerConfig(peer)
+	if err != nil {
+		return err
+	}
+	if err := m.client.ConfigureDevice(iface, wgtypes.Config{Peers: []wgtypes.PeerConfig{cfg}}); err != nil {
+		return fmt.Errorf("failed to configure peer on %s: %w", iface, err)
 	}
+	return nil
+}
 
-	return &models.Status{
-		Interface: d.Name,
-		PublicKey: d.PublicKey.String(),
-		ListenPort: d.ListenPort,
-		Peers:     peers,
-	}, nil
+func (m *WGManager) RemovePeer(ctx context.Context, iface, publicKey string) error {
+	iface, err := m.iface(iface)
+	if err != nil {
+		return err
+	}
+	key, err := wgtypes.ParseKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+	cfg := wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: key, Remove: true}}}
+	if err := m.client.ConfigureDevice(iface, cfg); err != nil {
+		return fmt.Errorf("failed to remove peer from %s: %w", iface, err)
+	}
+	return nil
 }
 
-func (m *WGManager) ListPeers(ctx context.Context) ([]models.Peer, error) {
-	d, err := m.client.Device(m.iface)
+func peerConfig(p models.PeerConfig) (wgtypes.PeerConfig, error) {
+	key, err := wgtypes.ParseKey(p.PublicKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get device %s: %w", m.iface, err)
+		return wgtypes.PeerConfig{}, fmt.Errorf("invalid public key: %w", err)
 	}
 
-	peers := make([]models.Peer, len(d.Peers))
-	for i, p := range d.Peers {
-		peers[i] = mapPeer(p)
+	cfg := wgtypes.PeerConfig{
+		PublicKey:         key,
+		ReplaceAllowedIPs: true,
 	}
-	return peers, nil
+
+	if p.PresharedKey != "" {
+		psk, err := wgtypes.ParseKey(p.PresharedKey)
+		if err != nil {
+			return wgtypes.PeerConfig{}, fmt.Errorf("invalid preshared key: %w", err)
+		}
+		cfg.PresharedKey = &psk
+	}
+
+	if p.Endpoint != "" {
+		endpoint, err := net.ResolveUDPAddr("udp", p.Endpoint)
+		if err != nil {
+			return wgtypes.PeerConfig{}, fmt.Errorf("invalid endpoint: %w", err)
+		}
+		cfg.Endpoint = endpoint
+	}
+
+	for _, ip := range p.AllowedIPs {
+		_, ipNet, err := net.ParseCIDR(ip)
+		if err != nil {
+			return wgtypes.PeerConfig{}, fmt.Errorf("invalid allowed ip %q: %w", ip, err)
+		}
+		cfg.AllowedIPs = append(cfg.AllowedIPs, *ipNet)
+	}
+
+	if p.KeepAlive > 0 {
+		keepAlive := time.Duration(p.KeepAlive) * time.Second
+		cfg.PersistentKeepaliveInterval = &keepAlive
+	}
+
+	return cfg, nil
 }
 
-func mapPeer(p wgtypes.Peer) models.Peer {
+func mapPeer(iface string, p wgtypes.Peer) models.Peer {
 	allowedIPs := make([]string, len(p.AllowedIPs))
 	for i, ip := range p.AllowedIPs {
 		allowedIPs[i] = ip.String()
@@ -70,6 +194,7 @@ func mapPeer(p wgtypes.Peer) models.Peer {
 	}
 
 	return models.Peer{
+		Interface:       iface,
 		PublicKey:       p.PublicKey.String(),
 		Endpoint:        endpoint,
 		AllowedIPs:      allowedIPs,
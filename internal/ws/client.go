@@ -27,7 +27,7 @@ var upgrader = websocket.Upgrader{
 type Client struct {
 	hub  *Hub
 	conn *websocket.Conn
-	send chan models.StatusEvent
+	send chan any
 }
 
 func (c *Client) readPump() {
@@ -57,14 +57,14 @@ func (c *Client) writePump() {
 	}()
 	for {
 		select {
-		case event, ok := <-c.send:
+		case msg, ok := <-c.send:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
 
-			if err := c.conn.WriteJSON(event); err != nil {
+			if err := c.conn.WriteJSON(msg); err != nil {
 				return
 			}
 
@@ -90,7 +90,7 @@ func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) *Client {
 		log.Error().Err(err).Msg("failed to upgrade websocket")
 		return nil
 	}
-	client := &Client{hub: hub, conn: conn, send: make(chan models.StatusEvent, 256)}
+	client := &Client{hub: hub, conn: conn, send: make(chan any, 256)}
 	client.hub.register <- client
 
 	// Allow collection of memory referenced by the caller by doing all work in
@@ -1,6 +1,7 @@
 package ws
 
 import (
+	"context"
 	"sync"
 
 	"github.com/ChronoCoders/sentra/internal/models"
@@ -8,7 +9,7 @@ import (
 
 type Hub struct {
 	clients    map[*Client]bool
-	broadcast  chan models.StatusEvent
+	broadcast  chan any
 	register   chan *Client
 	unregister chan *Client
 	mu         sync.Mutex
@@ -16,7 +17,7 @@ type Hub struct {
 
 func NewHub() *Hub {
 	return &Hub{
-		broadcast:  make(chan models.StatusEvent),
+		broadcast:  make(chan any),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		clients:    make(map[*Client]bool),
@@ -37,11 +38,11 @@ func (h *Hub) Run() {
 				close(client.send)
 			}
 			h.mu.Unlock()
-		case event := <-h.broadcast:
+		case msg := <-h.broadcast:
 			h.mu.Lock()
 			for client := range h.clients {
 				select {
-				case client.send <- event:
+				case client.send <- msg:
 				default:
 					close(client.send)
 					delete(h.clients, client)
@@ -55,3 +56,16 @@ func (h *Hub) Run() {
 func (h *Hub) Broadcast(event models.StatusEvent) {
 	h.broadcast <- event
 }
+
+// notificationMessage carries a notification to dashboards, which tell it
+// from status events by its type.
+type notificationMessage struct {
+	Type         string              `json:"type"`
+	Notification models.Notification `json:"notification"`
+}
+
+// Notify sends a notification to every dashboard.
+func (h *Hub) Notify(ctx context.Context, n models.Notification) error {
+	h.broadcast <- notificationMessage{Type: "notification", Notification: n}
+	return nil
+}